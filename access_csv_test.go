@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readCSV 用csv.Reader解析文件中的所有行
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return records
+}
+
+func TestGinCSVLoggerFields(t *testing.T) {
+	cfg := defaultAccessLogConfig()
+	cfg.Filename = tempLogFile(t)
+	l, err := OpenCSVAccessLog(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := NewManualClock(fixedTime)
+	r := gin.New()
+	r.Use(GinCSVLoggerWithClock(l, clock))
+	r.GET("/search", func(c *gin.Context) {
+		clock.Add(12345 * time.Microsecond)
+		c.String(http.StatusOK, "found")
+	})
+	req := httptest.NewRequest(http.MethodGet, `/search?q=a,b&x="y"`, nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11, \"Linux\")\nsecond line")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := readCSV(t, cfg.Filename)
+	want := [][]string{
+		csvAccessLogHeader,
+		{"2024-05-17T10:00:00.000Z", "200", "GET", "/search", `q=a,b&x="y"`, "10.0.0.1",
+			"Mozilla/5.0 (X11, \"Linux\")\nsecond line", "12.345", "5"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got  %q\nwant %q", records, want)
+	}
+}
+
+func TestCSVAccessLogHeaderAfterRotation(t *testing.T) {
+	cfg := defaultAccessLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.MaxSizeBytes = 200
+	l, err := OpenCSVAccessLog(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(GinCSVLogger(l))
+	r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	const requests = 10
+	for i := 0; i < requests; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+		// lumberjack的备份文件名精确到毫秒，同一毫秒内切割两次会覆盖前一个备份
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, name := filepath.Split(cfg.Filename)
+	files := append(backupFiles(t, dir, strings.TrimSuffix(name, filepath.Ext(name)), name), cfg.Filename)
+	if len(files) < 2 {
+		t.Fatalf("expected the log to rotate, got files %v", files)
+	}
+	rows := 0
+	for _, path := range files {
+		records := readCSV(t, path)
+		if len(records) < 2 || !reflect.DeepEqual(records[0], csvAccessLogHeader) {
+			t.Errorf("%s should start with the header and hold rows: %q", filepath.Base(path), records)
+			continue
+		}
+		for _, rec := range records[1:] {
+			if reflect.DeepEqual(rec, csvAccessLogHeader) {
+				t.Errorf("%s: header repeated inside the file", filepath.Base(path))
+			}
+			if rec[3] != "/ping" || rec[8] != "4" {
+				t.Errorf("%s: unexpected row %q", filepath.Base(path), rec)
+			}
+			rows++
+		}
+		if size := fileSize(path); size > cfg.MaxSizeBytes {
+			t.Errorf("%s is %d bytes, want at most %d", filepath.Base(path), size, cfg.MaxSizeBytes)
+		}
+	}
+	if rows != requests {
+		t.Errorf("got %d rows across %d files, want %d", rows, len(files), requests)
+	}
+}
+
+func TestCSVAccessLogReopenNoDuplicateHeader(t *testing.T) {
+	cfg := defaultAccessLogConfig()
+	cfg.Filename = tempLogFile(t)
+	for i := 0; i < 2; i++ {
+		l, err := OpenCSVAccessLog(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Write([]string{"t", "200", "GET", "/", "", "ip", "ua", "1.000", "0"}); err != nil {
+			t.Fatal(err)
+		}
+		l.Close()
+	}
+	records := readCSV(t, cfg.Filename)
+	if len(records) != 3 || !reflect.DeepEqual(records[0], csvAccessLogHeader) {
+		t.Errorf("reopening an existing file should append without a second header: %q", records)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGinCombinedLoggerGolden(t *testing.T) {
+	clock := NewManualClock(time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600)))
+	tests := []struct {
+		name   string
+		target string
+		setup  func(req *http.Request)
+		body   string
+		want   string
+	}{
+		{
+			name:   "basic",
+			target: "/hello",
+			setup:  func(req *http.Request) { req.Header.Set("User-Agent", "curl/8.0") },
+			body:   strings.Repeat("x", 2326),
+			want:   `1.2.3.4 - - [10/Oct/2000:13:55:36 -0700] "GET /hello HTTP/1.1" 200 2326 "-" "curl/8.0"` + "\n",
+		},
+		{
+			name:   "quotes in user agent",
+			target: "/hello?q=1",
+			setup: func(req *http.Request) {
+				req.Header.Set("User-Agent", `Mozilla "evil" \agent`)
+				req.Header.Set("Referer", "https://example.com/")
+			},
+			body: "ok",
+			want: `1.2.3.4 - - [10/Oct/2000:13:55:36 -0700] "GET /hello?q=1 HTTP/1.1" 200 2 "https://example.com/" "Mozilla \"evil\" \\agent"` + "\n",
+		},
+		{
+			name:   "basic auth and empty body",
+			target: "/hello",
+			setup:  func(req *http.Request) { req.SetBasicAuth("frank", "secret") },
+			want:   `1.2.3.4 - frank [10/Oct/2000:13:55:36 -0700] "GET /hello HTTP/1.1" 200 - "-" "-"` + "\n",
+		},
+		{
+			name:   "control characters",
+			target: "/hello",
+			setup:  func(req *http.Request) { req.Header.Set("User-Agent", "a\tb\x7f") },
+			want:   `1.2.3.4 - - [10/Oct/2000:13:55:36 -0700] "GET /hello HTTP/1.1" 200 - "-" "a\x09b\x7f"` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			r := gin.New()
+			r.Use(GinCombinedLoggerWithClock(&out, clock))
+			r.GET("/hello", func(c *gin.Context) { c.String(http.StatusOK, tt.body) })
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.RemoteAddr = "1.2.3.4:5678"
+			tt.setup(req)
+			r.ServeHTTP(httptest.NewRecorder(), req)
+			if got := out.String(); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenAccessLogSeparateFromAppLog(t *testing.T) {
+	appCfg := defaultLogConfig()
+	appCfg.Filename = tempLogFile(t)
+	appCfg.Encoding = EncodingJSON
+	b, err := newLogger(WithConfig(appCfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.close()
+
+	accessCfg := defaultAccessLogConfig()
+	accessCfg.Filename = tempLogFile(t)
+	w, closeFn, err := OpenAccessLog(accessCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(GinCombinedLogger(w))
+	r.GET("/hello", func(c *gin.Context) {
+		b.logger.Info("handling hello")
+		c.String(http.StatusOK, "hi")
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/hello", nil))
+	if err := closeFn(); err != nil {
+		t.Fatal(err)
+	}
+	_ = b.logger.Sync()
+
+	access := readLines(t, accessCfg.Filename)
+	if len(access) != 1 || !strings.Contains(access[0], `"GET /hello HTTP/1.1" 200 2 "-" "-"`) {
+		t.Errorf("access log:\n%s", strings.Join(access, "\n"))
+	}
+	app := readFile(t, appCfg.Filename)
+	if !strings.Contains(app, `"msg":"handling hello"`) || strings.Contains(app, "GET /hello") {
+		t.Errorf("app log should stay JSON without access lines:\n%s", app)
+	}
+}
+
+func TestOpenAccessLogEmptyFilename(t *testing.T) {
+	cfg := defaultAccessLogConfig()
+	cfg.Filename = ""
+	if _, _, err := OpenAccessLog(cfg); err == nil || !strings.Contains(err.Error(), "access log filename must not be empty") {
+		t.Fatalf("error = %v, want empty filename error", err)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+异步写入
+zap同步写文件，磁盘卡住（比如NFS抖动）时每个请求都会卡在GinLogger里。
+配置Async后，日志文件前面加一个有界队列和一个后台写入的goroutine：
+队列满时直接丢弃这条日志，绝不阻塞请求；丢弃的条数计入AsyncDropped（只统计日志文件的异步写入，
+Loki、Elasticsearch和IsolatedMultiSyncer的队列各自统计），
+并且每隔ReportInterval用一条Warn日志（dropped_total字段）报告一次。
+Sync会等队列写完，Close最多等DrainTimeout，超时后剩下的日志丢弃。
+*/
+
+// 异步写入的默认值
+const (
+	defaultAsyncQueueSize      = 1024
+	defaultAsyncDrainTimeout   = 5 * time.Second
+	defaultAsyncReportInterval = 10 * time.Second
+)
+
+// AsyncConfig 异步写入的配置，为0的项使用默认值
+type AsyncConfig struct {
+	QueueSize      int           `yaml:"queue_size" json:"queue_size"`           // 队列中最多缓存的日志条数，默认1024
+	DrainTimeout   time.Duration `yaml:"drain_timeout" json:"drain_timeout"`     // Sync和Close等待队列写完的最长时间，默认5秒
+	ReportInterval time.Duration `yaml:"report_interval" json:"report_interval"` // 报告丢弃条数的间隔，默认10秒
+}
+
+func (a AsyncConfig) validate() error {
+	if a.QueueSize < 0 {
+		return fmt.Errorf("log config: async queue size must not be negative, got %d", a.QueueSize)
+	}
+	if a.DrainTimeout < 0 {
+		return fmt.Errorf("log config: async drain timeout must not be negative, got %s", a.DrainTimeout)
+	}
+	if a.ReportInterval < 0 {
+		return fmt.Errorf("log config: async report interval must not be negative, got %s", a.ReportInterval)
+	}
+	return nil
+}
+
+func (a AsyncConfig) withDefaults() AsyncConfig {
+	if a.QueueSize == 0 {
+		a.QueueSize = defaultAsyncQueueSize
+	}
+	if a.DrainTimeout == 0 {
+		a.DrainTimeout = defaultAsyncDrainTimeout
+	}
+	if a.ReportInterval == 0 {
+		a.ReportInterval = defaultAsyncReportInterval
+	}
+	return a
+}
+
+// asyncDropped 日志文件的异步写入因为队列满丢弃的日志条数
+var asyncDropped uint64
+
+// AsyncDropped 返回到目前为止日志文件的异步写入因为队列满丢弃的日志条数
+func AsyncDropped() uint64 {
+	return atomic.LoadUint64(&asyncDropped)
+}
+
+// errAsyncDrainTimeout Sync或Close等待队列写完超时
+var errAsyncDrainTimeout = errors.New("async log writer: drain timed out")
+
+// asyncItem 队列中的一项：一条日志，或者一次Sync请求
+type asyncItem struct {
+	p      []byte
+	synced chan error // 不为nil时表示Sync请求，写完之前的日志后返回ws.Sync的结果
+}
+
+// asyncWriteSyncer 把写入放进队列，由后台goroutine写到ws
+type asyncWriteSyncer struct {
+	ws      zapcore.WriteSyncer
+	queue   chan asyncItem
+	timeout time.Duration
+	dropped uint64  // 本writer丢弃的条数
+	total   *uint64 // 丢弃时同时计入的计数，nil表示只计入dropped
+
+	mu     sync.RWMutex // 保护closed，避免向已关闭的queue发送
+	closed bool
+	done   chan struct{}
+}
+
+// newAsyncWriteSyncer 按cfg创建写到ws的队列，丢弃的条数除了本writer自己统计，还计入total（可以为nil）
+func newAsyncWriteSyncer(ws zapcore.WriteSyncer, cfg AsyncConfig, total *uint64) *asyncWriteSyncer {
+	cfg = cfg.withDefaults()
+	a := &asyncWriteSyncer{
+		ws:      ws,
+		total:   total,
+		queue:   make(chan asyncItem, cfg.QueueSize),
+		timeout: cfg.DrainTimeout,
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *asyncWriteSyncer) run() {
+	defer close(a.done)
+	for item := range a.queue {
+		if item.synced != nil {
+			item.synced <- a.ws.Sync()
+			continue
+		}
+		_, _ = a.ws.Write(item.p) // 写入错误没有调用方可以返回，与zap的ErrorOutput一样只能忽略
+	}
+}
+
+// Write 复制p放进队列，队列满时丢弃，永远不阻塞
+func (a *asyncWriteSyncer) Write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return a.ws.Write(p)
+	}
+	// zap在Write返回后会复用p
+	item := asyncItem{p: append([]byte(nil), p...)}
+	select {
+	case a.queue <- item:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+		if a.total != nil {
+			atomic.AddUint64(a.total, 1)
+		}
+	}
+	return len(p), nil
+}
+
+// Sync 等待队列中已有的日志写完再Sync，最多等timeout
+func (a *asyncWriteSyncer) Sync() error {
+	a.mu.RLock()
+	if a.closed {
+		a.mu.RUnlock()
+		return a.ws.Sync()
+	}
+	synced := make(chan error, 1)
+	timer := time.NewTimer(a.timeout)
+	defer timer.Stop()
+	select {
+	case a.queue <- asyncItem{synced: synced}:
+		a.mu.RUnlock()
+	case <-timer.C:
+		a.mu.RUnlock()
+		return errAsyncDrainTimeout
+	}
+	select {
+	case err := <-synced:
+		return err
+	case <-timer.C:
+		return errAsyncDrainTimeout
+	}
+}
+
+// Dropped 返回本writer丢弃的条数
+func (a *asyncWriteSyncer) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Close 停止接收新的日志，最多等timeout把队列写完，之后的写入直接写到ws。可重复调用
+func (a *asyncWriteSyncer) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-time.After(a.timeout):
+		return fmt.Errorf("%v, %d entries not written", errAsyncDrainTimeout, len(a.queue))
+	}
+}
+
+// enableAsync 按cfg在w（以及缓冲）前面加一层异步写入，需要在enableBuffer之后调用
+func (w *fileWriteSyncer) enableAsync(cfg LogConfig) {
+	if cfg.Async == nil {
+		return
+	}
+	w.async = newAsyncWriteSyncer(w.writeSyncer(), *cfg.Async, &asyncDropped)
+}
+
+// asyncDropReporter 定期用logger报告异步写入丢弃的条数
+type asyncDropReporter struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startAsyncDropReporter 每隔interval检查writers丢弃的总条数，有新的丢弃时记录一条Warn日志
+func startAsyncDropReporter(logger *zap.Logger, writers []*asyncWriteSyncer, interval time.Duration) *asyncDropReporter {
+	r := &asyncDropReporter{stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var reported uint64
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+			var total uint64
+			for _, w := range writers {
+				total += w.Dropped()
+			}
+			if total > reported {
+				logger.Warn("async log queue full, entries dropped",
+					zap.Uint64("dropped", total-reported), zap.Uint64("dropped_total", total))
+				reported = total
+			}
+		}
+	}()
+	return r
+}
+
+// close 停止报告，可以对nil调用
+func (r *asyncDropReporter) close() {
+	if r == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// slowWriteSyncer 模拟卡住的磁盘：每次Write先通知entered，再等到gate关闭才写入
+type slowWriteSyncer struct {
+	entered chan struct{}
+	gate    chan struct{}
+
+	mu    sync.Mutex
+	lines []string
+}
+
+func newSlowWriteSyncer() *slowWriteSyncer {
+	return &slowWriteSyncer{entered: make(chan struct{}, 100), gate: make(chan struct{})}
+}
+
+func (s *slowWriteSyncer) Write(p []byte) (int, error) {
+	s.entered <- struct{}{}
+	<-s.gate
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, string(p))
+	return len(p), nil
+}
+
+func (s *slowWriteSyncer) Sync() error { return nil }
+
+func (s *slowWriteSyncer) written() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.lines...)
+}
+
+func TestAsyncDropsWhenQueueFull(t *testing.T) {
+	ws := newSlowWriteSyncer()
+	var total uint64
+	a := newAsyncWriteSyncer(ws, AsyncConfig{QueueSize: 2}, &total)
+	globalBefore := AsyncDropped()
+
+	// 第一条被后台goroutine取走后卡在Write里，之后队列只能再放两条
+	a.Write([]byte("entry 0"))
+	<-ws.entered
+	start := time.Now()
+	for i := 1; i < 10; i++ {
+		if n, err := a.Write([]byte("entry")); n != 5 || err != nil {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Write blocked for %s while the disk was stalled", elapsed)
+	}
+	if got := a.Dropped(); got != 7 {
+		t.Errorf("Dropped() = %d, want 7", got)
+	}
+	if got := atomic.LoadUint64(&total); got != 7 {
+		t.Errorf("total = %d, want 7", got)
+	}
+	// 不是日志文件的队列，不计入AsyncDropped
+	if got := AsyncDropped() - globalBefore; got != 0 {
+		t.Errorf("AsyncDropped() grew by %d, want 0", got)
+	}
+
+	close(ws.gate)
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ws.written(); len(got) != 3 || got[0] != "entry 0" {
+		t.Errorf("written = %q, want the first entry and the two queued ones", got)
+	}
+}
+
+func TestAsyncCopiesBuffer(t *testing.T) {
+	ws := newSlowWriteSyncer()
+	close(ws.gate)
+	a := newAsyncWriteSyncer(ws, AsyncConfig{}, nil)
+	p := []byte("first")
+	a.Write(p)
+	copy(p, "XXXXX") // zap会复用传给Write的buffer
+	if err := a.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ws.written(); len(got) != 1 || got[0] != "first" {
+		t.Errorf("written = %q", got)
+	}
+	_ = a.Close()
+}
+
+func TestAsyncCloseDrainTimeout(t *testing.T) {
+	ws := newSlowWriteSyncer()
+	defer close(ws.gate)
+	a := newAsyncWriteSyncer(ws, AsyncConfig{QueueSize: 4, DrainTimeout: 50 * time.Millisecond}, nil)
+	a.Write([]byte("stuck"))
+	<-ws.entered
+	a.Write([]byte("queued"))
+
+	if err := a.Sync(); err != errAsyncDrainTimeout {
+		t.Errorf("Sync() = %v, want drain timeout", err)
+	}
+	start := time.Now()
+	err := a.Close()
+	if err == nil || !strings.Contains(err.Error(), "drain timed out") {
+		t.Errorf("Close() = %v, want drain timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close took %s with a 50ms drain timeout", elapsed)
+	}
+	if err := a.Close(); err != nil {
+		t.Errorf("second Close() = %v", err)
+	}
+}
+
+func TestAsyncDropReporter(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	w := &asyncWriteSyncer{}
+	r := startAsyncDropReporter(zap.New(core), []*asyncWriteSyncer{w}, 5*time.Millisecond)
+	defer r.close()
+
+	atomic.AddUint64(&w.dropped, 3)
+	waitFor(t, 5*time.Second, "the first drop report", func() bool { return logs.Len() == 1 })
+	atomic.AddUint64(&w.dropped, 2)
+	waitFor(t, 5*time.Second, "the second drop report", func() bool { return logs.Len() == 2 })
+	time.Sleep(20 * time.Millisecond)
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("got %d reports, want 2: no report without new drops", len(entries))
+	}
+	for i, want := range []map[string]interface{}{
+		{"dropped": uint64(3), "dropped_total": uint64(3)},
+		{"dropped": uint64(2), "dropped_total": uint64(5)},
+	} {
+		got := entries[i].ContextMap()
+		if entries[i].Level != zapcore.WarnLevel || got["dropped"] != want["dropped"] || got["dropped_total"] != want["dropped_total"] {
+			t.Errorf("report %d = %v %v, want %v", i, entries[i].Level, got, want)
+		}
+	}
+}
+
+func TestAsyncConfigValidate(t *testing.T) {
+	tests := []struct {
+		cfg     AsyncConfig
+		wantErr string
+	}{
+		{cfg: AsyncConfig{}},
+		{cfg: AsyncConfig{QueueSize: -1}, wantErr: "async queue size must not be negative"},
+		{cfg: AsyncConfig{DrainTimeout: -time.Second}, wantErr: "async drain timeout must not be negative"},
+		{cfg: AsyncConfig{ReportInterval: -time.Second}, wantErr: "async report interval must not be negative"},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.validate()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%+v: validate() = %v, want %q", tt.cfg, err, tt.wantErr)
+		}
+	}
+	if got := (AsyncConfig{}).withDefaults(); got.QueueSize != defaultAsyncQueueSize || got.DrainTimeout != defaultAsyncDrainTimeout || got.ReportInterval != defaultAsyncReportInterval {
+		t.Errorf("withDefaults() = %+v", got)
+	}
+}
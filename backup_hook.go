@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sync"
+)
+
+/*
+=============================================================
+切割后处理备份
+切割出的备份需要上传到S3/OSS之类的对象存储。LogConfig.OnRotate设置后，每次切割之后
+在后台用新生成的备份的路径调用它；配置了压缩时先压缩，传入的是压缩后的文件（.gz或.zst）。
+lumberjack压缩完成时没有通知，所以设置了OnRotate时gzip也改为由这里压缩。
+配置了Manifest时在调用OnRotate之前把备份的SHA-256记到manifest.jsonl（见manifest.go），
+记录的是压缩后的文件，OnRotate上传后删除本地文件也不影响记录。
+S3的上传实现见s3upload子包：
+	cfg.OnRotate = s3upload.New(sess, "my-bucket", logger).OnRotate
+*/
+
+// backupProcessor 在后台按顺序处理切割出的备份：压缩、记录清单、调用OnRotate、清理多余的备份
+type backupProcessor struct {
+	cfg      LogConfig
+	clock    Clock
+	compress func(src, dst string) error // 为nil时不压缩
+	suffix   string                      // 压缩后的后缀
+	onRotate func(backupPath string)
+	manifest bool
+	report   func(msg string, err error) // 报告后台处理的错误，为nil时忽略
+
+	mu sync.Mutex     // 同一时间只处理一批备份，避免与清理互相干扰
+	wg sync.WaitGroup // 还没处理完的备份，Close时等待
+}
+
+// newBackupProcessor 按cfg创建，既不用zstd也没有设置OnRotate和Manifest时返回nil，交给lumberjack处理
+func newBackupProcessor(cfg LogConfig, clock Clock) *backupProcessor {
+	p := &backupProcessor{cfg: cfg, clock: clock, onRotate: cfg.OnRotate, manifest: cfg.Manifest}
+	switch cfg.compression() {
+	case CompressionZstd:
+		p.suffix = ".zst"
+		p.compress = func(src, dst string) error { return compressFile(src, dst, newZstdWriter) }
+	case CompressionGzip:
+		if !cfg.processBackups() {
+			return nil
+		}
+		p.suffix = ".gz"
+		p.compress = func(src, dst string) error { return compressFile(src, dst, newGzipWriter) }
+	default:
+		if !cfg.processBackups() {
+			return nil
+		}
+	}
+	return p
+}
+
+// processAsync 在后台处理备份，完成后清理多余的备份
+func (p *backupProcessor) processAsync(backups []string) {
+	if len(backups) == 0 {
+		return
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for _, name := range backups {
+			path := name
+			if p.compress != nil {
+				// 与lumberjack压缩失败一样忽略，保留未压缩的备份
+				if err := p.compress(name, name+p.suffix); err == nil {
+					path = name + p.suffix
+				}
+			}
+			if p.manifest {
+				if err := appendManifest(path, p.clock.Now(), p.cfg.fileMode()); err != nil && p.report != nil {
+					p.report("append log manifest failed", err)
+				}
+			}
+			if p.onRotate != nil {
+				p.onRotate(path)
+			}
+		}
+		_ = cleanupBackups(p.cfg, p.clock)
+	}()
+}
+
+// wait 等待后台的处理完成
+func (p *backupProcessor) wait() {
+	p.wg.Wait()
+}
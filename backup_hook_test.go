@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeUploader 记录OnRotate收到的备份，调用时读出文件内容，模拟上传
+type fakeUploader struct {
+	mu       sync.Mutex
+	paths    []string
+	contents []string
+	release  chan struct{} // 不为nil时OnRotate阻塞到它被关闭
+}
+
+func (u *fakeUploader) OnRotate(backupPath string) {
+	if u.release != nil {
+		<-u.release
+	}
+	data, err := ioutil.ReadFile(backupPath)
+	if err != nil {
+		data = []byte("read error: " + err.Error())
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.paths = append(u.paths, backupPath)
+	u.contents = append(u.contents, string(data))
+}
+
+func (u *fakeUploader) uploaded() ([]string, []string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]string(nil), u.paths...), append([]string(nil), u.contents...)
+}
+
+func TestOnRotateCalledWithBackup(t *testing.T) {
+	tests := []struct {
+		compression string
+		suffix      string
+		decode      func(t *testing.T, path string) string
+	}{
+		{compression: CompressionNone, suffix: ".log", decode: func(t *testing.T, path string) string { return readFile(t, path) }},
+		{compression: CompressionGzip, suffix: ".log.gz", decode: gunzipFile},
+		{compression: CompressionZstd, suffix: ".log.zst", decode: unzstdFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.compression, func(t *testing.T) {
+			u := &fakeUploader{}
+			b, cfg := newClockedFileLogger(t, NewManualClock(fixedTime), func(cfg *LogConfig) {
+				cfg.Compression = tt.compression
+				cfg.OnRotate = u.OnRotate
+			})
+			b.logger.Info("before rotate")
+			if err := b.rotate(); err != nil {
+				t.Fatal(err)
+			}
+			b.file.backups.wait()
+
+			paths, contents := u.uploaded()
+			backups := logBackups(t, cfg)
+			if len(paths) != 1 || len(backups) != 1 || paths[0] != backups[0] {
+				t.Fatalf("OnRotate got %v, backups on disk %v", paths, backups)
+			}
+			if !strings.HasSuffix(paths[0], tt.suffix) {
+				t.Errorf("OnRotate path = %s, want suffix %s", paths[0], tt.suffix)
+			}
+			if tt.suffix != ".log" {
+				if _, err := os.Stat(trimCompressedSuffix(paths[0])); !os.IsNotExist(err) {
+					t.Errorf("uncompressed backup should be gone before OnRotate, stat err = %v", err)
+				}
+			}
+			if !strings.Contains(tt.decode(t, paths[0]), "before rotate") {
+				t.Errorf("backup passed to OnRotate does not hold the rotated entries")
+			}
+			if contents[0] == "" || strings.HasPrefix(contents[0], "read error") {
+				t.Errorf("backup should be complete when OnRotate runs, got %q", contents[0])
+			}
+		})
+	}
+}
+
+func TestOnRotateDoesNotBlockLogging(t *testing.T) {
+	u := &fakeUploader{release: make(chan struct{})}
+	b, cfg := newClockedFileLogger(t, NewManualClock(fixedTime), func(cfg *LogConfig) {
+		cfg.OnRotate = u.OnRotate
+	})
+	b.logger.Info("before rotate")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := b.rotate(); err != nil {
+			t.Error(err)
+		}
+		b.logger.Info("after rotate")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow OnRotate blocked rotation and logging")
+	}
+	if out := readFile(t, cfg.Filename); !strings.Contains(out, "after rotate") {
+		t.Errorf("active file:\n%s", out)
+	}
+
+	close(u.release)
+	b.file.backups.wait()
+	if paths, _ := u.uploaded(); len(paths) != 1 {
+		t.Errorf("OnRotate got %v, want one backup", paths)
+	}
+}
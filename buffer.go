@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+缓冲写入
+每条日志都单独Write一次文件，访问日志量大时系统调用很多。配置BufferSize或FlushInterval后，
+日志文件外面包一层zapcore.BufferedWriteSyncer：写满BufferSize或者每隔FlushInterval写一次文件。
+logger.Sync、Close和Rotate之前都会先把缓冲写进文件，Fatal时fatalHook也会先Sync；
+进程被kill -9时缓冲中的日志会丢失，这是换取吞吐的代价。
+*/
+
+// bufferEnabled 是否缓冲写入日志文件，BufferSize和FlushInterval为0时使用zap的默认值（256KB、30秒）
+func (cfg LogConfig) bufferEnabled() bool {
+	return cfg.BufferSize > 0 || cfg.FlushInterval > 0
+}
+
+// validateBuffer 检查缓冲写入的配置
+func (cfg LogConfig) validateBuffer() error {
+	if cfg.BufferSize < 0 {
+		return fmt.Errorf("log config: buffer size must not be negative, got %d", cfg.BufferSize)
+	}
+	if cfg.FlushInterval < 0 {
+		return fmt.Errorf("log config: flush interval must not be negative, got %s", cfg.FlushInterval)
+	}
+	return nil
+}
+
+// enableBuffer 按cfg在w（以及重试）外面包一层BufferedWriteSyncer，之后写日志要使用w.writeSyncer()
+func (w *fileWriteSyncer) enableBuffer(cfg LogConfig, clock Clock) {
+	if !cfg.bufferEnabled() {
+		return
+	}
+	w.buffer = &zapcore.BufferedWriteSyncer{
+		WS:            w.writeSyncer(),
+		Size:          cfg.BufferSize,
+		FlushInterval: cfg.FlushInterval,
+		Clock:         zapClock{clock},
+	}
+}
+
+// writeSyncer 写日志使用的WriteSyncer，依次优先返回asyncWriteSyncer、BufferedWriteSyncer和retryWriteSyncer
+func (w *fileWriteSyncer) writeSyncer() zapcore.WriteSyncer {
+	if w.async != nil {
+		return w.async
+	}
+	if w.buffer != nil {
+		return w.buffer
+	}
+	if w.retry != nil {
+		return w.retry
+	}
+	return w
+}
+
+// flushBuffer 把异步队列和缓冲中的日志写进文件，调用方不能持有w.mu
+func (w *fileWriteSyncer) flushBuffer() error {
+	if w.async != nil {
+		return w.async.Sync()
+	}
+	if w.buffer != nil {
+		return w.buffer.Sync()
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestBufferFlushIntervalWithoutSync(t *testing.T) {
+	const interval = 200 * time.Millisecond
+	b, cfg := newClockedFileLogger(t, realClock{}, func(cfg *LogConfig) {
+		cfg.BufferSize = 1 << 20
+		cfg.FlushInterval = interval
+	})
+	start := time.Now()
+	b.logger.Info("buffered entry")
+	// 还没到FlushInterval时日志应该还在缓冲里；机器很慢时已经过了一半的时间就不检查
+	if time.Since(start) < interval/2 {
+		if out := readFile(t, cfg.Filename); strings.Contains(out, "buffered entry") {
+			t.Errorf("entry should stay in the buffer before FlushInterval:\n%s", out)
+		}
+	}
+	waitFor(t, 5*time.Second, "the buffer to be flushed", func() bool {
+		return strings.Contains(readFile(t, cfg.Filename), "buffered entry")
+	})
+	if elapsed := time.Since(start); elapsed < interval/2 {
+		t.Errorf("flushed after %s, before FlushInterval %s", elapsed, interval)
+	}
+}
+
+func TestBufferDrainedByRotateAndClose(t *testing.T) {
+	b, cfg := newClockedFileLogger(t, NewManualClock(fixedTime), func(cfg *LogConfig) {
+		cfg.BufferSize = 1 << 20
+		cfg.FlushInterval = time.Hour
+	})
+	b.logger.Info("before rotate")
+	if err := b.rotate(); err != nil {
+		t.Fatal(err)
+	}
+	backups := logBackups(t, cfg)
+	if len(backups) != 1 || !strings.Contains(readFile(t, backups[0]), "before rotate") {
+		t.Fatalf("Rotate should flush the buffer into the old file, backups %v", backups)
+	}
+
+	b.logger.Info("before close")
+	if out := readFile(t, cfg.Filename); strings.Contains(out, "before close") {
+		t.Fatalf("entry should still be buffered:\n%s", out)
+	}
+	b.close()
+	if out := readFile(t, cfg.Filename); !strings.Contains(out, "before close") {
+		t.Errorf("Close should drain the buffer:\n%s", out)
+	}
+}
+
+func TestValidateBuffer(t *testing.T) {
+	tests := []struct {
+		size     int
+		interval time.Duration
+		enabled  bool
+		wantErr  string
+	}{
+		{},
+		{size: 4096, enabled: true},
+		{interval: time.Second, enabled: true},
+		{size: -1, enabled: false, wantErr: "buffer size must not be negative, got -1"},
+		{interval: -time.Second, enabled: false, wantErr: "flush interval must not be negative, got -1s"},
+	}
+	for _, tt := range tests {
+		cfg := LogConfig{BufferSize: tt.size, FlushInterval: tt.interval}
+		if cfg.bufferEnabled() != tt.enabled {
+			t.Errorf("%+v: bufferEnabled() = %v", tt, !tt.enabled)
+		}
+		err := cfg.validateBuffer()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || err.Error() != "log config: "+tt.wantErr) {
+			t.Errorf("%+v: validateBuffer() = %v, want %q", tt, err, tt.wantErr)
+		}
+	}
+}
+
+// writeSyscalls 返回进程到目前为止的write系统调用次数，只有Linux的/proc/self/io提供
+func writeSyscalls() (uint64, bool) {
+	f, err := os.Open("/proc/self/io")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if v := strings.TrimPrefix(s.Text(), "syscw: "); v != s.Text() {
+			n, err := strconv.ParseUint(v, 10, 64)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
+
+// benchmarkFileWrites 模拟GinLogger的访问日志写到文件，报告每条日志的write系统调用次数
+func benchmarkFileWrites(b *testing.B, bufferSize int) {
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(b)
+	cfg.Encoding = EncodingJSON
+	cfg.MaxSize = 1024
+	cfg.BufferSize = bufferSize
+	built, err := newLogger(WithConfig(cfg))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer built.close()
+	l := built.logger
+
+	before, ok := writeSyscalls()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Info("/api/v1/users",
+			zap.Int("status", 200),
+			zap.String("method", "GET"),
+			zap.String("path", "/api/v1/users"),
+			zap.String("query", "page=2"),
+			zap.String("ip", "10.0.0.1"),
+			zap.String("user-agent", "curl/7.68.0"),
+			zap.Duration("cost", 3*time.Millisecond),
+		)
+	}
+	_ = l.Sync()
+	b.StopTimer()
+	if after, ok2 := writeSyscalls(); ok && ok2 {
+		b.ReportMetric(float64(after-before)/float64(b.N), "syscalls/op")
+	}
+}
+
+// 对比直接写文件和缓冲写入，缓冲后每条日志的系统调用次数接近0，吞吐明显更高：
+//
+//	go test -run '^$' -bench BenchmarkFileWrite -benchtime 100000x
+func BenchmarkFileWriteUnbuffered(b *testing.B) {
+	benchmarkFileWrites(b, 0)
+}
+
+func BenchmarkFileWriteBuffered(b *testing.B) {
+	benchmarkFileWrites(b, 256*1024)
+}
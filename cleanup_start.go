@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+=============================================================
+启动时清理备份
+lumberjack只在切割之后清理备份，进程崩溃或者很久没有切割时，旧的备份一直留在目录里。
+配置CleanupOnStart后，打开日志文件时先扫描一遍日志目录，对lumberjack格式的备份
+（name-2006-01-02T15-04-05.000.ext，压缩后再加.gz或.zst）按MaxAge、MaxBackups、MaxTotalSizeMB清理，
+时间以文件名中的时间为准。文件名不符合这个格式的文件不会被删除。
+*/
+
+// backupTimeLayout lumberjack备份文件名中的时间格式
+const backupTimeLayout = "2006-01-02T15-04-05.000"
+
+// parseBackupTime 解析name是否为filename的lumberjack备份，返回文件名中的时间
+func parseBackupTime(name, filename string, loc *time.Location) (time.Time, bool) {
+	ext := filepath.Ext(filename)
+	prefix := strings.TrimSuffix(filepath.Base(filename), ext) + "-"
+	if !strings.HasPrefix(name, prefix) {
+		return time.Time{}, false
+	}
+	ts := trimCompressedSuffix(name[len(prefix):])
+	if !strings.HasSuffix(ts, ext) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(backupTimeLayout, strings.TrimSuffix(ts, ext), loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// cleanupBackups 按MaxAge和MaxBackups删除cfg.Filename的备份，总大小交给limitTotalSize。
+// 启动时和zstd压缩完成后调用
+func cleanupBackups(cfg LogConfig, clock Clock) error {
+	loc := time.UTC
+	if cfg.BackupLocalTime {
+		loc = time.Local
+	}
+	dir := filepath.Dir(cfg.Filename)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	type backup struct {
+		name string
+		t    time.Time
+	}
+	var backups []backup
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		if t, ok := parseBackupTime(info.Name(), cfg.Filename, loc); ok {
+			backups = append(backups, backup{filepath.Join(dir, info.Name()), t})
+		}
+	}
+	// 新的在前
+	sort.Slice(backups, func(i, j int) bool { return backups[i].t.After(backups[j].t) })
+
+	cutoff := clock.Now().Add(-time.Duration(cfg.MaxAge) * 24 * time.Hour)
+	remaining := make(map[string]bool, len(backups))
+	var firstErr error
+	for i, b := range backups {
+		tooMany := cfg.MaxBackups > 0 && i >= cfg.MaxBackups
+		tooOld := cfg.MaxAge > 0 && b.t.Before(cutoff)
+		if !tooMany && !tooOld {
+			remaining[b.name] = true
+			continue
+		}
+		if err := os.Remove(b.name); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if cfg.MaxTotalSizeMB > 0 {
+		if err := limitTotalSize(cfg.Filename, remaining, int64(cfg.MaxTotalSizeMB)*bytesPerMB); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startupBackups 预先放在日志目录中的备份，文件名中的时间在fixedTime之前
+var startupBackups = []string{
+	"test-2024-05-16T10-00-00.000.log",     // 1天前
+	"test-2024-05-15T10-00-00.000.log.gz",  // 2天前
+	"test-2024-05-12T10-00-00.000.log",     // 5天前
+	"test-2024-05-07T10-00-00.000.log.zst", // 10天前
+}
+
+// unrelatedFiles 与test.log的备份格式不符的文件，无论怎么配置都不能删除
+var unrelatedFiles = []string{
+	"notes.txt",
+	"test.log.bak",
+	"test-latest.log",
+	"test-2024-05-01T10-00-00.000.txt",
+	"test-2024-05-01T10-00-00.000.log.tmp",
+	"test-2024-05-01.log",
+	"other-2024-05-01T10-00-00.000.log",
+}
+
+func TestCleanupOnStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(cfg *LogConfig)
+		wantKept []string
+	}{
+		{
+			name:     "disabled",
+			modify:   func(cfg *LogConfig) { cfg.CleanupOnStart = false; cfg.MaxBackups = 1; cfg.MaxAge = 1 },
+			wantKept: startupBackups,
+		},
+		{
+			name:     "max backups",
+			modify:   func(cfg *LogConfig) { cfg.MaxBackups = 2 },
+			wantKept: startupBackups[:2],
+		},
+		{
+			name:     "max age",
+			modify:   func(cfg *LogConfig) { cfg.MaxAge = 3 },
+			wantKept: startupBackups[:2],
+		},
+		{
+			name:     "max age and backups",
+			modify:   func(cfg *LogConfig) { cfg.MaxAge = 7; cfg.MaxBackups = 1 },
+			wantKept: startupBackups[:1],
+		},
+		{
+			name: "max total size",
+			modify: func(cfg *LogConfig) {
+				cfg.MaxTotalSizeMB = 1
+			},
+			wantKept: startupBackups[:2],
+		},
+		{
+			name:     "nothing configured",
+			modify:   func(cfg *LogConfig) {},
+			wantKept: startupBackups,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir(t)
+			// 修改时间都一样，清理只能按文件名中的时间判断新旧
+			modTime := fixedTime.Add(-time.Hour)
+			for _, name := range startupBackups {
+				seedFile(t, filepath.Join(dir, name), 400*1024, modTime)
+			}
+			for _, name := range unrelatedFiles {
+				seedFile(t, filepath.Join(dir, name), 2*bytesPerMB, fixedTime.AddDate(-1, 0, 0))
+			}
+			if err := os.Mkdir(filepath.Join(dir, "test-2024-05-01T10-00-00.000.log"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			newClockedFileLogger(t, NewManualClock(fixedTime), func(cfg *LogConfig) {
+				cfg.Filename = filepath.Join(dir, "test.log")
+				cfg.CleanupOnStart = true
+				cfg.MaxBackups = 0
+				cfg.MaxAge = 0
+				tt.modify(cfg)
+			})
+
+			want := map[string]bool{"test.log": true, "test-2024-05-01T10-00-00.000.log": true}
+			for _, name := range append(append([]string{}, tt.wantKept...), unrelatedFiles...) {
+				want[name] = true
+			}
+			got := dirNames(t, dir)
+			for _, name := range got {
+				if !want[name] {
+					t.Errorf("%s should have been removed", name)
+				}
+				delete(want, name)
+			}
+			for name := range want {
+				t.Errorf("%s should have been kept", name)
+			}
+		})
+	}
+}
+
+func TestParseBackupTime(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{name: "app-2024-05-16T10-00-00.000.log", ok: true},
+		{name: "app-2024-05-16T10-00-00.000.log.gz", ok: true},
+		{name: "app-2024-05-16T10-00-00.000.log.zst", ok: true},
+		{name: "app-2024-05-16T10-00-00.log"},
+		{name: "app-2024-05-16T10-00-00.000.txt"},
+		{name: "app-2024-05-16T10-00-00.000.log.bz2"},
+		{name: "app.log"},
+		{name: "other-2024-05-16T10-00-00.000.log"},
+		{name: "my-app-2024-05-16T10-00-00.000.log"},
+	}
+	want := time.Date(2024, 5, 16, 10, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		got, ok := parseBackupTime(tt.name, "/var/log/app.log", time.UTC)
+		if ok != tt.ok {
+			t.Errorf("parseBackupTime(%q) ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && !got.Equal(want) {
+			t.Errorf("parseBackupTime(%q) = %v, want %v", tt.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+可注入的时钟
+日志时间戳、GinLogger的cost以及之后按时间切割都依赖当前时间，
+通过Clock注入时间后，测试可以使用ManualClock得到确定的输出。
+*/
+
+// Clock 提供当前时间
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock 使用系统时间
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// defaultClock 默认使用的系统时钟
+var defaultClock Clock = realClock{}
+
+// zapClock 把Clock适配成zap.WithClock需要的zapcore.Clock
+type zapClock struct {
+	Clock
+}
+
+func (zapClock) NewTicker(d time.Duration) *time.Ticker {
+	return time.NewTicker(d)
+}
+
+var _ zapcore.Clock = zapClock{}
+
+// ManualClock 手动控制的时钟，只有调用Set或Add时才会改变，到期的定时器也在这时触发，供测试使用
+type ManualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*manualTimer // 还没触发的定时器
+}
+
+// NewManualClock 返回一个停在t的时钟
+func NewManualClock(t time.Time) *ManualClock {
+	return &ManualClock{now: t}
+}
+
+// Now 返回当前设置的时间
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Add 把时钟往后拨d
+func (c *ManualClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.fireTimers()
+}
+
+// Set 把时钟设置为t
+func (c *ManualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+	c.fireTimers()
+}
+
+// timerClock 能创建定时器的Clock，定时切割通过它等待，ManualClock的定时器在Add/Set时触发
+type timerClock interface {
+	NewTimer(d time.Duration) (c <-chan time.Time, stop func())
+}
+
+func (realClock) NewTimer(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTimer(d)
+	return t.C, func() { t.Stop() }
+}
+
+// clockTimer 在clock上等待d，clock没有实现timerClock时使用系统定时器
+func clockTimer(clock Clock, d time.Duration) (<-chan time.Time, func()) {
+	if tc, ok := clock.(timerClock); ok {
+		return tc.NewTimer(d)
+	}
+	return realClock{}.NewTimer(d)
+}
+
+// manualTimer ManualClock上的定时器
+type manualTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// NewTimer 返回一个在时钟被拨到Now()+d之后触发的定时器
+func (c *ManualClock) NewTimer(d time.Duration) (<-chan time.Time, func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &manualTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+		return t.c, func() {}
+	}
+	c.timers = append(c.timers, t)
+	return t.c, func() { c.removeTimer(t) }
+}
+
+func (c *ManualClock) removeTimer(t *manualTimer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+// fireTimers 触发所有到期的定时器，调用方需要持有c.mu
+func (c *ManualClock) fireTimers() {
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if c.now.Before(t.at) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = pending
+}
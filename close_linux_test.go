@@ -0,0 +1,53 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openFDs 返回/proc/self/fd中指向path的文件描述符个数
+func openFDs(t *testing.T, path string) int {
+	t.Helper()
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("/proc/self/fd not available: %v", err)
+	}
+	n := 0
+	for _, fd := range fds {
+		target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name()))
+		if err == nil && target == path {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCloseReleasesFileDescriptor(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	if _, _, err := InitLoggerWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("before close")
+	// tempDir可能经过符号链接，/proc中是解析后的路径
+	path, err := filepath.EvalSymlinks(cfg.Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := openFDs(t, path); n != 1 {
+		t.Fatalf("%d descriptors point at the log file before Close, want 1", n)
+	}
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := openFDs(t, path); n != 0 {
+		t.Errorf("%d descriptors still point at the log file after Close", n)
+	}
+}
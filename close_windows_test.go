@@ -0,0 +1,48 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+// openExclusive 以不共享的方式打开path，其他句柄还开着时失败
+func openExclusive(path string) error {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+		syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return err
+	}
+	return syscall.CloseHandle(h)
+}
+
+func TestCloseReleasesFileHandle(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	if _, _, err := InitLoggerWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("before close")
+	if err := openExclusive(cfg.Filename); err == nil {
+		t.Fatal("exclusive open succeeded while the logger still holds the file")
+	}
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := openExclusive(cfg.Filename); err != nil {
+		t.Fatalf("exclusive open after Close: %v", err)
+	}
+	// 打开的文件没有FILE_SHARE_DELETE，句柄释放之后才能改名
+	if err := os.Rename(cfg.Filename, cfg.Filename+".moved"); err != nil {
+		t.Fatalf("rename after Close: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+
+	"github.com/mattn/go-isatty"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+彩色级别
+本地tail日志时错误不显眼。配置Color后console输出使用CapitalColorLevelEncoder给级别上色，
+只在console输出是终端时生效，ForceColor跳过终端检测。
+写lumberjack文件的core永远不上色，避免ANSI转义序列混进切割出的文件。
+*/
+
+// colorConsole 判断console输出是否使用彩色级别：只对console Encoder生效，
+// 写JSON文件时console总是console Encoder，否则要求Encoding是console
+func (o *loggerOptions) colorConsole() bool {
+	if !o.cfg.Color || !o.console {
+		return false
+	}
+	plain := o.cfg.Encoding == "" || o.cfg.Encoding == EncodingConsole || o.cfg.Mode == ModeDevelopment
+	if !plain && !(o.file && o.cfg.Encoding == EncodingJSON) {
+		return false
+	}
+	return o.cfg.ForceColor || isTerminal(o.consoleOut)
+}
+
+// newColorEncoder 返回级别带颜色的console Encoder
+func newColorEncoder(cfg LogConfig) (zapcore.Encoder, error) {
+	encoderConfig, err := getEncoderConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	encoder := withMultilineStack(zapcore.NewConsoleEncoder(encoderConfig), encoderConfig, cfg.MultilineStack)
+	return wrapEncoder(encoder, cfg), nil
+}
+
+// isTerminal 判断ws是否是终端，不是*os.File的一律视为非终端
+func isTerminal(ws zapcore.WriteSyncer) bool {
+	f, ok := ws.(*os.File)
+	if !ok {
+		return false
+	}
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+// ansiEscape ANSI转义序列的开头
+const ansiEscape = "\x1b["
+
+func TestColorOnlyInConsole(t *testing.T) {
+	tests := []struct {
+		name        string
+		encoding    string
+		color       bool
+		force       bool
+		wantColored bool
+	}{
+		{name: "forced console encoding", encoding: EncodingConsole, color: true, force: true, wantColored: true},
+		{name: "forced json file", encoding: EncodingJSON, color: true, force: true, wantColored: true},
+		{name: "not a terminal", encoding: EncodingConsole, color: true},
+		{name: "force without color", encoding: EncodingConsole, force: true},
+		{name: "disabled", encoding: EncodingConsole},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			console := &zaptest.Buffer{}
+			cfg := defaultLogConfig()
+			cfg.Filename = tempLogFile(t)
+			cfg.Encoding = tt.encoding
+			cfg.TeeToConsole = true
+			cfg.Color = tt.color
+			cfg.ForceColor = tt.force
+			b, err := newLogger(WithConfig(cfg), WithConsoleOutput(console))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.logger.Info("info line")
+			b.logger.Error("error line")
+			b.close()
+
+			if got := strings.Contains(console.String(), ansiEscape); got != tt.wantColored {
+				t.Errorf("console colored = %v, want %v:\n%q", got, tt.wantColored, console.String())
+			}
+			file := readFile(t, cfg.Filename)
+			if strings.Contains(file, ansiEscape) {
+				t.Errorf("log file must never contain escape sequences:\n%q", file)
+			}
+			if !strings.Contains(file, "error line") {
+				t.Errorf("log file missing entries:\n%s", file)
+			}
+		})
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	f, err := os.Create(tempLogFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if isTerminal(f) {
+		t.Error("regular file reported as terminal")
+	}
+	if isTerminal(&zaptest.Buffer{}) {
+		t.Error("buffer reported as terminal")
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+LogConfig
+InitLogger3里原来写死的文件名、切割大小、日志级别等参数统一收进LogConfig，
+通过InitLoggerWithConfig(cfg)构建logger，InitLogger3只是用默认配置调用它。
+*/
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Name            string `yaml:"name" json:"name"`                           // logger的名字，在LoggerManager中区分不同的logger
+	Filename        string `yaml:"filename" json:"filename"`                   // 日志文件的位置，可以使用{hostname}和{pid}，见path.go
+	MaxSize         int    `yaml:"max_size" json:"max_size"`                   // 在进行切割之前，日志文件的最大大小（以MB为单位）
+	MaxBackups      int    `yaml:"max_backups" json:"max_backups"`             // 保留旧文件的最大个数
+	MaxAge          int    `yaml:"max_age" json:"max_age"`                     // 保留旧文件的最大天数
+	Compress        bool   `yaml:"compress" json:"compress"`                   // 是否压缩/归档旧文件
+	BackupLocalTime bool   `yaml:"backup_local_time" json:"backup_local_time"` // 切割出的备份文件名中的时间戳使用本地时间，默认UTC
+	Level           string `yaml:"level" json:"level"`                         // 日志级别，如debug、info、warn、error
+	Encoding        string `yaml:"encoding" json:"encoding"`                   // Encoder：json、console、logfmt、gelf或json-pretty，为空时使用console
+	Mode            string `yaml:"mode" json:"mode"`                           // 预设模式：development或production，为空时使用上面的各项配置
+	TimeZone        string `yaml:"time_zone" json:"time_zone"`                 // 时间戳使用的时区：local（默认）、utc或IANA时区名如Asia/Shanghai
+	TimeLayout      string `yaml:"time_layout" json:"time_layout"`             // 时间戳的Go layout，如2006-01-02 15:04:05.000，为空时使用ISO8601
+	// TimeEncoding 时间戳的编码：iso8601（默认）、epoch、epoch_millis或epoch_nanos，后三种输出数字，不受TimeZone和TimeLayout影响
+	TimeEncoding string `yaml:"time_encoding" json:"time_encoding"`
+	// EpochMillisKey 非空时每条日志额外带一个该名字的整数毫秒时间戳字段（如ts_ms），与ts是同一时刻
+	EpochMillisKey string `yaml:"epoch_millis_key" json:"epoch_millis_key"`
+	// DurationEncoding zap.Duration字段（如gin中间件的cost）的编码：seconds、millis、nanos或string，
+	// 为空时JSON/console Encoder输出秒，开发模式输出string
+	DurationEncoding string `yaml:"duration_encoding" json:"duration_encoding"`
+	// LevelEncoding 级别的格式：capital（默认，INFO）、lower（info）、number（syslog severity，见levelSeverity）
+	// 或short（固定3个字符的DBG/INF/WRN/ERR，console输出时各列对齐）
+	LevelEncoding string `yaml:"level_encoding" json:"level_encoding"`
+	// CallerEncoding caller的格式：short（默认，包名/文件名:行号）、full（完整路径）或filename（只有文件名）
+	CallerEncoding string `yaml:"caller_encoding" json:"caller_encoding"`
+	// LogFunction 在caller之外记录调用函数的完整名字（func字段），如main.GinLoggerWithClock.func1
+	LogFunction bool `yaml:"log_function" json:"log_function"`
+	// LineEnding 每条日志的换行符："\n"（默认）或"\r\n"，给只认CRLF的Windows工具用，切割出的备份内容不变
+	LineEnding string `yaml:"line_ending" json:"line_ending"`
+
+	// 日志中各个key的名字，为空时使用zap的默认值（ts、msg、level、caller、stacktrace），为"-"时不输出该key
+	TimeKey       string `yaml:"time_key" json:"time_key"`
+	MessageKey    string `yaml:"message_key" json:"message_key"`
+	LevelKey      string `yaml:"level_key" json:"level_key"`
+	CallerKey     string `yaml:"caller_key" json:"caller_key"`
+	StacktraceKey string `yaml:"stacktrace_key" json:"stacktrace_key"`
+
+	// ErrorFile 不为nil时，Error及以上级别的日志单独写到这个文件，Filename中只保留Error以下的日志
+	ErrorFile *ErrorFileConfig `yaml:"error_file" json:"error_file"`
+	// MaxSizeBytes 大于0时以字节为单位设置切割前文件的最大大小，优先于MaxSize，可以小于1MB，见max_size.go
+	MaxSizeBytes int64 `yaml:"max_size_bytes" json:"max_size_bytes"`
+	// MaxTotalSizeMB 大于0时每次切割后从最旧的开始删除备份，直到所有备份的总大小不超过该值（MB），见total_size.go
+	MaxTotalSizeMB int `yaml:"max_total_size_mb" json:"max_total_size_mb"`
+	// TruncateOnStart 打开日志文件时按TruncateMode清空或切割走已有的日志文件，见truncate_start.go
+	TruncateOnStart bool `yaml:"truncate_on_start" json:"truncate_on_start"`
+	// TruncateMode TruncateOnStart的方式：truncate（默认）清空文件，rotate切割为备份
+	TruncateMode string `yaml:"truncate_mode" json:"truncate_mode"`
+	// CleanupOnStart 打开日志文件时先按MaxAge、MaxBackups、MaxTotalSizeMB清理已有的备份，见cleanup_start.go
+	CleanupOnStart bool `yaml:"cleanup_on_start" json:"cleanup_on_start"`
+	// Compression 备份的压缩方式：none、gzip或zstd，为空时按Compress决定是否gzip，见zstd.go
+	Compression string `yaml:"compression" json:"compression"`
+	// OnRotate 不为nil时，每次切割后在后台用新生成的备份（压缩后的文件）路径调用，例如上传到S3，见backup_hook.go
+	OnRotate func(backupPath string) `yaml:"-" json:"-"`
+	// Manifest 每次切割后把备份（压缩后的文件）的SHA-256追加到日志目录下的manifest.jsonl，见manifest.go
+	Manifest bool `yaml:"manifest" json:"manifest"`
+	// LowDisk 不为nil时定期检查日志盘的剩余空间，不足时把级别提高到Warn，见low_disk.go
+	LowDisk *LowDiskConfig `yaml:"low_disk" json:"low_disk"`
+	// Expvar 把Stats以logging为名发布到expvar（/debug/vars），见stats.go
+	Expvar bool `yaml:"expvar" json:"expvar"`
+	// BufferSize 大于0时缓冲写入日志文件，缓冲区的字节数，见buffer.go；只设置FlushInterval时默认256KB
+	BufferSize int `yaml:"buffer_size" json:"buffer_size"`
+	// FlushInterval 缓冲写入时最多隔多久写一次文件，如1s；只设置BufferSize时默认30s
+	FlushInterval time.Duration `yaml:"flush_interval" json:"flush_interval"`
+	// FilenamePattern 正在写的文件名带上日期，如./logs/app-%Y-%m-%d.log，设置后忽略Filename，见dated_file.go
+	FilenamePattern string `yaml:"filename_pattern" json:"filename_pattern"`
+	// DailyDirs 日志文件放在按日期命名的子目录中，如./logs/2024-05-17/app.log，跨天时换目录，见dated_file.go
+	DailyDirs bool `yaml:"daily_dirs" json:"daily_dirs"`
+	// RotateDaily 除了按大小，每天零点（TimeZone时区）也切割一次，见rotate_time.go
+	RotateDaily bool `yaml:"rotate_daily" json:"rotate_daily"`
+	// RotateEvery 除了按大小，每隔这么久也切割一次，如1h，不能与RotateDaily同时使用
+	RotateEvery time.Duration `yaml:"rotate_every" json:"rotate_every"`
+	// RotateAt 每天在这个时刻（TimeZone时区，HH:MM格式如00:00）主动切割，空闲的服务也会按时切割，见rotate_at.go
+	RotateAt string `yaml:"rotate_at" json:"rotate_at"`
+	// Sink 日志的主要输出：file（默认）写日志文件；journald发送到systemd journal，不可用时退回写文件，见journald.go
+	Sink string `yaml:"sink" json:"sink"`
+	// TeeToConsole 写文件的同时输出到console，console使用普通(console) Encoder，文件仍按JSON等配置编码
+	TeeToConsole bool `yaml:"tee_to_console" json:"tee_to_console"`
+	// Color console输出是终端时级别带颜色，ForceColor为true时不检测终端总是上色。写文件时文件内容永远不上色
+	Color      bool `yaml:"color" json:"color"`
+	ForceColor bool `yaml:"force_color" json:"force_color"`
+	// StderrMirror Warn及以上级别的日志额外用console Encoder输出一份到stderr，方便kubectl logs查看
+	StderrMirror    bool `yaml:"stderr_mirror" json:"stderr_mirror"`
+	StderrKeepStack bool `yaml:"stderr_keep_stack" json:"stderr_keep_stack"` // stderr上保留stack字段，默认去掉
+
+	// BaseDir 相对路径的Filename基于该目录解析，为空时使用可执行文件所在目录。Filename开头的~会展开为home目录
+	BaseDir  string      `yaml:"base_dir" json:"base_dir"`
+	DirMode  os.FileMode `yaml:"dir_mode" json:"dir_mode"`   // 自动创建日志目录时使用的权限，默认0755
+	FileMode os.FileMode `yaml:"file_mode" json:"file_mode"` // 日志文件及备份的权限，默认0644，Windows上无效
+
+	DisableStdLog bool `yaml:"disable_std_log" json:"disable_std_log"` // 不把标准库log包的输出重定向到logger
+	// ErrorOutput zap内部错误（如日志文件写入失败）的输出位置：stderr（默认）或文件路径
+	ErrorOutput string `yaml:"error_output" json:"error_output"`
+	// DisableCaller 不记录调用函数信息。记录caller每条日志都要调用一次runtime.Caller，
+	// 高QPS下在profile里很显眼，关闭后Info的吞吐能明显提高（见BenchmarkInfoWithCaller和BenchmarkInfoNoCaller），
+	// 代价是日志里没有文件和行号。
+	// gin中间件记录的path、method等是普通字段，不受影响
+	DisableCaller bool `yaml:"disable_caller" json:"disable_caller"`
+	// StacktraceLevel 该级别及以上的日志自动附带stacktrace，可选warn、error、dpanic，为空不附带。
+	// console Encoder会把stacktrace原样输出在日志行之后，不会变成一整段转义过的字符串
+	StacktraceLevel string `yaml:"stacktrace_level" json:"stacktrace_level"`
+	// MultilineStack console Encoder把stack字段和stacktrace原样缩进输出在日志行下面，而不是转义成一行
+	MultilineStack bool `yaml:"multiline_stack" json:"multiline_stack"`
+	// RedactKeys 需要脱敏的字段名，不区分大小写，可以用*开头或结尾做后缀或前缀匹配，如password、token、*_secret。
+	// GinLogger的query和GinRecovery的request按参数名和header名脱敏
+	RedactKeys []string `yaml:"redact_keys" json:"redact_keys"`
+	// SortFields 每次调用传入的字段按key排序，输出顺序不受调用方构造字段的顺序影响
+	SortFields bool `yaml:"sort_fields" json:"sort_fields"`
+	// MaxFieldBytes 大于0时，超过该字节数的字符串字段（如GinRecovery的request、stack）被截断
+	MaxFieldBytes int `yaml:"max_field_bytes" json:"max_field_bytes"`
+	// Sampling 采样配置，为nil时不采样
+	Sampling *SamplingConfig `yaml:"sampling" json:"sampling"`
+	// Async 异步写入日志文件的配置，为nil时同步写；队列满时丢弃日志而不是阻塞，见async.go
+	Async *AsyncConfig `yaml:"async" json:"async"`
+	// Failover 写日志文件连续失败时切换到stderr的配置，为nil时不切换，见failover.go
+	Failover *FailoverConfig `yaml:"failover" json:"failover"`
+	// Retry 写日志文件遇到EINTR、EAGAIN或只写了一部分时重试的配置，为nil时不重试，见retry.go
+	Retry *RetryConfig `yaml:"retry" json:"retry"`
+	// Syslog 同时输出到syslog的配置，为nil时不输出；不配置Filename时只输出到syslog，见syslog.go
+	Syslog *SyslogConfig `yaml:"syslog" json:"syslog"`
+	// Network 同时通过TCP/UDP发送日志的配置，为nil时不发送；不配置Filename时只通过网络发送，见network_sink.go
+	Network *NetworkSink `yaml:"network" json:"network"`
+	// Loki 同时推送到Grafana Loki的配置，为nil时不推送；不配置Filename时只推送到Loki，见loki.go
+	Loki *LokiConfig `yaml:"loki" json:"loki"`
+	// Elasticsearch 同时通过_bulk写入Elasticsearch的配置，为nil时不写入，见elasticsearch.go
+	Elasticsearch *ElasticsearchConfig `yaml:"elasticsearch" json:"elasticsearch"`
+
+	// ECS 按Elastic Common Schema输出：key改为@timestamp、log.level、message等，服务字段改为service.name等，
+	// 作为全局logger时GinLogger的字段也按ECS嵌套输出。通常与Encoding: json一起使用
+	ECS bool `yaml:"ecs" json:"ecs"`
+
+	// 服务信息，非空时作为字段附加到每条日志上，gin中间件的日志也会带上
+	ServiceName    string `yaml:"service_name" json:"service_name"`       // 服务名
+	ServiceVersion string `yaml:"service_version" json:"service_version"` // 服务版本，为空时从构建信息读取
+	Env            string `yaml:"env" json:"env"`                         // 运行环境，如dev、staging、prod
+	HostInfo       bool   `yaml:"host_info" json:"host_info"`             // 是否附加hostname和pid字段
+}
+
+// dirMode 返回创建日志目录使用的权限
+func (cfg LogConfig) dirMode() os.FileMode {
+	if cfg.DirMode == 0 {
+		return 0755
+	}
+	return cfg.DirMode
+}
+
+// fileMode 返回创建日志文件使用的权限
+func (cfg LogConfig) fileMode() os.FileMode {
+	if cfg.FileMode == 0 {
+		return 0644
+	}
+	return cfg.FileMode
+}
+
+// processBackups 判断切割出的备份是否需要由backupProcessor处理，这时gzip也由它压缩
+func (cfg LogConfig) processBackups() bool {
+	return cfg.OnRotate != nil || cfg.Manifest
+}
+
+// 预设模式
+const (
+	// ModeDevelopment 开发模式：development encoder配置、console Encoder、Debug级别、输出到stdout
+	ModeDevelopment = "development"
+	// ModeProduction 生产模式：JSON Encoder、Info级别、输出到lumberjack切割的文件
+	ModeProduction = "production"
+)
+
+// Encoding的取值
+const (
+	EncodingJSON    = "json"
+	EncodingConsole = "console"
+	EncodingLogfmt  = "logfmt"
+	EncodingGELF    = "gelf"
+	// EncodingJSONPretty 缩进成多行的JSON，只能输出到console
+	EncodingJSONPretty = "json-pretty"
+)
+
+// defaultLogConfig 返回InitLogger3原来写死的那一套默认配置
+func defaultLogConfig() LogConfig {
+	return LogConfig{
+		Filename:   "./test.log",
+		MaxSize:    1,
+		MaxBackups: 5,
+		MaxAge:     30,
+		Compress:   false,
+		Level:      "debug",
+		Encoding:   EncodingConsole,
+	}
+}
+
+// Validate 检查配置是否合法，避免悄悄创建出一个不可用的logger。
+// 会检查所有配置项，返回的error包含发现的全部问题（multierr）。
+// Filename和FilenamePattern都为空表示只输出到console，此时不检查文件和切割相关的配置
+func (cfg LogConfig) Validate() error {
+	cfg.FilenamePattern = cfg.dailyDirsPattern()
+	if cfg.FilenamePattern != "" {
+		if err := validateFilenamePattern(cfg.FilenamePattern, cfg.DailyDirs); err != nil {
+			return multierr.Append(err, cfg.validateCommon())
+		}
+		cfg.Filename, _ = renderFilenamePattern(cfg.FilenamePattern, defaultClock.Now(), false)
+	}
+	if cfg.Filename == "" {
+		return cfg.validateCommon()
+	}
+	return multierr.Append(cfg.validateFile(), cfg.validateCommon())
+}
+
+// validateFile 检查日志文件和切割相关的配置
+func (cfg LogConfig) validateFile() error {
+	err := checkLogDirWritable(cfg.Filename)
+	if cfg.Encoding == EncodingJSONPretty {
+		err = multierr.Append(err, fmt.Errorf("log config: encoding %s cannot be used with a log file", EncodingJSONPretty))
+	}
+	if cfg.ErrorFile != nil {
+		err = multierr.Append(err, cfg.validateErrorFile())
+	}
+	err = multierr.Append(err, cfg.validateRotation())
+	err = multierr.Append(err, validateTruncateMode(cfg.TruncateMode))
+	err = multierr.Append(err, cfg.validateCompression())
+	err = multierr.Append(err, cfg.validateBuffer())
+	if cfg.MaxSizeBytes < 0 {
+		err = multierr.Append(err, fmt.Errorf("log config: max size bytes must not be negative, got %d", cfg.MaxSizeBytes))
+	}
+	if cfg.MaxSizeBytes == 0 && cfg.MaxSize <= 0 {
+		err = multierr.Append(err, fmt.Errorf("log config: max size must be greater than 0, got %d", cfg.MaxSize))
+	}
+	if cfg.MaxBackups < 0 {
+		err = multierr.Append(err, fmt.Errorf("log config: max backups must not be negative, got %d", cfg.MaxBackups))
+	}
+	if cfg.MaxTotalSizeMB < 0 {
+		err = multierr.Append(err, fmt.Errorf("log config: max total size must not be negative, got %d", cfg.MaxTotalSizeMB))
+	}
+	if cfg.MaxAge < 0 {
+		err = multierr.Append(err, fmt.Errorf("log config: max age must not be negative, got %d", cfg.MaxAge))
+	}
+	return err
+}
+
+// validateCommon 检查与输出目标无关的配置
+func (cfg LogConfig) validateCommon() error {
+	var err error
+	if _, e := ParseLevel(cfg.Level); e != nil {
+		err = multierr.Append(err, fmt.Errorf("log config: %v", e))
+	}
+	if _, _, e := parseStacktraceLevel(cfg.StacktraceLevel); e != nil {
+		err = multierr.Append(err, e)
+	}
+	if cfg.Sampling != nil {
+		err = multierr.Append(err, cfg.Sampling.validate())
+	}
+	if cfg.Async != nil {
+		err = multierr.Append(err, cfg.Async.validate())
+	}
+	if cfg.Failover != nil {
+		err = multierr.Append(err, cfg.Failover.validate())
+	}
+	if cfg.Retry != nil {
+		err = multierr.Append(err, cfg.Retry.validate())
+	}
+	if cfg.LowDisk != nil {
+		err = multierr.Append(err, cfg.LowDisk.validate())
+	}
+	if cfg.Syslog != nil {
+		err = multierr.Append(err, cfg.Syslog.validate())
+	}
+	if cfg.Network != nil {
+		err = multierr.Append(err, cfg.Network.validate())
+	}
+	if cfg.Loki != nil {
+		err = multierr.Append(err, cfg.Loki.validate())
+	}
+	if cfg.Elasticsearch != nil {
+		err = multierr.Append(err, cfg.Elasticsearch.validate())
+	}
+	if cfg.MaxFieldBytes < 0 {
+		err = multierr.Append(err, fmt.Errorf("log config: max field bytes must not be negative, got %d", cfg.MaxFieldBytes))
+	}
+	if _, e := loadTimeZone(cfg.TimeZone); e != nil {
+		err = multierr.Append(err, e)
+	}
+	err = multierr.Append(err, validateEncoding(cfg.Encoding))
+	err = multierr.Append(err, validateSink(cfg.Sink))
+	err = multierr.Append(err, validateTimeLayout(cfg.TimeLayout))
+	if _, e := newTimeEncoder(cfg.TimeEncoding, cfg.TimeLayout, nil); e != nil {
+		err = multierr.Append(err, e)
+	}
+	if _, e := newDurationEncoder(cfg.DurationEncoding, nil); e != nil {
+		err = multierr.Append(err, e)
+	}
+	if _, e := newCallerEncoder(cfg.CallerEncoding, nil); e != nil {
+		err = multierr.Append(err, e)
+	}
+	if _, e := newLevelEncoder(cfg.LevelEncoding, nil); e != nil {
+		err = multierr.Append(err, e)
+	}
+	if _, e := newLineEnding(cfg.LineEnding); e != nil {
+		err = multierr.Append(err, e)
+	}
+	return multierr.Append(err, validateMode(cfg.Mode))
+}
+
+// parseStacktraceLevel 解析StacktraceLevel，为空时enabled返回false
+func parseStacktraceLevel(s string) (level zapcore.Level, enabled bool, err error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "":
+		return level, false, nil
+	case "warn":
+		return zapcore.WarnLevel, true, nil
+	case "error":
+		return zapcore.ErrorLevel, true, nil
+	case "dpanic":
+		return zapcore.DPanicLevel, true, nil
+	}
+	return level, false, fmt.Errorf("log config: invalid stacktrace level %q, want warn, error or dpanic", s)
+}
+
+// checkLogDirWritable 检查日志文件所在目录存在且可写；目录不存在时检查最近一级已存在的上级目录，
+// 确认之后能创建出来。检查时只创建并删除一个临时文件，不会创建目录或日志文件本身
+func checkLogDirWritable(filename string) error {
+	dir := filepath.Dir(filename)
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("log config: %s is not a directory", dir)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("log config: stat log dir: %v", err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return fmt.Errorf("log config: no existing parent directory for %s", filename)
+		}
+		dir = parent
+	}
+	f, err := ioutil.TempFile(dir, ".logcheck-*")
+	if err != nil {
+		return fmt.Errorf("log config: directory %s is not writable: %v", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func validateEncoding(encoding string) error {
+	switch encoding {
+	case "", EncodingJSON, EncodingConsole, EncodingLogfmt, EncodingGELF, EncodingJSONPretty:
+		return nil
+	}
+	return fmt.Errorf("log config: unknown encoding %q, want %s, %s, %s, %s or %s",
+		encoding, EncodingJSON, EncodingConsole, EncodingLogfmt, EncodingGELF, EncodingJSONPretty)
+}
+
+func validateMode(mode string) error {
+	switch mode {
+	case "", ModeDevelopment, ModeProduction:
+		return nil
+	}
+	return fmt.Errorf("log config: unknown mode %q, want %s or %s", mode, ModeDevelopment, ModeProduction)
+}
+
+// InitLoggerWithConfig 根据cfg初始化全局的logger和sugarLogger，同时替换zap.L()/zap.S()并重定向标准库log，
+// 返回的restore撤销这两步替换（主要给测试用）。
+// 优先级：命令行参数（RegisterFlags）> 环境变量（LOG_LEVEL、LOG_FILE、LOG_MAX_SIZE_MB、LOG_COMPRESS）> cfg
+func InitLoggerWithConfig(cfg LogConfig) (l *zap.Logger, restore func(), err error) {
+	cfg = applyFlagOverrides(applyEnvOverrides(cfg))
+	b, err := newLogger(WithConfig(cfg))
+	if err != nil {
+		return nil, nil, err
+	}
+	return b.logger, setGlobalLogger(b), nil
+}
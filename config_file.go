@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+=============================================================
+从YAML文件加载日志配置
+不同环境只需要改配置文件，不用重新编译。文件中没写的key沿用defaultLogConfig()的默认值，
+示例见log.example.yaml。
+*/
+
+// loadLogConfigFile 读取并解析YAML配置文件
+func loadLogConfigFile(path string) (LogConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return LogConfig{}, fmt.Errorf("read log config %s: %v", path, err)
+	}
+	cfg := defaultLogConfig()
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return LogConfig{}, fmt.Errorf("parse log config %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// InitLoggerFromFile 从YAML文件读取配置并初始化全局的logger和sugarLogger
+func InitLoggerFromFile(path string) error {
+	cfg, err := loadLogConfigFile(path)
+	if err != nil {
+		return err
+	}
+	if _, _, err = InitLoggerWithConfig(cfg); err != nil {
+		return err
+	}
+	globalMu.Lock()
+	globalConfigPath = path
+	globalMu.Unlock()
+	return nil
+}
+
+/*
+=============================================================
+从JSON加载日志配置
+字段名与YAML一致，未知字段直接忽略，没写的字段沿用默认值。
+*/
+
+// ParseLogConfigJSON 把JSON解析为LogConfig，并校验级别和切割大小
+func ParseLogConfigJSON(data []byte) (LogConfig, error) {
+	cfg := defaultLogConfig()
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return LogConfig{}, fmt.Errorf("parse log config json: %v", err)
+	}
+	if cfg.MaxSizeBytes < 0 {
+		return LogConfig{}, fmt.Errorf("parse log config json: max_size_bytes must not be negative, got %d", cfg.MaxSizeBytes)
+	}
+	if cfg.MaxSizeBytes == 0 && cfg.MaxSize <= 0 {
+		return LogConfig{}, fmt.Errorf("parse log config json: max_size must be greater than 0, got %d", cfg.MaxSize)
+	}
+	if _, err := ParseLevel(cfg.Level); err != nil {
+		return LogConfig{}, err
+	}
+	return cfg, nil
+}
+
+// InitLoggerFromJSON 从JSON配置初始化全局的logger和sugarLogger
+func InitLoggerFromJSON(data []byte) (*zap.Logger, error) {
+	cfg, err := ParseLogConfigJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	l, _, err := InitLoggerWithConfig(cfg)
+	return l, err
+}
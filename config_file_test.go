@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadLogConfigFileDefaults(t *testing.T) {
+	path := writeTempFile(t, "log.yaml", "filename: ./app.log\nlevel: info\n")
+
+	cfg, err := loadLogConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := defaultLogConfig()
+	want.Filename = "./app.log"
+	want.Level = "info"
+	if cfg.Filename != want.Filename || cfg.Level != want.Level {
+		t.Errorf("filename, level = %q, %q, want %q, %q", cfg.Filename, cfg.Level, want.Filename, want.Level)
+	}
+	if cfg.MaxSize != want.MaxSize || cfg.MaxBackups != want.MaxBackups || cfg.MaxAge != want.MaxAge ||
+		cfg.Compress != want.Compress || cfg.Encoding != want.Encoding {
+		t.Errorf("missing keys not defaulted: got %+v", cfg)
+	}
+}
+
+func TestLoadLogConfigFileAllKeys(t *testing.T) {
+	path := writeTempFile(t, "log.yaml", `
+filename: /var/log/app.log
+max_size: 10
+max_backups: 3
+max_age: 7
+compress: true
+level: warn
+encoding: json
+`)
+
+	cfg, err := loadLogConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Filename != "/var/log/app.log" || cfg.MaxSize != 10 || cfg.MaxBackups != 3 || cfg.MaxAge != 7 ||
+		!cfg.Compress || cfg.Level != "warn" || cfg.Encoding != EncodingJSON {
+		t.Errorf("got %+v", cfg)
+	}
+}
+
+func TestLoadLogConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    func(t *testing.T) string
+		wantErr string
+	}{
+		{
+			name:    "missing file",
+			path:    func(t *testing.T) string { return filepath.Join(tempDir(t), "missing.yaml") },
+			wantErr: "read log config",
+		},
+		{
+			name:    "malformed yaml",
+			path:    func(t *testing.T) string { return writeTempFile(t, "log.yaml", "level: [debug\n") },
+			wantErr: "parse log config",
+		},
+		{
+			name:    "wrong type",
+			path:    func(t *testing.T) string { return writeTempFile(t, "log.yaml", "max_size: big\n") },
+			wantErr: "parse log config",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path(t)
+			_, err := loadLogConfigFile(path)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), path) {
+				t.Errorf("error %q should mention %q and the file path", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInitLoggerFromFile(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	logFile := tempLogFile(t)
+	path := writeTempFile(t, "log.yaml", "filename: "+logFile+"\nlevel: info\nencoding: json\n")
+
+	if err := InitLoggerFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("dropped")
+	logger.Info("from yaml")
+	_ = logger.Sync()
+
+	out := readFile(t, logFile)
+	if !strings.Contains(out, `"msg":"from yaml"`) {
+		t.Errorf("log file missing info line:\n%s", out)
+	}
+	if strings.Contains(out, "dropped") {
+		t.Errorf("debug line written at info level:\n%s", out)
+	}
+}
+
+func TestInitLoggerFromFileMalformed(t *testing.T) {
+	path := writeTempFile(t, "log.yaml", "filename: [\n")
+	if err := InitLoggerFromFile(path); err == nil {
+		t.Fatal("expected error for malformed file")
+	}
+}
+
+func TestParseLogConfigJSONRoundTrip(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseLogConfigJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, cfg) {
+		t.Errorf("round trip changed config:\ngot  %+v\nwant %+v", parsed, cfg)
+	}
+
+	l, err := InitLoggerFromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("from json")
+	_ = l.Sync()
+	if out := readFile(t, cfg.Filename); !strings.Contains(out, "from json") {
+		t.Errorf("log file missing line:\n%s", out)
+	}
+}
+
+func TestParseLogConfigJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+		check   func(t *testing.T, cfg LogConfig)
+	}{
+		{
+			name: "missing fields use defaults",
+			json: `{"level":"warn"}`,
+			check: func(t *testing.T, cfg LogConfig) {
+				want := defaultLogConfig()
+				want.Level = "warn"
+				if !reflect.DeepEqual(cfg, want) {
+					t.Errorf("got %+v, want %+v", cfg, want)
+				}
+			},
+		},
+		{
+			name: "unknown fields ignored",
+			json: `{"level":"info","no_such_field":1,"nested":{"a":"b"}}`,
+			check: func(t *testing.T, cfg LogConfig) {
+				if cfg.Level != "info" {
+					t.Errorf("level = %q, want info", cfg.Level)
+				}
+			},
+		},
+		{name: "invalid level", json: `{"level":"verbose"}`, wantErr: `invalid log level "verbose"`},
+		{name: "zero max size", json: `{"max_size":0}`, wantErr: "max_size must be greater than 0, got 0"},
+		{name: "negative max size", json: `{"max_size":-1}`, wantErr: "max_size must be greater than 0, got -1"},
+		{name: "negative max size bytes", json: `{"max_size_bytes":-1}`, wantErr: "max_size_bytes must not be negative"},
+		{name: "malformed", json: `{"level":`, wantErr: "parse log config json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseLogConfigJSON([]byte(tt.json))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestParseLogConfigJSONMaxSizeBytes(t *testing.T) {
+	// MaxSizeBytes优先于MaxSize，此时MaxSize为0也是合法的
+	cfg, err := ParseLogConfigJSON([]byte(`{"max_size":0,"max_size_bytes":4096}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxSizeBytes != 4096 {
+		t.Errorf("max size bytes = %d, want 4096", cfg.MaxSizeBytes)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestLogConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(t *testing.T, cfg *LogConfig)
+		wantErr []string
+	}{
+		{
+			name:   "valid",
+			modify: func(t *testing.T, cfg *LogConfig) {},
+		},
+		{
+			name:    "zero max size",
+			modify:  func(t *testing.T, cfg *LogConfig) { cfg.MaxSize = 0 },
+			wantErr: []string{"max size must be greater than 0, got 0"},
+		},
+		{
+			name:    "negative max size",
+			modify:  func(t *testing.T, cfg *LogConfig) { cfg.MaxSize = -5 },
+			wantErr: []string{"max size must be greater than 0, got -5"},
+		},
+		{
+			name:    "negative max backups",
+			modify:  func(t *testing.T, cfg *LogConfig) { cfg.MaxBackups = -1 },
+			wantErr: []string{"max backups must not be negative, got -1"},
+		},
+		{
+			name:    "negative max age",
+			modify:  func(t *testing.T, cfg *LogConfig) { cfg.MaxAge = -1 },
+			wantErr: []string{"max age must not be negative, got -1"},
+		},
+		{
+			name: "zero max age with compress",
+			modify: func(t *testing.T, cfg *LogConfig) {
+				cfg.MaxAge = 0
+				cfg.Compress = true
+			},
+		},
+		{
+			name: "missing parent directory is created later",
+			modify: func(t *testing.T, cfg *LogConfig) {
+				cfg.Filename = filepath.Join(filepath.Dir(cfg.Filename), "a", "b", "app.log")
+			},
+		},
+		{
+			name: "parent is a file",
+			modify: func(t *testing.T, cfg *LogConfig) {
+				parent := writeTempFile(t, "not-a-dir", "")
+				cfg.Filename = filepath.Join(parent, "app.log")
+			},
+			wantErr: []string{"is not a directory"},
+		},
+		{
+			name: "every problem reported",
+			modify: func(t *testing.T, cfg *LogConfig) {
+				cfg.MaxSize = 0
+				cfg.MaxBackups = -1
+				cfg.MaxAge = -1
+				cfg.Level = "verbose"
+			},
+			wantErr: []string{
+				"max size must be greater than 0",
+				"max backups must not be negative",
+				"max age must not be negative",
+				"invalid log level",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultLogConfig()
+			cfg.Filename = tempLogFile(t)
+			tt.modify(t, &cfg)
+
+			errs := multierr.Errors(cfg.Validate())
+			if len(errs) != len(tt.wantErr) {
+				t.Fatalf("got %d errors %v, want %d", len(errs), errs, len(tt.wantErr))
+			}
+			for i, want := range tt.wantErr {
+				if !strings.Contains(errs[i].Error(), want) {
+					t.Errorf("error %d = %q, want containing %q", i, errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLogConfigValidateNotWritable(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("directory permissions are not enforced")
+	}
+	dir := tempDir(t)
+	if err := os.Chmod(dir, 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0700)
+
+	cfg := defaultLogConfig()
+	cfg.Filename = filepath.Join(dir, "app.log")
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "is not writable") {
+		t.Fatalf("error = %v, want not writable", err)
+	}
+}
+
+func TestLogConfigValidateConsoleOnly(t *testing.T) {
+	// 只输出到console时不检查切割相关的配置
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.MaxSize = 0
+	cfg.MaxBackups = -1
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInitLoggerWithConfigFailsFast(t *testing.T) {
+	unsetLogEnv(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = filepath.Join(tempDir(t), "logs", "app.log")
+	cfg.MaxBackups = -1
+	if _, _, err := InitLoggerWithConfig(cfg); err == nil {
+		t.Fatal("expected validation error")
+	}
+	if _, err := os.Stat(filepath.Dir(cfg.Filename)); !os.IsNotExist(err) {
+		t.Errorf("invalid config should not create the log directory, stat err = %v", err)
+	}
+}
+
+func TestStacktraceLevel(t *testing.T) {
+	out := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.StacktraceLevel = "error"
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.Info("info line")
+	if lines := out.Lines(); len(lines) != 1 {
+		t.Fatalf("info should be a single line without stacktrace, got:\n%s", out.String())
+	}
+	out.Reset()
+
+	l.Error("error line")
+	lines := out.Lines()
+	if len(lines) < 2 {
+		t.Fatalf("error should be followed by a stacktrace, got:\n%s", out.String())
+	}
+	// console Encoder把stacktrace原样输出在日志行之后，而不是转义成一个字段
+	if strings.Contains(lines[0], `\n`) || strings.Contains(lines[0], "TestStacktraceLevel") {
+		t.Errorf("stacktrace should not be quoted into the log line: %s", lines[0])
+	}
+	if !strings.Contains(strings.Join(lines[1:], "\n"), "TestStacktraceLevel") {
+		t.Errorf("stacktrace should name the test function:\n%s", out.String())
+	}
+}
+
+func TestParseStacktraceLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    zapcore.Level
+		enabled bool
+		wantErr bool
+	}{
+		{in: ""},
+		{in: "warn", want: zapcore.WarnLevel, enabled: true},
+		{in: " Error ", want: zapcore.ErrorLevel, enabled: true},
+		{in: "dpanic", want: zapcore.DPanicLevel, enabled: true},
+		{in: "info", wantErr: true},
+		{in: "fatal", wantErr: true},
+	}
+	for _, tt := range tests {
+		level, enabled, err := parseStacktraceLevel(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseStacktraceLevel(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if level != tt.want || enabled != tt.enabled {
+			t.Errorf("parseStacktraceLevel(%q) = %v, %v, want %v, %v", tt.in, level, enabled, tt.want, tt.enabled)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+=============================================================
+带日期的日志文件名
+默认的test.log只有切割出的备份才带时间，外部工具按日期挑文件不方便。
+配置FilenamePattern（如./logs/app-%Y-%m-%d.log）后，正在写的文件名就带上日期，
+渲染出的文件名变化时（跨天，或者包含%H时跨小时）关闭旧文件、写入新文件。
+lumberjack只清理同一个文件名切割出的备份，这里在每次换文件后按MaxBackups和MaxAge
+清理所有匹配FilenamePattern的旧文件（包括它们的备份和压缩后的.gz、.zst）。
+支持的占位符：%Y（4位年）、%m、%d、%H（2位月、日、时）、%%（%本身）。
+
+配置DailyDirs后，文件放在按日期命名的子目录中，如logs/2024-05-17/app.log，相当于在文件名前插入%Y-%m-%d目录。
+跨天时换到新目录，MaxAge按目录名的日期删除整个过期目录，MaxBackups只限制每个目录中lumberjack的备份个数。
+logs/current是指向当天目录的符号链接，方便tail -F logs/current/app.log。
+*/
+
+// dailyDirToken DailyDirs在文件名前插入的目录
+const dailyDirToken = "%Y-%m-%d"
+
+// dailyDirLayout 按日期命名的目录的Go时间格式
+const dailyDirLayout = "2006-01-02"
+
+// currentDirLink DailyDirs时指向当天目录的符号链接的名字
+const currentDirLink = "current"
+
+// globDigit 渲染glob时占位符的每一位替换为它，不会匹配到current这样的名字
+const globDigit = "[0-9]"
+
+// filenamePatternLayouts FilenamePattern中的占位符对应的Go时间格式
+var filenamePatternLayouts = map[byte]string{
+	'Y': "2006",
+	'm': "01",
+	'd': "02",
+	'H': "15",
+}
+
+// renderFilenamePattern 用t渲染pattern，glob为true时把占位符的每一位替换为[0-9]，用来匹配所有日期的文件
+func renderFilenamePattern(pattern string, t time.Time, glob bool) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		if i+1 == len(pattern) {
+			return "", fmt.Errorf("log config: filename pattern %q ends with %%", pattern)
+		}
+		i++
+		if pattern[i] == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		layout, ok := filenamePatternLayouts[pattern[i]]
+		if !ok {
+			return "", fmt.Errorf("log config: unknown token %%%c in filename pattern %q, want %%Y, %%m, %%d or %%H", pattern[i], pattern)
+		}
+		if glob {
+			b.WriteString(strings.Repeat(globDigit, len(layout)))
+		} else {
+			b.WriteString(t.Format(layout))
+		}
+	}
+	return b.String(), nil
+}
+
+// validateFilenamePattern 检查FilenamePattern，至少要有一个占位符，否则与Filename没有区别。
+// 目录中不能有占位符，dailyDirs为true时只允许最后一级目录是%Y-%m-%d
+func validateFilenamePattern(pattern string, dailyDirs bool) error {
+	name, err := renderFilenamePattern(pattern, time.Time{}, true)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(name, globDigit) {
+		return fmt.Errorf("log config: filename pattern %q has no date token", pattern)
+	}
+	dir := filepath.Dir(name)
+	if dailyDirs && isDailyDirPattern(pattern) {
+		dir = filepath.Dir(dir)
+	}
+	if strings.Contains(dir, globDigit) {
+		return fmt.Errorf("log config: filename pattern %q must not put date tokens in the directory", pattern)
+	}
+	return nil
+}
+
+// isDailyDirPattern 判断pattern的最后一级目录是不是%Y-%m-%d
+func isDailyDirPattern(pattern string) bool {
+	return filepath.Base(filepath.Dir(pattern)) == dailyDirToken
+}
+
+// dailyDirsPattern 配置了DailyDirs时在文件名前插入%Y-%m-%d目录，FilenamePattern为空时以Filename为基础；
+// 已经插入过时原样返回。没有配置DailyDirs时返回FilenamePattern
+func (cfg LogConfig) dailyDirsPattern() string {
+	if !cfg.DailyDirs {
+		return cfg.FilenamePattern
+	}
+	pattern := cfg.FilenamePattern
+	if pattern == "" {
+		if cfg.Filename == "" {
+			return ""
+		}
+		pattern = strings.Replace(cfg.Filename, "%", "%%", -1)
+	}
+	if isDailyDirPattern(pattern) {
+		return pattern
+	}
+	return filepath.Join(filepath.Dir(pattern), dailyDirToken, filepath.Base(pattern))
+}
+
+// resolveFilenamePattern 配置了FilenamePattern时解析它的路径，并用clock的当前时间渲染出Filename
+func (cfg LogConfig) resolveFilenamePattern(clock Clock) (LogConfig, error) {
+	cfg.FilenamePattern = cfg.dailyDirsPattern()
+	if cfg.FilenamePattern == "" {
+		return cfg, nil
+	}
+	if err := validateFilenamePattern(cfg.FilenamePattern, cfg.DailyDirs); err != nil {
+		return cfg, err
+	}
+	pattern, err := resolveLogPath(cfg.FilenamePattern, cfg.BaseDir)
+	if err != nil {
+		return cfg, err
+	}
+	loc, err := loadTimeZone(cfg.TimeZone)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.FilenamePattern = pattern
+	cfg.Filename, err = renderFilenamePattern(pattern, clock.Now().In(loc), false)
+	return cfg, err
+}
+
+// datedFilename 跟踪FilenamePattern渲染出的文件名
+type datedFilename struct {
+	cfg     LogConfig // 已经解析过路径的配置，Filename为当前文件
+	clock   Clock
+	loc     *time.Location
+	hourly  bool      // 包含%H时每小时检查一次，否则每天检查一次
+	daily   bool      // DailyDirs，按目录清理并维护current链接
+	current string    // 当前写入的文件
+	next    time.Time // 下一次需要重新渲染文件名的时间
+}
+
+// newDatedFilename 按cfg创建，没有配置FilenamePattern时返回nil
+func newDatedFilename(cfg LogConfig, clock Clock) (*datedFilename, error) {
+	if cfg.FilenamePattern == "" {
+		return nil, nil
+	}
+	loc, err := loadTimeZone(cfg.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	d := &datedFilename{
+		cfg:     cfg,
+		clock:   clock,
+		loc:     loc,
+		hourly:  strings.Contains(strings.Replace(cfg.FilenamePattern, "%%", "", -1), "%H"),
+		daily:   cfg.DailyDirs && isDailyDirPattern(cfg.FilenamePattern),
+		current: cfg.Filename,
+	}
+	d.next = d.boundaryAfter(clock.Now())
+	if d.daily {
+		if err := d.linkCurrent(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// boundaryAfter 返回t之后文件名可能变化的第一个时间
+func (d *datedFilename) boundaryAfter(t time.Time) time.Time {
+	t = t.In(d.loc)
+	if d.hourly {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, d.loc)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, d.loc)
+}
+
+// due 到了重新渲染的时间并且文件名变了时返回新文件名，调用方需要加锁
+func (d *datedFilename) due() (string, bool) {
+	now := d.clock.Now()
+	if now.Before(d.next) {
+		return "", false
+	}
+	d.next = d.boundaryAfter(now)
+	name, err := renderFilenamePattern(d.cfg.FilenamePattern, now.In(d.loc), false)
+	if err != nil || name == d.current {
+		return "", false
+	}
+	return name, true
+}
+
+// switchTo 准备好新文件并返回它的配置
+func (d *datedFilename) switchTo(name string) (LogConfig, error) {
+	cfg := d.cfg
+	cfg.Filename = name
+	if err := prepareLogFile(cfg); err != nil {
+		return cfg, err
+	}
+	d.current = name
+	if d.daily {
+		return cfg, d.linkCurrent()
+	}
+	return cfg, nil
+}
+
+// linkCurrent 让current链接指向当前文件所在的目录。先创建临时链接再改名替换，
+// 替换过程中current一直存在，tail -F不会中断
+func (d *datedFilename) linkCurrent() error {
+	dir := filepath.Dir(d.current)
+	link := filepath.Join(filepath.Dir(dir), currentDirLink)
+	target := filepath.Base(dir)
+	if old, err := os.Readlink(link); err == nil && old == target {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(link), d.cfg.dirMode()); err != nil {
+		return fmt.Errorf("create log dir %s: %v", filepath.Dir(link), err)
+	}
+	tmp := link + ".tmp"
+	_ = os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return fmt.Errorf("link %s to %s: %v", link, target, err)
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("link %s to %s: %v", link, target, err)
+	}
+	return nil
+}
+
+// cleanupDirs 删除目录名的日期早于MaxAge天前的整个目录，当前目录不会被删除
+func (d *datedFilename) cleanupDirs() error {
+	if d.cfg.MaxAge == 0 {
+		return nil
+	}
+	dir := filepath.Dir(d.current)
+	root := filepath.Dir(dir)
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	now := d.clock.Now().In(d.loc)
+	cutoff := time.Date(now.Year(), now.Month(), now.Day()-d.cfg.MaxAge, 0, 0, 0, 0, d.loc)
+	var firstErr error
+	for _, e := range entries {
+		// ReadDir不跟随符号链接，current不是目录
+		if !e.IsDir() || e.Name() == filepath.Base(dir) {
+			continue
+		}
+		day, err := time.ParseInLocation(dailyDirLayout, e.Name(), d.loc)
+		if err != nil || !day.Before(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, e.Name())); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// datedFileNames 返回匹配pattern的所有日期文件，以及lumberjack从它们切割出的备份（如app-2024-01-01-2024-01-01T12-00-00.000.log.gz）
+func datedFileNames(pattern string) (map[string]bool, error) {
+	glob, err := renderFilenamePattern(pattern, time.Time{}, true)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, g := range withCompressedSuffixes(glob) {
+		matches, err := filepath.Glob(g)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range matches {
+			names[name] = true
+			if g != glob {
+				continue
+			}
+			for backup := range backupNames(name) {
+				names[backup] = true
+			}
+		}
+	}
+	return names, nil
+}
+
+// cleanup 按MaxBackups和MaxAge删除匹配FilenamePattern的旧文件，当前文件不会被删除；
+// DailyDirs时改为按MaxAge删除过期的目录
+func (d *datedFilename) cleanup() error {
+	if d.daily {
+		return d.cleanupDirs()
+	}
+	if d.cfg.MaxBackups == 0 && d.cfg.MaxAge == 0 {
+		return nil
+	}
+	names, err := datedFileNames(d.cfg.FilenamePattern)
+	if err != nil {
+		return err
+	}
+	// 当前文件的备份由lumberjack按MaxBackups和MaxAge清理
+	current := backupNames(d.current)
+	type oldFile struct {
+		name    string
+		modTime time.Time
+	}
+	var files []oldFile
+	for name := range names {
+		if name == d.current || current[name] {
+			continue
+		}
+		if info, err := os.Stat(name); err == nil && !info.IsDir() {
+			files = append(files, oldFile{name, info.ModTime()})
+		}
+	}
+	// 新的在前，修改时间相同时按文件名，日期靠后的文件名也靠后
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].modTime.Equal(files[j].modTime) {
+			return files[i].modTime.After(files[j].modTime)
+		}
+		return files[i].name > files[j].name
+	})
+
+	cutoff := d.clock.Now().Add(-time.Duration(d.cfg.MaxAge) * 24 * time.Hour)
+	var firstErr error
+	for i, f := range files {
+		tooMany := d.cfg.MaxBackups > 0 && i >= d.cfg.MaxBackups
+		tooOld := d.cfg.MaxAge > 0 && f.modTime.Before(cutoff)
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := os.Remove(f.name); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
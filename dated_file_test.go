@@ -0,0 +1,333 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newDatedLogger 用clock构建按FilenamePattern写入临时目录的logger，返回目录
+func newDatedLogger(t *testing.T, clock Clock, pattern string, modify func(cfg *LogConfig)) (*builtLogger, string) {
+	t.Helper()
+	var dir string
+	b, _ := newClockedFileLogger(t, clock, func(cfg *LogConfig) {
+		dir = filepath.Dir(cfg.Filename)
+		cfg.Filename = ""
+		cfg.FilenamePattern = filepath.Join(dir, pattern)
+		modify(cfg)
+	})
+	return b, dir
+}
+
+// dirNames 返回dir下按名字排序的文件名
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	f, err := os.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// seedFile 写一个修改时间为modTime的文件
+func seedFile(t *testing.T, path string, size int, modTime time.Time) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFilenamePatternSwitchesOnDateChange(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 5, 17, 23, 59, 58, 0, time.UTC))
+	b, dir := newDatedLogger(t, clock, "app-%Y-%m-%d.log", func(*LogConfig) {})
+
+	b.logger.Info("day one")
+	clock.Add(time.Second)
+	b.logger.Info("day one, last second")
+	if got := dirNames(t, dir); strings.Join(got, ",") != "app-2024-05-17.log" {
+		t.Fatalf("files before midnight = %v", got)
+	}
+
+	clock.Add(2 * time.Second)
+	b.logger.Info("day two")
+	if got := dirNames(t, dir); strings.Join(got, ",") != "app-2024-05-17.log,app-2024-05-18.log" {
+		t.Fatalf("files after midnight = %v", got)
+	}
+	old := readFile(t, filepath.Join(dir, "app-2024-05-17.log"))
+	if !strings.Contains(old, "day one, last second") || strings.Contains(old, "day two") {
+		t.Errorf("previous day's file:\n%s", old)
+	}
+	if cur := readFile(t, filepath.Join(dir, "app-2024-05-18.log")); !strings.Contains(cur, "day two") || strings.Contains(cur, "day one") {
+		t.Errorf("new day's file:\n%s", cur)
+	}
+	if b.file.dated.current != filepath.Join(dir, "app-2024-05-18.log") {
+		t.Errorf("current = %q", b.file.dated.current)
+	}
+}
+
+func TestFilenamePatternHourly(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 5, 17, 10, 59, 0, 0, time.UTC))
+	b, dir := newDatedLogger(t, clock, "app-%Y%m%d%H.log", func(*LogConfig) {})
+	b.logger.Info("ten")
+	clock.Add(2 * time.Minute)
+	b.logger.Info("eleven")
+	if got := dirNames(t, dir); strings.Join(got, ",") != "app-2024051710.log,app-2024051711.log" {
+		t.Errorf("files = %v", got)
+	}
+}
+
+func TestFilenamePatternCleanupAcrossDatedFiles(t *testing.T) {
+	start := time.Date(2024, 5, 17, 23, 59, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	b, dir := newDatedLogger(t, clock, "app-%Y-%m-%d.log", func(cfg *LogConfig) {
+		cfg.MaxBackups = 2
+		cfg.Compress = false
+	})
+	// 之前几天留下的文件，包括压缩过的，修改时间越新日期越靠后
+	for i, name := range []string{
+		"app-2024-05-13.log.gz",
+		"app-2024-05-14.log",
+		"app-2024-05-15.log",
+		"app-2024-05-16.log",
+	} {
+		seedFile(t, filepath.Join(dir, name), 10, start.Add(time.Duration(i-10)*time.Hour))
+	}
+	unrelated := filepath.Join(dir, "other-2024-05-01.log")
+	seedFile(t, unrelated, 10, start.Add(-30*24*time.Hour))
+
+	b.logger.Info("day one")
+	clock.Add(2 * time.Minute)
+	b.logger.Info("day two")
+
+	want := []string{
+		"app-2024-05-16.log", // 旧文件中最新的两个
+		"app-2024-05-17.log",
+		"app-2024-05-18.log", // 当前文件不计入MaxBackups
+		"other-2024-05-01.log",
+	}
+	if got := dirNames(t, dir); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+}
+
+func TestFilenamePatternCleanupBackupsOfOldDays(t *testing.T) {
+	start := time.Date(2024, 5, 17, 23, 59, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	b, dir := newDatedLogger(t, clock, "app-%Y-%m-%d.log", func(cfg *LogConfig) {
+		cfg.MaxBackups = 3
+		cfg.MaxAge = 0
+		cfg.Compress = false
+	})
+	// 前几天的日期文件和lumberjack从它们切割出的备份
+	for i, name := range []string{
+		"app-2024-05-15-2024-05-15T08-00-00.000.log.gz",
+		"app-2024-05-15.log",
+		"app-2024-05-16-2024-05-16T08-00-00.000.log.zst",
+		"app-2024-05-16-2024-05-16T12-00-00.000.log",
+		"app-2024-05-16.log",
+	} {
+		seedFile(t, filepath.Join(dir, name), 10, start.Add(time.Duration(i-10)*time.Hour))
+	}
+
+	b.logger.Info("day one")
+	clock.Add(2 * time.Minute)
+	b.logger.Info("day two")
+
+	// 备份和日期文件一起按修改时间排序，只留下最新的三个
+	names := dirNames(t, dir)
+	want := []string{
+		"app-2024-05-16-2024-05-16T12-00-00.000.log",
+		"app-2024-05-16.log",
+		"app-2024-05-17.log",
+		"app-2024-05-18.log",
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("files = %v, want %v", names, want)
+	}
+}
+
+func TestFilenamePatternTotalSizeIncludesBackupsOfOldDays(t *testing.T) {
+	start := time.Date(2024, 5, 17, 23, 59, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	b, dir := newDatedLogger(t, clock, "app-%Y-%m-%d.log", func(cfg *LogConfig) {
+		cfg.MaxTotalSizeMB = 1
+		cfg.MaxBackups = 0
+		cfg.MaxAge = 0
+	})
+	oldest := filepath.Join(dir, "app-2024-05-16-2024-05-16T08-00-00.000.log.gz")
+	seedFile(t, oldest, 600*1024, start.Add(-10*time.Hour))
+	seedFile(t, filepath.Join(dir, "app-2024-05-16.log"), 600*1024, start.Add(-5*time.Hour))
+
+	b.logger.Info("day one")
+	clock.Add(2 * time.Minute)
+	b.logger.Info("day two")
+
+	if _, err := os.Stat(oldest); !os.IsNotExist(err) {
+		t.Errorf("the backup of an earlier day should count toward MaxTotalSizeMB, files = %v", dirNames(t, dir))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app-2024-05-16.log")); err != nil {
+		t.Errorf("only the oldest file needs to go: %v", err)
+	}
+}
+
+func TestFilenamePatternMaxAge(t *testing.T) {
+	start := time.Date(2024, 5, 17, 23, 59, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	b, dir := newDatedLogger(t, clock, "app-%Y-%m-%d.log", func(cfg *LogConfig) {
+		cfg.MaxBackups = 0
+		cfg.MaxAge = 3
+	})
+	seedFile(t, filepath.Join(dir, "app-2024-05-10.log"), 10, start.Add(-7*24*time.Hour))
+	seedFile(t, filepath.Join(dir, "app-2024-05-16.log"), 10, start.Add(-24*time.Hour))
+
+	b.logger.Info("day one")
+	clock.Add(2 * time.Minute)
+	b.logger.Info("day two")
+
+	want := "app-2024-05-16.log,app-2024-05-17.log,app-2024-05-18.log"
+	if got := dirNames(t, dir); strings.Join(got, ",") != want {
+		t.Errorf("files = %v, want %s", got, want)
+	}
+}
+
+func TestRenderFilenamePattern(t *testing.T) {
+	at := time.Date(2024, 5, 7, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		pattern string
+		want    string
+		glob    string
+		wantErr string
+	}{
+		{pattern: "app-%Y-%m-%d.log", want: "app-2024-05-07.log", glob: "app-[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9].log"},
+		{pattern: "app-%Y%m%d%H.log", want: "app-2024050709.log"},
+		{pattern: "100%%-%d.log", want: "100%-07.log", glob: "100%-[0-9][0-9].log"},
+		{pattern: "app-%Y-%j.log", wantErr: "unknown token %j"},
+		{pattern: "app-%Y%", wantErr: "ends with %"},
+	}
+	for _, tt := range tests {
+		got, err := renderFilenamePattern(tt.pattern, at, false)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("renderFilenamePattern(%q) error = %v, want %q", tt.pattern, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("renderFilenamePattern(%q) = %q, %v, want %q", tt.pattern, got, err, tt.want)
+		}
+		if tt.glob == "" {
+			continue
+		}
+		if glob, _ := renderFilenamePattern(tt.pattern, at, true); glob != tt.glob {
+			t.Errorf("glob of %q = %q, want %q", tt.pattern, glob, tt.glob)
+		}
+	}
+}
+
+func TestValidateFilenamePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr string
+	}{
+		{pattern: "logs/app-%Y-%m-%d.log"},
+		{pattern: "logs/app.log", wantErr: "has no date token"},
+		{pattern: "logs/100%%.log", wantErr: "has no date token"},
+		{pattern: "logs-%Y/app-%d.log", wantErr: "must not put date tokens in the directory"},
+	}
+	for _, tt := range tests {
+		err := validateFilenamePattern(tt.pattern, false)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("validateFilenamePattern(%q) = %v, want %q", tt.pattern, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDailyDirsCrossingTwoMidnights(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 5, 17, 23, 59, 59, 0, time.UTC))
+	var root string
+	b, _ := newClockedFileLogger(t, clock, func(cfg *LogConfig) {
+		root = filepath.Dir(cfg.Filename)
+		cfg.Filename = filepath.Join(root, "app.log")
+		cfg.DailyDirs = true
+		cfg.MaxAge = 1
+	})
+	// 过期的目录整个删除，不是日期的目录不动
+	if err := os.MkdirAll(filepath.Join(root, "2024-05-01"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	seedFile(t, filepath.Join(root, "2024-05-01", "app.log"), 10, clock.Now().Add(-16*24*time.Hour))
+	if err := os.MkdirAll(filepath.Join(root, "archive"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	link := filepath.Join(root, currentDirLink)
+	checkCurrent := func(day string) {
+		t.Helper()
+		if target, err := os.Readlink(link); err != nil || target != day {
+			t.Errorf("current -> %q (%v), want %s", target, err, day)
+		}
+		if !strings.Contains(readFile(t, filepath.Join(link, "app.log")), "on "+day) {
+			t.Errorf("current/app.log does not contain the %s entry", day)
+		}
+	}
+
+	b.logger.Info("on 2024-05-17")
+	checkCurrent("2024-05-17")
+	clock.Add(2 * time.Second)
+	b.logger.Info("on 2024-05-18")
+	checkCurrent("2024-05-18")
+	clock.Add(24 * time.Hour)
+	b.logger.Info("on 2024-05-19")
+	checkCurrent("2024-05-19")
+
+	// MaxAge为1天：05-18还在，05-17和05-01已经过期
+	want := "2024-05-18,2024-05-19,archive,current"
+	if got := dirNames(t, root); strings.Join(got, ",") != want {
+		t.Errorf("dirs = %v, want %s", got, want)
+	}
+	day18 := readFile(t, filepath.Join(root, "2024-05-18", "app.log"))
+	if !strings.Contains(day18, "on 2024-05-18") || strings.Contains(day18, "on 2024-05-19") {
+		t.Errorf("2024-05-18/app.log:\n%s", day18)
+	}
+}
+
+func TestDailyDirsPattern(t *testing.T) {
+	tests := []struct {
+		cfg  LogConfig
+		want string
+	}{
+		{cfg: LogConfig{Filename: "logs/app.log"}, want: ""},
+		{cfg: LogConfig{Filename: "logs/app.log", DailyDirs: true}, want: filepath.Join("logs", dailyDirToken, "app.log")},
+		{cfg: LogConfig{Filename: "logs/100%.log", DailyDirs: true}, want: filepath.Join("logs", dailyDirToken, "100%%.log")},
+		{cfg: LogConfig{FilenamePattern: "logs/app-%H.log", DailyDirs: true}, want: filepath.Join("logs", dailyDirToken, "app-%H.log")},
+		{cfg: LogConfig{FilenamePattern: "logs/%Y-%m-%d/app.log", DailyDirs: true}, want: "logs/%Y-%m-%d/app.log"},
+		{cfg: LogConfig{DailyDirs: true}, want: ""},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.dailyDirsPattern(); got != tt.want {
+			t.Errorf("%+v: dailyDirsPattern() = %q, want %q", tt.cfg, got, tt.want)
+		}
+	}
+	if err := validateFilenamePattern("logs/%Y-%m-%d/app.log", true); err != nil {
+		t.Errorf("daily dir pattern should be valid: %v", err)
+	}
+	if err := validateFilenamePattern("logs/%Y-%m-%d/app.log", false); err == nil {
+		t.Error("date tokens in the directory need DailyDirs")
+	}
+	if err := validateFilenamePattern("logs/%Y/%Y-%m-%d/app.log", true); err == nil {
+		t.Error("only the last directory may be the date")
+	}
+}
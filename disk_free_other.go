@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package main
+
+import "errors"
+
+// statDiskFree 其他系统上不支持，LowDisk不会降级
+func statDiskFree(dir string) (uint64, error) {
+	return 0, errors.New("disk free space is not supported on this platform")
+}
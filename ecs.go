@@ -0,0 +1,115 @@
+package main
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+ECS（Elastic Common Schema）
+日志进Elastic时按ECS的字段名：配置ECS后Encoder的key改为@timestamp、log.level、message等，
+服务和主机字段改为service.name、host.hostname等，并带上ecs.version。
+全局logger开启ECS时，GinLogger的字段按ECS嵌套输出：
+	{"http":{"request":{"method":"GET"},"response":{"status_code":200}},"url":{"path":"/hello","query":""},
+	 "client":{"ip":"1.2.3.4"},"user_agent":{"original":"curl/8.0"},"event":{"duration":12000000}}
+event.duration按ECS的约定是纳秒，zap.Error的error字段改名为error.message。
+c.Errors与普通输出一样用GinErrorsField记录为errors数组。
+*/
+
+// ecsVersion 输出的ecs.version
+const ecsVersion = "1.12.0"
+
+// applyECSKeys 把EncoderConfig的key改为ECS的字段名，级别使用小写
+func applyECSKeys(encoderConfig *zapcore.EncoderConfig) {
+	encoderConfig.TimeKey = "@timestamp"
+	encoderConfig.LevelKey = "log.level"
+	encoderConfig.MessageKey = "message"
+	encoderConfig.NameKey = "log.logger"
+	encoderConfig.CallerKey = "log.origin.file.name"
+	encoderConfig.StacktraceKey = "error.stack_trace"
+	if encoderConfig.FunctionKey != "" {
+		encoderConfig.FunctionKey = "log.origin.function"
+	}
+	encoderConfig.EncodeLevel = zapcore.LowercaseLevelEncoder
+}
+
+// ecsServiceFields 与serviceFields相同的信息，使用ECS的字段名
+func ecsServiceFields(cfg LogConfig, version string) []zap.Field {
+	fields := []zap.Field{zap.String("ecs.version", ecsVersion)}
+	if cfg.ServiceName != "" {
+		fields = append(fields, zap.String("service.name", cfg.ServiceName))
+	}
+	if version != "" {
+		fields = append(fields, zap.String("service.version", version))
+	}
+	if cfg.Env != "" {
+		fields = append(fields, zap.String("service.environment", cfg.Env))
+	}
+	if cfg.HostInfo {
+		host, pid := hostInfo()
+		fields = append(fields, zap.String("host.hostname", host), zap.Int("process.pid", pid))
+	}
+	return fields
+}
+
+// ecsObject 用键值对生成嵌套的对象字段
+type ecsObject []zap.Field
+
+func (o ecsObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, f := range o {
+		f.AddTo(enc)
+	}
+	return nil
+}
+
+// ecsAccessFields 按ECS生成GinLogger的字段，c.Errors由GinLogger另外用GinErrorsField记录
+func ecsAccessFields(status int, method, path, query, ip, userAgent string, cost time.Duration) []zap.Field {
+	return []zap.Field{
+		zap.Object("http", ecsObject{
+			zap.Object("request", ecsObject{zap.String("method", method)}),
+			zap.Object("response", ecsObject{zap.Int("status_code", status)}),
+		}),
+		zap.Object("url", ecsObject{zap.String("path", path), zap.String("query", query)}),
+		zap.Object("client", ecsObject{zap.String("ip", ip)}),
+		zap.Object("user_agent", ecsObject{zap.String("original", userAgent)}),
+		zap.Object("event", ecsObject{zap.Int64("duration", cost.Nanoseconds())}),
+	}
+}
+
+// ecsEncoder 把zap.Error产生的error字段改名为error.message，ECS里error是一个对象
+type ecsEncoder struct {
+	zapcore.Encoder
+}
+
+func (enc ecsEncoder) Clone() zapcore.Encoder {
+	return ecsEncoder{enc.Encoder.Clone()}
+}
+
+func (enc ecsEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	var renamed []zapcore.Field
+	for i, f := range fields {
+		if f.Type != zapcore.ErrorType || f.Key != "error" {
+			continue
+		}
+		if renamed == nil {
+			renamed = append([]zapcore.Field(nil), fields...)
+		}
+		renamed[i].Key = "error.message"
+	}
+	if renamed != nil {
+		fields = renamed
+	}
+	return enc.Encoder.EncodeEntry(ent, fields)
+}
+
+// withECS cfg开启ECS时包装enc
+func withECS(enc zapcore.Encoder, cfg LogConfig) zapcore.Encoder {
+	if !cfg.ECS {
+		return enc
+	}
+	return ecsEncoder{enc}
+}
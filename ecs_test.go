@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestECSGinLoggerGolden(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Encoding = EncodingJSON
+	cfg.ECS = true
+	want := `{"log.level":"info","@timestamp":"2024-05-17T10:00:00.025Z","message":"/users","ecs.version":"1.12.0",` +
+		`"http":{"request":{"method":"GET"},"response":{"status_code":200}},"url":{"path":"/users","query":"page=2"},` +
+		`"client":{"ip":"10.0.0.1"},"user_agent":{"original":"test-agent"},"event":{"duration":25000000}}`
+	if got := ginAccessLine(t, cfg, GinLoggerConfig{ECS: true}); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestECSApplicationLogGolden(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Encoding = EncodingJSON
+	cfg.TimeZone = "utc"
+	cfg.DisableCaller = true
+	cfg.ECS = true
+	cfg.ServiceName = "orders"
+	cfg.ServiceVersion = "1.2.3"
+	cfg.Env = "prod"
+	want := `{"log.level":"info","@timestamp":"2024-05-17T10:00:00.000Z","message":"hello","ecs.version":"1.12.0",` +
+		`"service.name":"orders","service.version":"1.2.3","service.environment":"prod","error.message":"db down","order_id":7}`
+	if got := encodeLine(t, cfg, zap.Error(errors.New("db down")), zap.Int("order_id", 7)); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+// ecsKeyPaths 返回JSON对象中所有叶子的点号路径
+func ecsKeyPaths(prefix string, v interface{}, paths map[string]interface{}) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		paths[prefix] = v
+		return
+	}
+	for k, child := range m {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		ecsKeyPaths(k, child, paths)
+	}
+}
+
+func TestECSKeyPaths(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Encoding = EncodingJSON
+	cfg.ECS = true
+	var entry interface{}
+	if err := json.Unmarshal([]byte(ginAccessLine(t, cfg, GinLoggerConfig{ECS: true})), &entry); err != nil {
+		t.Fatal(err)
+	}
+	paths := make(map[string]interface{})
+	ecsKeyPaths("", entry, paths)
+	for _, key := range []string{
+		"@timestamp", "log.level", "message", "ecs.version",
+		"http.request.method", "http.response.status_code", "url.path", "client.ip",
+		"user_agent.original", "event.duration",
+	} {
+		if _, ok := paths[key]; !ok {
+			t.Errorf("missing ECS key %s in %v", key, paths)
+		}
+	}
+	for _, key := range []string{"status", "method", "path", "ip", "cost", "level", "msg", "ts"} {
+		if _, ok := paths[key]; ok {
+			t.Errorf("non-ECS key %s present", key)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+写入Elasticsearch
+配置Elasticsearch后，日志用JSON Encoder编码（ECS为true时就是ECS格式），攒够FlushSize条或者每隔FlushInterval
+通过_bulk接口写入一次，index名按Index中的Go时间格式用日志时间替换，如app-logs-2006.01.02。
+它与日志文件一起输出（zapcore.NewTee），日志文件仍然是完整的记录。日志先进入异步写入的队列（见async.go），不会阻塞请求。
+_bulk返回的单条失败计入ElasticsearchFailed；429、5xx以及整个请求失败时重新排队，最多重试MaxRetries次，
+其他失败（如mapping错误）和重试用完的文档直接丢弃，计入ElasticsearchDropped，队列满时丢弃的文档也计入。
+*/
+
+// 写入Elasticsearch的默认值
+const (
+	defaultESIndex         = "app-logs-2006.01.02"
+	defaultESFlushSize     = 500
+	defaultESFlushInterval = 5 * time.Second
+	defaultESMaxRetries    = 3
+	defaultESTimeout       = 10 * time.Second
+)
+
+// ElasticsearchConfig 写入Elasticsearch的配置，为0的项使用默认值
+type ElasticsearchConfig struct {
+	URL           string        `yaml:"url" json:"url"`                       // 如http://elasticsearch:9200
+	Index         string        `yaml:"index" json:"index"`                   // index名，其中的Go时间格式按日志时间替换，默认app-logs-2006.01.02
+	FlushSize     int           `yaml:"flush_size" json:"flush_size"`         // 攒够多少条写入一次，默认500
+	FlushInterval time.Duration `yaml:"flush_interval" json:"flush_interval"` // 最多隔多久写入一次，默认5秒
+	MaxRetries    int           `yaml:"max_retries" json:"max_retries"`       // 每条文档最多重新排队的次数，默认3
+	Username      string        `yaml:"username" json:"username"`             // 不为空时使用Basic认证
+	Password      string        `yaml:"password" json:"password"`
+	Timeout       time.Duration `yaml:"timeout" json:"timeout"`       // 每次请求的超时，默认10秒
+	QueueSize     int           `yaml:"queue_size" json:"queue_size"` // 异步队列的长度，默认1024
+}
+
+func (e ElasticsearchConfig) validate() error {
+	if !strings.HasPrefix(e.URL, "http://") && !strings.HasPrefix(e.URL, "https://") {
+		return fmt.Errorf("log config: elasticsearch url must start with http:// or https://, got %q", e.URL)
+	}
+	if e.FlushSize < 0 || e.MaxRetries < 0 || e.QueueSize < 0 {
+		return fmt.Errorf("log config: elasticsearch flush size, max retries and queue size must not be negative")
+	}
+	if e.FlushInterval < 0 || e.Timeout < 0 {
+		return fmt.Errorf("log config: elasticsearch flush interval and timeout must not be negative")
+	}
+	if strings.ContainsAny(e.Index, "\n\"") {
+		return fmt.Errorf("log config: elasticsearch index %q must not contain newlines or quotes", e.Index)
+	}
+	return nil
+}
+
+func (e ElasticsearchConfig) withDefaults() ElasticsearchConfig {
+	if e.Index == "" {
+		e.Index = defaultESIndex
+	}
+	if e.FlushSize == 0 {
+		e.FlushSize = defaultESFlushSize
+	}
+	if e.FlushInterval == 0 {
+		e.FlushInterval = defaultESFlushInterval
+	}
+	if e.MaxRetries == 0 {
+		e.MaxRetries = defaultESMaxRetries
+	}
+	if e.Timeout == 0 {
+		e.Timeout = defaultESTimeout
+	}
+	return e
+}
+
+// esFailed _bulk返回失败的文档数（每次失败都算），esDropped 最终没有写入而丢弃的文档数
+var esFailed, esDropped uint64
+
+// ElasticsearchFailed 返回到目前为止写入Elasticsearch失败的次数，重新排队后又失败的文档会再算一次
+func ElasticsearchFailed() uint64 {
+	return atomic.LoadUint64(&esFailed)
+}
+
+// ElasticsearchDropped 返回到目前为止最终没有写入Elasticsearch而丢弃的文档数
+func ElasticsearchDropped() uint64 {
+	return atomic.LoadUint64(&esDropped)
+}
+
+// esDoc 等待写入的一条文档
+type esDoc struct {
+	index    string
+	source   []byte
+	attempts int // 已经失败的次数
+}
+
+// esBulkResponse _bulk响应中需要的部分
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// esBulker 攒批并通过_bulk写入。经过异步队列写入的每一项是：index名、换行、一行JSON
+type esBulker struct {
+	cfg    ElasticsearchConfig
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	pending []esDoc
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newESBulker(cfg ElasticsearchConfig) *esBulker {
+	cfg = cfg.withDefaults()
+	b := &esBulker{
+		cfg:    cfg,
+		url:    strings.TrimSuffix(cfg.URL, "/") + "/_bulk",
+		client: &http.Client{Timeout: cfg.Timeout},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// run 每隔FlushInterval写入一次
+func (b *esBulker) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+		_ = b.Sync()
+	}
+}
+
+func (b *esBulker) Write(p []byte) (int, error) {
+	i := bytes.IndexByte(p, '\n')
+	if i < 0 {
+		return 0, fmt.Errorf("elasticsearch: entry without index")
+	}
+	doc := esDoc{index: string(p[:i]), source: append([]byte(nil), p[i+1:]...)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, doc)
+	if len(b.pending) >= b.cfg.FlushSize {
+		return len(p), b.flushLocked()
+	}
+	return len(p), nil
+}
+
+// Sync 立即写入攒着的文档
+func (b *esBulker) Sync() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushLocked()
+}
+
+// Close 停止定期写入，并写入剩下的文档，这时失败的文档不再重试
+func (b *esBulker) Close() error {
+	close(b.stop)
+	<-b.done
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.flushLocked()
+	if n := len(b.pending); n > 0 {
+		atomic.AddUint64(&esDropped, uint64(n))
+		b.pending = nil
+	}
+	return err
+}
+
+// flushLocked 写入pending中的文档，需要重试的文档放回pending
+func (b *esBulker) flushLocked() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	docs := b.pending
+	b.pending = nil
+	var body bytes.Buffer
+	for _, doc := range docs {
+		fmt.Fprintf(&body, "{\"index\":{\"_index\":%q}}\n", doc.index)
+		body.Write(doc.source)
+		body.WriteByte('\n')
+	}
+	resp, err := b.bulk(body.Bytes())
+	if err != nil {
+		// 整个请求失败，全部重新排队
+		atomic.AddUint64(&esFailed, uint64(len(docs)))
+		for _, doc := range docs {
+			b.requeueLocked(doc)
+		}
+		return err
+	}
+	if !resp.Errors {
+		return nil
+	}
+	var failed int
+	for i, item := range resp.Items {
+		if i >= len(docs) {
+			break
+		}
+		for _, result := range item {
+			if result.Status < 300 {
+				continue
+			}
+			failed++
+			atomic.AddUint64(&esFailed, 1)
+			if result.Status == http.StatusTooManyRequests || result.Status >= 500 {
+				b.requeueLocked(docs[i])
+			} else {
+				atomic.AddUint64(&esDropped, 1)
+			}
+		}
+	}
+	return fmt.Errorf("elasticsearch: %d of %d documents failed", failed, len(docs))
+}
+
+// requeueLocked 把失败的文档放回pending，超过MaxRetries时丢弃
+func (b *esBulker) requeueLocked(doc esDoc) {
+	doc.attempts++
+	if doc.attempts > b.cfg.MaxRetries {
+		atomic.AddUint64(&esDropped, 1)
+		return
+	}
+	b.pending = append(b.pending, doc)
+}
+
+// bulk POST body到_bulk，返回解析后的响应
+func (b *esBulker) bulk(body []byte) (*esBulkResponse, error) {
+	req, err := http.NewRequest(http.MethodPost, b.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if b.cfg.Username != "" {
+		req.SetBasicAuth(b.cfg.Username, b.cfg.Password)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("elasticsearch: bulk returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var result esBulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("elasticsearch: decode bulk response: %v", err)
+	}
+	return &result, nil
+}
+
+// esCore 编码后把index名和文档一起写进异步队列，由esBulker写入
+type esCore struct {
+	zapcore.LevelEnabler
+	enc   zapcore.Encoder
+	index string
+	ws    zapcore.WriteSyncer
+}
+
+// newESCore 按cfg创建写入Elasticsearch的core，enc需要是JSON Encoder；
+// 返回的io.Closer先写完队列再写入剩下的文档
+func newESCore(cfg ElasticsearchConfig, enc zapcore.Encoder, level zapcore.LevelEnabler) (zapcore.Core, io.Closer) {
+	cfg = cfg.withDefaults()
+	bulker := newESBulker(cfg)
+	async := newAsyncWriteSyncer(bulker, AsyncConfig{QueueSize: cfg.QueueSize, DrainTimeout: cfg.Timeout}, &esDropped)
+	return &esCore{LevelEnabler: level, enc: enc, index: cfg.Index, ws: async}, &esCloser{async, bulker}
+}
+
+func (c *esCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &esCore{LevelEnabler: c.LevelEnabler, enc: enc, index: c.index, ws: c.ws}
+}
+
+func (c *esCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *esCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	doc := bytes.TrimRight(buf.Bytes(), "\r\n")
+	b := make([]byte, 0, len(c.index)+1+len(doc))
+	b = append(ent.Time.AppendFormat(b, c.index), '\n')
+	b = append(b, doc...)
+	buf.Free()
+	_, err = c.ws.Write(b)
+	return err
+}
+
+func (c *esCore) Sync() error {
+	return c.ws.Sync()
+}
+
+// esCloser 先把异步队列写完，再写入剩下的文档
+type esCloser struct {
+	async  *asyncWriteSyncer
+	bulker *esBulker
+}
+
+func (c *esCloser) Close() error {
+	return multierr.Append(c.async.Close(), c.bulker.Close())
+}
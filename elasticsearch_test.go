@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// esBulkAction _bulk请求中的一对action和文档
+type esBulkAction struct {
+	index string
+	doc   map[string]interface{}
+}
+
+// esServer 本地的Elasticsearch。results依次决定每个请求的处理：
+// 为负数时整个请求返回对应的HTTP状态码，否则是逐条文档的状态码，用完之后全部返回201
+type esServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	results  [][]int
+	requests [][]esBulkAction
+	auth     []string
+}
+
+func startESServer(t *testing.T, results ...[]int) *esServer {
+	t.Helper()
+	s := &esServer{results: results}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("unexpected request %s %s (%s)", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		actions := parseBulkBody(t, body)
+		user, pass, _ := r.BasicAuth()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, actions)
+		s.auth = append(s.auth, user+":"+pass)
+		var statuses []int
+		if len(s.results) > 0 {
+			statuses, s.results = s.results[0], s.results[1:]
+		}
+		if len(statuses) == 1 && statuses[0] < 0 {
+			http.Error(w, "cluster unavailable", -statuses[0])
+			return
+		}
+		resp := esBulkResponse{}
+		for i := range actions {
+			status := http.StatusCreated
+			if i < len(statuses) {
+				status = statuses[i]
+			}
+			item := map[string]struct {
+				Status int             `json:"status"`
+				Error  json.RawMessage `json:"error"`
+			}{"index": {Status: status}}
+			if status >= 300 {
+				resp.Errors = true
+			}
+			resp.Items = append(resp.Items, item)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// parseBulkBody 检查_bulk请求体的格式：每条文档前一行action，每行都以换行结尾
+func parseBulkBody(t *testing.T, body []byte) []esBulkAction {
+	t.Helper()
+	if !bytes.HasSuffix(body, []byte("\n")) {
+		t.Errorf("bulk body must end with a newline: %q", body)
+	}
+	var actions []esBulkAction
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	for sc.Scan() {
+		var action struct {
+			Index struct {
+				Index string `json:"_index"`
+			} `json:"index"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &action); err != nil || action.Index.Index == "" {
+			t.Errorf("bad action line %q", sc.Text())
+		}
+		if !sc.Scan() {
+			t.Errorf("action without document in %q", body)
+			break
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(sc.Bytes(), &doc); err != nil {
+			t.Errorf("bad document line %q", sc.Text())
+		}
+		actions = append(actions, esBulkAction{index: action.Index.Index, doc: doc})
+	}
+	return actions
+}
+
+// bulks 返回收到的每个请求中各文档的msg
+func (s *esServer) bulks() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, actions := range s.requests {
+		var msgs []string
+		for _, a := range actions {
+			msgs = append(msgs, fmt.Sprint(a.doc["msg"]))
+		}
+		out = append(out, strings.Join(msgs, ","))
+	}
+	return out
+}
+
+// newTestESLogger 用JSON Encoder创建只写入Elasticsearch的logger。logger的Sync等异步队列写完后写入一次，
+// 返回的bulker可以跳过队列直接重试排队的文档
+func newTestESLogger(t *testing.T, cfg ElasticsearchConfig) (*zap.Logger, *esBulker, func() error) {
+	t.Helper()
+	encCfg := zap.NewProductionEncoderConfig()
+	encCfg.TimeKey = ""
+	core, closer := newESCore(cfg, zapcore.NewJSONEncoder(encCfg), zapcore.DebugLevel)
+	closed := false
+	closeOnce := func() error {
+		if closed {
+			return nil
+		}
+		closed = true
+		return closer.Close()
+	}
+	t.Cleanup(func() { closeOnce() })
+	return zap.New(core), closer.(*esCloser).bulker, closeOnce
+}
+
+func TestESBulkFraming(t *testing.T) {
+	s := startESServer(t)
+	l, _, _ := newTestESLogger(t, ElasticsearchConfig{URL: s.URL + "/", Index: "app-logs-2006.01.02", FlushInterval: time.Hour, Username: "elastic", Password: "secret"})
+	day1 := time.Date(2024, 5, 17, 23, 59, 59, 0, time.UTC)
+	for i, ts := range []time.Time{day1, day1.Add(2 * time.Second)} {
+		if ce := l.Check(zapcore.InfoLevel, fmt.Sprintf("entry %d", i)); ce != nil {
+			ce.Time = ts
+			ce.Write(zap.String("path", "/users"), zap.String("quote", `a "quoted" value`))
+		}
+	}
+	if err := l.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) != 1 || len(s.requests[0]) != 2 {
+		t.Fatalf("requests = %+v, want one bulk with two documents", s.requests)
+	}
+	for i, want := range []string{"app-logs-2024.05.17", "app-logs-2024.05.18"} {
+		a := s.requests[0][i]
+		if a.index != want {
+			t.Errorf("document %d index = %s, want %s", i, a.index, want)
+		}
+		if a.doc["msg"] != fmt.Sprintf("entry %d", i) || a.doc["path"] != "/users" || a.doc["quote"] != `a "quoted" value` {
+			t.Errorf("document %d = %v", i, a.doc)
+		}
+	}
+	if s.auth[0] != "elastic:secret" {
+		t.Errorf("basic auth = %q", s.auth[0])
+	}
+}
+
+func TestESFlushSize(t *testing.T) {
+	s := startESServer(t)
+	l, _, _ := newTestESLogger(t, ElasticsearchConfig{URL: s.URL, FlushSize: 2, FlushInterval: time.Hour})
+	for i := 0; i < 5; i++ {
+		l.Info(fmt.Sprint(i))
+	}
+	if err := l.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(s.bulks(), " | "); got != "0,1 | 2,3 | 4" {
+		t.Errorf("bulks = %s", got)
+	}
+}
+
+func TestESFlushInterval(t *testing.T) {
+	s := startESServer(t)
+	l, _, _ := newTestESLogger(t, ElasticsearchConfig{URL: s.URL, FlushInterval: 10 * time.Millisecond})
+	l.Info("alone")
+	waitFor(t, 5*time.Second, "the flush interval to send a partial bulk", func() bool { return len(s.bulks()) == 1 })
+}
+
+func TestESPartialFailure(t *testing.T) {
+	// 第一次：a写入成功，b遇到429，c遇到mapping错误，d遇到503；第二次只重试b和d
+	s := startESServer(t, []int{201, 429, 400, 503})
+	l, b, _ := newTestESLogger(t, ElasticsearchConfig{URL: s.URL, FlushInterval: time.Hour})
+	failed, dropped := ElasticsearchFailed(), ElasticsearchDropped()
+	for _, msg := range []string{"a", "b", "c", "d"} {
+		l.Info(msg)
+	}
+
+	err := l.Sync()
+	if err == nil || err.Error() != "elasticsearch: 3 of 4 documents failed" {
+		t.Errorf("first Sync() = %v", err)
+	}
+	if err := b.Sync(); err != nil {
+		t.Errorf("retry Sync() = %v", err)
+	}
+	if got := strings.Join(s.bulks(), " | "); got != "a,b,c,d | b,d" {
+		t.Errorf("bulks = %s", got)
+	}
+	if got := ElasticsearchFailed() - failed; got != 3 {
+		t.Errorf("ElasticsearchFailed() grew by %d, want 3", got)
+	}
+	if got := ElasticsearchDropped() - dropped; got != 1 {
+		t.Errorf("ElasticsearchDropped() grew by %d, want 1 (the mapping error)", got)
+	}
+}
+
+func TestESRetryLimit(t *testing.T) {
+	s := startESServer(t, []int{503}, []int{503}, []int{503})
+	l, b, _ := newTestESLogger(t, ElasticsearchConfig{URL: s.URL, FlushInterval: time.Hour, MaxRetries: 2})
+	failed, dropped := ElasticsearchFailed(), ElasticsearchDropped()
+	l.Info("unlucky")
+	l.Sync()
+	for i := 0; i < 3; i++ {
+		b.Sync()
+	}
+	// 第一次加两次重试，之后不再排队
+	if got := len(s.bulks()); got != 3 {
+		t.Errorf("got %d bulks, want 3", got)
+	}
+	if got := ElasticsearchFailed() - failed; got != 3 {
+		t.Errorf("ElasticsearchFailed() grew by %d, want 3", got)
+	}
+	if got := ElasticsearchDropped() - dropped; got != 1 {
+		t.Errorf("ElasticsearchDropped() grew by %d, want 1", got)
+	}
+}
+
+func TestESRequestFailureRequeuesAll(t *testing.T) {
+	s := startESServer(t, []int{-http.StatusServiceUnavailable})
+	l, _, closeES := newTestESLogger(t, ElasticsearchConfig{URL: s.URL, FlushInterval: time.Hour})
+	l.Info("a")
+	l.Info("b")
+	if err := l.Sync(); err == nil || !strings.Contains(err.Error(), "bulk returned 503") {
+		t.Errorf("Sync() = %v", err)
+	}
+	l.Info("c")
+	if err := closeES(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(s.bulks(), " | "); got != "a,b | a,b,c" {
+		t.Errorf("bulks = %s", got)
+	}
+}
+
+func TestESCloseDropsFailedDocuments(t *testing.T) {
+	s := startESServer(t, []int{201, 429})
+	l, _, closeES := newTestESLogger(t, ElasticsearchConfig{URL: s.URL, FlushInterval: time.Hour})
+	dropped := ElasticsearchDropped()
+	l.Info("a")
+	l.Info("b")
+	if err := closeES(); err == nil {
+		t.Error("Close() should report the failed document")
+	}
+	if got := ElasticsearchDropped() - dropped; got != 1 {
+		t.Errorf("ElasticsearchDropped() grew by %d, want 1", got)
+	}
+}
+
+func TestESTeeWithFile(t *testing.T) {
+	// Elasticsearch不可用时日志文件仍然完整，Close时失败的文档不再重试
+	s := startESServer(t, []int{-http.StatusInternalServerError})
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.Encoding = EncodingJSON
+	b, err := newLogger(WithConfig(cfg), WithElasticsearch(ElasticsearchConfig{URL: s.URL, FlushInterval: time.Hour, MaxRetries: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.logger.Info("kept", zap.Int("n", 1))
+	b.logger.Info("kept", zap.Int("n", 2))
+	b.close()
+
+	lines := readLines(t, cfg.Filename)
+	if len(lines) != 3 || !strings.Contains(lines[1], `"n":1`) || !strings.Contains(lines[2], `"n":2`) {
+		t.Errorf("file lines = %q", lines)
+	}
+	if got := strings.Join(s.bulks(), " | "); got != "logging to file,kept,kept" {
+		t.Errorf("bulks = %s", got)
+	}
+}
+
+func TestESConfigValidate(t *testing.T) {
+	tests := []struct {
+		cfg     ElasticsearchConfig
+		wantErr string
+	}{
+		{cfg: ElasticsearchConfig{URL: "http://es:9200"}},
+		{cfg: ElasticsearchConfig{URL: "es:9200"}, wantErr: "elasticsearch url must start with http:// or https://"},
+		{cfg: ElasticsearchConfig{URL: "http://es:9200", FlushSize: -1}, wantErr: "must not be negative"},
+		{cfg: ElasticsearchConfig{URL: "http://es:9200", FlushInterval: -1}, wantErr: "must not be negative"},
+		{cfg: ElasticsearchConfig{URL: "http://es:9200", Index: `logs"x`}, wantErr: "must not contain newlines or quotes"},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.validate()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%+v: validate() = %v, want %q", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
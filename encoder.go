@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+getEncoder用到的各种EncoderConfig定制
+*/
+
+// loadTimeZone 解析TimeZone配置：""或local为本地时区，utc为UTC，其余按IANA时区名加载（如Asia/Shanghai）
+func loadTimeZone(name string) (*time.Location, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "local":
+		return time.Local, nil
+	case "utc":
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(strings.TrimSpace(name))
+	if err != nil {
+		return nil, fmt.Errorf("log config: invalid time zone %q: %v", name, err)
+	}
+	return loc, nil
+}
+
+// timeEncoderIn 先把时间转换到loc时区，再交给enc格式化
+func timeEncoderIn(loc *time.Location, enc zapcore.TimeEncoder) zapcore.TimeEncoder {
+	return func(t time.Time, pae zapcore.PrimitiveArrayEncoder) {
+		enc(t.In(loc), pae)
+	}
+}
+
+// validateTimeLayout 检查TimeLayout，没有配置时合法，配置了但只有空白时报错
+func validateTimeLayout(layout string) error {
+	if layout != "" && strings.TrimSpace(layout) == "" {
+		return fmt.Errorf("log config: time layout must not be blank")
+	}
+	return nil
+}
+
+// TimeEncoding的取值
+const (
+	TimeEncodingISO8601     = "iso8601"
+	TimeEncodingEpoch       = "epoch"        // 秒，浮点数
+	TimeEncodingEpochMillis = "epoch_millis" // 毫秒，整数
+	TimeEncodingEpochNanos  = "epoch_nanos"  // 纳秒，整数
+)
+
+// epochMillisTimeEncoder 以整数毫秒编码时间。zapcore.EpochMillisTimeEncoder输出浮点数，
+// 会带上纳秒的小数部分，console Encoder里还会变成科学计数法
+func epochMillisTimeEncoder(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+	enc.AppendInt64(t.UnixNano() / int64(time.Millisecond))
+}
+
+// newTimeEncoder 按TimeEncoding和TimeLayout选择时间编码器：
+// encoding为空或iso8601时，layout非空则按layout格式化，否则使用def；epoch系列不能同时配置layout
+func newTimeEncoder(encoding, layout string, def zapcore.TimeEncoder) (zapcore.TimeEncoder, error) {
+	var enc zapcore.TimeEncoder
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", TimeEncodingISO8601:
+		if layout == "" {
+			return def, nil
+		}
+		return zapcore.TimeEncoderOfLayout(layout), nil
+	case TimeEncodingEpoch:
+		enc = zapcore.EpochTimeEncoder
+	case TimeEncodingEpochMillis:
+		enc = epochMillisTimeEncoder
+	case TimeEncodingEpochNanos:
+		enc = zapcore.EpochNanosTimeEncoder
+	default:
+		return nil, fmt.Errorf("log config: unknown time encoding %q, want %s, %s, %s or %s",
+			encoding, TimeEncodingISO8601, TimeEncodingEpoch, TimeEncodingEpochMillis, TimeEncodingEpochNanos)
+	}
+	if layout != "" {
+		return nil, fmt.Errorf("log config: time layout cannot be used with time encoding %q", encoding)
+	}
+	return enc, nil
+}
+
+// DurationEncoding的取值
+const (
+	DurationEncodingSeconds = "seconds" // 秒，浮点数
+	DurationEncodingMillis  = "millis"  // 毫秒，整数
+	DurationEncodingNanos   = "nanos"   // 纳秒，整数
+	DurationEncodingString  = "string"  // time.Duration.String()，如12.3ms
+)
+
+// newDurationEncoder 按DurationEncoding选择zap.Duration字段的编码器，为空时使用def
+func newDurationEncoder(encoding string, def zapcore.DurationEncoder) (zapcore.DurationEncoder, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "":
+		return def, nil
+	case DurationEncodingSeconds:
+		return zapcore.SecondsDurationEncoder, nil
+	case DurationEncodingMillis:
+		return zapcore.MillisDurationEncoder, nil
+	case DurationEncodingNanos:
+		return zapcore.NanosDurationEncoder, nil
+	case DurationEncodingString:
+		return zapcore.StringDurationEncoder, nil
+	}
+	return nil, fmt.Errorf("log config: unknown duration encoding %q, want %s, %s, %s or %s",
+		encoding, DurationEncodingSeconds, DurationEncodingMillis, DurationEncodingNanos, DurationEncodingString)
+}
+
+// functionKey LogFunction开启时函数名使用的key
+const functionKey = "func"
+
+// omitKeyName 配置为该值的key不输出
+const omitKeyName = "-"
+
+// keyName 返回配置的key名：为空时使用def，为"-"时返回zapcore.OmitKey
+func keyName(name, def string) string {
+	switch name {
+	case "":
+		return def
+	case omitKeyName:
+		return zapcore.OmitKey
+	}
+	return name
+}
+
+// applyKeyNames 用cfg中配置的key名覆盖EncoderConfig的默认值
+func applyKeyNames(encoderConfig *zapcore.EncoderConfig, cfg LogConfig) {
+	encoderConfig.TimeKey = keyName(cfg.TimeKey, encoderConfig.TimeKey)
+	encoderConfig.MessageKey = keyName(cfg.MessageKey, encoderConfig.MessageKey)
+	encoderConfig.LevelKey = keyName(cfg.LevelKey, encoderConfig.LevelKey)
+	encoderConfig.CallerKey = keyName(cfg.CallerKey, encoderConfig.CallerKey)
+	encoderConfig.StacktraceKey = keyName(cfg.StacktraceKey, encoderConfig.StacktraceKey)
+}
+
+// CallerEncoding的取值
+const (
+	CallerEncodingShort    = "short"    // 包名/文件名:行号，默认
+	CallerEncodingFull     = "full"     // 完整路径:行号
+	CallerEncodingFilename = "filename" // 文件名:行号
+)
+
+// newCallerEncoder 按CallerEncoding选择caller的编码器，为空时使用def
+func newCallerEncoder(encoding string, def zapcore.CallerEncoder) (zapcore.CallerEncoder, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "":
+		return def, nil
+	case CallerEncodingShort:
+		return zapcore.ShortCallerEncoder, nil
+	case CallerEncodingFull:
+		return zapcore.FullCallerEncoder, nil
+	case CallerEncodingFilename:
+		return filenameCallerEncoder, nil
+	}
+	return nil, fmt.Errorf("log config: unknown caller encoding %q, want %s, %s or %s",
+		encoding, CallerEncodingShort, CallerEncodingFull, CallerEncodingFilename)
+}
+
+// filenameCallerEncoder 只输出文件名和行号，如main.go:42。runtime返回的路径在各平台都以/分隔
+func filenameCallerEncoder(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
+	if !caller.Defined {
+		enc.AppendString("undefined")
+		return
+	}
+	enc.AppendString(path.Base(caller.File) + ":" + strconv.Itoa(caller.Line))
+}
+
+// newLineEnding 解析LineEnding配置，为空时使用zap默认的\n，也可以写作lf、crlf
+func newLineEnding(ending string) (string, error) {
+	switch strings.ToLower(ending) {
+	case "", "\n", "lf":
+		return zapcore.DefaultLineEnding, nil
+	case "\r\n", "crlf":
+		return "\r\n", nil
+	}
+	return "", fmt.Errorf(`log config: unknown line ending %q, want "\n" or "\r\n"`, ending)
+}
+
+// wrapEncoder 按cfg给各种Encoder套上通用的包装：ECS字段改名、脱敏、毫秒时间戳
+func wrapEncoder(enc zapcore.Encoder, cfg LogConfig) zapcore.Encoder {
+	return withEpochMillis(withRedaction(withECS(enc, cfg), cfg.RedactKeys), cfg.EpochMillisKey)
+}
+
+// defaultEpochMillisKey WithEpochMillis使用的字段名
+const defaultEpochMillisKey = "ts_ms"
+
+// epochMillisEncoder 给每条日志加上整数毫秒时间戳字段，与时间戳字段取自同一个ent.Time
+type epochMillisEncoder struct {
+	zapcore.Encoder
+	key string
+}
+
+// withEpochMillis key非空时包装enc，让每条日志带上key字段
+func withEpochMillis(enc zapcore.Encoder, key string) zapcore.Encoder {
+	if key == "" {
+		return enc
+	}
+	return epochMillisEncoder{enc, key}
+}
+
+func (enc epochMillisEncoder) Clone() zapcore.Encoder {
+	return epochMillisEncoder{enc.Encoder.Clone(), enc.key}
+}
+
+func (enc epochMillisEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	withMillis := make([]zapcore.Field, 0, len(fields)+1)
+	withMillis = append(withMillis, zapcore.Field{Key: enc.key, Type: zapcore.Int64Type, Integer: ent.Time.UnixNano() / int64(time.Millisecond)})
+	return enc.Encoder.EncodeEntry(ent, append(withMillis, fields...))
+}
+
+// LevelEncoding的取值
+const (
+	LevelEncodingCapital = "capital" // INFO
+	LevelEncodingLower   = "lower"   // info
+	LevelEncodingNumber  = "number"  // syslog severity，如6
+	LevelEncodingShort   = "short"   // 固定3个字符，如INF，console输出时各列对齐
+)
+
+// levelSeverity zap级别对应的syslog severity（RFC 5424），5（notice）没有对应的级别：
+//
+//	Debug  7 debug
+//	Info   6 informational
+//	Warn   4 warning
+//	Error  3 error
+//	DPanic 2 critical
+//	Panic  1 alert
+//	Fatal  0 emergency
+func levelSeverity(l zapcore.Level) int64 {
+	switch l {
+	case zapcore.DebugLevel:
+		return 7
+	case zapcore.InfoLevel:
+		return 6
+	case zapcore.WarnLevel:
+		return 4
+	case zapcore.ErrorLevel:
+		return 3
+	case zapcore.DPanicLevel:
+		return 2
+	case zapcore.PanicLevel:
+		return 1
+	case zapcore.FatalLevel:
+		return 0
+	}
+	if l < zapcore.DebugLevel {
+		return 7
+	}
+	return 0
+}
+
+// numberLevelEncoder 把级别编码为syslog severity
+func numberLevelEncoder(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	enc.AppendInt64(levelSeverity(l))
+}
+
+// shortLevelNames 各级别的3字符简写
+var shortLevelNames = map[zapcore.Level]string{
+	zapcore.DebugLevel:  "DBG",
+	zapcore.InfoLevel:   "INF",
+	zapcore.WarnLevel:   "WRN",
+	zapcore.ErrorLevel:  "ERR",
+	zapcore.DPanicLevel: "DPN",
+	zapcore.PanicLevel:  "PNC",
+	zapcore.FatalLevel:  "FTL",
+}
+
+// shortLevelEncoder 把级别编码为固定3个字符的简写，未知级别输出???
+func shortLevelEncoder(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	name, ok := shortLevelNames[l]
+	if !ok {
+		name = "???"
+	}
+	enc.AppendString(name)
+}
+
+// newLevelEncoder 按LevelEncoding选择级别的编码器，为空时使用def
+func newLevelEncoder(encoding string, def zapcore.LevelEncoder) (zapcore.LevelEncoder, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "":
+		return def, nil
+	case LevelEncodingCapital:
+		return zapcore.CapitalLevelEncoder, nil
+	case LevelEncodingLower:
+		return zapcore.LowercaseLevelEncoder, nil
+	case LevelEncodingNumber:
+		return numberLevelEncoder, nil
+	case LevelEncodingShort:
+		return shortLevelEncoder, nil
+	}
+	return nil, fmt.Errorf("log config: unknown level encoding %q, want %s, %s, %s or %s",
+		encoding, LevelEncodingCapital, LevelEncodingLower, LevelEncodingNumber, LevelEncodingShort)
+}
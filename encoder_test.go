@@ -0,0 +1,603 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+)
+
+// fixedTime 测试中使用的固定时间
+var fixedTime = time.Date(2024, 5, 17, 10, 0, 0, 0, time.UTC)
+
+// encodeLine 用cfg和固定时钟编码一条带fields的Info日志，返回输出的那一行
+func encodeLine(t *testing.T, cfg LogConfig, fields ...zap.Field) string {
+	t.Helper()
+	out := &zaptest.Buffer{}
+	cfg.Filename = ""
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out), WithClock(NewManualClock(fixedTime)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("hello", fields...)
+	lines := out.Lines()
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1:\n%s", len(lines), out.String())
+	}
+	return lines[0]
+}
+
+func TestTimeZone(t *testing.T) {
+	if _, err := time.LoadLocation("Etc/GMT-8"); err != nil {
+		t.Skip("time zone database not available:", err)
+	}
+	tests := []struct {
+		zone string
+		want string
+	}{
+		{zone: "utc", want: `"ts":"2024-05-17T10:00:00.000Z"`},
+		{zone: "UTC", want: `"ts":"2024-05-17T10:00:00.000Z"`},
+		{zone: "Etc/GMT-8", want: `"ts":"2024-05-17T18:00:00.000+0800"`},
+		{zone: "America/New_York", want: `"ts":"2024-05-17T06:00:00.000-0400"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.zone, func(t *testing.T) {
+			cfg := defaultLogConfig()
+			cfg.Encoding = EncodingJSON
+			cfg.TimeZone = tt.zone
+			if line := encodeLine(t, cfg); !strings.Contains(line, tt.want) {
+				t.Errorf("got %s, want %s", line, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidTimeZoneFailsAtInit(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.TimeZone = "Mars/Olympus_Mons"
+	_, err := NewLogger(WithConfig(cfg))
+	if err == nil || !strings.Contains(err.Error(), `invalid time zone "Mars/Olympus_Mons"`) {
+		t.Fatalf("error = %v, want invalid time zone", err)
+	}
+}
+
+func TestEncodingGolden(t *testing.T) {
+	tests := []struct {
+		encoding string
+		want     string
+	}{
+		{encoding: EncodingJSON, want: `{"level":"INFO","ts":"2024-05-17T10:00:00.000Z","msg":"hello","user":"alice","n":3}`},
+		{encoding: EncodingConsole, want: "2024-05-17T10:00:00.000Z\tINFO\thello\t{\"user\": \"alice\", \"n\": 3}"},
+		{encoding: "", want: "2024-05-17T10:00:00.000Z\tINFO\thello\t{\"user\": \"alice\", \"n\": 3}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			cfg := defaultLogConfig()
+			cfg.Encoding = tt.encoding
+			cfg.TimeZone = "utc"
+			cfg.DisableCaller = true
+			if got := encodeLine(t, cfg, zap.String("user", "alice"), zap.Int("n", 3)); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownEncoding(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = "xml"
+	if _, err := NewLogger(WithConfig(cfg)); err == nil || !strings.Contains(err.Error(), `unknown encoding "xml"`) {
+		t.Fatalf("error = %v, want unknown encoding", err)
+	}
+}
+
+func TestTimeLayoutGolden(t *testing.T) {
+	tests := []struct {
+		layout string
+		want   string
+	}{
+		{layout: "", want: `{"level":"INFO","ts":"2024-05-17T10:00:00.000Z","msg":"hello"}`},
+		{layout: "2006-01-02 15:04:05.000", want: `{"level":"INFO","ts":"2024-05-17 10:00:00.000","msg":"hello"}`},
+		{layout: time.RFC3339, want: `{"level":"INFO","ts":"2024-05-17T10:00:00Z","msg":"hello"}`},
+		{layout: "02/Jan/2006:15:04:05 -0700", want: `{"level":"INFO","ts":"17/May/2024:10:00:00 +0000","msg":"hello"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.layout, func(t *testing.T) {
+			cfg := defaultLogConfig()
+			cfg.Encoding = EncodingJSON
+			cfg.TimeZone = "utc"
+			cfg.TimeLayout = tt.layout
+			cfg.DisableCaller = true
+			if got := encodeLine(t, cfg); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlankTimeLayout(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.TimeLayout = "   "
+	if _, err := NewLogger(WithConfig(cfg)); err == nil || !strings.Contains(err.Error(), "time layout must not be blank") {
+		t.Fatalf("error = %v, want blank layout error", err)
+	}
+}
+
+func TestTimeEncodingGolden(t *testing.T) {
+	// 带上毫秒以下的部分，确认毫秒是整数
+	at := fixedTime.Add(123456789 * time.Nanosecond)
+	tests := []struct {
+		encoding string
+		want     string
+	}{
+		{encoding: TimeEncodingISO8601, want: `"ts":"2024-05-17T10:00:00.123Z"`},
+		{encoding: TimeEncodingEpoch, want: `"ts":1715940000.1234567`},
+		{encoding: TimeEncodingEpochMillis, want: `"ts":1715940000123,`},
+		{encoding: TimeEncodingEpochNanos, want: `"ts":1715940000123456789,`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			out := &zaptest.Buffer{}
+			cfg := defaultLogConfig()
+			cfg.Filename = ""
+			cfg.Encoding = EncodingJSON
+			cfg.TimeZone = "utc"
+			cfg.TimeEncoding = tt.encoding
+			cfg.DisableCaller = true
+			l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out), WithClock(NewManualClock(at)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			l.Info("hello", zap.Duration("cost", 1500*time.Millisecond))
+			got := out.String()
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			if strings.Contains(got, "e+") {
+				t.Errorf("numbers should not use scientific notation: %s", got)
+			}
+			// gin中间件的cost等Duration字段不受影响
+			if !strings.Contains(got, `"cost":1.5`) {
+				t.Errorf("duration field changed: %s", got)
+			}
+		})
+	}
+}
+
+func TestEpochMillisConsole(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.TimeEncoding = TimeEncodingEpochMillis
+	cfg.DisableCaller = true
+	if got, want := encodeLine(t, cfg), "1715940000000\tINFO\thello"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTimeEncodingErrors(t *testing.T) {
+	tests := []struct {
+		encoding, layout, wantErr string
+	}{
+		{encoding: "rfc3339", wantErr: `unknown time encoding "rfc3339"`},
+		{encoding: TimeEncodingEpochMillis, layout: time.RFC3339, wantErr: "time layout cannot be used"},
+	}
+	for _, tt := range tests {
+		if _, err := newTimeEncoder(tt.encoding, tt.layout, nil); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("newTimeEncoder(%q, %q) error = %v, want %q", tt.encoding, tt.layout, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDurationEncodingGolden(t *testing.T) {
+	d := 12300 * time.Microsecond
+	tests := []struct {
+		encoding    string
+		wantJSON    string
+		wantConsole string
+	}{
+		{encoding: "", wantJSON: `"cost":0.0123`, wantConsole: `{"cost": 0.0123}`},
+		{encoding: DurationEncodingSeconds, wantJSON: `"cost":0.0123`, wantConsole: `{"cost": 0.0123}`},
+		{encoding: DurationEncodingMillis, wantJSON: `"cost":12`, wantConsole: `{"cost": 12}`},
+		{encoding: DurationEncodingNanos, wantJSON: `"cost":12300000`, wantConsole: `{"cost": 12300000}`},
+		{encoding: DurationEncodingString, wantJSON: `"cost":"12.3ms"`, wantConsole: `{"cost": "12.3ms"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			console := &zaptest.Buffer{}
+			cfg := defaultLogConfig()
+			cfg.Filename = tempLogFile(t)
+			cfg.Encoding = EncodingJSON
+			cfg.TeeToConsole = true
+			cfg.DisableCaller = true
+			cfg.DurationEncoding = tt.encoding
+			b, err := newLogger(WithConfig(cfg), WithConsoleOutput(console))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.logger.Info("hello", zap.Duration("cost", d))
+			b.close()
+
+			lines := readLines(t, cfg.Filename)
+			if last := lines[len(lines)-1]; !strings.HasSuffix(last, tt.wantJSON+"}") {
+				t.Errorf("file: got %s, want suffix %s}", last, tt.wantJSON)
+			}
+			consoleLines := console.Lines()
+			if last := consoleLines[len(consoleLines)-1]; !strings.HasSuffix(last, "\thello\t"+tt.wantConsole) {
+				t.Errorf("console: got %q, want suffix %q", last, tt.wantConsole)
+			}
+		})
+	}
+}
+
+func TestUnknownDurationEncoding(t *testing.T) {
+	if _, err := newDurationEncoder("hours", nil); err == nil {
+		t.Fatal("expected error for unknown duration encoding")
+	}
+}
+
+func TestKeyNamesGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *LogConfig)
+		want   string
+	}{
+		{
+			name: "renamed",
+			modify: func(cfg *LogConfig) {
+				cfg.TimeKey = "@timestamp"
+				cfg.MessageKey = "message"
+				cfg.LevelKey = "severity"
+			},
+			want: `{"severity":"INFO","@timestamp":"2024-05-17T10:00:00.000Z","message":"hello"}`,
+		},
+		{
+			name: "omitted",
+			modify: func(cfg *LogConfig) {
+				cfg.TimeKey = "-"
+				cfg.LevelKey = "-"
+			},
+			want: `{"msg":"hello"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultLogConfig()
+			cfg.Encoding = EncodingJSON
+			cfg.TimeZone = "utc"
+			cfg.CallerKey = "-"
+			tt.modify(&cfg)
+			if got := encodeLine(t, cfg); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyNamesGinLogger(t *testing.T) {
+	clock := NewManualClock(fixedTime)
+	out := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingJSON
+	cfg.TimeZone = "utc"
+	cfg.TimeKey = "@timestamp"
+	cfg.MessageKey = "message"
+	cfg.LevelKey = "severity"
+	cfg.CallerKey = "-"
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveGin("GET", "/ping", MustGinLoggerWithConfig(l, GinLoggerConfig{Clock: clock}))
+
+	want := `{"severity":"INFO","@timestamp":"2024-05-17T10:00:00.000Z","message":"/ping","status":200,"method":"GET",` +
+		`"path":"/ping","query":"","ip":"192.0.2.1","user-agent":"","cost":0}`
+	if got := strings.TrimSpace(out.String()); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestCallerEncodingShapes(t *testing.T) {
+	// encodeLine在本文件中调用l.Info，caller指向这个文件
+	_, file, _, _ := runtime.Caller(0)
+	short := path.Base(path.Dir(file)) + "/encoder_test.go:"
+	tests := []struct {
+		encoding string
+		prefix   string
+	}{
+		{encoding: "", prefix: short},
+		{encoding: CallerEncodingShort, prefix: short},
+		{encoding: CallerEncodingFull, prefix: file + ":"},
+		{encoding: CallerEncodingFilename, prefix: "encoder_test.go:"},
+	}
+	for _, tt := range tests {
+		for _, encoding := range []string{EncodingJSON, EncodingConsole} {
+			t.Run(tt.encoding+"/"+encoding, func(t *testing.T) {
+				cfg := defaultLogConfig()
+				cfg.Encoding = encoding
+				cfg.CallerEncoding = tt.encoding
+				line := encodeLine(t, cfg)
+
+				var caller string
+				if encoding == EncodingJSON {
+					var m map[string]interface{}
+					if err := json.Unmarshal([]byte(line), &m); err != nil {
+						t.Fatal(err)
+					}
+					caller, _ = m["caller"].(string)
+				} else {
+					// console的各列为时间、级别、caller、消息
+					if cols := strings.Split(line, "\t"); len(cols) > 2 {
+						caller = cols[2]
+					}
+				}
+				if !strings.HasPrefix(caller, tt.prefix) {
+					t.Fatalf("caller = %q, want prefix %q", caller, tt.prefix)
+				}
+				if _, err := strconv.Atoi(strings.TrimPrefix(caller, tt.prefix)); err != nil {
+					t.Errorf("caller = %q should end with a line number", caller)
+				}
+			})
+		}
+	}
+}
+
+func TestFilenameCallerEncoderUndefined(t *testing.T) {
+	var got logfmtPrimitives
+	filenameCallerEncoder(zapcore.EntryCaller{}, &got)
+	if len(got) != 1 || got[0] != "undefined" {
+		t.Errorf("got %v, want undefined", got)
+	}
+}
+
+func TestUnknownCallerEncoding(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.CallerEncoding = "relative"
+	if _, err := NewLogger(WithConfig(cfg)); err == nil || !strings.Contains(err.Error(), `unknown caller encoding "relative"`) {
+		t.Fatalf("error = %v, want unknown caller encoding", err)
+	}
+}
+
+func TestLineEndingCRLF(t *testing.T) {
+	for _, encoding := range []string{EncodingJSON, EncodingConsole} {
+		t.Run(encoding, func(t *testing.T) {
+			cfg := defaultLogConfig()
+			cfg.Filename = tempLogFile(t)
+			cfg.Encoding = encoding
+			cfg.LineEnding = "\r\n"
+			cfg.Compress = true
+			b, err := newLogger(WithConfig(cfg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.logger.Info("before rotate")
+			b.logger.Info("second line")
+			if _, _, err := b.file.rotateAndFindBackup(); err != nil {
+				t.Fatal(err)
+			}
+			b.logger.Info("after rotate")
+			b.close()
+
+			assertCRLF(t, "active file", readFile(t, cfg.Filename), 1)
+			assertCRLF(t, "compressed backup", gunzipFile(t, waitForBackup(t, cfg.Filename, ".gz")), 3) // 启动时的logging to file和两条日志
+		})
+	}
+}
+
+// assertCRLF 检查raw中有n行日志，每行都以\r\n结束，没有单独的\n
+func assertCRLF(t *testing.T, what, raw string, n int) {
+	t.Helper()
+	if !strings.HasSuffix(raw, "\r\n") {
+		t.Errorf("%s should end with CRLF: %q", what, raw)
+	}
+	if got := strings.Count(raw, "\r\n"); got != n || strings.Count(raw, "\n") != n {
+		t.Errorf("%s: got %d CRLF and %d LF, want %d of each: %q", what, got, strings.Count(raw, "\n"), n, raw)
+	}
+}
+
+func TestLineEndingDefault(t *testing.T) {
+	for _, ending := range []string{"", "\n", "lf", "LF"} {
+		if got, err := newLineEnding(ending); err != nil || got != "\n" {
+			t.Errorf("newLineEnding(%q) = %q, %v, want \\n", ending, got, err)
+		}
+	}
+	if got, err := newLineEnding("crlf"); err != nil || got != "\r\n" {
+		t.Errorf(`newLineEnding("crlf") = %q, %v`, got, err)
+	}
+	if _, err := newLineEnding("\r"); err == nil {
+		t.Error("bare CR should be rejected")
+	}
+}
+
+func TestEpochMillisAgreesWithTs(t *testing.T) {
+	clock := NewManualClock(fixedTime.Add(123456789 * time.Nanosecond))
+	out := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingJSON
+	cfg.TimeZone = "Etc/GMT-8"
+	if _, err := time.LoadLocation(cfg.TimeZone); err != nil {
+		cfg.TimeZone = "utc"
+	}
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out), WithClock(clock), WithEpochMillis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("direct")
+	r := gin.New()
+	r.Use(MustGinLoggerWithConfig(l, GinLoggerConfig{Clock: clock}))
+	r.GET("/ping", func(c *gin.Context) {
+		clock.Add(time.Second)
+		c.Status(http.StatusOK)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+	wantMillis := []int64{1715940000123, 1715940001123}
+	entries := decodeJSONLines(t, out.Lines())
+	if len(entries) != len(wantMillis) {
+		t.Fatalf("got %d entries, want %d:\n%s", len(entries), len(wantMillis), out.String())
+	}
+	for i, e := range entries {
+		ts, err := time.Parse("2006-01-02T15:04:05.000Z0700", e["ts"].(string))
+		if err != nil {
+			t.Fatalf("entry %d: %v", i, err)
+		}
+		millis, ok := e[defaultEpochMillisKey].(float64)
+		if !ok || int64(millis) != wantMillis[i] {
+			t.Errorf("entry %d: %s = %v, want %d", i, defaultEpochMillisKey, e[defaultEpochMillisKey], wantMillis[i])
+		}
+		if got := ts.UnixNano() / int64(time.Millisecond); got != int64(millis) {
+			t.Errorf("entry %d: ts %s is %d ms, %s is %v", i, e["ts"], got, defaultEpochMillisKey, millis)
+		}
+	}
+}
+
+func TestEpochMillisKeyIsInteger(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Encoding = EncodingJSON
+	cfg.TimeZone = "utc"
+	cfg.DisableCaller = true
+	cfg.EpochMillisKey = "epoch"
+	want := `{"level":"INFO","ts":"2024-05-17T10:00:00.000Z","msg":"hello","epoch":1715940000000}`
+	if got := encodeLine(t, cfg); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestLevelEncodingGolden(t *testing.T) {
+	levels := []zapcore.Level{
+		zapcore.DebugLevel, zapcore.InfoLevel, zapcore.WarnLevel, zapcore.ErrorLevel,
+		zapcore.DPanicLevel, zapcore.PanicLevel, zapcore.FatalLevel,
+	}
+	tests := []struct {
+		encoding string
+		want     []string
+	}{
+		{encoding: LevelEncodingNumber, want: []string{`7`, `6`, `4`, `3`, `2`, `1`, `0`}},
+		{encoding: LevelEncodingCapital, want: []string{`"DEBUG"`, `"INFO"`, `"WARN"`, `"ERROR"`, `"DPANIC"`, `"PANIC"`, `"FATAL"`}},
+		{encoding: LevelEncodingLower, want: []string{`"debug"`, `"info"`, `"warn"`, `"error"`, `"dpanic"`, `"panic"`, `"fatal"`}},
+		{encoding: LevelEncodingShort, want: []string{`"DBG"`, `"INF"`, `"WRN"`, `"ERR"`, `"DPN"`, `"PNC"`, `"FTL"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			encodeLevel, err := newLevelEncoder(tt.encoding, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{LevelKey: "level", MessageKey: "msg", EncodeLevel: encodeLevel})
+			for i, l := range levels {
+				buf, err := enc.EncodeEntry(zapcore.Entry{Level: l, Message: "m"}, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := `{"level":` + tt.want[i] + `,"msg":"m"}` + "\n"
+				if got := buf.String(); got != want {
+					t.Errorf("%s: got %s, want %s", l, got, want)
+				}
+				buf.Free()
+			}
+		})
+	}
+}
+
+func TestLevelEncodingNumberKeepsConsoleWords(t *testing.T) {
+	console := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.Encoding = EncodingJSON
+	cfg.LevelEncoding = LevelEncodingNumber
+	cfg.TeeToConsole = true
+	cfg.DisableCaller = true
+	b, err := newLogger(WithConfig(cfg), WithConsoleOutput(console))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.logger.Warn("disk almost full")
+	b.close()
+
+	lines := readLines(t, cfg.Filename)
+	if last := lines[len(lines)-1]; !strings.HasPrefix(last, `{"level":4,`) {
+		t.Errorf("file should use the numeric severity: %s", last)
+	}
+	consoleLines := console.Lines()
+	if last := consoleLines[len(consoleLines)-1]; !strings.Contains(last, "\tWARN\tdisk almost full") {
+		t.Errorf("console should keep the word form: %q", last)
+	}
+}
+
+func TestUnknownLevelEncoding(t *testing.T) {
+	if _, err := newLevelEncoder("syslog", nil); err == nil {
+		t.Fatal("expected error for unknown level encoding")
+	}
+}
+
+func TestShortLevelConsoleGolden(t *testing.T) {
+	for _, withCaller := range []bool{false, true} {
+		t.Run(fmt.Sprintf("caller=%v", withCaller), func(t *testing.T) {
+			out := &zaptest.Buffer{}
+			cfg := defaultLogConfig()
+			cfg.Filename = ""
+			cfg.Level = "debug"
+			cfg.TimeZone = "utc"
+			cfg.LevelEncoding = LevelEncodingShort
+			cfg.CallerEncoding = CallerEncodingFilename
+			cfg.DisableCaller = !withCaller
+			l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out), WithClock(NewManualClock(fixedTime)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			l.Debug("m")
+			l.Info("m")
+			l.Warn("m")
+			l.Error("m")
+			l.DPanic("m")
+			func() {
+				defer func() { _ = recover() }()
+				l.Panic("m")
+			}()
+
+			lines := out.Lines()
+			codes := []string{"DBG", "INF", "WRN", "ERR", "DPN", "PNC"}
+			if len(lines) != len(codes) {
+				t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(codes), out.String())
+			}
+			for i, line := range lines {
+				// 堆栈在后面的行，这里只看日志行本身
+				want := "2024-05-17T10:00:00.000Z\t" + codes[i] + "\t"
+				if withCaller {
+					want += callerOf(t, line) + "\t"
+				}
+				want += "m"
+				if line != want {
+					t.Errorf("got  %q\nwant %q", line, want)
+				}
+				// 各列对齐：消息总在同一个位置开始
+				if strings.Index(line, "\tm") != strings.Index(lines[0], "\tm") {
+					t.Errorf("line %d is not aligned with the first line:\n%s\n%s", i, lines[0], line)
+				}
+			}
+		})
+	}
+}
+
+func TestShortLevelUnknown(t *testing.T) {
+	var got logfmtPrimitives
+	shortLevelEncoder(zapcore.Level(42), &got)
+	if len(got) != 1 || got[0] != "???" {
+		t.Errorf("got %v, want ???", got)
+	}
+}
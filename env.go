@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+=============================================================
+环境变量覆盖日志配置
+容器里改日志级别不方便改文件，可以直接设置环境变量：
+LOG_LEVEL、LOG_FILE、LOG_MAX_SIZE_MB、LOG_COMPRESS
+*/
+
+const (
+	envLogLevel     = "LOG_LEVEL"
+	envLogFile      = "LOG_FILE"
+	envLogMaxSizeMB = "LOG_MAX_SIZE_MB"
+	envLogCompress  = "LOG_COMPRESS"
+)
+
+// applyEnvOverrides 用环境变量覆盖cfg中的对应字段。
+// 优先级：环境变量 > 传入的cfg（配置文件/JSON/默认值），命令行参数又优先于环境变量，见RegisterFlags。
+// 环境变量解析失败时只往stderr打印警告，并保留cfg中原来的值。
+func applyEnvOverrides(cfg LogConfig) LogConfig {
+	if v, ok := os.LookupEnv(envLogLevel); ok {
+		v = strings.TrimSpace(v)
+		if _, err := ParseLevel(v); err != nil {
+			envWarn(envLogLevel, v, err)
+		} else {
+			cfg.Level = v
+		}
+	}
+	if v, ok := os.LookupEnv(envLogFile); ok {
+		cfg.Filename = strings.TrimSpace(v) // 设置为空表示只输出到console
+	}
+	if v, ok := os.LookupEnv(envLogMaxSizeMB); ok {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err == nil && n <= 0 {
+			err = fmt.Errorf("must be greater than 0")
+		}
+		if err != nil {
+			envWarn(envLogMaxSizeMB, v, err)
+		} else {
+			cfg.MaxSize = n
+		}
+	}
+	if v, ok := os.LookupEnv(envLogCompress); ok {
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			envWarn(envLogCompress, v, err)
+		} else {
+			cfg.Compress = b
+		}
+	}
+	return cfg
+}
+
+func envWarn(key, value string, err error) {
+	fmt.Fprintf(os.Stderr, "warning: ignore invalid %s=%q: %v\n", key, value, err)
+}
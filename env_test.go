@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureStderr 返回fn执行期间写到os.Stderr的内容
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stderr
+	os.Stderr = w
+	done := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		done <- data
+	}()
+	defer func() {
+		os.Stderr = old
+	}()
+	fn()
+	w.Close()
+	return string(<-done)
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	base := defaultLogConfig()
+	tests := []struct {
+		name     string
+		env      map[string]string
+		want     func(cfg *LogConfig)
+		wantWarn string
+	}{
+		{
+			name: "unset keeps config",
+			want: func(cfg *LogConfig) {},
+		},
+		{
+			name: "all overrides",
+			env: map[string]string{
+				envLogLevel:     " Error ",
+				envLogFile:      "/tmp/env.log",
+				envLogMaxSizeMB: "20",
+				envLogCompress:  "true",
+			},
+			want: func(cfg *LogConfig) {
+				cfg.Level = "Error"
+				cfg.Filename = "/tmp/env.log"
+				cfg.MaxSize = 20
+				cfg.Compress = true
+			},
+		},
+		{
+			name: "empty file means console only",
+			env:  map[string]string{envLogFile: ""},
+			want: func(cfg *LogConfig) { cfg.Filename = "" },
+		},
+		{
+			name:     "invalid level",
+			env:      map[string]string{envLogLevel: "verbose"},
+			want:     func(cfg *LogConfig) {},
+			wantWarn: `ignore invalid LOG_LEVEL="verbose"`,
+		},
+		{
+			name:     "invalid max size",
+			env:      map[string]string{envLogMaxSizeMB: "ten"},
+			want:     func(cfg *LogConfig) {},
+			wantWarn: `ignore invalid LOG_MAX_SIZE_MB="ten"`,
+		},
+		{
+			name:     "zero max size",
+			env:      map[string]string{envLogMaxSizeMB: "0"},
+			want:     func(cfg *LogConfig) {},
+			wantWarn: "must be greater than 0",
+		},
+		{
+			name:     "invalid compress",
+			env:      map[string]string{envLogCompress: "maybe"},
+			want:     func(cfg *LogConfig) {},
+			wantWarn: `ignore invalid LOG_COMPRESS="maybe"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetLogEnv(t)
+			for k, v := range tt.env {
+				setEnv(t, k, v)
+			}
+			var got LogConfig
+			warn := captureStderr(t, func() { got = applyEnvOverrides(base) })
+
+			want := base
+			tt.want(&want)
+			if got.Level != want.Level || got.Filename != want.Filename ||
+				got.MaxSize != want.MaxSize || got.Compress != want.Compress {
+				t.Errorf("got level=%q file=%q max_size=%d compress=%v, want level=%q file=%q max_size=%d compress=%v",
+					got.Level, got.Filename, got.MaxSize, got.Compress,
+					want.Level, want.Filename, want.MaxSize, want.Compress)
+			}
+			if tt.wantWarn == "" && warn != "" {
+				t.Errorf("unexpected warning: %s", warn)
+			}
+			if !strings.Contains(warn, tt.wantWarn) {
+				t.Errorf("warning %q should contain %q", warn, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestEnvOverridesInitLoggerWithConfig(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	configured := tempLogFile(t)
+	fromEnv := tempLogFile(t)
+	setEnv(t, envLogFile, fromEnv)
+	setEnv(t, envLogLevel, "warn")
+
+	cfg := defaultLogConfig()
+	cfg.Filename = configured
+	l, _, err := InitLoggerWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("info dropped")
+	l.Warn("warn kept")
+	_ = l.Sync()
+
+	if out := readFile(t, configured); out != "" {
+		t.Errorf("configured file should not be used:\n%s", out)
+	}
+	out := readFile(t, fromEnv)
+	if !strings.Contains(out, "warn kept") || strings.Contains(out, "info dropped") {
+		t.Errorf("LOG_FILE/LOG_LEVEL not applied:\n%s", out)
+	}
+}
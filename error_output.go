@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+zap内部错误输出
+日志文件写不进去时，zap把自己的错误信息写到ErrorOutput（默认stderr），很容易被忽略。
+配置ErrorOutput为文件路径后这些错误单独写到一个小文件里；同时统计内部错误的次数，通过InternalErrors查看。
+定点切割等在后台发生、没有调用方接收的错误也写到这里（见reportError）。
+*/
+
+// errorOutputStderr ErrorOutput的默认值，输出到stderr
+const errorOutputStderr = "stderr"
+
+// internalErrors zap内部错误的次数
+var internalErrors uint64
+
+// InternalErrors 返回到目前为止zap内部错误（写日志失败、hook返回error等）的次数
+func InternalErrors() uint64 {
+	return atomic.LoadUint64(&internalErrors)
+}
+
+// countingErrorOutput 每写一次计一次内部错误，zap每个内部错误只写一行
+type countingErrorOutput struct {
+	zapcore.WriteSyncer
+}
+
+func (w countingErrorOutput) Write(p []byte) (int, error) {
+	atomic.AddUint64(&internalErrors, 1)
+	return w.WriteSyncer.Write(p)
+}
+
+// errorOutputHolder 让atomic.Value中总是保存同一种类型
+type errorOutputHolder struct {
+	ws zapcore.WriteSyncer
+}
+
+// setErrorOutput 设置后台错误的输出，ws应该已经是zapcore.Lock过、计入InternalErrors的
+func (w *fileWriteSyncer) setErrorOutput(ws zapcore.WriteSyncer) {
+	w.errorOutput.Store(errorOutputHolder{ws})
+}
+
+// reportError 把没有调用方接收的错误按zap内部错误的格式写到ErrorOutput，没有设置时写到stderr，都计入InternalErrors
+func (w *fileWriteSyncer) reportError(msg string, err error) {
+	out, ok := w.errorOutput.Load().(errorOutputHolder)
+	if !ok {
+		out.ws = zapcore.Lock(countingErrorOutput{os.Stderr})
+	}
+	fmt.Fprintf(out.ws, "%v %s: %v\n", time.Now(), msg, err)
+	_ = out.ws.Sync()
+}
+
+// openErrorOutput 打开ErrorOutput指定的输出，path为空或stderr时返回os.Stderr，
+// 否则以追加方式打开文件，需要调用方关闭
+func openErrorOutput(path string, cfg LogConfig) (*os.File, error) {
+	if path == "" || path == errorOutputStderr {
+		return os.Stderr, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), cfg.dirMode()); err != nil {
+		return nil, fmt.Errorf("log config: create error output dir: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, cfg.fileMode())
+	if err != nil {
+		return nil, fmt.Errorf("log config: open error output: %v", err)
+	}
+	return f, nil
+}
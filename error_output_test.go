@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+)
+
+// failingWriteSyncer 每次写入都失败
+type failingWriteSyncer struct{}
+
+func (failingWriteSyncer) Write([]byte) (int, error) { return 0, errors.New("disk on fire") }
+func (failingWriteSyncer) Sync() error               { return nil }
+
+// withFailingSink 用总是写入失败的core代替日志文件
+func withFailingSink() Option {
+	return WithPrimarySink(func(zapcore.WriteSyncer) (zapcore.Core, error) {
+		enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+		return zapcore.NewCore(enc, failingWriteSyncer{}, zapcore.DebugLevel), nil
+	})
+}
+
+func TestErrorOutputCountsInternalErrors(t *testing.T) {
+	errOut := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(&zaptest.Buffer{}), WithErrorOutput(errOut), withFailingSink())
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := InternalErrors()
+	l.Info("lost 1")
+	l.Info("lost 2")
+
+	if got := InternalErrors() - before; got != 2 {
+		t.Errorf("InternalErrors increased by %d, want 2", got)
+	}
+	lines := errOut.Lines()
+	if len(lines) != 2 || !strings.Contains(lines[0], "write error: disk on fire") {
+		t.Errorf("error output:\n%s", errOut.String())
+	}
+}
+
+func TestErrorOutputFile(t *testing.T) {
+	dir := tempDir(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.ErrorOutput = filepath.Join(dir, "internal", "zap-errors.log")
+	b, err := newLogger(WithConfig(cfg), WithConsoleOutput(&zaptest.Buffer{}), withFailingSink())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.logger.Info("lost")
+	if err := b.close(); err != nil {
+		t.Fatal(err)
+	}
+	if out := readFile(t, cfg.ErrorOutput); !strings.Contains(out, "disk on fire") {
+		t.Errorf("internal error should be written to %s, got %q", cfg.ErrorOutput, out)
+	}
+}
+
+func TestReportError(t *testing.T) {
+	errOut := &zaptest.Buffer{}
+	w := &fileWriteSyncer{}
+	w.setErrorOutput(zapcore.Lock(countingErrorOutput{errOut}))
+	before := InternalErrors()
+
+	w.reportError("scheduled rotate failed", errors.New("no space"))
+
+	if InternalErrors()-before != 1 || !strings.Contains(errOut.String(), "scheduled rotate failed: no space") {
+		t.Errorf("reportError output %q", errOut.String())
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+日志文件写入失败时切换到stderr
+日志盘被卸载或者写满时，写文件一直报错，zap只会把错误写到ErrorOutput，日志本身就丢了。
+配置Failover后，写文件的core连续失败MaxErrors次就切换到stderr（console Encoder），
+同时记录一条"log sink degraded"；之后每隔ProbeInterval尝试往文件写一条"log sink recovered"，
+写成功就切回文件，并在stderr上也记录一条"log sink recovered"。
+开启Async时写入错误由后台goroutine忽略，不会触发切换；开启缓冲时要等写满或Sync时才能发现错误。
+*/
+
+// 切换到stderr的默认值
+const (
+	defaultFailoverMaxErrors     = 3
+	defaultFailoverProbeInterval = 5 * time.Second
+)
+
+// FailoverConfig 日志文件写入失败时切换到stderr的配置，为0的项使用默认值
+type FailoverConfig struct {
+	MaxErrors     int           `yaml:"max_errors" json:"max_errors"`         // 连续失败多少次后切换，默认3
+	ProbeInterval time.Duration `yaml:"probe_interval" json:"probe_interval"` // 切换后隔多久尝试写一次文件，默认5秒
+}
+
+func (f FailoverConfig) validate() error {
+	if f.MaxErrors < 0 {
+		return fmt.Errorf("log config: failover max errors must not be negative, got %d", f.MaxErrors)
+	}
+	if f.ProbeInterval < 0 {
+		return fmt.Errorf("log config: failover probe interval must not be negative, got %s", f.ProbeInterval)
+	}
+	return nil
+}
+
+func (f FailoverConfig) withDefaults() FailoverConfig {
+	if f.MaxErrors == 0 {
+		f.MaxErrors = defaultFailoverMaxErrors
+	}
+	if f.ProbeInterval == 0 {
+		f.ProbeInterval = defaultFailoverProbeInterval
+	}
+	return f
+}
+
+// failoverState 一个文件core及其With出的core共享的切换状态
+type failoverState struct {
+	cfg      FailoverConfig
+	clock    Clock
+	primary  zapcore.Core // 写文件的core，探测时直接用它写
+	fallback zapcore.Core // 写stderr的core
+
+	mu       sync.Mutex
+	errors   int       // 连续失败的次数
+	degraded bool      // 是否已经切换到stderr
+	since    time.Time // 切换到stderr的时间
+	stop     chan struct{}
+	done     chan struct{} // 探测的goroutine退出时关闭，没有在探测时为nil
+	closed   bool
+}
+
+// failoverCore 写文件失败时改写到stderr的core
+type failoverCore struct {
+	zapcore.Core
+	fallback zapcore.Core
+	state    *failoverState
+}
+
+// newFailoverCore 包装写文件的core，fallback写stderr并使用与core相同的级别
+func newFailoverCore(core, fallback zapcore.Core, cfg FailoverConfig, clock Clock) *failoverCore {
+	return &failoverCore{
+		Core:     core,
+		fallback: fallback,
+		state: &failoverState{
+			cfg:      cfg.withDefaults(),
+			clock:    clock,
+			primary:  core,
+			fallback: fallback,
+			stop:     make(chan struct{}),
+		},
+	}
+}
+
+func (c *failoverCore) With(fields []zapcore.Field) zapcore.Core {
+	return &failoverCore{
+		Core:     c.Core.With(fields),
+		fallback: c.fallback.With(fields),
+		state:    c.state,
+	}
+}
+
+func (c *failoverCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *failoverCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if c.state.isDegraded() {
+		return c.fallback.Write(ent, fields)
+	}
+	err := c.Core.Write(ent, fields)
+	if !c.state.writeResult(err) {
+		return err
+	}
+	// 这一条也改写到stderr，不丢失
+	return c.fallback.Write(ent, fields)
+}
+
+func (c *failoverCore) Sync() error {
+	if c.state.isDegraded() {
+		return c.fallback.Sync()
+	}
+	return c.Core.Sync()
+}
+
+// close 停止探测，可重复调用
+func (c *failoverCore) close() {
+	c.state.close()
+}
+
+func (s *failoverState) isDegraded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.degraded
+}
+
+// writeResult 记录一次写文件的结果，连续失败达到MaxErrors时切换到stderr并返回true
+func (s *failoverState) writeResult(err error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.errors = 0
+		return false
+	}
+	s.errors++
+	if s.degraded || s.closed || s.errors < s.cfg.MaxErrors {
+		return false
+	}
+	s.degraded = true
+	s.since = s.clock.Now()
+	_ = s.fallback.Write(s.entry(zapcore.ErrorLevel, "log sink degraded"), []zapcore.Field{
+		zap.Error(err),
+		zap.Int("consecutive_errors", s.errors),
+		zap.Duration("probe_interval", s.cfg.ProbeInterval),
+	})
+	s.done = make(chan struct{})
+	go s.probe(s.done)
+	return true
+}
+
+// probe 每隔ProbeInterval往文件写一条"log sink recovered"，写成功就切回文件
+func (s *failoverState) probe(done chan struct{}) {
+	defer close(done)
+	for {
+		fire, stopTimer := clockTimer(s.clock, s.cfg.ProbeInterval)
+		select {
+		case <-s.stop:
+			stopTimer()
+			return
+		case <-fire:
+		}
+		if s.tryRecover() {
+			return
+		}
+	}
+}
+
+func (s *failoverState) tryRecover() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return true
+	}
+	fields := []zapcore.Field{zap.Duration("degraded_for", s.clock.Now().Sub(s.since))}
+	ent := s.entry(zapcore.WarnLevel, "log sink recovered")
+	if s.primary.Write(ent, fields) != nil {
+		return false
+	}
+	s.degraded = false
+	s.errors = 0
+	_ = s.fallback.Write(ent, fields)
+	return true
+}
+
+// entry 切换和恢复时记录的日志
+func (s *failoverState) entry(level zapcore.Level, msg string) zapcore.Entry {
+	return zapcore.Entry{Level: level, Time: s.clock.Now(), Message: msg}
+}
+
+func (s *failoverState) close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.stop)
+	done := s.done
+	s.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// newFailoverCores 按cfg.Failover包装写文件的cores，失败时用encoder写到ws
+func newFailoverCores(cores []zapcore.Core, encoder zapcore.Encoder, ws zapcore.WriteSyncer, cfg FailoverConfig, clock Clock) ([]zapcore.Core, []*failoverCore) {
+	out := make([]zapcore.Core, len(cores))
+	failovers := make([]*failoverCore, len(cores))
+	for i, core := range cores {
+		fallback := zapcore.NewCore(encoder.Clone(), zapcore.Lock(ws), core)
+		failovers[i] = newFailoverCore(core, fallback, cfg, clock)
+		out[i] = failovers[i]
+	}
+	return out, failovers
+}
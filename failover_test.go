@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+)
+
+// switchableWriteSyncer 模拟日志盘：failing为true时写入失败，否则记录写入的内容
+type switchableWriteSyncer struct {
+	mu       sync.Mutex
+	failing  bool
+	attempts int
+	out      strings.Builder
+}
+
+func (s *switchableWriteSyncer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.failing {
+		return 0, errors.New("no space left on device")
+	}
+	return s.out.Write(p)
+}
+
+func (s *switchableWriteSyncer) Sync() error { return nil }
+
+func (s *switchableWriteSyncer) setFailing(failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+}
+
+func (s *switchableWriteSyncer) stats() (int, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts, s.out.String()
+}
+
+// newTestFailover 用disk作为日志文件构建failoverCore，切换后写到返回的Buffer
+func newTestFailover(t *testing.T, clock Clock, cfg FailoverConfig) (*zap.Logger, *failoverCore, *switchableWriteSyncer, *zaptest.Buffer) {
+	t.Helper()
+	disk := &switchableWriteSyncer{}
+	stderr := &zaptest.Buffer{}
+	encCfg := zap.NewProductionEncoderConfig()
+	encCfg.TimeKey = ""
+	primary := zapcore.NewCore(zapcore.NewJSONEncoder(encCfg), disk, zapcore.DebugLevel)
+	cores, failovers := newFailoverCores([]zapcore.Core{primary}, zapcore.NewConsoleEncoder(encCfg), stderr, cfg, clock)
+	t.Cleanup(failovers[0].close)
+	return zap.New(cores[0], zap.ErrorOutput(zapcore.AddSync(ioutil.Discard))), failovers[0], disk, stderr
+}
+
+func TestFailoverSwitchesToStderr(t *testing.T) {
+	l, c, disk, stderr := newTestFailover(t, NewManualClock(fixedTime), FailoverConfig{MaxErrors: 3, ProbeInterval: time.Second})
+	disk.setFailing(true)
+
+	l.Info("lost 1")
+	l.Info("lost 2")
+	if c.state.isDegraded() || stderr.String() != "" {
+		t.Fatalf("should not switch before MaxErrors, stderr:\n%s", stderr.String())
+	}
+	l.Info("third failure")
+	if !c.state.isDegraded() {
+		t.Fatal("should switch to stderr after 3 consecutive errors")
+	}
+	l.Info("while degraded")
+
+	lines := stderr.Lines()
+	if len(lines) != 3 {
+		t.Fatalf("stderr:\n%s", stderr.String())
+	}
+	if !strings.Contains(lines[0], "error\tlog sink degraded") || !strings.Contains(lines[0], `"consecutive_errors": 3`) ||
+		!strings.Contains(lines[0], "no space left on device") {
+		t.Errorf("degraded entry = %s", lines[0])
+	}
+	if !strings.Contains(lines[1], "third failure") || !strings.Contains(lines[2], "while degraded") {
+		t.Errorf("entries should go to stderr in the console format:\n%s", stderr.String())
+	}
+	if attempts, _ := disk.stats(); attempts != 3 {
+		t.Errorf("file written %d times, want no attempts after switching", attempts)
+	}
+}
+
+func TestFailoverCountsConsecutiveErrors(t *testing.T) {
+	l, c, disk, _ := newTestFailover(t, NewManualClock(fixedTime), FailoverConfig{MaxErrors: 2})
+	for i := 0; i < 3; i++ {
+		disk.setFailing(true)
+		l.Info("fails")
+		disk.setFailing(false)
+		l.Info("succeeds")
+	}
+	if c.state.isDegraded() {
+		t.Error("errors separated by successful writes must not trigger the switch")
+	}
+}
+
+func TestFailoverRecovers(t *testing.T) {
+	clock := NewManualClock(fixedTime)
+	l, c, disk, stderr := newTestFailover(t, clock, FailoverConfig{MaxErrors: 1, ProbeInterval: time.Second})
+	disk.setFailing(true)
+	l.Info("disk gone")
+	if !c.state.isDegraded() {
+		t.Fatal("should switch after the first error")
+	}
+
+	// 磁盘还没恢复时探测失败，继续写stderr
+	waitForScheduler(t, clock)
+	clock.Add(time.Second)
+	waitForScheduler(t, clock)
+	if !c.state.isDegraded() {
+		t.Fatal("probe should fail while the disk is still failing")
+	}
+
+	disk.setFailing(false)
+	clock.Add(time.Second)
+	waitFor(t, 5*time.Second, "the sink to recover", func() bool { return !c.state.isDegraded() })
+	l.Info("back on disk")
+
+	_, file := disk.stats()
+	lines := strings.Split(strings.TrimSpace(file), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"msg":"log sink recovered"`) || !strings.Contains(lines[0], `"degraded_for":2`) ||
+		!strings.Contains(lines[1], "back on disk") {
+		t.Errorf("file:\n%s", file)
+	}
+	if out := stderr.String(); !strings.Contains(out, "warn\tlog sink recovered") || strings.Contains(out, "back on disk") {
+		t.Errorf("stderr:\n%s", out)
+	}
+	if n := pendingTimers(clock); n != 0 {
+		t.Errorf("probing should stop after recovery, %d timers pending", n)
+	}
+}
+
+func TestFailoverCloseStopsProbe(t *testing.T) {
+	clock := NewManualClock(fixedTime)
+	l, c, disk, _ := newTestFailover(t, clock, FailoverConfig{MaxErrors: 1, ProbeInterval: time.Second})
+	disk.setFailing(true)
+	l.Info("disk gone")
+	waitForScheduler(t, clock)
+
+	done := make(chan struct{})
+	go func() {
+		c.close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close did not stop the probe goroutine")
+	}
+	c.close()
+}
+
+func TestFailoverWithLogger(t *testing.T) {
+	stderr := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	b, err := newLogger(WithConfig(cfg), WithFailover(FailoverConfig{}), WithStderrOutput(stderr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.close()
+	if len(b.failovers) != 1 {
+		t.Fatalf("got %d failover cores, want 1", len(b.failovers))
+	}
+	b.logger.Info("healthy")
+	if stderr.String() != "" || !strings.Contains(readFile(t, cfg.Filename), "healthy") {
+		t.Errorf("healthy writes should only go to the file, stderr:\n%s", stderr.String())
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+Fatal时的处理
+logger.Fatal默认写完日志直接os.Exit(1)，来不及执行清理逻辑。
+这里通过zap.WithFatalHook安装fatalHook：先Sync所有core，保证Fatal这一行已经落盘，
+再依次执行注册的回调（WithOnFatal），最后退出。测试时可以用WithFatalPanic改成panic，避免进程退出。
+*/
+
+type fatalHook struct {
+	core      zapcore.Core // Fatal时需要Sync的core
+	callbacks []func()
+	panic     bool
+}
+
+func (h *fatalHook) OnWrite(ce *zapcore.CheckedEntry, _ []zapcore.Field) {
+	if h.core != nil {
+		_ = h.core.Sync()
+	}
+	for _, fn := range h.callbacks {
+		fn()
+	}
+	if h.panic {
+		panic(ce.Message)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envFatalLog 子进程中TestFatalFlushesBeforeExit写日志的文件
+const envFatalLog = "ZAP_LUMBERJACK_FATAL_LOG"
+
+func TestFatalFlushesBeforeExit(t *testing.T) {
+	if path := os.Getenv(envFatalLog); path != "" {
+		// 子进程：缓冲写入且FlushInterval很长，只有fatalHook先Sync，Fatal这一行才会落盘
+		cfg := defaultLogConfig()
+		cfg.Filename = path
+		cfg.BufferSize = 1 << 20
+		cfg.FlushInterval = time.Hour
+		l, err := NewLogger(WithConfig(cfg), WithOnFatal(func() {
+			_ = ioutil.WriteFile(path+".callback", []byte(readFile(t, path)), 0644)
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Info("before fatal")
+		l.Fatal("fatal line")
+		return
+	}
+
+	path := tempLogFile(t)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFatalFlushesBeforeExit$")
+	cmd.Env = append(os.Environ(), envFatalLog+"="+path)
+	out, err := cmd.CombinedOutput()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("subprocess should exit with status 1, got %v\n%s", err, out)
+	}
+
+	log := readFile(t, path)
+	if !strings.Contains(log, "before fatal") || !strings.Contains(log, "fatal line") {
+		t.Errorf("fatal line not flushed to the log file:\n%s", log)
+	}
+	// 回调在Sync之后执行，此时文件中已经有Fatal这一行
+	if snapshot := readFile(t, path+".callback"); !strings.Contains(snapshot, "fatal line") {
+		t.Errorf("OnFatal callback should run after the fatal line is flushed, saw:\n%s", snapshot)
+	}
+}
+
+func TestFatalPanic(t *testing.T) {
+	var called []string
+	l, logs := newObservedLogger(t, WithFatalPanic(),
+		WithOnFatal(func() { called = append(called, "first") }, func() { called = append(called, "second") }))
+
+	defer func() {
+		if r := recover(); r != "fatal in test" {
+			t.Errorf("recovered %v, want the fatal message", r)
+		}
+		if strings.Join(called, ",") != "first,second" {
+			t.Errorf("callbacks = %v, want first,second in order", called)
+		}
+		if logs.FilterMessage("fatal in test").Len() != 1 {
+			t.Error("fatal entry should be written before panicking")
+		}
+	}()
+	l.Fatal("fatal in test")
+	t.Fatal("Fatal should not return")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"runtime/debug"
+
+	"go.uber.org/zap"
+)
+
+/*
+=============================================================
+每条日志都带上的全局字段
+*/
+
+// readBuildInfo 读取编译进二进制的模块信息，测试时可以替换
+var readBuildInfo = debug.ReadBuildInfo
+
+// develVersion go build/go run编译主模块时ReadBuildInfo返回的版本，不是真正的版本号
+const develVersion = "(devel)"
+
+// buildVersion 返回debug.ReadBuildInfo中主模块的版本，读不到或者是(devel)时返回空
+func buildVersion() string {
+	info, ok := readBuildInfo()
+	if !ok || info.Main.Version == develVersion {
+		return ""
+	}
+	return info.Main.Version
+}
+
+// serviceFields 根据配置生成服务名、版本和环境字段，为空的不输出。
+// 没有配置版本时从debug.ReadBuildInfo读取主模块版本
+func serviceFields(cfg LogConfig) []zap.Field {
+	version := cfg.ServiceVersion
+	if version == "" {
+		version = buildVersion()
+	}
+	if cfg.ECS {
+		return ecsServiceFields(cfg, version)
+	}
+	var fields []zap.Field
+	if cfg.ServiceName != "" {
+		fields = append(fields, zap.String("service", cfg.ServiceName))
+	}
+	if version != "" {
+		fields = append(fields, zap.String("version", version))
+	}
+	if cfg.Env != "" {
+		fields = append(fields, zap.String("env", cfg.Env))
+	}
+	if cfg.HostInfo {
+		fields = append(fields, hostFields()...)
+	}
+	return fields
+}
+
+// hostFields 在初始化时获取一次hostname和pid，获取hostname失败时使用"unknown"
+func hostFields() []zap.Field {
+	host, pid := hostInfo()
+	return []zap.Field{
+		zap.String("hostname", host),
+		zap.Int("pid", pid),
+	}
+}
+
+// hostInfo 通过path.go中的hostname和getpid返回主机名和进程号，获取主机名失败时使用"unknown"
+func hostInfo() (host string, pid int) {
+	host, err := hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return host, getpid()
+}
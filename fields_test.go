@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"runtime/debug"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newObservedLogger 按opts构建logger，日志写到observer而不是文件或console
+func newObservedLogger(t *testing.T, opts ...Option) (*zap.Logger, *observer.ObservedLogs) {
+	t.Helper()
+	core, logs := observer.New(zapcore.DebugLevel)
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	opts = append([]Option{WithConfig(cfg), WithConsoleOutput(zapcore.AddSync(ioutil.Discard))}, opts...)
+	opts = append(opts, WithPrimarySink(func(zapcore.WriteSyncer) (zapcore.Core, error) { return core, nil }))
+	b, err := newLogger(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.close() })
+	return b.logger, logs
+}
+
+// fakeHost 替换hostname和getpid
+func fakeHost(t *testing.T, host string, err error, pid int) {
+	t.Helper()
+	oldHostname, oldGetpid := hostname, getpid
+	hostname = func() (string, error) { return host, err }
+	getpid = func() int { return pid }
+	t.Cleanup(func() { hostname, getpid = oldHostname, oldGetpid })
+}
+
+func TestWithHostInfo(t *testing.T) {
+	fakeHost(t, "web-1", nil, 4242)
+	l, logs := newObservedLogger(t, WithHostInfo())
+	l.Info("with host")
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["hostname"] != "web-1" || fields["pid"] != int64(4242) {
+		t.Errorf("hostname = %v, pid = %v, want the values from the hooks", fields["hostname"], fields["pid"])
+	}
+}
+
+func TestHostInfoUnknownFallback(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		err  error
+	}{
+		{"error", "", errors.New("no uts namespace")},
+		{"empty", "", nil},
+		{"error with name", "partial", errors.New("truncated")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeHost(t, tt.host, tt.err, 7)
+			if host, pid := hostInfo(); host != "unknown" || pid != 7 {
+				t.Errorf("hostInfo() = %q, %d, want unknown, 7", host, pid)
+			}
+			l, logs := newObservedLogger(t, WithHostInfo())
+			l.Info("with host")
+			if got := logs.All()[0].ContextMap()["hostname"]; got != "unknown" {
+				t.Errorf("hostname field = %v, want unknown", got)
+			}
+			// ECS的host.hostname同样来自hostInfo
+			enc := zapcore.NewMapObjectEncoder()
+			for _, f := range ecsServiceFields(LogConfig{HostInfo: true}, "") {
+				f.AddTo(enc)
+			}
+			if enc.Fields["host.hostname"] != "unknown" || enc.Fields["process.pid"] != int64(7) {
+				t.Errorf("ECS fields = %v, want the unknown fallback and the hooked pid", enc.Fields)
+			}
+		})
+	}
+}
+
+func TestWithoutHostInfo(t *testing.T) {
+	l, logs := newObservedLogger(t)
+	l.Info("without host")
+
+	fields := logs.All()[0].ContextMap()
+	if _, ok := fields["hostname"]; ok {
+		t.Errorf("hostname should be opt-in, got %v", fields)
+	}
+	if _, ok := fields["pid"]; ok {
+		t.Errorf("pid should be opt-in, got %v", fields)
+	}
+}
+
+// fakeBuildInfo 替换readBuildInfo，ok为false时表示读不到构建信息
+func fakeBuildInfo(t *testing.T, version string, ok bool) {
+	t.Helper()
+	old := readBuildInfo
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		if !ok {
+			return nil, false
+		}
+		return &debug.BuildInfo{Main: debug.Module{Path: "study-zap-lumberjack", Version: version}}, true
+	}
+	t.Cleanup(func() { readBuildInfo = old })
+}
+
+func TestServiceFieldsInFileAndGinEntries(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.Encoding = EncodingJSON
+	cfg.ServiceName = "orders"
+	cfg.ServiceVersion = "v1.4.0"
+	cfg.Env = "staging"
+	l, _, err := InitLoggerWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("app entry")
+	serveGin(http.MethodGet, "/orders", GinLogger(GetLogger(ginAccessLoggerName)), GinRecovery(l, false))
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := decodeJSONLines(t, readLines(t, cfg.Filename))
+	msgs := make(map[interface{}]bool)
+	for _, e := range entries {
+		msgs[e["msg"]] = true
+		if e["service"] != "orders" || e["version"] != "v1.4.0" || e["env"] != "staging" {
+			t.Errorf("entry %v is missing the service fields", e)
+		}
+	}
+	if !msgs["app entry"] || !msgs["/orders"] {
+		t.Errorf("want both the app and the gin entry, got %v", entries)
+	}
+}
+
+func TestServiceVersionFromBuildInfo(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         LogConfig
+		build       string
+		ok          bool
+		wantVersion interface{}
+	}{
+		{name: "module version", build: "v2.1.0", ok: true, wantVersion: "v2.1.0"},
+		{name: "module version with service", cfg: LogConfig{ServiceName: "orders"}, build: "v2.1.0", ok: true, wantVersion: "v2.1.0"},
+		{name: "devel", cfg: LogConfig{ServiceName: "orders"}, build: develVersion, ok: true},
+		{name: "no build info", cfg: LogConfig{ServiceName: "orders"}},
+		{name: "configured wins", cfg: LogConfig{ServiceVersion: "v9"}, build: "v2.1.0", ok: true, wantVersion: "v9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeBuildInfo(t, tt.build, tt.ok)
+			enc := zapcore.NewMapObjectEncoder()
+			for _, f := range serviceFields(tt.cfg) {
+				f.AddTo(enc)
+			}
+			if got := enc.Fields["version"]; got != tt.wantVersion {
+				t.Errorf("version = %v, want %v (fields %v)", got, tt.wantVersion, enc.Fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+=============================================================
+命令行参数
+从systemd unit启动时习惯用命令行参数调整日志：-log-level、-log-file、-log-max-size。
+优先级：命令行参数 > 环境变量 > 配置文件 > 默认值。
+命令行里显式设置过的值会被记录下来，InitLoggerWithConfig在应用环境变量之后再应用它们，
+所以不管最终用哪个LogConfig初始化，命令行参数总是生效。
+*/
+
+var (
+	flagMu        sync.Mutex
+	flagOverrides []func(*LogConfig) // 命令行中显式设置过的参数
+)
+
+// configFlag 通过get/set读写LogConfig字段的flag.Value
+type configFlag struct {
+	get func() string
+	set func(string) error
+}
+
+func (f configFlag) String() string {
+	if f.get == nil {
+		return ""
+	}
+	return f.get()
+}
+
+func (f configFlag) Set(s string) error {
+	return f.set(s)
+}
+
+// RegisterFlags 在fs上注册-log-level、-log-file、-log-max-size，返回绑定了这些参数的LogConfig（初始为默认值）。
+// 非法的级别或大小会让fs.Parse返回错误（flag.CommandLine会直接打印用法并退出），此时还没有开始记录日志
+func RegisterFlags(fs *flag.FlagSet) *LogConfig {
+	cfg := defaultLogConfig()
+	fs.Var(configFlag{
+		get: func() string { return cfg.Level },
+		set: func(s string) error {
+			l, err := ParseLevel(s)
+			if err != nil {
+				return err
+			}
+			setFlagOverride(&cfg, func(c *LogConfig) { c.Level = l.String() })
+			return nil
+		},
+	}, "log-level", "日志级别：debug、info、warn、error、dpanic、panic、fatal")
+	fs.Var(configFlag{
+		get: func() string { return cfg.Filename },
+		set: func(s string) error {
+			s = strings.TrimSpace(s)
+			setFlagOverride(&cfg, func(c *LogConfig) { c.Filename = s })
+			return nil
+		},
+	}, "log-file", "日志文件的位置，为空时只输出到console")
+	fs.Var(configFlag{
+		get: func() string { return strconv.Itoa(cfg.MaxSize) },
+		set: func(s string) error {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid max size %q, want a positive number of MB", s)
+			}
+			setFlagOverride(&cfg, func(c *LogConfig) { c.MaxSize = n })
+			return nil
+		},
+	}, "log-max-size", "切割之前日志文件的最大大小（以MB为单位）")
+	return &cfg
+}
+
+// setFlagOverride 立即修改cfg，并记录下来供之后的初始化使用
+func setFlagOverride(cfg *LogConfig, fn func(*LogConfig)) {
+	fn(cfg)
+	flagMu.Lock()
+	defer flagMu.Unlock()
+	flagOverrides = append(flagOverrides, fn)
+}
+
+// applyFlagOverrides 用命令行中显式设置过的参数覆盖cfg
+func applyFlagOverrides(cfg LogConfig) LogConfig {
+	flagMu.Lock()
+	defer flagMu.Unlock()
+	for _, fn := range flagOverrides {
+		fn(&cfg)
+	}
+	return cfg
+}
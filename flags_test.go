@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// resetFlagOverrides 清空已记录的命令行参数，测试结束时恢复
+func resetFlagOverrides(t *testing.T) {
+	t.Helper()
+	flagMu.Lock()
+	saved := flagOverrides
+	flagOverrides = nil
+	flagMu.Unlock()
+	t.Cleanup(func() {
+		flagMu.Lock()
+		flagOverrides = saved
+		flagMu.Unlock()
+	})
+}
+
+// parseFlags 在新的FlagSet上注册并解析args
+func parseFlags(t *testing.T, args ...string) (*LogConfig, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	cfg := RegisterFlags(fs)
+	return cfg, fs.Parse(args)
+}
+
+func TestRegisterFlags(t *testing.T) {
+	resetFlagOverrides(t)
+	cfg, err := parseFlags(t, "-log-level", "WARN", "-log-file", "/tmp/flag.log", "-log-max-size", "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Level != "warn" || cfg.Filename != "/tmp/flag.log" || cfg.MaxSize != 42 {
+		t.Errorf("got level=%q file=%q max_size=%d", cfg.Level, cfg.Filename, cfg.MaxSize)
+	}
+	// 没有设置的参数保持默认值
+	if def := defaultLogConfig(); cfg.MaxBackups != def.MaxBackups || cfg.Encoding != def.Encoding {
+		t.Errorf("unset flags should keep defaults, got %+v", cfg)
+	}
+}
+
+func TestRegisterFlagsInvalid(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{args: []string{"-log-level", "verbose"}, wantErr: `invalid log level "verbose"`},
+		{args: []string{"-log-max-size", "0"}, wantErr: `invalid max size "0"`},
+		{args: []string{"-log-max-size", "big"}, wantErr: `invalid max size "big"`},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			resetFlagOverrides(t)
+			_, err := parseFlags(t, tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+			if applyFlagOverrides(defaultLogConfig()).Level != defaultLogConfig().Level {
+				t.Error("an invalid flag should not be recorded as an override")
+			}
+		})
+	}
+}
+
+func TestFlagPrecedence(t *testing.T) {
+	tests := []struct {
+		name      string
+		flags     []string
+		env       map[string]string
+		fileLevel string
+		want      string
+	}{
+		{name: "defaults", want: "debug"},
+		{name: "config file", fileLevel: "info", want: "info"},
+		{name: "env over config file", fileLevel: "info", env: map[string]string{envLogLevel: "warn"}, want: "warn"},
+		{name: "flag over env", fileLevel: "info", env: map[string]string{envLogLevel: "warn"}, flags: []string{"-log-level", "error"}, want: "error"},
+		{name: "flag over config file", fileLevel: "info", flags: []string{"-log-level", "error"}, want: "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlagOverrides(t)
+			unsetLogEnv(t)
+			for k, v := range tt.env {
+				setEnv(t, k, v)
+			}
+			if _, err := parseFlags(t, tt.flags...); err != nil {
+				t.Fatal(err)
+			}
+			cfg := defaultLogConfig()
+			if tt.fileLevel != "" {
+				cfg.Level = tt.fileLevel
+			}
+			if got := applyFlagOverrides(applyEnvOverrides(cfg)).Level; got != tt.want {
+				t.Errorf("level = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+GELF Encoder
+Graylog从文件读取GELF 1.1格式的日志，Encoding配置为gelf时使用，仍然写到lumberjack文件，每条一行：
+	{"version":"1.1","host":"web-1","short_message":"/hello","timestamp":1577934245.006,"level":6,"_http_status":200}
+level使用syslog severity（见levelSeverity），timestamp是带毫秒的秒数。
+其余字段都是附加字段，名字前加_，嵌套的对象用_连接展开，值只能是字符串或数字。
+消息有多行时short_message只取第一行，完整的消息放在full_message。
+全局logger使用gelf时GinLogger的字段放到http下，输出为_http_status、_http_method等。
+*/
+
+const gelfVersion = "1.1"
+
+// gelfEncoder 字段先收集到MapObjectEncoder，EncodeEntry时再展开成GELF的附加字段
+type gelfEncoder struct {
+	*zapcore.MapObjectEncoder
+	cfg  *zapcore.EncoderConfig
+	host string
+}
+
+// newGELFEncoder 使用cfg创建GELF Encoder，cfg中只有key是否为空（是否输出）和EncodeCaller生效
+func newGELFEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	host, _ := hostInfo()
+	return &gelfEncoder{MapObjectEncoder: zapcore.NewMapObjectEncoder(), cfg: &cfg, host: host}
+}
+
+func (enc *gelfEncoder) Clone() zapcore.Encoder {
+	clone := &gelfEncoder{MapObjectEncoder: zapcore.NewMapObjectEncoder(), cfg: enc.cfg, host: enc.host}
+	for k, v := range enc.Fields {
+		clone.Fields[k] = v
+	}
+	return clone
+}
+
+func (enc *gelfEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	m := enc.Clone().(*gelfEncoder)
+	for i := range fields {
+		fields[i].AddTo(m)
+	}
+	additional := make(map[string]interface{}, len(m.Fields)+4)
+	for k, v := range m.Fields {
+		gelfFlatten(additional, "_"+k, v)
+	}
+	if ent.LoggerName != "" && enc.cfg.NameKey != "" {
+		additional["_logger"] = ent.LoggerName
+	}
+	if ent.Caller.Defined && enc.cfg.CallerKey != "" && enc.cfg.EncodeCaller != nil {
+		var caller logfmtPrimitives
+		enc.cfg.EncodeCaller(ent.Caller, &caller)
+		additional["_caller"] = strings.Join(caller, ",")
+	}
+	if ent.Caller.Defined && enc.cfg.FunctionKey != "" {
+		additional["_func"] = ent.Caller.Function
+	}
+	if ent.Stack != "" && enc.cfg.StacktraceKey != "" {
+		additional["_stacktrace"] = ent.Stack
+	}
+	if id, ok := additional["_id"]; ok { // GELF保留_id，改名为__id
+		delete(additional, "_id")
+		additional["__id"] = id
+	}
+
+	short := ent.Message
+	if i := strings.IndexAny(short, "\r\n"); i >= 0 {
+		short = short[:i]
+	}
+	buf := bufferPool.Get()
+	buf.AppendString(`{"version":"` + gelfVersion + `","host":`)
+	gelfAppendJSON(buf, enc.host)
+	buf.AppendString(`,"short_message":`)
+	gelfAppendJSON(buf, short)
+	if short != ent.Message {
+		buf.AppendString(`,"full_message":`)
+		gelfAppendJSON(buf, ent.Message)
+	}
+	buf.AppendString(`,"timestamp":`)
+	buf.AppendString(strconv.FormatFloat(float64(ent.Time.UnixNano()/int64(time.Millisecond))/1000, 'f', 3, 64))
+	buf.AppendString(`,"level":`)
+	buf.AppendInt(levelSeverity(ent.Level))
+
+	keys := make([]string, 0, len(additional))
+	for k := range additional {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		buf.AppendByte(',')
+		gelfAppendJSON(buf, k)
+		buf.AppendByte(':')
+		gelfAppendJSON(buf, additional[k])
+	}
+	buf.AppendByte('}')
+	if enc.cfg.LineEnding != "" {
+		buf.AppendString(enc.cfg.LineEnding)
+	} else {
+		buf.AppendString(zapcore.DefaultLineEnding)
+	}
+	return buf, nil
+}
+
+// gelfFlatten 把MapObjectEncoder收集到的值展开为GELF的附加字段，值只保留字符串和数字
+func gelfFlatten(out map[string]interface{}, key string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			gelfFlatten(out, key+"_"+k, elem)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			gelfFlatten(out, key+"_"+strconv.Itoa(i), elem)
+		}
+	case string:
+		out[key] = v
+	case bool:
+		out[key] = strconv.FormatBool(v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr, float32, float64:
+		out[key] = v
+	case time.Duration:
+		out[key] = v.Seconds()
+	case time.Time:
+		out[key] = float64(v.UnixNano()/int64(time.Millisecond)) / 1000
+	case []byte:
+		out[key] = string(v)
+	case nil:
+		out[key] = "null"
+	default:
+		// zap.Any等反射得到的值先转成JSON再展开
+		data, err := json.Marshal(v)
+		if err != nil {
+			out[key] = fmt.Sprint(v)
+			return
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			out[key] = string(data)
+			return
+		}
+		if s, ok := decoded.(string); ok {
+			out[key] = s
+			return
+		}
+		gelfFlatten(out, key, decoded)
+	}
+}
+
+// gelfAppendJSON 把v编码为JSON写入buf，编码失败时写入其字符串形式
+func gelfAppendJSON(buf *buffer.Buffer, v interface{}) {
+	if f, ok := v.(float64); ok {
+		buf.AppendString(strconv.FormatFloat(f, 'f', -1, 64))
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	_, _ = buf.Write(data)
+}
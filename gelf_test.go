@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+// gelfFieldName GELF 1.1对附加字段名的要求
+var gelfFieldName = regexp.MustCompile(`^_[\w\.\-]*$`)
+
+// checkGELF 按GELF 1.1检查一条日志，返回解析出的对象
+func checkGELF(t *testing.T, line string) map[string]interface{} {
+	t.Helper()
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		t.Fatalf("invalid JSON %q: %v", line, err)
+	}
+	if m["version"] != "1.1" {
+		t.Errorf("version = %v, want 1.1", m["version"])
+	}
+	if host, ok := m["host"].(string); !ok || host == "" {
+		t.Errorf("host = %v, want a non-empty string", m["host"])
+	}
+	if msg, ok := m["short_message"].(string); !ok || msg == "" {
+		t.Errorf("short_message = %v, want a non-empty string", m["short_message"])
+	}
+	if _, ok := m["timestamp"].(float64); !ok {
+		t.Errorf("timestamp = %v, want a number", m["timestamp"])
+	}
+	if level, ok := m["level"].(float64); !ok || level < 0 || level > 7 {
+		t.Errorf("level = %v, want a syslog severity", m["level"])
+	}
+	for k, v := range m {
+		switch k {
+		case "version", "host", "short_message", "full_message", "timestamp", "level":
+			continue
+		}
+		if !gelfFieldName.MatchString(k) || k == "_id" {
+			t.Errorf("invalid additional field name %q", k)
+		}
+		switch v.(type) {
+		case string, float64:
+		default:
+			t.Errorf("additional field %s = %v (%T), want a string or number", k, v, v)
+		}
+	}
+	return m
+}
+
+// newGELFLogger 构建输出到buffer的gelf logger
+func newGELFLogger(t *testing.T, clock Clock) (*builtLogger, *zaptest.Buffer) {
+	t.Helper()
+	out := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingGELF
+	b, err := newLogger(WithConfig(cfg), WithConsoleOutput(out), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.close() })
+	return b, out
+}
+
+func TestGELFEntry(t *testing.T) {
+	b, out := newGELFLogger(t, NewManualClock(fixedTime.Add(6*time.Millisecond)))
+	b.logger.Named("orders").Warn("slow query",
+		zap.Int("rows", 3),
+		zap.Bool("cached", false),
+		zap.Duration("cost", 1500*time.Millisecond),
+		zap.String("id", "req-1"),
+		zap.Error(errors.New("timeout")),
+		zap.Any("db", map[string]interface{}{"name": "orders", "hosts": []string{"a", "b"}}),
+	)
+
+	m := checkGELF(t, out.Lines()[0])
+	host, _ := hostInfo()
+	want := map[string]interface{}{
+		"host":          host,
+		"short_message": "slow query",
+		"timestamp":     1715940000.006,
+		"level":         float64(4),
+		"_logger":       "orders",
+		"_rows":         float64(3),
+		"_cached":       "false",
+		"_cost":         1.5,
+		"__id":          "req-1",
+		"_error":        "timeout",
+		"_db_name":      "orders",
+		"_db_hosts_0":   "a",
+		"_db_hosts_1":   "b",
+	}
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("%s = %v, want %v", k, m[k], v)
+		}
+	}
+	if _, ok := m["full_message"]; ok {
+		t.Errorf("single-line message should not have full_message: %v", m)
+	}
+}
+
+func TestGELFMultilineMessage(t *testing.T) {
+	b, out := newGELFLogger(t, NewManualClock(fixedTime))
+	b.logger.Error("first line\nsecond line\r\nthird \"line\"")
+
+	lines := out.Lines()
+	if len(lines) != 1 {
+		t.Fatalf("a GELF entry must be a single line, got %d:\n%s", len(lines), out.String())
+	}
+	m := checkGELF(t, lines[0])
+	if m["short_message"] != "first line" {
+		t.Errorf("short_message = %q, want the first line", m["short_message"])
+	}
+	if m["full_message"] != "first line\nsecond line\r\nthird \"line\"" {
+		t.Errorf("full_message = %q", m["full_message"])
+	}
+	if m["level"] != float64(3) {
+		t.Errorf("level = %v, want 3", m["level"])
+	}
+}
+
+func TestGELFGinLogger(t *testing.T) {
+	cleanupGlobalLogger(t)
+	clock := NewManualClock(fixedTime)
+	b, out := newGELFLogger(t, clock)
+	setGlobalLogger(b)
+
+	r := gin.New()
+	r.Use(GinLoggerWithClock(logger, clock))
+	r.GET("/hello", func(c *gin.Context) {
+		clock.Add(12 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/hello?x=1", nil)
+	req.RemoteAddr = "1.2.3.4:5678"
+	req.Header.Set("User-Agent", "curl/8.0")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	m := checkGELF(t, out.Lines()[len(out.Lines())-1])
+	want := map[string]interface{}{
+		"short_message":    "/hello",
+		"level":            float64(6),
+		"_http_status":     float64(200),
+		"_http_method":     "GET",
+		"_http_path":       "/hello",
+		"_http_query":      "x=1",
+		"_http_ip":         "1.2.3.4",
+		"_http_user-agent": "curl/8.0",
+		"_http_cost":       0.012,
+	}
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("%s = %v, want %v", k, m[k], v)
+		}
+	}
+}
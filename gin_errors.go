@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+gin错误列表
+GinLogger原来把c.Errors拼成一个字符串，丢掉了错误类型和Meta。
+GinErrorsField把每个错误输出为{type, error, meta}对象组成的数组，没有错误时GinLogger不输出errors字段。
+*/
+
+// ginErrorsKey GinLogger记录c.Errors使用的key
+const ginErrorsKey = "errors"
+
+// GinErrorsField 把errs输出为名为errors的数组字段
+func GinErrorsField(errs []*gin.Error) zap.Field {
+	return zap.Array(ginErrorsKey, ginErrors(errs))
+}
+
+// ginErrors 实现zapcore.ArrayMarshaler
+type ginErrors []*gin.Error
+
+func (errs ginErrors) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, e := range errs {
+		if err := enc.AppendObject(ginError{e}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ginError 实现zapcore.ObjectMarshaler，Meta为nil时不输出meta
+type ginError struct {
+	*gin.Error
+}
+
+func (e ginError) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("type", ginErrorType(e.Type))
+	enc.AddString("error", e.Error.Error())
+	if e.Meta != nil {
+		return enc.AddReflected("meta", e.Meta)
+	}
+	return nil
+}
+
+// ginErrorType 返回gin.ErrorType的名字
+func ginErrorType(t gin.ErrorType) string {
+	switch t {
+	case gin.ErrorTypeBind:
+		return "bind"
+	case gin.ErrorTypeRender:
+		return "render"
+	case gin.ErrorTypePrivate:
+		return "private"
+	case gin.ErrorTypePublic:
+		return "public"
+	case gin.ErrorTypeAny:
+		return "any"
+	}
+	return "unknown"
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap/zapcore"
+)
+
+// withGinErrors 返回一个往c.Errors里加错误的handler
+func withGinErrors(errs ...*gin.Error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, e := range errs {
+			c.Errors = append(c.Errors, e)
+		}
+	}
+}
+
+func TestGinErrorsField(t *testing.T) {
+	enc := zapcore.NewMapObjectEncoder()
+	GinErrorsField([]*gin.Error{
+		{Err: errors.New("bad id"), Type: gin.ErrorTypePublic},
+		{Err: errors.New("db down"), Type: gin.ErrorTypePrivate, Meta: map[string]interface{}{"table": "orders"}},
+		{Err: errors.New("invalid json"), Type: gin.ErrorTypeBind, Meta: "body"},
+		{Err: errors.New("odd"), Type: 1 << 20},
+	}).AddTo(enc)
+
+	want := []interface{}{
+		map[string]interface{}{"type": "public", "error": "bad id"},
+		map[string]interface{}{"type": "private", "error": "db down", "meta": map[string]interface{}{"table": "orders"}},
+		map[string]interface{}{"type": "bind", "error": "invalid json", "meta": "body"},
+		map[string]interface{}{"type": "unknown", "error": "odd"},
+	}
+	if got := enc.Fields[ginErrorsKey]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+}
+
+func TestGinLoggerErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		conf GinLoggerConfig
+	}{
+		{name: "flat"},
+		{name: "namespace", conf: GinLoggerConfig{HTTPNamespace: true}},
+		{name: "ecs", conf: GinLoggerConfig{ECS: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultLogConfig()
+			cfg.Filename = ""
+			cfg.Encoding = EncodingJSON
+			cfg.ECS = tt.conf.ECS
+			l, logs := newObservedLogger(t, WithConfig(cfg))
+			serveGin(http.MethodGet, "/orders", MustGinLoggerWithConfig(l, tt.conf), withGinErrors(
+				&gin.Error{Err: errors.New("bad id"), Type: gin.ErrorTypePublic},
+				&gin.Error{Err: errors.New("db down"), Type: gin.ErrorTypePrivate, Meta: 42},
+			))
+
+			enc := zapcore.NewMapObjectEncoder()
+			for _, f := range logs.All()[0].Context {
+				f.AddTo(enc)
+			}
+			// HTTPNamespace时errors也在http对象里
+			fields := enc.Fields
+			if tt.conf.HTTPNamespace {
+				fields = fields[httpNamespace].(map[string]interface{})
+			}
+			want := []interface{}{
+				map[string]interface{}{"type": "public", "error": "bad id"},
+				map[string]interface{}{"type": "private", "error": "db down", "meta": 42},
+			}
+			if got := fields[ginErrorsKey]; !reflect.DeepEqual(got, want) {
+				t.Errorf("errors = %v, want %v", got, want)
+			}
+			if _, ok := enc.Fields["error"]; ok {
+				t.Errorf("errors should not be flattened into a string: %v", enc.Fields)
+			}
+		})
+	}
+}
+
+func TestGinLoggerNoErrorsField(t *testing.T) {
+	for _, conf := range []GinLoggerConfig{{}, {ECS: true}} {
+		l, logs := newObservedLogger(t)
+		serveGin(http.MethodGet, "/orders", MustGinLoggerWithConfig(l, conf))
+		for _, f := range logs.All()[0].Context {
+			if f.Key == ginErrorsKey || strings.HasPrefix(f.Key, "error") {
+				t.Errorf("ECS=%v: field %s should be omitted without errors", conf.ECS, f.Key)
+			}
+		}
+	}
+}
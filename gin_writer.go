@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+gin自己的debug输出（路由注册、debug模式警告等）默认写到gin.DefaultWriter即stdout，
+不经过lumberjack。UseGinWriter把gin.DefaultWriter和gin.DefaultErrorWriter替换成写zap的io.Writer。
+*/
+
+// zapWriter 把Write的内容按行写成日志。
+// 一次Write中的多行内容会拆成多条日志（空行忽略），每行一条，便于按行检索和切割。
+// 每次Write互不影响，zap.Logger本身并发安全，所以zapWriter可以被并发使用。
+type zapWriter struct {
+	logger *zap.Logger
+	level  zapcore.Level
+}
+
+func (w *zapWriter) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(p, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if ce := w.logger.Check(w.level, string(line)); ce != nil {
+			ce.Write()
+		}
+	}
+	return len(p), nil
+}
+
+// UseGinWriter 让gin的普通输出以Info级别、错误输出以Error级别写入logger，需要在gin.New()之前调用
+func UseGinWriter(logger *zap.Logger) {
+	l := logger.Named("gin").WithOptions(zap.WithCaller(false)) // caller总是指向gin内部，没有意义
+	gin.DefaultWriter = &zapWriter{logger: l, level: zapcore.InfoLevel}
+	gin.DefaultErrorWriter = &zapWriter{logger: l, level: zapcore.ErrorLevel}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+全局logger的替换
+logger和sugarLogger是包级变量，多次调用Init函数（比如先InitLogger3再InitLogger2）时，
+如果直接赋值，旧的core被悄悄替换，旧的lumberjack文件句柄也泄漏了。
+这里统一通过setGlobalLogger替换：先Sync并关闭旧的logger，再换上新的。
+这些全局变量只是兼容层，新代码建议用Build/BuildFromConfig拿到logger后自己传递。
+
+其他包里使用zap.L()和zap.S()的代码默认拿到的是no-op logger，
+所以setGlobalLogger同时调用zap.ReplaceGlobals，
+并用zap.RedirectStdLogAt把标准库log包的输出以Info级别写进同一个core（可通过DisableStdLog关闭）。
+旧的全局logger被替换时这两步会先被撤销；InitLogger3和InitLoggerWithConfig返回的restore函数也可以手动撤销（主要给测试用）。
+*/
+
+var (
+	globalMu    sync.Mutex
+	globalBuilt *builtLogger // 当前的全局logger及其日志文件，未初始化或已Close时为nil
+	globalLevel = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	globalUndo  func() // 撤销zap.ReplaceGlobals和zap.RedirectStdLog，可能为nil
+
+	globalConfigPath string // InitLoggerFromFile使用的配置文件，其他方式初始化时为空
+
+	globalRotateSignalStop func() // 停止HandleRotateSignal的监听，没有监听时为nil
+
+	namedLoggers = make(map[string]*zap.Logger) // GetLogger创建的子logger，全局logger替换时清空
+)
+
+// setGlobalLogger 拆掉旧的全局logger（Sync并关闭其writer），再设置新的logger和sugarLogger。
+// 可并发调用，最后一次调用生效。返回的restore撤销这次对zap.L()/zap.S()和标准库log的替换
+func setGlobalLogger(b *builtLogger) (restore func()) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+
+	if logger != nil {
+		_ = logger.Sync() // 输出到stderr时Sync可能返回invalid argument，忽略
+	}
+	if globalBuilt != nil {
+		_ = globalBuilt.close()
+	}
+	if globalUndo != nil {
+		globalUndo()
+	}
+	logger = b.logger
+	sugarLogger = logger.Sugar()
+	namedLoggers = make(map[string]*zap.Logger)
+	globalBuilt = b
+	globalLevel = b.level
+	globalConfigPath = ""
+
+	undoGlobals := zap.ReplaceGlobals(logger)
+	undoStdLog := func() {}
+	if b.stdLog {
+		// zap撤销重定向时把log的输出改回os.Stderr，这里改回重定向之前的输出
+		prevOut := log.Writer()
+		if undo, err := zap.RedirectStdLogAt(logger, zapcore.InfoLevel); err == nil {
+			undoStdLog = func() {
+				undo()
+				log.SetOutput(prevOut)
+			}
+		}
+	}
+	globalUndo = func() {
+		undoStdLog()
+		undoGlobals()
+	}
+	return func() { restoreGlobals(b) }
+}
+
+// restoreGlobals 撤销b初始化时对zap.L()/zap.S()和标准库log的替换，恢复到初始化之前的状态，
+// 包内的logger和sugarLogger不受影响。b已经被替换或关闭时什么都不做，不会撤销之后的初始化
+func restoreGlobals(b *builtLogger) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+
+	if globalBuilt == b && globalUndo != nil {
+		globalUndo()
+		globalUndo = nil
+	}
+}
+
+// globalGinLoggerConfig GinLogger按全局logger的配置选择输出格式：ECS按ECS字段名输出，GELF把字段放到http下
+func globalGinLoggerConfig() GinLoggerConfig {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	if globalBuilt == nil {
+		return GinLoggerConfig{}
+	}
+	return GinLoggerConfig{ECS: globalBuilt.ecs, HTTPNamespace: globalBuilt.gelf}
+}
+
+// GetLogger 返回全局logger名为name的子logger，日志中会带上"logger":name字段，
+// 与全局logger共用同一个core和lumberjack文件。同一个name返回同一个实例，可并发调用。
+// 需要在InitLogger系列函数之后调用
+func GetLogger(name string) *zap.Logger {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+
+	if l, ok := namedLoggers[name]; ok {
+		return l
+	}
+	l := logger.Named(name)
+	namedLoggers[name] = l
+	return l
+}
+
+// WrapLogger 返回跳过skip层栈帧的全局logger，给包装日志函数的helper使用，
+// 这样caller字段指向helper的调用处而不是helper本身
+func WrapLogger(skip int) *zap.Logger {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	return logger.WithOptions(zap.AddCallerSkip(skip))
+}
+
+// WrapSugaredLogger 同WrapLogger，返回SugaredLogger
+func WrapSugaredLogger(skip int) *zap.SugaredLogger {
+	return WrapLogger(skip).Sugar()
+}
+
+// Close 关闭全局logger：Sync之后关闭底层的lumberjack文件句柄，并撤销对zap全局logger和标准库log的替换，
+// HandleRotateSignal的监听也会停止。
+// Close之后仍持有旧logger的代码写入的日志会输出到stderr，不会重新打开日志文件
+func Close() error {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+
+	var err error
+	if logger != nil {
+		_ = logger.Sync()
+	}
+	if globalBuilt != nil {
+		err = globalBuilt.close()
+		globalBuilt = nil
+	}
+	if globalUndo != nil {
+		globalUndo()
+		globalUndo = nil
+	}
+	if globalRotateSignalStop != nil {
+		globalRotateSignalStop()
+		globalRotateSignalStop = nil
+	}
+	return err
+}
+
+// Rotate 立即切割全局logger的日志文件（包括ErrorFile），之后的日志写入新文件，
+// 例如打包日志之前先切出一个新文件。可以与写日志并发调用，只输出到console时什么都不做
+func Rotate() error {
+	globalMu.Lock()
+	b := globalBuilt
+	globalMu.Unlock()
+
+	if b == nil {
+		return nil
+	}
+	return b.rotate()
+}
+
+// Level 返回全局logger的AtomicLevel，可以直接用作http.Handler动态调整级别
+func Level() zap.AtomicLevel {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	return globalLevel
+}
+
+// SetLevel 修改全局logger的级别，对logger和sugarLogger立即生效，不需要重建core
+func SetLevel(l zapcore.Level) {
+	Level().SetLevel(l)
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newTestBuiltLogger 用临时文件构建一个builtLogger
+func newTestBuiltLogger(t *testing.T, opts ...Option) (*builtLogger, string) {
+	t.Helper()
+	path := tempLogFile(t)
+	b, err := newLogger(append([]Option{WithConfig(defaultLogConfig()), WithFile(path)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, path
+}
+
+// fileClosed 返回日志文件是否已经关闭
+func fileClosed(w *fileWriteSyncer) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closed
+}
+
+func TestSetGlobalLoggerSequential(t *testing.T) {
+	cleanupGlobalLogger(t)
+	first, firstPath := newTestBuiltLogger(t)
+	setGlobalLogger(first)
+	old := logger
+	old.Info("first logger")
+
+	second, secondPath := newTestBuiltLogger(t)
+	setGlobalLogger(second)
+	logger.Info("second logger")
+	_ = logger.Sync()
+
+	if !fileClosed(first.file) {
+		t.Error("first log file should be closed after re-init")
+	}
+	if fileClosed(second.file) {
+		t.Error("second log file should stay open")
+	}
+	// 旧logger的文件句柄已经释放，继续写入时输出到stderr
+	stderr := captureStderr(t, func() { old.Info("stale write") })
+	if !strings.Contains(stderr, "stale write") {
+		t.Errorf("stale write should go to stderr, got %q", stderr)
+	}
+	if out := readFile(t, firstPath); !strings.Contains(out, "first logger") || strings.Contains(out, "stale write") {
+		t.Errorf("first file:\n%s", out)
+	}
+	if out := readFile(t, secondPath); !strings.Contains(out, "second logger") || strings.Contains(out, "first logger") {
+		t.Errorf("second file:\n%s", out)
+	}
+}
+
+func TestSetGlobalLoggerConcurrent(t *testing.T) {
+	cleanupGlobalLogger(t)
+	const n = 8
+	built := make([]*builtLogger, n)
+	for i := range built {
+		built[i], _ = newTestBuiltLogger(t)
+	}
+
+	var wg sync.WaitGroup
+	for _, b := range built {
+		wg.Add(1)
+		go func(b *builtLogger) {
+			defer wg.Done()
+			setGlobalLogger(b)
+			GetLogger("concurrent").Info("init")
+		}(b)
+	}
+	wg.Wait()
+
+	globalMu.Lock()
+	current := globalBuilt
+	currentLogger := logger
+	globalMu.Unlock()
+	if currentLogger != current.logger {
+		t.Error("logger does not belong to the current global builtLogger")
+	}
+	for i, b := range built {
+		if closed := fileClosed(b.file); closed == (b == current) {
+			t.Errorf("logger %d: closed = %v, current = %v", i, closed, b == current)
+		}
+	}
+}
+
+func TestInitLoggerTwice(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	if _, _, err := InitLoggerWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	first := globalBuilt
+	if _, _, err := InitLoggerWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !fileClosed(first.file) {
+		t.Error("second init should close the first log file")
+	}
+	logger.Info("after second init")
+	_ = logger.Sync()
+	if out := readFile(t, cfg.Filename); !strings.Contains(out, "after second init") {
+		t.Errorf("log file:\n%s", out)
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	cleanupGlobalLogger(t)
+	out := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	b, err := newLogger(WithConfig(cfg), WithConsoleOutput(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobalLogger(b)
+
+	logger.Debug("debug before")
+	sugarLogger.Debug("sugar debug before")
+	SetLevel(zapcore.ErrorLevel)
+	if Level().Level() != zapcore.ErrorLevel {
+		t.Errorf("Level() = %v, want error", Level().Level())
+	}
+	logger.Debug("debug after")
+	sugarLogger.Warn("sugar warn after")
+	logger.Error("error after")
+
+	got := out.String()
+	for _, want := range []string{"debug before", "sugar debug before", "error after"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"debug after", "sugar warn after"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("output should not contain %q after SetLevel(error):\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestReplaceGlobals(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	_, restore, err := InitLoggerWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zap.L().Info("via zap.L")
+	zap.S().Infow("via zap.S", "k", "v")
+	restore()
+	zap.L().Info("after restore")
+	_ = logger.Sync()
+
+	out := readFile(t, cfg.Filename)
+	for _, want := range []string{"via zap.L", "via zap.S"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log file missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "after restore") {
+		t.Errorf("zap.L() should be restored to the no-op logger:\n%s", out)
+	}
+	if zap.L() == logger {
+		t.Error("zap.L() still returns the package logger after restore")
+	}
+	restore() // 重复调用什么都不做
+}
+
+func TestInitLogger3Restore(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	// 默认配置写到./test.log，用LOG_FILE改到临时目录
+	setEnv(t, "LOG_FILE", tempLogFile(t))
+	restore, err := InitLogger3()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zap.L() != logger {
+		t.Fatal("InitLogger3 should replace zap.L()")
+	}
+	restore()
+	if zap.L() == logger {
+		t.Error("zap.L() still returns the package logger after restore")
+	}
+}
+
+func TestStaleRestoreKeepsNewerGlobals(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	_, oldRestore, err := InitLoggerWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, restore, err := InitLoggerWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	// 第一次初始化的restore不能撤销第二次的替换
+	oldRestore()
+	if zap.L() != l {
+		t.Error("restore of a replaced logger undid the current globals")
+	}
+}
+
+// infoViaHelper 模拟业务代码中包装全局logger的helper
+func infoViaHelper(msg string) {
+	WrapLogger(1).Info(msg)
+}
+
+// infofViaHelper 同infoViaHelper，使用SugaredLogger
+func infofViaHelper(format string, args ...interface{}) {
+	WrapSugaredLogger(1).Infof(format, args...)
+}
+
+func TestWrapLogger(t *testing.T) {
+	cleanupGlobalLogger(t)
+	core, logs := observer.New(zapcore.DebugLevel)
+	b, err := newLogger(WithConfig(LogConfig{Level: "debug"}), WithConsoleOutput(zapcore.AddSync(ioutil.Discard)),
+		WithPrimarySink(func(zapcore.WriteSyncer) (zapcore.Core, error) { return core, nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobalLogger(b)
+
+	infoViaHelper("plain")
+	infofViaHelper("sugared %d", 1)
+
+	for _, e := range logs.All() {
+		if !strings.HasSuffix(e.Caller.Function, ".TestWrapLogger") {
+			t.Errorf("%q: caller function = %q, want TestWrapLogger", e.Message, e.Caller.Function)
+		}
+	}
+	if logs.Len() != 2 {
+		t.Errorf("got %d entries, want 2", logs.Len())
+	}
+}
+
+func TestRotate(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	if err := Rotate(); err != nil {
+		t.Fatalf("Rotate before init should be a no-op, got %v", err)
+	}
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	if _, _, err := InitLoggerWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("before rotate")
+	if err := Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if active := readFile(t, cfg.Filename); active != "" {
+		t.Errorf("active file should be empty right after Rotate:\n%s", active)
+	}
+	logger.Info("after rotate")
+	_ = logger.Sync()
+
+	backups := logBackups(t, cfg)
+	if len(backups) != 1 {
+		t.Fatalf("got backups %v, want 1", backups)
+	}
+	if old := readFile(t, backups[0]); !strings.Contains(old, "before rotate") || strings.Contains(old, "after rotate") {
+		t.Errorf("backup:\n%s", old)
+	}
+	if active := readFile(t, cfg.Filename); !strings.Contains(active, "after rotate") || strings.Contains(active, "before rotate") {
+		t.Errorf("active file:\n%s", active)
+	}
+}
+
+func TestRotateConcurrentWithLogging(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.Encoding = EncodingJSON
+	if _, _, err := InitLoggerWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	const writers, perWriter, rotations = 4, 200, 5
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWriter; j++ {
+				logger.Info("concurrent")
+			}
+		}()
+	}
+	for i := 0; i < rotations; i++ {
+		if err := Rotate(); err != nil {
+			t.Error(err)
+		}
+		// lumberjack的备份文件名精确到毫秒，同一毫秒内切割两次会覆盖前一个备份
+		time.Sleep(2 * time.Millisecond)
+	}
+	wg.Wait()
+	_ = Close()
+
+	n := 0
+	for _, path := range append(logBackups(t, cfg), cfg.Filename) {
+		for _, line := range readLines(t, path) {
+			if !strings.HasPrefix(line, "{") || !strings.HasSuffix(line, "}") {
+				t.Fatalf("%s has a torn line: %q", path, line)
+			}
+			if strings.Contains(line, `"msg":"concurrent"`) {
+				n++
+			}
+		}
+	}
+	if n != writers*perWriter {
+		t.Errorf("got %d entries across all files, want %d", n, writers*perWriter)
+	}
+}
+
+// captureStdLog 把标准库log的输出改到返回的Buffer，测试结束时恢复
+func captureStdLog(t *testing.T) *zaptest.Buffer {
+	t.Helper()
+	out := &zaptest.Buffer{}
+	oldOut, oldFlags, oldPrefix := log.Writer(), log.Flags(), log.Prefix()
+	log.SetOutput(out)
+	t.Cleanup(func() {
+		log.SetOutput(oldOut)
+		log.SetFlags(oldFlags)
+		log.SetPrefix(oldPrefix)
+	})
+	return out
+}
+
+// initStdLogConfig 用JSON格式和临时文件初始化全局logger
+func initStdLogConfig(t *testing.T, disable bool) LogConfig {
+	t.Helper()
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.Encoding = EncodingJSON
+	cfg.DisableStdLog = disable
+	if _, _, err := InitLoggerWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestStdLogRedirect(t *testing.T) {
+	stdOut := captureStdLog(t)
+	cfg := initStdLogConfig(t, false)
+	log.Printf("dependency says %d", 42)
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := decodeJSONLines(t, readLines(t, cfg.Filename)[1:])
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want the std log line", len(entries))
+	}
+	e := entries[0]
+	if e["msg"] != "dependency says 42" || e["level"] != "INFO" || e["ts"] == nil {
+		t.Errorf("entry = %v, want an info entry with the normal fields", e)
+	}
+	if caller, _ := e["caller"].(string); !strings.Contains(caller, "global_test.go") {
+		t.Errorf("caller = %v, want the log.Printf call site", e["caller"])
+	}
+	if stdOut.String() != "" {
+		t.Errorf("redirected line also reached the old std log output: %q", stdOut.String())
+	}
+}
+
+func TestStdLogDisabled(t *testing.T) {
+	stdOut := captureStdLog(t)
+	cfg := initStdLogConfig(t, true)
+	log.Print("stays on std log")
+	_ = logger.Sync()
+
+	if out := readFile(t, cfg.Filename); strings.Contains(out, "stays on std log") {
+		t.Errorf("DisableStdLog should keep log output out of the file:\n%s", out)
+	}
+	if !strings.Contains(stdOut.String(), "stays on std log") {
+		t.Errorf("std log output = %q", stdOut.String())
+	}
+}
+
+func TestCloseUndoesStdLogRedirect(t *testing.T) {
+	stdOut := captureStdLog(t)
+	log.SetFlags(log.Lshortfile)
+	cfg := initStdLogConfig(t, false)
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	log.Print("after close")
+
+	if out := readFile(t, cfg.Filename); strings.Contains(out, "after close") {
+		t.Errorf("std log still redirected after Close:\n%s", out)
+	}
+	if got := stdOut.String(); !strings.Contains(got, "after close") || !strings.HasPrefix(got, "global_test.go:") {
+		t.Errorf("std log output = %q, want the original writer and flags back", got)
+	}
+}
+
+func TestWriteAfterCloseFallsBackToStderr(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	l, _, err := InitLoggerWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(cfg.Filename); err != nil {
+		t.Fatal(err)
+	}
+
+	stderr := captureStderr(t, func() { l.Info("after close") })
+	if !strings.Contains(stderr, "after close") {
+		t.Errorf("stderr = %q, want the entry written after Close", stderr)
+	}
+	if _, err := os.Stat(cfg.Filename); !os.IsNotExist(err) {
+		t.Errorf("a write after Close recreated the log file: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*
+=============================================================
+测试共用的helper
+*/
+
+// tempDir 创建一个测试结束时删除的临时目录
+func tempDir(t testing.TB) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "zap-lumberjack-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// tempLogFile 返回临时目录下的日志文件路径，文件本身还不存在
+func tempLogFile(t testing.TB) string {
+	t.Helper()
+	return filepath.Join(tempDir(t), "test.log")
+}
+
+// writeTempFile 在临时目录下写一个文件并返回路径
+func writeTempFile(t testing.TB, name, content string) string {
+	t.Helper()
+	path := filepath.Join(tempDir(t), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readFile 返回文件内容，文件不存在时返回空字符串
+func readFile(t testing.TB, path string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// readLines 返回文件中的非空行
+func readLines(t testing.TB, path string) []string {
+	t.Helper()
+	var lines []string
+	for _, line := range strings.Split(readFile(t, path), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// setEnv 设置环境变量，测试结束时恢复原来的值
+func setEnv(t testing.TB, key, value string) {
+	t.Helper()
+	restoreEnv(t, key)
+	os.Setenv(key, value)
+}
+
+// unsetEnv 删除环境变量，测试结束时恢复原来的值
+func unsetEnv(t testing.TB, key string) {
+	t.Helper()
+	restoreEnv(t, key)
+	os.Unsetenv(key)
+}
+
+func restoreEnv(t testing.TB, key string) {
+	old, ok := os.LookupEnv(key)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// cleanupGlobalLogger 测试结束时关闭全局logger，撤销对zap.L()和标准库log的替换
+func cleanupGlobalLogger(t testing.TB) {
+	t.Helper()
+	t.Cleanup(func() { _ = Close() })
+}
+
+// unsetLogEnv 清掉会覆盖配置的LOG_*环境变量，避免运行测试的环境影响结果
+func unsetLogEnv(t testing.TB) {
+	t.Helper()
+	for _, key := range []string{envLogLevel, envLogFile, envLogMaxSizeMB, envLogCompress} {
+		unsetEnv(t, key)
+	}
+}
+
+// waitFor 每隔几毫秒检查一次cond，超时仍不满足时测试失败
+func waitFor(t testing.TB, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// backupFiles 返回dir下除active以外、以prefix开头的文件
+func backupFiles(t testing.TB, dir, prefix, active string) []string {
+	t.Helper()
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var backups []string
+	for _, e := range entries {
+		if e.Name() != active && strings.HasPrefix(e.Name(), prefix) {
+			backups = append(backups, filepath.Join(dir, e.Name()))
+		}
+	}
+	return backups
+}
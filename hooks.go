@@ -0,0 +1,34 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+Hooks
+通过WithHooks在初始化时注册zap.Hooks，每条日志写出后都会调用，适合做按级别计数、
+Fatal时触发告警之类的横切逻辑。hook返回的error不会影响日志本身，
+zap会把它当作写入错误输出到ErrorOutput（默认stderr）。
+*/
+
+// entryCounts 按级别统计的日志条数，下标为level-zapcore.DebugLevel
+var entryCounts [zapcore.FatalLevel - zapcore.DebugLevel + 1]uint64
+
+// CountEntriesHook 示例hook：按级别统计日志条数，配合EntryCount查看
+func CountEntriesHook(ent zapcore.Entry) error {
+	if ent.Level >= zapcore.DebugLevel && ent.Level <= zapcore.FatalLevel {
+		atomic.AddUint64(&entryCounts[ent.Level-zapcore.DebugLevel], 1)
+	}
+	return nil
+}
+
+// EntryCount 返回CountEntriesHook统计到的level级别的日志条数
+func EntryCount(level zapcore.Level) uint64 {
+	if level < zapcore.DebugLevel || level > zapcore.FatalLevel {
+		return 0
+	}
+	return atomic.LoadUint64(&entryCounts[level-zapcore.DebugLevel])
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestCountEntriesHook(t *testing.T) {
+	l, _ := newObservedLogger(t, WithHooks(CountEntriesHook))
+	info, warn, errs := EntryCount(zapcore.InfoLevel), EntryCount(zapcore.WarnLevel), EntryCount(zapcore.ErrorLevel)
+
+	l.Info("a")
+	l.Info("b")
+	l.Warn("c")
+	l.Debug("d")
+
+	if got := EntryCount(zapcore.InfoLevel) - info; got != 2 {
+		t.Errorf("info count increased by %d, want 2", got)
+	}
+	if got := EntryCount(zapcore.WarnLevel) - warn; got != 1 {
+		t.Errorf("warn count increased by %d, want 1", got)
+	}
+	if got := EntryCount(zapcore.ErrorLevel) - errs; got != 0 {
+		t.Errorf("error count increased by %d, want 0", got)
+	}
+	if got := EntryCount(zapcore.Level(42)); got != 0 {
+		t.Errorf("unknown level count = %d, want 0", got)
+	}
+}
+
+func TestHookErrorDoesNotBreakLogger(t *testing.T) {
+	errOut := &zaptest.Buffer{}
+	var calls int
+	failing := func(zapcore.Entry) error {
+		calls++
+		return errors.New("hook failed")
+	}
+	l, logs := newObservedLogger(t, WithHooks(failing, CountEntriesHook), WithErrorOutput(errOut))
+	before := InternalErrors()
+
+	l.Info("first")
+	l.Info("second")
+
+	if logs.Len() != 2 {
+		t.Errorf("got %d entries, want 2", logs.Len())
+	}
+	if calls != 2 {
+		t.Errorf("hook called %d times, want 2", calls)
+	}
+	if !strings.Contains(errOut.String(), "hook failed") {
+		t.Errorf("hook error should go to the error output, got %q", errOut.String())
+	}
+	if InternalErrors() == before {
+		t.Error("hook errors should be counted in InternalErrors")
+	}
+}
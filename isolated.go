@@ -0,0 +1,114 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+互不影响的多个输出
+zapcore.NewMultiWriteSyncer依次写每个输出，一个输出报错整个Write就报错，一个输出卡住所有输出都跟着卡住。
+IsolatedMultiSyncer给每个输出一个异步写入的队列和goroutine（见async.go）：Write只是把日志放进各自的队列，
+某个输出（比如网络输出）失败或者变慢只会让它自己的队列满、丢弃日志，不影响其他输出。
+每个输出的写入错误次数和丢弃条数见Stats，丢弃的总数见Dropped，它们不计入AsyncDropped；Sync同时等所有输出，每个最多等AsyncConfig.DrainTimeout。
+*/
+
+// SinkStats IsolatedMultiSyncer中一个输出的统计
+type SinkStats struct {
+	Errors  uint64 // 写入返回错误的次数
+	Dropped uint64 // 队列满时丢弃的条数
+}
+
+// IsolatedMultiSyncer 把日志写到多个输出，每个输出使用自己的队列
+type IsolatedMultiSyncer struct {
+	sinks []*isolatedSink
+}
+
+// isolatedSink 统计写入错误，放在asyncWriteSyncer后面
+type isolatedSink struct {
+	ws     zapcore.WriteSyncer
+	async  *asyncWriteSyncer
+	errors uint64
+}
+
+func (s *isolatedSink) Write(p []byte) (int, error) {
+	n, err := s.ws.Write(p)
+	if err != nil {
+		atomic.AddUint64(&s.errors, 1)
+	}
+	return n, err
+}
+
+func (s *isolatedSink) Sync() error {
+	err := s.ws.Sync()
+	if err != nil {
+		atomic.AddUint64(&s.errors, 1)
+	}
+	return err
+}
+
+// NewIsolatedMultiSyncer 按cfg给每个输出创建队列，cfg中只有QueueSize和DrainTimeout生效
+func NewIsolatedMultiSyncer(cfg AsyncConfig, sinks ...zapcore.WriteSyncer) *IsolatedMultiSyncer {
+	m := &IsolatedMultiSyncer{}
+	for _, ws := range sinks {
+		s := &isolatedSink{ws: ws}
+		s.async = newAsyncWriteSyncer(s, cfg, nil)
+		m.sinks = append(m.sinks, s)
+	}
+	return m
+}
+
+// Write 把p放进每个输出的队列，永远不会阻塞或者返回错误
+func (m *IsolatedMultiSyncer) Write(p []byte) (int, error) {
+	for _, s := range m.sinks {
+		_, _ = s.async.Write(p)
+	}
+	return len(p), nil
+}
+
+// Sync 同时等所有输出写完队列中的日志并Sync
+func (m *IsolatedMultiSyncer) Sync() error {
+	return m.each(func(s *isolatedSink) error { return s.async.Sync() })
+}
+
+// Close 写完各个队列，不关闭输出本身。可重复调用
+func (m *IsolatedMultiSyncer) Close() error {
+	return m.each(func(s *isolatedSink) error { return s.async.Close() })
+}
+
+// Stats 按创建时的顺序返回每个输出的统计
+func (m *IsolatedMultiSyncer) Stats() []SinkStats {
+	stats := make([]SinkStats, len(m.sinks))
+	for i, s := range m.sinks {
+		stats[i] = SinkStats{Errors: atomic.LoadUint64(&s.errors), Dropped: s.async.Dropped()}
+	}
+	return stats
+}
+
+// Dropped 返回所有输出因为队列满丢弃的总条数
+func (m *IsolatedMultiSyncer) Dropped() uint64 {
+	var total uint64
+	for _, s := range m.sinks {
+		total += s.async.Dropped()
+	}
+	return total
+}
+
+// each 对每个输出并发调用fn，等全部返回后合并错误
+func (m *IsolatedMultiSyncer) each(fn func(*isolatedSink) error) error {
+	errs := make([]error, len(m.sinks))
+	var wg sync.WaitGroup
+	for i, s := range m.sinks {
+		wg.Add(1)
+		go func(i int, s *isolatedSink) {
+			defer wg.Done()
+			errs[i] = fn(s)
+		}(i, s)
+	}
+	wg.Wait()
+	return multierr.Combine(errs...)
+}
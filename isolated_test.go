@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestIsolatedFailingSinkDoesNotAffectHealthy(t *testing.T) {
+	healthy := &zaptest.Buffer{}
+	failing := &switchableWriteSyncer{failing: true}
+	m := NewIsolatedMultiSyncer(AsyncConfig{QueueSize: 1000}, healthy, failing)
+	defer m.Close()
+	l := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), m, zapcore.DebugLevel))
+
+	const n = 500
+	for i := 0; i < n; i++ {
+		l.Info("entry", zap.Int("i", i))
+	}
+	if err := l.Sync(); err != nil {
+		t.Fatalf("Sync() = %v, write errors of one sink must not be returned", err)
+	}
+	lines := healthy.Lines()
+	if len(lines) != n {
+		t.Fatalf("healthy sink got %d entries, want %d", len(lines), n)
+	}
+	if !strings.Contains(lines[n-1], `"i":499`) {
+		t.Errorf("last entry = %s", lines[n-1])
+	}
+	stats := m.Stats()
+	if stats[0] != (SinkStats{}) {
+		t.Errorf("healthy stats = %+v", stats[0])
+	}
+	if stats[1].Errors != n || stats[1].Dropped != 0 {
+		t.Errorf("failing stats = %+v, want %d errors", stats[1], n)
+	}
+}
+
+func TestIsolatedSlowSinkDropsOnlyItsOwn(t *testing.T) {
+	healthy := &switchableWriteSyncer{}
+	healthyLines := func() int {
+		_, out := healthy.stats()
+		return strings.Count(out, "\n")
+	}
+	slow := newSlowWriteSyncer()
+	defer close(slow.gate)
+	m := NewIsolatedMultiSyncer(AsyncConfig{QueueSize: 2, DrainTimeout: 50 * time.Millisecond}, healthy, slow)
+	globalBefore := AsyncDropped()
+
+	m.Write([]byte("entry 0\n"))
+	<-slow.entered
+	start := time.Now()
+	for i := 1; i < 10; i++ {
+		m.Write([]byte("entry\n"))
+		// 健康的输出每条都等它写完，队列不会满
+		waitFor(t, 5*time.Second, "the healthy sink", func() bool { return healthyLines() == i+1 })
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("writes took %s while one sink was stuck", elapsed)
+	}
+	stats := m.Stats()
+	if stats[0].Dropped != 0 || stats[1].Dropped != 7 {
+		t.Errorf("stats = %+v, want only the slow sink to drop", stats)
+	}
+	if m.Dropped() != 7 {
+		t.Errorf("Dropped() = %d, want 7", m.Dropped())
+	}
+	// AsyncDropped只统计日志文件的异步写入
+	if got := AsyncDropped() - globalBefore; got != 0 {
+		t.Errorf("AsyncDropped() grew by %d, want 0", got)
+	}
+
+	// Sync同时等所有输出，卡住的输出最多等DrainTimeout
+	start = time.Now()
+	if err := m.Sync(); err != errAsyncDrainTimeout {
+		t.Errorf("Sync() = %v, want the slow sink's drain timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Sync took %s with a 50ms drain timeout", elapsed)
+	}
+	if err := m.Close(); err == nil {
+		t.Error("Close() should report the slow sink's drain timeout")
+	}
+	if got := healthyLines(); got != 10 {
+		t.Errorf("healthy sink got %d entries, want 10", got)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+=============================================================
+输出到journald
+systemd的主机上更希望日志直接进journal，带上优先级和结构化字段，而不是写文件。
+配置Sink为journald后，日志按journald的native协议（unix datagram发到/run/systemd/journal/socket）发送：
+级别映射为PRIORITY，消息为MESSAGE，字段展开为大写的journal字段，如path -> PATH、http.status -> HTTP_STATUS。
+只在Linux上支持；socket不存在时（或者不是Linux）自动退回写日志文件，没有日志文件时输出到console。
+*/
+
+// Sink的取值
+const (
+	SinkFile     = "file"     // 写lumberjack切割的日志文件，默认
+	SinkJournald = "journald" // 发送到journald，不可用时退回写文件
+)
+
+// journaldSocketPath journald接收native协议的socket
+var journaldSocketPath = "/run/systemd/journal/socket"
+
+// errJournaldUnavailable journald的socket不存在或者不是Linux
+var errJournaldUnavailable = errors.New("journald is not available")
+
+// validateSink 检查Sink
+func validateSink(sink string) error {
+	switch sink {
+	case "", SinkFile, SinkJournald:
+		return nil
+	}
+	return fmt.Errorf("log config: unknown sink %q, want %s or %s", sink, SinkFile, SinkJournald)
+}
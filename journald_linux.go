@@ -0,0 +1,193 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// journalMaxFieldName journal字段名的最大长度
+const journalMaxFieldName = 64
+
+// journalReservedFields journaldCore自己写的字段，日志中同名的字段加上FIELD_前缀
+var journalReservedFields = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"LOGGER":            true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+	"STACKTRACE":        true,
+}
+
+// journaldCore 按native协议把日志发送到journald
+type journaldCore struct {
+	zapcore.LevelEnabler
+	conn       *net.UnixConn
+	identifier string
+	fields     []zapcore.Field // With传入的字段
+}
+
+// newJournaldCore 连接journald的socket，socket不存在时返回errJournaldUnavailable。
+// 返回的io.Closer用于关闭连接
+func newJournaldCore(cfg LogConfig, level zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	if _, err := os.Stat(journaldSocketPath); err != nil {
+		return nil, nil, errJournaldUnavailable
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocketPath, Net: "unixgram"})
+	if err != nil {
+		return nil, nil, fmt.Errorf("log config: connect journald: %v", err)
+	}
+	identifier := cfg.ServiceName
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+	return &journaldCore{LevelEnabler: level, conn: conn, identifier: identifier}, conn, nil
+}
+
+func (c *journaldCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	return &clone
+}
+
+func (c *journaldCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *journaldCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	_, err := c.conn.Write(journalEntry(ent, c.identifier, c.fields, fields))
+	return err
+}
+
+func (c *journaldCore) Sync() error {
+	return nil
+}
+
+// journalEntry 按native协议编码一条日志
+func journalEntry(ent zapcore.Entry, identifier string, with, fields []zapcore.Field) []byte {
+	var b bytes.Buffer
+	appendJournalField(&b, "MESSAGE", ent.Message)
+	appendJournalField(&b, "PRIORITY", strconv.FormatInt(levelSeverity(ent.Level), 10))
+	appendJournalField(&b, "SYSLOG_IDENTIFIER", identifier)
+	if ent.LoggerName != "" {
+		appendJournalField(&b, "LOGGER", ent.LoggerName)
+	}
+	if ent.Caller.Defined {
+		appendJournalField(&b, "CODE_FILE", ent.Caller.File)
+		appendJournalField(&b, "CODE_LINE", strconv.Itoa(ent.Caller.Line))
+		if ent.Caller.Function != "" {
+			appendJournalField(&b, "CODE_FUNC", ent.Caller.Function)
+		}
+	}
+	if ent.Stack != "" {
+		appendJournalField(&b, "STACKTRACE", ent.Stack)
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range with {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	appendJournalValue(&b, "", enc.Fields)
+	return b.Bytes()
+}
+
+// appendJournalValue 把嵌套的对象用_连接展开成多个字段，数组编码为JSON
+func appendJournalValue(b *bytes.Buffer, key string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if key != "" {
+				appendJournalValue(b, key+"_"+k, v[k])
+			} else {
+				appendJournalValue(b, k, v[k])
+			}
+		}
+	case []interface{}:
+		if js, err := json.Marshal(v); err == nil {
+			appendJournalField(b, journalFieldName(key), string(js))
+		} else {
+			appendJournalField(b, journalFieldName(key), fmt.Sprint(v))
+		}
+	case string:
+		appendJournalField(b, journalFieldName(key), v)
+	case time.Time:
+		appendJournalField(b, journalFieldName(key), v.Format(time.RFC3339Nano))
+	default:
+		// zap.Any传入的map和struct先转成JSON对象再展开
+		if k := reflect.Indirect(reflect.ValueOf(v)).Kind(); k == reflect.Map || k == reflect.Struct {
+			var obj map[string]interface{}
+			if js, err := json.Marshal(v); err == nil && json.Unmarshal(js, &obj) == nil {
+				appendJournalValue(b, key, obj)
+				return
+			}
+		}
+		appendJournalField(b, journalFieldName(key), fmt.Sprint(v))
+	}
+}
+
+// journalFieldName 转为合法的journal字段名：大写字母、数字和下划线，不以下划线或数字开头
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+	name = strings.TrimLeft(name, "_")
+	if name == "" || name[0] >= '0' && name[0] <= '9' || journalReservedFields[name] {
+		name = "FIELD_" + name
+	}
+	if len(name) > journalMaxFieldName {
+		name = name[:journalMaxFieldName]
+	}
+	return name
+}
+
+// appendJournalField 写一个字段：值中没有换行时为NAME=value\n，
+// 有换行时为NAME\n、8字节小端的长度、value、\n
+func appendJournalField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteString(name)
+	b.WriteByte('\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	b.Write(size[:])
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
@@ -0,0 +1,191 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeJournald 在临时目录下监听unixgram，并让journaldSocketPath指向它
+func fakeJournald(t *testing.T) net.PacketConn {
+	t.Helper()
+	path := filepath.Join(tempDir(t), "journal.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	setJournaldSocket(t, path)
+	return conn
+}
+
+func setJournaldSocket(t *testing.T, path string) {
+	old := journaldSocketPath
+	journaldSocketPath = path
+	t.Cleanup(func() { journaldSocketPath = old })
+}
+
+// readJournal 读一条消息并按native协议解析成字段
+func readJournal(t *testing.T, conn net.PacketConn) map[string]string {
+	t.Helper()
+	buf := make([]byte, 64*1024)
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make(map[string]string)
+	b := buf[:n]
+	for len(b) > 0 {
+		i := bytes.IndexAny(b, "=\n")
+		if i < 0 {
+			t.Fatalf("truncated field in %q", buf[:n])
+		}
+		name := string(b[:i])
+		if b[i] == '=' {
+			end := bytes.IndexByte(b, '\n')
+			fields[name] = string(b[i+1 : end])
+			b = b[end+1:]
+			continue
+		}
+		// NAME\n、8字节小端的长度、value、\n
+		b = b[i+1:]
+		size := int(binary.LittleEndian.Uint64(b[:8]))
+		if len(b) < 8+size+1 || b[8+size] != '\n' {
+			t.Fatalf("bad binary field %s in %q", name, buf[:n])
+		}
+		fields[name] = string(b[8 : 8+size])
+		b = b[8+size+1:]
+	}
+	return fields
+}
+
+func newJournaldLogger(t *testing.T) *builtLogger {
+	t.Helper()
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.Sink = SinkJournald
+	cfg.ServiceName = "demo"
+	b, err := newLogger(WithConfig(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.close() })
+	return b
+}
+
+func TestJournaldWireFormat(t *testing.T) {
+	conn := fakeJournald(t)
+	b := newJournaldLogger(t)
+
+	type point struct {
+		X int `json:"x"`
+	}
+	b.logger.Named("http").With(zap.String("request_id", "r1")).Warn("slow\nrequest",
+		zap.Int("http.status", 200),
+		zap.String("MESSAGE", "spoofed"),
+		zap.Namespace("db"), zap.Duration("cost", time.Second),
+		zap.Strings("tags", []string{"a", "b"}),
+		zap.Any("point", point{X: 1}),
+	)
+	got := readJournal(t, conn)
+	want := map[string]string{
+		"MESSAGE":           "slow\nrequest",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "demo",
+		"LOGGER":            "http",
+		"REQUEST_ID":        "r1",
+		"HTTP_STATUS":       "200",
+		"DB_COST":           "1s",
+		"DB_TAGS":           `["a","b"]`,
+		"DB_POINT_X":        "1",
+		"FIELD_MESSAGE":     "spoofed",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+	if !strings.HasSuffix(got["CODE_FILE"], "journald_linux_test.go") || got["CODE_LINE"] == "" || !strings.Contains(got["CODE_FUNC"], "TestJournaldWireFormat") {
+		t.Errorf("caller fields = %q %q %q", got["CODE_FILE"], got["CODE_LINE"], got["CODE_FUNC"])
+	}
+}
+
+func TestJournaldPriority(t *testing.T) {
+	conn := fakeJournald(t)
+	b := newJournaldLogger(t)
+	tests := []struct {
+		log      func(string, ...zap.Field)
+		priority string
+	}{
+		{b.logger.Debug, "7"},
+		{b.logger.Info, "6"},
+		{b.logger.Warn, "4"},
+		{b.logger.Error, "3"},
+	}
+	for _, tt := range tests {
+		tt.log("entry")
+		if got := readJournal(t, conn); got["PRIORITY"] != tt.priority {
+			t.Errorf("PRIORITY = %s, want %s", got["PRIORITY"], tt.priority)
+		}
+	}
+}
+
+func TestJournaldFallsBackToFile(t *testing.T) {
+	setJournaldSocket(t, filepath.Join(tempDir(t), "missing.sock"))
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.Encoding = EncodingJSON
+	cfg.Sink = SinkJournald
+	b, err := newLogger(WithConfig(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.logger.Info("to file")
+	b.close()
+	out := readFile(t, cfg.Filename)
+	if !strings.Contains(out, "journald is not available, fall back to file") || !strings.Contains(out, `"msg":"to file"`) {
+		t.Errorf("log file:\n%s", out)
+	}
+}
+
+func TestJournalFieldName(t *testing.T) {
+	tests := map[string]string{
+		"path":                  "PATH",
+		"http.status":           "HTTP_STATUS",
+		"user-agent":            "USER_AGENT",
+		"_private":              "PRIVATE",
+		"2xx":                   "FIELD_2XX",
+		"PRIORITY":              "FIELD_PRIORITY",
+		"":                      "FIELD_",
+		"中文":                    "FIELD_",
+		strings.Repeat("a", 70): strings.Repeat("A", journalMaxFieldName),
+	}
+	for key, want := range tests {
+		if got := journalFieldName(key); got != want {
+			t.Errorf("journalFieldName(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestValidateSink(t *testing.T) {
+	for _, sink := range []string{"", SinkFile, SinkJournald} {
+		if err := validateSink(sink); err != nil {
+			t.Errorf("validateSink(%q) = %v", sink, err)
+		}
+	}
+	if err := validateSink("syslog"); err == nil || !strings.Contains(err.Error(), `unknown sink "syslog"`) {
+		t.Errorf("validateSink(syslog) = %v", err)
+	}
+}
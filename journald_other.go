@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"io"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// newJournaldCore 只有Linux上才有journald，总是返回errJournaldUnavailable
+func newJournaldCore(cfg LogConfig, level zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	return nil, nil, errJournaldUnavailable
+}
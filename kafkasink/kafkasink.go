@@ -0,0 +1,317 @@
+// Package kafkasink 把日志以JSON发送到Kafka的topic，代替写日志文件，配合WithPrimarySink使用：
+//
+//	NewLogger(WithFile("./app.log"), WithPrimarySink(func(file zapcore.WriteSyncer) (zapcore.Core, error) {
+//		return kafkasink.New(kafkasink.Config{Brokers: []string{"kafka:9092"}, Topic: "app-logs"}, zapcore.InfoLevel, file)
+//	}))
+//
+// 日志在后台按BatchSize或Linger攒成一批发送。队列满或者发送失败时改写到fallback（通常是日志文件），
+// 不会阻塞请求。GinLogger的日志以path字段为key，同一路径的日志进入同一个partition。
+package kafkasink
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// 默认的发送参数
+const (
+	defaultAcks      = "all"
+	defaultBatchSize = 100
+	defaultLinger    = 100 * time.Millisecond
+	defaultQueueSize = 10000
+	defaultKeyField  = "path"
+	defaultTimeout   = 10 * time.Second
+)
+
+// Config Kafka的连接和批量发送参数，为0的项使用默认值
+type Config struct {
+	Brokers   []string
+	Topic     string
+	Acks      string        // all（默认）、one或none
+	BatchSize int           // 每批最多的条数，默认100
+	Linger    time.Duration // 不满一批时最多等多久发送，默认100ms
+	QueueSize int           // 等待发送的最多条数，默认10000，满了之后改写到fallback
+	KeyField  string        // 作为消息key的字符串字段，默认path（GinLogger记录的请求路径）
+	Timeout   time.Duration // 每批发送以及Sync的超时，默认10秒
+}
+
+func (c Config) withDefaults() Config {
+	if c.Acks == "" {
+		c.Acks = defaultAcks
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = defaultBatchSize
+	}
+	if c.Linger == 0 {
+		c.Linger = defaultLinger
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = defaultQueueSize
+	}
+	if c.KeyField == "" {
+		c.KeyField = defaultKeyField
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultTimeout
+	}
+	return c
+}
+
+func (c Config) requiredAcks() (kafka.RequiredAcks, error) {
+	switch strings.ToLower(c.Acks) {
+	case "all", "-1":
+		return kafka.RequireAll, nil
+	case "one", "1":
+		return kafka.RequireOne, nil
+	case "none", "0":
+		return kafka.RequireNone, nil
+	}
+	return 0, fmt.Errorf("kafka sink: unknown acks %q, want all, one or none", c.Acks)
+}
+
+// Producer 发送一批消息，*kafka.Writer实现了这个接口，测试时可以传入假的实现
+type Producer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Core 把日志编码为JSON后发送到Kafka的core
+type Core struct {
+	zapcore.LevelEnabler
+	enc  zapcore.Encoder
+	key  []byte // With传入的KeyField字段
+	sink *sink
+}
+
+// New 按cfg创建发送到Kafka的core，发送失败的日志写到fallback
+func New(cfg Config, level zapcore.LevelEnabler, fallback zapcore.WriteSyncer) (*Core, error) {
+	cfg = cfg.withDefaults()
+	if len(cfg.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka sink: brokers must not be empty")
+	}
+	if cfg.Topic == "" {
+		return nil, fmt.Errorf("kafka sink: topic must not be empty")
+	}
+	acks, err := cfg.requiredAcks()
+	if err != nil {
+		return nil, err
+	}
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        cfg.Topic,
+		Balancer:     &kafka.Hash{},
+		BatchSize:    cfg.BatchSize,
+		BatchTimeout: time.Millisecond, // 已经攒好一批才发送，不用再等
+		WriteTimeout: cfg.Timeout,
+		RequiredAcks: acks,
+	}
+	return NewWithProducer(w, cfg, level, fallback)
+}
+
+// NewWithProducer 同New，使用指定的Producer发送
+func NewWithProducer(producer Producer, cfg Config, level zapcore.LevelEnabler, fallback zapcore.WriteSyncer) (*Core, error) {
+	cfg = cfg.withDefaults()
+	if _, err := cfg.requiredAcks(); err != nil {
+		return nil, err
+	}
+	encCfg := zap.NewProductionEncoderConfig()
+	encCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+	s := &sink{
+		cfg:      cfg,
+		producer: producer,
+		fallback: zapcore.Lock(fallback),
+		queue:    make(chan item, cfg.QueueSize),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return &Core{LevelEnabler: level, enc: zapcore.NewJSONEncoder(encCfg), sink: s}, nil
+}
+
+func (c *Core) With(fields []zapcore.Field) zapcore.Core {
+	clone := &Core{LevelEnabler: c.LevelEnabler, enc: c.enc.Clone(), key: c.key, sink: c.sink}
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	if key := c.sink.keyOf(fields); key != nil {
+		clone.key = key
+	}
+	return clone
+}
+
+func (c *Core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write 编码后放进发送队列，队列满时写到fallback，不会阻塞
+func (c *Core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	value := append([]byte(nil), buf.Bytes()...)
+	buf.Free()
+	key := c.key
+	if k := c.sink.keyOf(fields); k != nil {
+		key = k
+	}
+	return c.sink.send(kafka.Message{Key: key, Value: value, Time: ent.Time})
+}
+
+// Sync 等队列中已有的日志发送完，最多等Timeout
+func (c *Core) Sync() error {
+	return c.sink.sync()
+}
+
+// Close 发送完队列中的日志并关闭Producer，可重复调用
+func (c *Core) Close() error {
+	return c.sink.close()
+}
+
+// Fallbacks 返回到目前为止改写到fallback的日志条数
+func (c *Core) Fallbacks() uint64 {
+	return atomic.LoadUint64(&c.sink.fallbacks)
+}
+
+// item 队列中的一项：一条消息，或者一次Sync请求
+type item struct {
+	msg     kafka.Message
+	flushed chan struct{} // 不为nil时表示Sync请求，之前的消息都发送（或改写到fallback）之后关闭
+}
+
+// sink Core及其With出的Core共享的发送队列
+type sink struct {
+	cfg       Config
+	producer  Producer
+	fallback  zapcore.WriteSyncer
+	queue     chan item
+	fallbacks uint64
+
+	mu     sync.RWMutex // 保护closed，避免向已关闭的queue发送
+	closed bool
+	done   chan struct{}
+}
+
+// keyOf 返回fields中KeyField字符串字段的值，没有时返回nil
+func (s *sink) keyOf(fields []zapcore.Field) []byte {
+	for _, f := range fields {
+		if f.Key == s.cfg.KeyField && f.Type == zapcore.StringType {
+			return []byte(f.String)
+		}
+	}
+	return nil
+}
+
+func (s *sink) send(msg kafka.Message) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.closed {
+		select {
+		case s.queue <- item{msg: msg}:
+			return nil
+		default:
+		}
+	}
+	return s.writeFallback([]kafka.Message{msg})
+}
+
+// writeFallback 把发不出去的消息写到fallback，消息的值已经是以换行结尾的JSON
+func (s *sink) writeFallback(msgs []kafka.Message) error {
+	atomic.AddUint64(&s.fallbacks, uint64(len(msgs)))
+	var err error
+	for _, msg := range msgs {
+		if _, e := s.fallback.Write(msg.Value); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// run 攒够BatchSize条或者等了Linger之后发送一批
+func (s *sink) run() {
+	defer close(s.done)
+	batch := make([]kafka.Message, 0, s.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeout)
+		if err := s.producer.WriteMessages(ctx, batch...); err != nil {
+			_ = s.writeFallback(batch)
+		}
+		cancel()
+		batch = make([]kafka.Message, 0, s.cfg.BatchSize)
+	}
+	linger := time.NewTimer(s.cfg.Linger)
+	defer linger.Stop()
+	for {
+		select {
+		case it, ok := <-s.queue:
+			if !ok {
+				flush()
+				return
+			}
+			if it.flushed != nil {
+				flush()
+				close(it.flushed)
+				continue
+			}
+			if len(batch) == 0 {
+				linger.Reset(s.cfg.Linger)
+			}
+			batch = append(batch, it.msg)
+			if len(batch) >= s.cfg.BatchSize {
+				flush()
+			}
+		case <-linger.C:
+			flush()
+		}
+	}
+}
+
+func (s *sink) sync() error {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return s.fallback.Sync()
+	}
+	flushed := make(chan struct{})
+	timer := time.NewTimer(s.cfg.Timeout)
+	defer timer.Stop()
+	select {
+	case s.queue <- item{flushed: flushed}:
+		s.mu.RUnlock()
+	case <-timer.C:
+		s.mu.RUnlock()
+		return fmt.Errorf("kafka sink: sync timed out")
+	}
+	select {
+	case <-flushed:
+		return s.fallback.Sync()
+	case <-timer.C:
+		return fmt.Errorf("kafka sink: sync timed out")
+	}
+}
+
+func (s *sink) close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+	<-s.done
+	return s.producer.Close()
+}
@@ -0,0 +1,63 @@
+//go:build kafka
+// +build kafka
+
+package kafkasink
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+)
+
+// 需要本地的Kafka，topic需要已经存在或者允许自动创建：
+//
+//	KAFKA_BROKERS=localhost:9092 KAFKA_TOPIC=app-logs go test -tags kafka ./kafkasink/
+func TestLocalBroker(t *testing.T) {
+	brokers := strings.Split(envOr("KAFKA_BROKERS", "localhost:9092"), ",")
+	topic := envOr("KAFKA_TOPIC", "zap-lumberjack-test")
+	fallback := &zaptest.Buffer{}
+	core, err := New(Config{Brokers: brokers, Topic: topic, Linger: 10 * time.Millisecond}, zapcore.InfoLevel, fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marker := fmt.Sprintf("integration %d", time.Now().UnixNano())
+	zap.New(core).Info(marker, zap.String("path", "/users"))
+	if err := core.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fallback.String() != "" {
+		t.Fatalf("send failed, entries went to the fallback:\n%s", fallback.String())
+	}
+
+	r := kafka.NewReader(kafka.ReaderConfig{Brokers: brokers, Topic: topic, GroupID: marker})
+	defer r.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for {
+		msg, err := r.ReadMessage(ctx)
+		if err != nil {
+			t.Fatalf("entry %q not found: %v", marker, err)
+		}
+		if strings.Contains(string(msg.Value), marker) {
+			if string(msg.Key) != "/users" {
+				t.Errorf("key = %q, want /users", msg.Key)
+			}
+			return
+		}
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
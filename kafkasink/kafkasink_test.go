@@ -0,0 +1,221 @@
+package kafkasink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeProducer 记录收到的每一批消息；err不为nil时发送失败，block不为nil时阻塞到它被关闭
+type fakeProducer struct {
+	mu      sync.Mutex
+	batches [][]kafka.Message
+	err     error
+	block   chan struct{}
+	closed  bool
+}
+
+func (p *fakeProducer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if p.block != nil {
+		<-p.block
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.batches = append(p.batches, append([]kafka.Message(nil), msgs...))
+	return nil
+}
+
+func (p *fakeProducer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+func (p *fakeProducer) sent() [][]kafka.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([][]kafka.Message(nil), p.batches...)
+}
+
+// newTestCore 用fakeProducer创建Core，fallback写到返回的Buffer
+func newTestCore(t *testing.T, p *fakeProducer, cfg Config) (*zap.Logger, *Core, *zaptest.Buffer) {
+	t.Helper()
+	fallback := &zaptest.Buffer{}
+	cfg.Brokers = []string{"kafka:9092"}
+	cfg.Topic = "app-logs"
+	core, err := NewWithProducer(p, cfg, zapcore.DebugLevel, fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { core.Close() })
+	return zap.New(core), core, fallback
+}
+
+// waitFor 每隔几毫秒检查一次cond，超时仍不满足时测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	p := &fakeProducer{}
+	l, _, fallback := newTestCore(t, p, Config{BatchSize: 3, Linger: time.Hour})
+	for i := 0; i < 7; i++ {
+		l.Info("entry", zap.Int("i", i))
+	}
+	waitFor(t, "two full batches", func() bool { return len(p.sent()) == 2 })
+	if err := l.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	batches := p.sent()
+	var sizes []int
+	i := 0
+	for _, batch := range batches {
+		sizes = append(sizes, len(batch))
+		for _, msg := range batch {
+			var entry map[string]interface{}
+			if err := json.Unmarshal(msg.Value, &entry); err != nil {
+				t.Fatalf("message is not JSON: %s", msg.Value)
+			}
+			if entry["msg"] != "entry" || entry["i"] != float64(i) || !strings.HasSuffix(string(msg.Value), "\n") {
+				t.Errorf("message %d = %s", i, msg.Value)
+			}
+			i++
+		}
+	}
+	if len(sizes) != 3 || sizes[0] != 3 || sizes[1] != 3 || sizes[2] != 1 {
+		t.Errorf("batch sizes = %v, want [3 3 1]", sizes)
+	}
+	if fallback.String() != "" {
+		t.Errorf("nothing should go to the fallback:\n%s", fallback.String())
+	}
+}
+
+func TestLinger(t *testing.T) {
+	p := &fakeProducer{}
+	l, _, _ := newTestCore(t, p, Config{BatchSize: 100, Linger: 10 * time.Millisecond})
+	l.Info("alone")
+	waitFor(t, "the linger timeout to send a partial batch", func() bool { return len(p.sent()) == 1 })
+}
+
+func TestMessageKeyFromPath(t *testing.T) {
+	p := &fakeProducer{}
+	l, _, _ := newTestCore(t, p, Config{BatchSize: 100, Linger: time.Hour})
+	l.Info("/users", zap.Int("status", 200), zap.String("path", "/users"))
+	l.With(zap.String("path", "/orders")).Info("from With")
+	l.With(zap.String("path", "/orders")).Info("overridden", zap.String("path", "/items"))
+	l.Info("no path")
+	l.Info("path not a string", zap.Int("path", 1))
+	if err := l.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/users", "/orders", "/items", "", ""}
+	msgs := p.sent()[0]
+	if len(msgs) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(msgs), len(want))
+	}
+	for i, msg := range msgs {
+		if string(msg.Key) != want[i] {
+			t.Errorf("message %d key = %q, want %q (%s)", i, msg.Key, want[i], msg.Value)
+		}
+	}
+}
+
+func TestProducerFailureFallsBack(t *testing.T) {
+	p := &fakeProducer{err: errors.New("leader not available")}
+	l, core, fallback := newTestCore(t, p, Config{BatchSize: 2, Linger: time.Hour})
+	l.Info("first")
+	l.Info("second")
+	l.Info("third")
+	if err := l.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	lines := fallback.Lines()
+	if len(lines) != 3 || !strings.Contains(lines[0], `"msg":"first"`) || !strings.Contains(lines[2], `"msg":"third"`) {
+		t.Errorf("fallback:\n%s", fallback.String())
+	}
+	if core.Fallbacks() != 3 {
+		t.Errorf("Fallbacks() = %d, want 3", core.Fallbacks())
+	}
+}
+
+func TestFullQueueDoesNotBlock(t *testing.T) {
+	p := &fakeProducer{block: make(chan struct{})}
+	l, core, fallback := newTestCore(t, p, Config{BatchSize: 1, Linger: time.Hour, QueueSize: 1})
+	defer close(p.block)
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		l.Info("entry", zap.Int("i", i))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("logging blocked for %s while the producer was stuck", elapsed)
+	}
+	// 一条卡在发送中，一条在队列里，其余改写到fallback
+	if core.Fallbacks() < 8 || len(fallback.Lines()) != int(core.Fallbacks()) {
+		t.Errorf("Fallbacks() = %d, fallback lines %d", core.Fallbacks(), len(fallback.Lines()))
+	}
+}
+
+func TestCloseFlushesAndClosesProducer(t *testing.T) {
+	p := &fakeProducer{}
+	l, core, fallback := newTestCore(t, p, Config{BatchSize: 100, Linger: time.Hour})
+	l.Info("before close")
+	if err := core.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if batches := p.sent(); len(batches) != 1 || len(batches[0]) != 1 || !p.closed {
+		t.Errorf("batches = %v, closed = %v", batches, p.closed)
+	}
+	l.Info("after close")
+	if !strings.Contains(fallback.String(), "after close") {
+		t.Errorf("entries after Close should go to the fallback:\n%s", fallback.String())
+	}
+	if err := core.Close(); err != nil {
+		t.Errorf("second Close() = %v", err)
+	}
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	tests := []struct {
+		cfg     Config
+		wantErr string
+	}{
+		{cfg: Config{Topic: "app-logs"}, wantErr: "brokers must not be empty"},
+		{cfg: Config{Brokers: []string{"kafka:9092"}}, wantErr: "topic must not be empty"},
+		{cfg: Config{Brokers: []string{"kafka:9092"}, Topic: "app-logs", Acks: "two"}, wantErr: `unknown acks "two"`},
+	}
+	for _, tt := range tests {
+		_, err := New(tt.cfg, zapcore.InfoLevel, zapcore.AddSync(&zaptest.Buffer{}))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("New(%+v) = %v, want %q", tt.cfg, err, tt.wantErr)
+		}
+	}
+	for in, want := range map[string]kafka.RequiredAcks{"": kafka.RequireAll, "ALL": kafka.RequireAll, "one": kafka.RequireOne, "0": kafka.RequireNone} {
+		got, err := Config{Acks: in}.withDefaults().requiredAcks()
+		if err != nil || got != want {
+			t.Errorf("acks %q = %v, %v, want %v", in, got, err, want)
+		}
+	}
+}
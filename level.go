@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// validLevels ParseLevel接受的级别，按从低到高排列
+var validLevels = []zapcore.Level{
+	zapcore.DebugLevel,
+	zapcore.InfoLevel,
+	zapcore.WarnLevel,
+	zapcore.ErrorLevel,
+	zapcore.DPanicLevel,
+	zapcore.PanicLevel,
+	zapcore.FatalLevel,
+}
+
+// ParseLevel 把字符串解析为日志级别，忽略大小写和首尾空白，
+// 接受debug、info、warn、error、dpanic、panic、fatal
+func ParseLevel(s string) (zapcore.Level, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	for _, l := range validLevels {
+		if l.String() == name {
+			return l, nil
+		}
+	}
+	names := make([]string, len(validLevels))
+	for i, l := range validLevels {
+		names[i] = l.String()
+	}
+	return zapcore.InfoLevel, fmt.Errorf("invalid log level %q, valid levels are: %s", s, strings.Join(names, ", "))
+}
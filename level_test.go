@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    zapcore.Level
+		wantErr bool
+	}{
+		{in: "debug", want: zapcore.DebugLevel},
+		{in: "info", want: zapcore.InfoLevel},
+		{in: "warn", want: zapcore.WarnLevel},
+		{in: "error", want: zapcore.ErrorLevel},
+		{in: "dpanic", want: zapcore.DPanicLevel},
+		{in: "panic", want: zapcore.PanicLevel},
+		{in: "fatal", want: zapcore.FatalLevel},
+		{in: "DEBUG", want: zapcore.DebugLevel},
+		{in: "Warn", want: zapcore.WarnLevel},
+		{in: "dPaNiC", want: zapcore.DPanicLevel},
+		{in: "  info  ", want: zapcore.InfoLevel},
+		{in: "\tError\n", want: zapcore.ErrorLevel},
+		{in: "", wantErr: true},
+		{in: "verbose", wantErr: true},
+		{in: "warning", wantErr: true},
+		{in: "in fo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLevel(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseLevel(%q) = %v, want error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLevel(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLevelErrorListsValidLevels(t *testing.T) {
+	_, err := ParseLevel("verbose")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, `"verbose"`) {
+		t.Errorf("error %q should quote the input", msg)
+	}
+	for _, l := range validLevels {
+		if !strings.Contains(msg, l.String()) {
+			t.Errorf("error %q should list %s", msg, l)
+		}
+	}
+}
+
+func TestInitLoggerWithConfigInvalidLevel(t *testing.T) {
+	unsetLogEnv(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.Level = "verbose"
+	if _, _, err := InitLoggerWithConfig(cfg); err == nil || !strings.Contains(err.Error(), "invalid log level") {
+		t.Fatalf("error = %v, want invalid log level", err)
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+logfmt Encoder
+有的日志系统解析logfmt（key=value，空格分隔）比JSON更好，Encoding配置为logfmt时使用。
+与JSON Encoder共用EncoderConfig，gin中间件的日志输出为：
+	ts=2020-01-02T03:04:05.000Z level=INFO msg=/ping status=200 method=GET cost=12ms
+值中有空格、=、引号或换行时加引号并转义；嵌套的对象、数组和zap.Any的值按点号展开，
+如req.header.0=... 、err.code=500。
+*/
+
+// bufferPool 自定义Encoder输出日志使用的buffer池
+var bufferPool = buffer.NewPool()
+
+// logfmtEncoder 实现zapcore.Encoder，prefix是OpenNamespace和嵌套对象带来的key前缀
+type logfmtEncoder struct {
+	cfg    *zapcore.EncoderConfig
+	buf    *buffer.Buffer
+	prefix string
+}
+
+// newLogfmtEncoder 使用cfg创建logfmt Encoder
+func newLogfmtEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	return &logfmtEncoder{cfg: &cfg, buf: bufferPool.Get()}
+}
+
+func (enc *logfmtEncoder) Clone() zapcore.Encoder {
+	clone := &logfmtEncoder{cfg: enc.cfg, buf: bufferPool.Get(), prefix: enc.prefix}
+	_, _ = clone.buf.Write(enc.buf.Bytes())
+	return clone
+}
+
+func (enc *logfmtEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	final := &logfmtEncoder{cfg: enc.cfg, buf: bufferPool.Get()}
+	cfg := enc.cfg
+	if cfg.TimeKey != "" && cfg.EncodeTime != nil {
+		final.addPrimitives(cfg.TimeKey, func(pe zapcore.PrimitiveArrayEncoder) { cfg.EncodeTime(ent.Time, pe) })
+	}
+	if cfg.LevelKey != "" && cfg.EncodeLevel != nil {
+		final.addPrimitives(cfg.LevelKey, func(pe zapcore.PrimitiveArrayEncoder) { cfg.EncodeLevel(ent.Level, pe) })
+	}
+	if cfg.NameKey != "" && ent.LoggerName != "" {
+		nameEncoder := cfg.EncodeName
+		if nameEncoder == nil {
+			nameEncoder = zapcore.FullNameEncoder
+		}
+		final.addPrimitives(cfg.NameKey, func(pe zapcore.PrimitiveArrayEncoder) { nameEncoder(ent.LoggerName, pe) })
+	}
+	if ent.Caller.Defined {
+		if cfg.CallerKey != "" && cfg.EncodeCaller != nil {
+			final.addPrimitives(cfg.CallerKey, func(pe zapcore.PrimitiveArrayEncoder) { cfg.EncodeCaller(ent.Caller, pe) })
+		}
+		if cfg.FunctionKey != "" {
+			final.AddString(cfg.FunctionKey, ent.Caller.Function)
+		}
+	}
+	if cfg.MessageKey != "" {
+		final.AddString(cfg.MessageKey, ent.Message)
+	}
+	if ent.Stack != "" && cfg.StacktraceKey != "" {
+		final.AddString(cfg.StacktraceKey, ent.Stack)
+	}
+	if enc.buf.Len() > 0 {
+		if final.buf.Len() > 0 {
+			final.buf.AppendByte(' ')
+		}
+		_, _ = final.buf.Write(enc.buf.Bytes())
+	}
+	final.prefix = enc.prefix
+	for i := range fields {
+		fields[i].AddTo(final)
+	}
+	if cfg.LineEnding != "" {
+		final.buf.AppendString(cfg.LineEnding)
+	} else {
+		final.buf.AppendString(zapcore.DefaultLineEnding)
+	}
+	return final.buf, nil
+}
+
+// add 写出一个key=value，value需要时加引号
+func (enc *logfmtEncoder) add(key, value string) {
+	if enc.buf.Len() > 0 {
+		enc.buf.AppendByte(' ')
+	}
+	enc.buf.AppendString(logfmtKey(enc.prefix + key))
+	enc.buf.AppendByte('=')
+	enc.buf.AppendString(logfmtValue(value))
+}
+
+// addPrimitives 用EncodeTime、EncodeLevel之类的编码器生成value，编码器输出多个值时用逗号连接
+func (enc *logfmtEncoder) addPrimitives(key string, encode func(zapcore.PrimitiveArrayEncoder)) {
+	var values logfmtPrimitives
+	encode(&values)
+	enc.add(key, strings.Join(values, ","))
+}
+
+func (enc *logfmtEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	return arr.MarshalLogArray(&logfmtArrayEncoder{enc: enc, key: key})
+}
+
+func (enc *logfmtEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	prefix := enc.prefix
+	enc.prefix = prefix + key + "."
+	err := obj.MarshalLogObject(enc)
+	enc.prefix = prefix
+	return err
+}
+
+func (enc *logfmtEncoder) AddBinary(key string, value []byte) {
+	enc.add(key, base64.StdEncoding.EncodeToString(value))
+}
+
+func (enc *logfmtEncoder) AddByteString(key string, value []byte) { enc.add(key, string(value)) }
+func (enc *logfmtEncoder) AddBool(key string, value bool)         { enc.add(key, strconv.FormatBool(value)) }
+func (enc *logfmtEncoder) AddComplex128(key string, value complex128) {
+	enc.add(key, fmt.Sprint(value))
+}
+func (enc *logfmtEncoder) AddComplex64(key string, value complex64) { enc.add(key, fmt.Sprint(value)) }
+func (enc *logfmtEncoder) AddFloat64(key string, value float64) {
+	enc.add(key, strconv.FormatFloat(value, 'f', -1, 64))
+}
+func (enc *logfmtEncoder) AddFloat32(key string, value float32) {
+	enc.add(key, strconv.FormatFloat(float64(value), 'f', -1, 32))
+}
+func (enc *logfmtEncoder) AddInt(key string, value int) { enc.AddInt64(key, int64(value)) }
+func (enc *logfmtEncoder) AddInt64(key string, value int64) {
+	enc.add(key, strconv.FormatInt(value, 10))
+}
+func (enc *logfmtEncoder) AddInt32(key string, value int32) { enc.AddInt64(key, int64(value)) }
+func (enc *logfmtEncoder) AddInt16(key string, value int16) { enc.AddInt64(key, int64(value)) }
+func (enc *logfmtEncoder) AddInt8(key string, value int8)   { enc.AddInt64(key, int64(value)) }
+func (enc *logfmtEncoder) AddString(key, value string)      { enc.add(key, value) }
+func (enc *logfmtEncoder) AddUint(key string, value uint)   { enc.AddUint64(key, uint64(value)) }
+func (enc *logfmtEncoder) AddUint64(key string, value uint64) {
+	enc.add(key, strconv.FormatUint(value, 10))
+}
+func (enc *logfmtEncoder) AddUint32(key string, value uint32)   { enc.AddUint64(key, uint64(value)) }
+func (enc *logfmtEncoder) AddUint16(key string, value uint16)   { enc.AddUint64(key, uint64(value)) }
+func (enc *logfmtEncoder) AddUint8(key string, value uint8)     { enc.AddUint64(key, uint64(value)) }
+func (enc *logfmtEncoder) AddUintptr(key string, value uintptr) { enc.AddUint64(key, uint64(value)) }
+
+func (enc *logfmtEncoder) AddDuration(key string, value time.Duration) {
+	if enc.cfg.EncodeDuration == nil {
+		enc.AddInt64(key, int64(value))
+		return
+	}
+	enc.addPrimitives(key, func(pe zapcore.PrimitiveArrayEncoder) { enc.cfg.EncodeDuration(value, pe) })
+}
+
+func (enc *logfmtEncoder) AddTime(key string, value time.Time) {
+	if enc.cfg.EncodeTime == nil {
+		enc.AddInt64(key, value.UnixNano())
+		return
+	}
+	enc.addPrimitives(key, func(pe zapcore.PrimitiveArrayEncoder) { enc.cfg.EncodeTime(value, pe) })
+}
+
+// AddReflected 先按JSON序列化，再把对象和数组按点号展开，如zap.Any("req", map...)得到req.method=GET
+func (enc *logfmtEncoder) AddReflected(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	enc.addFlattened(key, v)
+	return nil
+}
+
+// addFlattened 把JSON解析出的值按点号展开写出
+func (enc *logfmtEncoder) addFlattened(key string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			enc.add(key, "{}")
+			return
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			enc.addFlattened(key+"."+k, v[k])
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			enc.add(key, "[]")
+			return
+		}
+		for i, elem := range v {
+			enc.addFlattened(key+"."+strconv.Itoa(i), elem)
+		}
+	case nil:
+		enc.add(key, "null")
+	default:
+		enc.add(key, fmt.Sprint(v))
+	}
+}
+
+func (enc *logfmtEncoder) OpenNamespace(key string) {
+	enc.prefix += key + "."
+}
+
+// logfmtArrayEncoder 数组元素按下标展开为key.0、key.1……
+type logfmtArrayEncoder struct {
+	enc *logfmtEncoder
+	key string
+	i   int
+}
+
+func (a *logfmtArrayEncoder) next() string {
+	key := a.key + "." + strconv.Itoa(a.i)
+	a.i++
+	return key
+}
+
+func (a *logfmtArrayEncoder) AppendArray(v zapcore.ArrayMarshaler) error {
+	return a.enc.AddArray(a.next(), v)
+}
+func (a *logfmtArrayEncoder) AppendObject(v zapcore.ObjectMarshaler) error {
+	return a.enc.AddObject(a.next(), v)
+}
+func (a *logfmtArrayEncoder) AppendReflected(v interface{}) error {
+	return a.enc.AddReflected(a.next(), v)
+}
+func (a *logfmtArrayEncoder) AppendBool(v bool)              { a.enc.AddBool(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendByteString(v []byte)      { a.enc.AddByteString(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendComplex128(v complex128)  { a.enc.AddComplex128(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendComplex64(v complex64)    { a.enc.AddComplex64(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendFloat64(v float64)        { a.enc.AddFloat64(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendFloat32(v float32)        { a.enc.AddFloat32(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendInt(v int)                { a.enc.AddInt(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendInt64(v int64)            { a.enc.AddInt64(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendInt32(v int32)            { a.enc.AddInt32(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendInt16(v int16)            { a.enc.AddInt16(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendInt8(v int8)              { a.enc.AddInt8(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendString(v string)          { a.enc.AddString(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendUint(v uint)              { a.enc.AddUint(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendUint64(v uint64)          { a.enc.AddUint64(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendUint32(v uint32)          { a.enc.AddUint32(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendUint16(v uint16)          { a.enc.AddUint16(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendUint8(v uint8)            { a.enc.AddUint8(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendUintptr(v uintptr)        { a.enc.AddUintptr(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendDuration(v time.Duration) { a.enc.AddDuration(a.next(), v) }
+func (a *logfmtArrayEncoder) AppendTime(v time.Time)         { a.enc.AddTime(a.next(), v) }
+
+// logfmtPrimitives 收集EncodeTime、EncodeLevel等编码器输出的值
+type logfmtPrimitives []string
+
+func (p *logfmtPrimitives) add(v string)                  { *p = append(*p, v) }
+func (p *logfmtPrimitives) AppendBool(v bool)             { p.add(strconv.FormatBool(v)) }
+func (p *logfmtPrimitives) AppendByteString(v []byte)     { p.add(string(v)) }
+func (p *logfmtPrimitives) AppendComplex128(v complex128) { p.add(fmt.Sprint(v)) }
+func (p *logfmtPrimitives) AppendComplex64(v complex64)   { p.add(fmt.Sprint(v)) }
+func (p *logfmtPrimitives) AppendFloat64(v float64)       { p.add(strconv.FormatFloat(v, 'f', -1, 64)) }
+func (p *logfmtPrimitives) AppendFloat32(v float32) {
+	p.add(strconv.FormatFloat(float64(v), 'f', -1, 32))
+}
+func (p *logfmtPrimitives) AppendInt(v int)         { p.AppendInt64(int64(v)) }
+func (p *logfmtPrimitives) AppendInt64(v int64)     { p.add(strconv.FormatInt(v, 10)) }
+func (p *logfmtPrimitives) AppendInt32(v int32)     { p.AppendInt64(int64(v)) }
+func (p *logfmtPrimitives) AppendInt16(v int16)     { p.AppendInt64(int64(v)) }
+func (p *logfmtPrimitives) AppendInt8(v int8)       { p.AppendInt64(int64(v)) }
+func (p *logfmtPrimitives) AppendString(v string)   { p.add(v) }
+func (p *logfmtPrimitives) AppendUint(v uint)       { p.AppendUint64(uint64(v)) }
+func (p *logfmtPrimitives) AppendUint64(v uint64)   { p.add(strconv.FormatUint(v, 10)) }
+func (p *logfmtPrimitives) AppendUint32(v uint32)   { p.AppendUint64(uint64(v)) }
+func (p *logfmtPrimitives) AppendUint16(v uint16)   { p.AppendUint64(uint64(v)) }
+func (p *logfmtPrimitives) AppendUint8(v uint8)     { p.AppendUint64(uint64(v)) }
+func (p *logfmtPrimitives) AppendUintptr(v uintptr) { p.AppendUint64(uint64(v)) }
+
+// logfmtKey key中的空白、=和引号替换为下划线
+func logfmtKey(key string) string {
+	if !strings.ContainsAny(key, " =\"\t\r\n") {
+		return key
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '=' || r == '"' || unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// logfmtValue value为空或含有空白、=、引号、反斜杠、控制字符时加引号并转义
+func logfmtValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+	for _, r := range value {
+		if r == '=' || r == '"' || r == '\\' || r == utf8.RuneError || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return strconv.Quote(value)
+		}
+	}
+	return value
+}
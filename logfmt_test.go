@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+// parseLogfmt 解析一行logfmt，value带引号时按Go字符串字面量反转义，key重复时报错
+func parseLogfmt(line string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for line != "" {
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("missing key=value at %q", line)
+		}
+		key := line[:eq]
+		if strings.ContainsAny(key, " \"") {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+		line = line[eq+1:]
+
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			end := 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, fmt.Errorf("key %s: unterminated quote", key)
+			}
+			quoted := line[:end+1]
+			var err error
+			if value, err = strconv.Unquote(quoted); err != nil {
+				return nil, fmt.Errorf("key %s: %v", key, err)
+			}
+			line = line[len(quoted):]
+		} else {
+			end := strings.IndexByte(line, ' ')
+			if end < 0 {
+				end = len(line)
+			}
+			value = line[:end]
+			if strings.ContainsAny(value, "=\"") {
+				return nil, fmt.Errorf("key %s: unquoted value %q", key, value)
+			}
+			line = line[end:]
+		}
+		if _, ok := pairs[key]; ok {
+			return nil, fmt.Errorf("duplicate key %s", key)
+		}
+		pairs[key] = value
+
+		if line != "" {
+			if line[0] != ' ' {
+				return nil, fmt.Errorf("key %s: missing separator before %q", key, line)
+			}
+			line = line[1:]
+		}
+	}
+	return pairs, nil
+}
+
+// encodeLogfmt 用logfmt编码一条Info日志，返回去掉换行的那一行
+func encodeLogfmt(t *testing.T, fields ...zap.Field) string {
+	t.Helper()
+	cfg := defaultLogConfig()
+	cfg.Encoding = EncodingLogfmt
+	cfg.TimeZone = "utc"
+	cfg.DisableCaller = true
+	return encodeLine(t, cfg, fields...)
+}
+
+func TestLogfmtRoundTrip(t *testing.T) {
+	values := []string{
+		"plain",
+		"",
+		"with space",
+		"a=b",
+		`say "hi"`,
+		`C:\logs\app.log`,
+		"line1\nline2",
+		"tab\there",
+		"cr\r\n",
+		"bell\a",
+		"中文 日志",
+		"trailing ",
+	}
+	for _, v := range values {
+		t.Run(strconv.Quote(v), func(t *testing.T) {
+			line := encodeLogfmt(t, zap.String("v", v))
+			if strings.ContainsAny(line, "\r\n") {
+				t.Fatalf("line breaks must be escaped: %q", line)
+			}
+			got, err := parseLogfmt(line)
+			if err != nil {
+				t.Fatalf("parse %q: %v", line, err)
+			}
+			if got["v"] != v {
+				t.Errorf("v = %q, want %q (line %q)", got["v"], v, line)
+			}
+			if got["msg"] != "hello" || got["level"] != "INFO" || got["ts"] != "2024-05-17T10:00:00.000Z" {
+				t.Errorf("entry keys = %v", got)
+			}
+		})
+	}
+}
+
+func TestLogfmtFieldTypes(t *testing.T) {
+	line := encodeLogfmt(t,
+		zap.Int("int", -3),
+		zap.Uint8("uint", 7),
+		zap.Bool("ok", true),
+		zap.Float64("ratio", 0.25),
+		zap.Duration("cost", 12*time.Millisecond),
+		zap.Binary("bin", []byte{0xff, 0x00}),
+		zap.Error(errors.New("boom: bad thing")),
+		zap.Strings("tags", []string{"a", "b c"}),
+		zap.Namespace("req"),
+		zap.String("id", "r1"),
+	)
+	got, err := parseLogfmt(line)
+	if err != nil {
+		t.Fatalf("parse %q: %v", line, err)
+	}
+	want := map[string]string{
+		"int":    "-3",
+		"uint":   "7",
+		"ok":     "true",
+		"ratio":  "0.25",
+		"cost":   "0.012",
+		"bin":    "/wA=",
+		"error":  "boom: bad thing",
+		"tags.0": "a",
+		"tags.1": "b c",
+		"req.id": "r1",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q (line %q)", k, got[k], v, line)
+		}
+	}
+}
+
+func TestLogfmtFlattensAny(t *testing.T) {
+	line := encodeLogfmt(t, zap.Any("error", map[string]interface{}{
+		"code": 500,
+		"detail": map[string]interface{}{
+			"reason": "db down",
+			"hosts":  []string{"db1", "db2"},
+		},
+		"empty": []int{},
+		"nil":   nil,
+	}))
+	got, err := parseLogfmt(line)
+	if err != nil {
+		t.Fatalf("parse %q: %v", line, err)
+	}
+	want := map[string]string{
+		"error.code":           "500",
+		"error.detail.reason":  "db down",
+		"error.detail.hosts.0": "db1",
+		"error.detail.hosts.1": "db2",
+		"error.empty":          "[]",
+		"error.nil":            "null",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q (line %q)", k, got[k], v, line)
+		}
+	}
+	if _, ok := got["error"]; ok {
+		t.Errorf("nested value should be flattened, got error=%q", got["error"])
+	}
+}
+
+func TestLogfmtKeysSanitized(t *testing.T) {
+	line := encodeLogfmt(t, zap.String("bad key=\"x\"", "v"))
+	got, err := parseLogfmt(line)
+	if err != nil {
+		t.Fatalf("parse %q: %v", line, err)
+	}
+	if got["bad_key__x_"] != "v" {
+		t.Errorf("sanitized key missing: %v", got)
+	}
+}
+
+func TestLogfmtGinLogger(t *testing.T) {
+	clock := NewManualClock(fixedTime)
+	out := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingLogfmt
+	cfg.TimeZone = "utc"
+	cfg.DisableCaller = true
+	cfg.DurationEncoding = DurationEncodingString
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(MustGinLoggerWithConfig(l, GinLoggerConfig{Clock: clock}))
+	r.GET("/ping", func(c *gin.Context) {
+		clock.Add(12 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("User-Agent", "curl/7.68.0 (x86_64)")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	want := `ts=2024-05-17T10:00:00.012Z level=INFO msg=/ping status=200 method=GET path=/ping query="" ` +
+		`ip=10.0.0.1 user-agent="curl/7.68.0 (x86_64)" cost=12ms`
+	if got := strings.TrimSpace(out.String()); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestLogfmtGinRecovery(t *testing.T) {
+	out := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingLogfmt
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(GinRecoveryWithConfig(l, GinRecoveryConfig{Stack: true, StructuredRequest: true}))
+	r.GET("/panic", func(c *gin.Context) {
+		panic(map[string]interface{}{"code": 42, "why": "bad input"})
+	})
+	req := httptest.NewRequest(http.MethodGet, "/panic?x=1", nil)
+	req.Header.Set("X-Trace", "abc")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := out.Lines()
+	if len(lines) != 1 {
+		t.Fatalf("stack must stay on one escaped line, got %d lines:\n%s", len(lines), out.String())
+	}
+	got, err := parseLogfmt(lines[0])
+	if err != nil {
+		t.Fatalf("parse %q: %v", lines[0], err)
+	}
+	if got["error.code"] != "42" || got["error.why"] != "bad input" {
+		t.Errorf("panic value should be flattened: %v", got)
+	}
+	if got["request.method"] != http.MethodGet || got["request.url"] != "/panic?x=1" || got["request.header.X-Trace"] != "abc" {
+		t.Errorf("request object should be flattened: %v", got)
+	}
+	if !strings.Contains(got["stack"], "TestLogfmtGinRecovery") {
+		t.Errorf("stack = %q", got["stack"])
+	}
+}
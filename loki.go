@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+推送到Grafana Loki
+不想为了读lumberjack文件再部署promtail时，配置Loki后日志直接POST到Loki的/loki/api/v1/push：
+	{"streams":[{"stream":{"service":"demo","env":"prod","level":"info"},"values":[["1577934245006000000","..."]]}]}
+每条日志按level分到不同的stream，service、env取自ServiceName、Env，Labels中的标签也一起带上。
+日志先进入异步写入的队列（见async.go），不会阻塞请求；后台攒够BatchSize条或者最早的一条等了BatchWait之后推送一次，
+遇到429或5xx时按Backoff翻倍重试，最多MaxRetries次，最终失败的条数和队列满时丢弃的条数见LokiDropped。
+*/
+
+// lokiPushPath Loki接收日志的接口
+const lokiPushPath = "/loki/api/v1/push"
+
+// 推送到Loki的默认值
+const (
+	defaultLokiBatchSize  = 1000
+	defaultLokiBatchWait  = time.Second
+	defaultLokiMaxRetries = 5
+	defaultLokiBackoff    = 500 * time.Millisecond
+	defaultLokiTimeout    = 10 * time.Second
+	lokiMaxBackoff        = 30 * time.Second
+	lokiMinBatchWait      = 10 * time.Millisecond
+)
+
+// LokiConfig 推送到Loki的配置，为0的项使用默认值
+type LokiConfig struct {
+	URL        string            `yaml:"url" json:"url"`                 // Loki的地址，如http://loki:3100
+	Labels     map[string]string `yaml:"labels" json:"labels"`           // 额外的stream标签
+	BatchSize  int               `yaml:"batch_size" json:"batch_size"`   // 每次最多推送的条数，默认1000
+	BatchWait  time.Duration     `yaml:"batch_wait" json:"batch_wait"`   // 最早的一条最多等多久推送，默认1秒
+	MaxRetries int               `yaml:"max_retries" json:"max_retries"` // 429或5xx时最多重试的次数，默认5
+	Backoff    time.Duration     `yaml:"backoff" json:"backoff"`         // 第一次重试前等待的时间，之后每次翻倍，默认500ms
+	Timeout    time.Duration     `yaml:"timeout" json:"timeout"`         // 每次请求的超时，默认10秒
+	QueueSize  int               `yaml:"queue_size" json:"queue_size"`   // 异步队列的长度，默认1024
+}
+
+func (l LokiConfig) validate() error {
+	if l.URL == "" {
+		return fmt.Errorf("log config: loki url must not be empty")
+	}
+	if !strings.HasPrefix(l.URL, "http://") && !strings.HasPrefix(l.URL, "https://") {
+		return fmt.Errorf("log config: loki url must start with http:// or https://, got %q", l.URL)
+	}
+	if l.BatchSize < 0 || l.MaxRetries < 0 || l.QueueSize < 0 {
+		return fmt.Errorf("log config: loki batch size, max retries and queue size must not be negative")
+	}
+	if l.BatchWait < 0 || l.Backoff < 0 || l.Timeout < 0 {
+		return fmt.Errorf("log config: loki batch wait, backoff and timeout must not be negative")
+	}
+	if l.BatchWait > 0 && l.BatchWait < lokiMinBatchWait {
+		return fmt.Errorf("log config: loki batch wait must be at least %v, got %v", lokiMinBatchWait, l.BatchWait)
+	}
+	for name := range l.Labels {
+		if name == "level" {
+			return fmt.Errorf("log config: loki label level is set per entry")
+		}
+	}
+	return nil
+}
+
+func (l LokiConfig) withDefaults() LokiConfig {
+	if l.BatchSize == 0 {
+		l.BatchSize = defaultLokiBatchSize
+	}
+	if l.BatchWait == 0 {
+		l.BatchWait = defaultLokiBatchWait
+	}
+	if l.MaxRetries == 0 {
+		l.MaxRetries = defaultLokiMaxRetries
+	}
+	if l.Backoff == 0 {
+		l.Backoff = defaultLokiBackoff
+	}
+	if l.Timeout == 0 {
+		l.Timeout = defaultLokiTimeout
+	}
+	return l
+}
+
+// lokiDropped 推送最终失败或者队列满而丢弃的日志条数
+var lokiDropped uint64
+
+// LokiDropped 返回到目前为止推送到Loki最终失败或者队列满而丢弃的日志条数
+func LokiDropped() uint64 {
+	return atomic.LoadUint64(&lokiDropped)
+}
+
+// lokiStream push请求中的一个stream
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// lokiPusher 攒批并推送到Loki。经过异步队列写入的每一项是：1字节级别、8字节UnixNano时间戳、一行日志
+type lokiPusher struct {
+	cfg    LokiConfig
+	url    string
+	labels map[string]string // 每个stream都带的标签
+	client *http.Client
+	sleep  func(time.Duration)
+
+	pushMu  sync.Mutex // 保证多批日志按顺序推送，重试等待时只持有pushMu，Write可以继续攒下一批
+	mu      sync.Mutex
+	streams map[zapcore.Level][][2]string
+	count   int
+	first   time.Time // 这一批最早一条进入的时间
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newLokiPusher(cfg LokiConfig, logCfg LogConfig) *lokiPusher {
+	cfg = cfg.withDefaults()
+	labels := make(map[string]string)
+	if logCfg.ServiceName != "" {
+		labels["service"] = logCfg.ServiceName
+	}
+	if logCfg.Env != "" {
+		labels["env"] = logCfg.Env
+	}
+	for k, v := range cfg.Labels {
+		labels[k] = v
+	}
+	p := &lokiPusher{
+		cfg:     cfg,
+		url:     strings.TrimSuffix(cfg.URL, "/") + lokiPushPath,
+		labels:  labels,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		sleep:   time.Sleep,
+		streams: make(map[zapcore.Level][][2]string),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// run 定期推送等了BatchWait还没推送的日志
+func (p *lokiPusher) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.cfg.BatchWait / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		due := p.count > 0 && time.Since(p.first) >= p.cfg.BatchWait
+		p.mu.Unlock()
+		if due {
+			_ = p.flush()
+		}
+	}
+}
+
+func (p *lokiPusher) Write(b []byte) (int, error) {
+	if len(b) < 9 {
+		return 0, fmt.Errorf("loki: short entry")
+	}
+	level := zapcore.Level(int8(b[0]))
+	ts := strconv.FormatInt(int64(binary.BigEndian.Uint64(b[1:9])), 10)
+	p.mu.Lock()
+	if p.count == 0 {
+		p.first = time.Now()
+	}
+	p.streams[level] = append(p.streams[level], [2]string{ts, string(b[9:])})
+	p.count++
+	full := p.count >= p.cfg.BatchSize
+	p.mu.Unlock()
+	if full {
+		return len(b), p.flush()
+	}
+	return len(b), nil
+}
+
+// Sync 立即推送攒着的日志
+func (p *lokiPusher) Sync() error {
+	return p.flush()
+}
+
+// Close 停止定期推送，并推送剩下的日志
+func (p *lokiPusher) Close() error {
+	close(p.stop)
+	<-p.done
+	return p.Sync()
+}
+
+// flush 在mu下取出攒着的日志，放开mu之后再推送
+func (p *lokiPusher) flush() error {
+	p.pushMu.Lock()
+	defer p.pushMu.Unlock()
+	p.mu.Lock()
+	body, count, err := p.takeLocked()
+	p.mu.Unlock()
+	if count == 0 {
+		return nil
+	}
+	if err == nil {
+		err = p.push(body)
+	}
+	if err != nil {
+		atomic.AddUint64(&lokiDropped, uint64(count))
+	}
+	return err
+}
+
+// takeLocked 把攒着的日志编码成push请求并清空，返回的count为其中的条数
+func (p *lokiPusher) takeLocked() (body []byte, count int, err error) {
+	if p.count == 0 {
+		return nil, 0, nil
+	}
+	req := struct {
+		Streams []lokiStream `json:"streams"`
+	}{}
+	levels := make([]zapcore.Level, 0, len(p.streams))
+	for level := range p.streams {
+		levels = append(levels, level)
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+	for _, level := range levels {
+		stream := map[string]string{"level": level.String()}
+		for k, v := range p.labels {
+			stream[k] = v
+		}
+		req.Streams = append(req.Streams, lokiStream{Stream: stream, Values: p.streams[level]})
+	}
+	count = p.count
+	p.streams = make(map[zapcore.Level][][2]string)
+	p.count = 0
+	body, err = json.Marshal(req)
+	return body, count, err
+}
+
+// push POST body，遇到429、5xx或网络错误时重试
+func (p *lokiPusher) push(body []byte) error {
+	backoff := p.cfg.Backoff
+	var err error
+	for attempt := 0; attempt <= p.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			p.sleep(backoff)
+			if backoff *= 2; backoff > lokiMaxBackoff {
+				backoff = lokiMaxBackoff
+			}
+		}
+		var retry bool
+		if retry, err = p.pushOnce(body); err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// pushOnce 推送一次，返回的retry表示失败后是否值得重试
+func (p *lokiPusher) pushOnce(body []byte) (retry bool, err error) {
+	resp, err := p.client.Post(p.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	err = fmt.Errorf("loki: push returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// lokiCore 编码后把级别和时间一起写进异步队列，由lokiPusher推送
+type lokiCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	ws  zapcore.WriteSyncer
+}
+
+// newLokiCore 按cfg.Loki创建推送到Loki的core，返回的io.Closer先写完队列再推送剩下的日志
+func newLokiCore(cfg LogConfig, enc zapcore.Encoder, level zapcore.LevelEnabler) (zapcore.Core, io.Closer) {
+	loki := cfg.Loki.withDefaults()
+	pusher := newLokiPusher(loki, cfg)
+	async := newAsyncWriteSyncer(pusher, AsyncConfig{QueueSize: loki.QueueSize, DrainTimeout: loki.Timeout}, &lokiDropped)
+	return &lokiCore{LevelEnabler: level, enc: enc, ws: async}, &lokiCloser{async, pusher}
+}
+
+func (c *lokiCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &lokiCore{LevelEnabler: c.LevelEnabler, enc: enc, ws: c.ws}
+}
+
+func (c *lokiCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *lokiCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	line := bytes.TrimRight(buf.Bytes(), "\r\n")
+	b := make([]byte, 9, 9+len(line))
+	b[0] = byte(ent.Level)
+	binary.BigEndian.PutUint64(b[1:9], uint64(ent.Time.UnixNano()))
+	b = append(b, line...)
+	buf.Free()
+	_, err = c.ws.Write(b)
+	return err
+}
+
+func (c *lokiCore) Sync() error {
+	return c.ws.Sync()
+}
+
+// lokiCloser 先把异步队列写完，再推送剩下的日志
+type lokiCloser struct {
+	async  *asyncWriteSyncer
+	pusher *lokiPusher
+}
+
+func (c *lokiCloser) Close() error {
+	return multierr.Append(c.async.Close(), c.pusher.Close())
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// lokiPush 反序列化后的push请求
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+// lokiServer 本地的Loki，statuses依次作为每个请求的响应码，用完之后总是返回204
+type lokiServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	pushes   []lokiPush
+	requests int
+}
+
+func startLokiServer(t *testing.T, statuses ...int) *lokiServer {
+	t.Helper()
+	s := &lokiServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != lokiPushPath || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %s (%s)", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests++
+		status := http.StatusNoContent
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		if status/100 == 2 {
+			var push lokiPush
+			if err := json.Unmarshal(body, &push); err != nil {
+				t.Errorf("push body is not JSON: %s", body)
+			}
+			s.pushes = append(s.pushes, push)
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, http.StatusText(status))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *lokiServer) received() (requests int, pushes []lokiPush) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests, append([]lokiPush(nil), s.pushes...)
+}
+
+// lokiEntry 按lokiPusher.Write要求的格式拼出一项
+func lokiEntry(level zapcore.Level, ts time.Time, line string) []byte {
+	b := make([]byte, 9, 9+len(line))
+	b[0] = byte(level)
+	binary.BigEndian.PutUint64(b[1:9], uint64(ts.UnixNano()))
+	return append(b, line...)
+}
+
+// newTestLokiPusher 直接创建lokiPusher，重试等待的时间记在返回的切片里而不真的等待
+func newTestLokiPusher(t *testing.T, cfg LokiConfig) (*lokiPusher, *[]time.Duration) {
+	t.Helper()
+	p := newLokiPusher(cfg, LogConfig{ServiceName: "demo", Env: "test"})
+	var sleeps []time.Duration
+	p.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	t.Cleanup(func() { p.Close() })
+	return p, &sleeps
+}
+
+func TestLokiPushPayload(t *testing.T) {
+	s := startLokiServer(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingJSON
+	cfg.ServiceName = "demo"
+	cfg.Env = "prod"
+	b, err := newLogger(WithConfig(cfg), WithLoki(LokiConfig{URL: s.URL + "/", Labels: map[string]string{"region": "eu"}, BatchWait: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	b.logger.Info("first")
+	b.logger.Error("failed")
+	b.logger.Info("second")
+	if err := b.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, pushes := s.received()
+	if len(pushes) != 1 {
+		t.Fatalf("got %d pushes, want 1 batch", len(pushes))
+	}
+	streams := pushes[0].Streams
+	if len(streams) != 2 {
+		t.Fatalf("got %d streams, want one per level: %+v", len(streams), streams)
+	}
+	want := []struct {
+		level string
+		msgs  []string
+	}{
+		{"info", []string{"first", "second"}},
+		{"error", []string{"failed"}},
+	}
+	for i, w := range want {
+		labels := streams[i].Stream
+		if len(labels) != 4 || labels["level"] != w.level || labels["service"] != "demo" || labels["env"] != "prod" || labels["region"] != "eu" {
+			t.Errorf("stream %d labels = %v", i, labels)
+		}
+		if len(streams[i].Values) != len(w.msgs) {
+			t.Fatalf("stream %s has %d values, want %d", w.level, len(streams[i].Values), len(w.msgs))
+		}
+		for j, v := range streams[i].Values {
+			ns, err := strconv.ParseInt(v[0], 10, 64)
+			if err != nil || time.Unix(0, ns).Before(start.Add(-time.Second)) {
+				t.Errorf("timestamp %q should be the entry time in nanoseconds", v[0])
+			}
+			var entry map[string]interface{}
+			if err := json.Unmarshal([]byte(v[1]), &entry); err != nil || strings.HasSuffix(v[1], "\n") {
+				t.Fatalf("line is not a single JSON object: %q", v[1])
+			}
+			if entry["msg"] != w.msgs[j] {
+				t.Errorf("stream %s value %d = %s, want msg %q", w.level, j, v[1], w.msgs[j])
+			}
+		}
+	}
+}
+
+func TestLokiBatching(t *testing.T) {
+	s := startLokiServer(t)
+	p, _ := newTestLokiPusher(t, LokiConfig{URL: s.URL, BatchSize: 3, BatchWait: time.Hour})
+	for i := 0; i < 7; i++ {
+		if _, err := p.Write(lokiEntry(zapcore.InfoLevel, fixedTime, fmt.Sprintf("entry %d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, pushes := s.received(); len(pushes) != 2 {
+		t.Fatalf("got %d pushes after 7 entries, want 2 full batches", len(pushes))
+	}
+	if err := p.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	_, pushes := s.received()
+	var got []string
+	for _, push := range pushes {
+		got = append(got, fmt.Sprint(len(push.Streams[0].Values)))
+		if ts := push.Streams[0].Values[0][0]; ts != strconv.FormatInt(fixedTime.UnixNano(), 10) {
+			t.Errorf("timestamp = %s", ts)
+		}
+	}
+	if strings.Join(got, ",") != "3,3,1" {
+		t.Errorf("batch sizes = %s, want 3,3,1", strings.Join(got, ","))
+	}
+}
+
+func TestLokiBatchWait(t *testing.T) {
+	s := startLokiServer(t)
+	p, _ := newTestLokiPusher(t, LokiConfig{URL: s.URL, BatchWait: 20 * time.Millisecond})
+	p.Write(lokiEntry(zapcore.WarnLevel, fixedTime, "alone"))
+	waitFor(t, 5*time.Second, "the batch wait to push a partial batch", func() bool {
+		_, pushes := s.received()
+		return len(pushes) == 1
+	})
+}
+
+func TestLokiRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantRequests int
+		wantErr      string
+		wantSleeps   string
+	}{
+		{name: "ok", wantRequests: 1, wantSleeps: "[]"},
+		{name: "429 then ok", statuses: []int{429, 429}, wantRequests: 3, wantSleeps: "[10ms 20ms]"},
+		{name: "5xx then ok", statuses: []int{500, 502, 503}, wantRequests: 4, wantSleeps: "[10ms 20ms 40ms]"},
+		{name: "retries exhausted", statuses: []int{503, 503, 503, 503, 503}, wantRequests: 4, wantErr: "503 Service Unavailable", wantSleeps: "[10ms 20ms 40ms]"},
+		{name: "400 is not retried", statuses: []int{400}, wantRequests: 1, wantErr: "400 Bad Request", wantSleeps: "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := startLokiServer(t, tt.statuses...)
+			p, sleeps := newTestLokiPusher(t, LokiConfig{URL: s.URL, BatchWait: time.Hour, MaxRetries: 3, Backoff: 10 * time.Millisecond})
+			dropped := LokiDropped()
+			p.Write(lokiEntry(zapcore.InfoLevel, fixedTime, "a"))
+			p.Write(lokiEntry(zapcore.ErrorLevel, fixedTime, "b"))
+
+			err := p.Sync()
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Sync() = %v, want %q", err, tt.wantErr)
+			}
+			requests, pushes := s.received()
+			if requests != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", requests, tt.wantRequests)
+			}
+			if fmt.Sprint(*sleeps) != tt.wantSleeps {
+				t.Errorf("backoff = %v, want %s", *sleeps, tt.wantSleeps)
+			}
+			var wantDropped uint64
+			if tt.wantErr != "" {
+				wantDropped = 2
+			} else if len(pushes) != 1 || len(pushes[0].Streams) != 2 {
+				t.Errorf("pushes = %+v", pushes)
+			}
+			if got := LokiDropped() - dropped; got != wantDropped {
+				t.Errorf("LokiDropped() grew by %d, want %d", got, wantDropped)
+			}
+		})
+	}
+}
+
+func TestLokiWriteNotBlockedByRetry(t *testing.T) {
+	s := startLokiServer(t, 503)
+	p, _ := newTestLokiPusher(t, LokiConfig{URL: s.URL, BatchWait: time.Hour, MaxRetries: 1})
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	p.sleep = func(time.Duration) {
+		close(entered)
+		<-release
+	}
+	p.Write(lokiEntry(zapcore.InfoLevel, fixedTime, "first batch"))
+	synced := make(chan error)
+	go func() { synced <- p.Sync() }()
+	<-entered
+
+	// 第一批在退避等待时，后面的日志照常攒进下一批
+	wrote := make(chan struct{})
+	go func() {
+		p.Write(lokiEntry(zapcore.InfoLevel, fixedTime, "second batch"))
+		close(wrote)
+	}()
+	select {
+	case <-wrote:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write blocked while a push was backing off")
+	}
+	close(release)
+	if err := <-synced; err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	_, pushes := s.received()
+	if len(pushes) != 2 || pushes[0].Streams[0].Values[0][1] != "first batch" || pushes[1].Streams[0].Values[0][1] != "second batch" {
+		t.Errorf("pushes = %+v, want the two batches in order", pushes)
+	}
+}
+
+func TestLokiConfigValidate(t *testing.T) {
+	tests := []struct {
+		cfg     LokiConfig
+		wantErr string
+	}{
+		{cfg: LokiConfig{URL: "http://loki:3100"}},
+		{cfg: LokiConfig{URL: "https://loki:3100", BatchWait: lokiMinBatchWait}},
+		{cfg: LokiConfig{}, wantErr: "loki url must not be empty"},
+		{cfg: LokiConfig{URL: "loki:3100"}, wantErr: "loki url must start with http:// or https://"},
+		{cfg: LokiConfig{URL: "http://loki:3100", BatchSize: -1}, wantErr: "must not be negative"},
+		{cfg: LokiConfig{URL: "http://loki:3100", Backoff: -1}, wantErr: "must not be negative"},
+		{cfg: LokiConfig{URL: "http://loki:3100", BatchWait: time.Nanosecond}, wantErr: "loki batch wait must be at least 10ms, got 1ns"},
+		{cfg: LokiConfig{URL: "http://loki:3100", Labels: map[string]string{"level": "x"}}, wantErr: "loki label level is set per entry"},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.validate()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%+v: validate() = %v, want %q", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+日志盘空间不足时降级
+日志盘写满会让服务出问题，空间紧张时宁可少写Debug/Info。配置LowDisk后，每隔CheckInterval检查一次
+日志目录所在磁盘的剩余空间（Unix上是statfs，Windows上是GetDiskFreeSpaceEx），
+低于MinFreeMB时通过AtomicLevel把级别提高到Warn，并记录一条"log volume low"；
+剩余空间回到MinFreeMB的1.2倍以上时恢复原来的级别并记录"log volume recovered"，避免在阈值附近反复切换。
+降级期间如果级别被SetLevel或重新加载配置改过，恢复时不再改回去。当前状态见LogVolumeLow。
+*/
+
+// 空间不足检查的默认值
+const (
+	defaultLowDiskMinFreeMB     = 500
+	defaultLowDiskCheckInterval = 30 * time.Second
+)
+
+// LowDiskConfig 日志盘空间不足时降级的配置，为0的项使用默认值
+type LowDiskConfig struct {
+	MinFreeMB     int           `yaml:"min_free_mb" json:"min_free_mb"`       // 剩余空间低于多少MB时只写Warn及以上，默认500
+	CheckInterval time.Duration `yaml:"check_interval" json:"check_interval"` // 检查间隔，默认30秒
+}
+
+func (l LowDiskConfig) validate() error {
+	if l.MinFreeMB < 0 {
+		return fmt.Errorf("log config: low disk min free mb must not be negative, got %d", l.MinFreeMB)
+	}
+	if l.CheckInterval < 0 {
+		return fmt.Errorf("log config: low disk check interval must not be negative, got %s", l.CheckInterval)
+	}
+	return nil
+}
+
+func (l LowDiskConfig) withDefaults() LowDiskConfig {
+	if l.MinFreeMB == 0 {
+		l.MinFreeMB = defaultLowDiskMinFreeMB
+	}
+	if l.CheckInterval == 0 {
+		l.CheckInterval = defaultLowDiskCheckInterval
+	}
+	return l
+}
+
+// diskFree 返回dir所在磁盘对当前用户可用的字节数，测试时可以替换
+var diskFree = statDiskFree
+
+// lowDiskVolumes 当前处于空间不足状态的日志目录个数
+var lowDiskVolumes int32
+
+// LogVolumeLow 返回是否有日志目录所在的磁盘空间不足，此时相应logger的级别被提高到了Warn
+func LogVolumeLow() bool {
+	return atomic.LoadInt32(&lowDiskVolumes) > 0
+}
+
+// lowDiskMonitor 定期检查一个日志目录的剩余空间
+type lowDiskMonitor struct {
+	cfg    LowDiskConfig
+	dir    string
+	level  zap.AtomicLevel
+	logger *zap.Logger
+	clock  Clock
+
+	low   bool          // 只在检查的goroutine中访问
+	saved zapcore.Level // 降级前的级别
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// startLowDiskMonitor 先检查一次，之后每隔CheckInterval在后台检查dir的剩余空间
+func startLowDiskMonitor(logger *zap.Logger, level zap.AtomicLevel, dir string, cfg LowDiskConfig, clock Clock) *lowDiskMonitor {
+	m := &lowDiskMonitor{
+		cfg:    cfg.withDefaults(),
+		dir:    dir,
+		level:  level,
+		logger: logger,
+		clock:  clock,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	m.check()
+	go m.run()
+	return m
+}
+
+func (m *lowDiskMonitor) run() {
+	defer close(m.done)
+	for {
+		fire, stopTimer := clockTimer(m.clock, m.cfg.CheckInterval)
+		select {
+		case <-m.stop:
+			stopTimer()
+			return
+		case <-fire:
+		}
+		m.check()
+	}
+}
+
+// check 按剩余空间降级或恢复，读取失败时保持当前状态
+func (m *lowDiskMonitor) check() {
+	free, err := diskFree(m.dir)
+	if err != nil {
+		return
+	}
+	minFree := uint64(m.cfg.MinFreeMB) * bytesPerMB
+	switch {
+	case !m.low && free < minFree:
+		m.low = true
+		atomic.AddInt32(&lowDiskVolumes, 1)
+		m.saved = m.level.Level()
+		if m.saved < zapcore.WarnLevel {
+			m.level.SetLevel(zapcore.WarnLevel)
+		}
+		m.logger.Error("log volume low",
+			zap.String("dir", m.dir),
+			zap.Uint64("free_bytes", free),
+			zap.Int("min_free_mb", m.cfg.MinFreeMB),
+			zap.Stringer("level", m.level.Level()))
+	case m.low && free >= minFree+minFree/5:
+		m.low = false
+		atomic.AddInt32(&lowDiskVolumes, -1)
+		if m.saved < zapcore.WarnLevel && m.level.Level() == zapcore.WarnLevel {
+			m.level.SetLevel(m.saved)
+		}
+		m.logger.Warn("log volume recovered",
+			zap.String("dir", m.dir),
+			zap.Uint64("free_bytes", free),
+			zap.Stringer("level", m.level.Level()))
+	}
+}
+
+// close 停止检查，仍处于空间不足状态时从LogVolumeLow中去掉，可以对nil调用，可以重复调用
+func (m *lowDiskMonitor) close() {
+	if m == nil {
+		return
+	}
+	m.closeOnce.Do(func() {
+		close(m.stop)
+		<-m.done
+		if m.low {
+			atomic.AddInt32(&lowDiskVolumes, -1)
+		}
+	})
+}
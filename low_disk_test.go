@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// fakeDiskFree 替换diskFree，返回的函数设置之后检查读到的剩余空间（MB）
+func fakeDiskFree(t *testing.T, mb uint64) func(mb uint64) {
+	t.Helper()
+	var free uint64
+	atomic.StoreUint64(&free, mb*bytesPerMB)
+	old := diskFree
+	diskFree = func(string) (uint64, error) { return atomic.LoadUint64(&free), nil }
+	t.Cleanup(func() { diskFree = old })
+	return func(mb uint64) { atomic.StoreUint64(&free, mb*bytesPerMB) }
+}
+
+// newLowDiskLogger 构建配置了LowDisk的logger，级别为debug，每分钟检查一次
+func newLowDiskLogger(t *testing.T, clock *ManualClock) (*builtLogger, LogConfig) {
+	t.Helper()
+	b, cfg := newClockedFileLogger(t, clock, func(cfg *LogConfig) {
+		cfg.Level = "debug"
+		cfg.LowDisk = &LowDiskConfig{MinFreeMB: 100, CheckInterval: time.Minute}
+	})
+	waitForScheduler(t, clock)
+	return b, cfg
+}
+
+// tick 让检查的goroutine检查一次，并等它重新开始等待
+func tick(t *testing.T, clock *ManualClock) {
+	t.Helper()
+	clock.Add(time.Minute)
+	waitForScheduler(t, clock)
+}
+
+func TestLowDiskRaisesLevelAndRecovers(t *testing.T) {
+	setFree := fakeDiskFree(t, 1024)
+	clock := NewManualClock(fixedTime)
+	b, cfg := newLowDiskLogger(t, clock)
+	b.logger.Debug("debug while ok")
+
+	setFree(50)
+	tick(t, clock)
+	if !LogVolumeLow() || !Stats().VolumeLow || b.level.Level() != zapcore.WarnLevel {
+		t.Fatalf("LogVolumeLow() = %v, level = %v after free space fell below the threshold", LogVolumeLow(), b.level.Level())
+	}
+	b.logger.Info("info while low")
+	b.logger.Warn("warn while low")
+	tick(t, clock) // 仍然不足时不再重复记录
+
+	// 回到阈值以上但还不到1.2倍时不恢复
+	setFree(110)
+	tick(t, clock)
+	if !LogVolumeLow() {
+		t.Fatal("should stay degraded until free space is 20% above the threshold")
+	}
+	setFree(130)
+	tick(t, clock)
+	if LogVolumeLow() || Stats().VolumeLow || b.level.Level() != zapcore.DebugLevel {
+		t.Fatalf("LogVolumeLow() = %v, level = %v after recovery", LogVolumeLow(), b.level.Level())
+	}
+	b.logger.Debug("debug after recovery")
+
+	out := readFile(t, cfg.Filename)
+	for _, want := range []string{"debug while ok", "warn while low", "debug after recovery"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log file is missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "info while low") {
+		t.Errorf("info entries should be dropped while the volume is low:\n%s", out)
+	}
+	if n := strings.Count(out, `"msg":"log volume low"`); n != 1 || !strings.Contains(out, `{"level":"ERROR","ts":"2024-05-17T10:01:00.000Z"`) {
+		t.Errorf(`"log volume low" logged %d times, want a single error:\n%s`, n, out)
+	}
+	if n := strings.Count(out, `"msg":"log volume recovered"`); n != 1 {
+		t.Errorf(`"log volume recovered" logged %d times:\n%s`, n, out)
+	}
+}
+
+func TestLowDiskKeepsLevelChangedWhileLow(t *testing.T) {
+	setFree := fakeDiskFree(t, 50)
+	clock := NewManualClock(fixedTime)
+	b, _ := newLowDiskLogger(t, clock)
+	if !LogVolumeLow() {
+		t.Fatal("the first check runs at startup")
+	}
+	// 降级期间级别被改成了Error，恢复时不再改回Debug
+	b.level.SetLevel(zapcore.ErrorLevel)
+	setFree(1024)
+	tick(t, clock)
+	if LogVolumeLow() || b.level.Level() != zapcore.ErrorLevel {
+		t.Errorf("LogVolumeLow() = %v, level = %v, want the level set while low kept", LogVolumeLow(), b.level.Level())
+	}
+}
+
+func TestLowDiskCloseClearsState(t *testing.T) {
+	fakeDiskFree(t, 50)
+	clock := NewManualClock(fixedTime)
+	b, _ := newLowDiskLogger(t, clock)
+	if !LogVolumeLow() {
+		t.Fatal("volume should be low")
+	}
+	b.close()
+	if LogVolumeLow() {
+		t.Error("closing the logger should drop its volume from LogVolumeLow")
+	}
+}
+
+func TestStatDiskFree(t *testing.T) {
+	free, err := statDiskFree(tempDir(t))
+	if err != nil || free == 0 {
+		t.Errorf("statDiskFree() = %d, %v", free, err)
+	}
+}
+
+func TestLowDiskConfigValidate(t *testing.T) {
+	if err := (LowDiskConfig{MinFreeMB: -1}).validate(); err == nil {
+		t.Error("negative MinFreeMB should be rejected")
+	}
+	if err := (LowDiskConfig{CheckInterval: -time.Second}).validate(); err == nil {
+		t.Error("negative CheckInterval should be rejected")
+	}
+	if got := (LowDiskConfig{}).withDefaults(); got.MinFreeMB != defaultLowDiskMinFreeMB || got.CheckInterval != defaultLowDiskCheckInterval {
+		t.Errorf("withDefaults() = %+v", got)
+	}
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
 	"runtime/debug"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/natefinch/lumberjack"
@@ -27,14 +32,22 @@ Logger
 var logger *zap.Logger
 
 func mainDemo1() {
-	InitLogger1()
+	if err := InitLogger1(); err != nil {
+		exitOnInitError(err)
+	}
 	defer logger.Sync()
 	simpleHttpGet1("www.sogou.com")
 	simpleHttpGet1("http://www.sogou.com")
 }
 
-func InitLogger1() {
-	logger, _ = zap.NewProduction()
+func InitLogger1() error {
+	// 相当于zap.NewProduction()：JSON格式、Info级别、输出到console
+	b, err := newLogger(WithConsole(), WithJSON(), WithLevel(zapcore.InfoLevel))
+	if err != nil {
+		return err
+	}
+	setGlobalLogger(b)
+	return nil
 }
 
 func simpleHttpGet1(url string) {
@@ -65,16 +78,22 @@ Sugared Logger
 var sugarLogger *zap.SugaredLogger
 
 func mainDemo2() {
-	InitLogger2()
+	if err := InitLogger2(); err != nil {
+		exitOnInitError(err)
+	}
 	defer sugarLogger.Sync()
 	simpleHttpGet2("www.google.com")
 	simpleHttpGet2("http://www.google.com")
 }
 
-func InitLogger2() {
+func InitLogger2() error {
 	//logger, _ := zap.NewProduction()//外部mian未使用logger，使用的是sugarLogger，所以可全局可局部logger变量
-	logger, _ = zap.NewProduction()
-	sugarLogger = logger.Sugar()
+	b, err := newLogger(WithConsole(), WithJSON(), WithLevel(zapcore.InfoLevel))
+	if err != nil {
+		return err
+	}
+	setGlobalLogger(b) // 同时设置logger和sugarLogger
+	return nil
 }
 func simpleHttpGet2(url string) {
 	sugarLogger.Debugf("Trying to hit GET request for %s", url)
@@ -92,8 +111,10 @@ func simpleHttpGet2(url string) {
 使用Lumberjack进行日志切割归档
 */
 func mainDemo3() {
-	InitLogger3()
-	defer sugarLogger.Sync()
+	if _, err := InitLogger3(); err != nil {
+		exitOnInitError(err)
+	}
+	defer Close()
 
 	for i := 0; i < 10000; i++ {
 		sugarLogger.Info("test log")
@@ -102,10 +123,215 @@ func mainDemo3() {
 	simpleHttpGet2("http://www.sogou.com")
 }
 
-func InitLogger3() {
-	writeSyncer := getLogWriter()
-	encoder := getEncoder()
-	core := zapcore.NewCore(encoder, writeSyncer, zapcore.DebugLevel)
+// InitLogger3 用默认配置初始化全局logger，返回的restore撤销对zap.L()/zap.S()和标准库log的替换
+func InitLogger3() (restore func(), err error) {
+	_, restore, err = InitLoggerWithConfig(defaultLogConfig())
+	return restore, err
+}
+
+// buildLogger 根据loggerOptions构建logger，InitLogger3的具体实现挪到了这里。
+// 同时输出到文件和console时使用zapcore.NewTee组合两个core，此时console总是使用普通(console) Encoder。
+// 级别使用zap.AtomicLevel，运行时可以通过SetLevel修改而不用重建core。
+//
+// 并发：返回的logger可以被任意多个goroutine同时使用，每条日志在每个输出中都是完整的一行，不会与其他日志交错。
+// 每个core的WriteSyncer都自己保证这一点：日志文件由fileWriteSyncer的锁串行化（外面的重试和缓冲
+// 各有自己的锁，异步写入只有一个goroutine写文件），console、stderr和内部错误输出使用zapcore.Lock，
+// syslog、网络、Loki、Elasticsearch和journald的输出各自加锁或者经过异步队列。不同输出之间的先后顺序不保证一致
+func buildLogger(o *loggerOptions) (*builtLogger, error) {
+	cfg := o.cfg
+	l, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	level := zap.NewAtomicLevelAt(l)
+	encoder, err := getEncoder(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// plainEncoder 写文件时console和stderr上使用的普通(console) Encoder，级别总是输出为单词
+	plainCfg := cfg
+	plainCfg.Encoding = EncodingConsole
+	plainCfg.LevelEncoding = ""
+	plainEncoder, err := getEncoder(plainCfg)
+	if err != nil {
+		return nil, err
+	}
+	// jsonEncoder Elasticsearch总是使用JSON Encoder
+	jsonCfg := cfg
+	jsonCfg.Mode = ""
+	jsonCfg.Encoding = EncodingJSON
+	jsonEncoder, err := getEncoder(jsonCfg)
+	if err != nil {
+		return nil, err
+	}
+	consoleEncoder := encoder.Clone()
+	if o.file {
+		consoleEncoder = plainEncoder.Clone()
+	}
+	if o.colorConsole() {
+		if consoleEncoder, err = newColorEncoder(cfg); err != nil {
+			return nil, err
+		}
+	}
+	zapOpts := []zap.Option{
+		zap.WithCaller(!cfg.DisableCaller),
+		zap.AddCallerSkip(o.callerSkip),
+		zap.Fields(serviceFields(cfg)...),
+		zap.WithClock(zapClock{o.clock}),
+	}
+	if len(o.hooks) > 0 {
+		zapOpts = append(zapOpts, zap.Hooks(o.hooks...))
+	}
+	if stackLevel, ok, err := parseStacktraceLevel(cfg.StacktraceLevel); err != nil {
+		return nil, err
+	} else if ok {
+		zapOpts = append(zapOpts, zap.AddStacktrace(stackLevel))
+	}
+
+	// zap内部错误的输出，先于日志文件打开，出错时不会留下打开的日志文件
+	var errorFile *os.File
+	errorOut := o.errorOut
+	if errorOut == nil {
+		f, err := openErrorOutput(cfg.ErrorOutput, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if f != os.Stderr {
+			errorFile = f
+		}
+		errorOut = f
+	}
+	internalErrorOutput := zapcore.Lock(countingErrorOutput{errorOut})
+	zapOpts = append(zapOpts, zap.ErrorOutput(internalErrorOutput))
+
+	// syslog也先于日志文件连接
+	var syslogCore zapcore.Core
+	var syslogConn io.Closer
+	if cfg.Syslog != nil {
+		if syslogCore, syslogConn, err = newSyslogCore(*cfg.Syslog, encoder.Clone(), level, o.clock); err != nil {
+			if errorFile != nil {
+				errorFile.Close()
+			}
+			return nil, err
+		}
+	}
+	// 网络输出启动时连不上不算错误，先缓存日志，之后按退避时间重连
+	var network *networkWriteSyncer
+	if cfg.Network != nil {
+		network = newNetworkWriteSyncer(*cfg.Network, o.clock)
+	}
+	// Sink为journald时代替日志文件，socket不存在时退回写文件，没有日志文件时输出到console
+	var journaldCore zapcore.Core
+	var journaldConn io.Closer
+	if cfg.Sink == SinkJournald {
+		journaldCore, journaldConn, err = newJournaldCore(cfg, level)
+		if err != nil && err != errJournaldUnavailable {
+			if errorFile != nil {
+				errorFile.Close()
+			}
+			if syslogConn != nil {
+				syslogConn.Close()
+			}
+			if network != nil {
+				network.Close()
+			}
+			return nil, err
+		}
+	}
+	journaldFallback := cfg.Sink == SinkJournald && journaldCore == nil
+
+	var cores []zapcore.Core
+	var files []*fileWriteSyncer
+	if journaldCore != nil {
+		cores = append(cores, journaldCore)
+	} else if o.file {
+		if cores, files, err = newFileCores(cfg, encoder, level, o.clock); err != nil {
+			if errorFile != nil {
+				errorFile.Close()
+			}
+			if syslogConn != nil {
+				syslogConn.Close()
+			}
+			if network != nil {
+				network.Close()
+			}
+			return nil, err
+		}
+	}
+	for _, f := range files {
+		f.setErrorOutput(internalErrorOutput)
+	}
+	var primarySink io.Closer
+	if o.primarySink != nil {
+		fallback := o.stderrOut
+		if len(files) > 0 {
+			fallback = files[0].writeSyncer()
+		}
+		core, err := o.primarySink(fallback)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			if errorFile != nil {
+				errorFile.Close()
+			}
+			if syslogConn != nil {
+				syslogConn.Close()
+			}
+			if network != nil {
+				network.Close()
+			}
+			if journaldConn != nil {
+				journaldConn.Close()
+			}
+			return nil, err
+		}
+		cores = []zapcore.Core{core}
+		primarySink, _ = core.(io.Closer)
+	}
+	var failovers []*failoverCore
+	if cfg.Failover != nil && len(files) > 0 && o.primarySink == nil {
+		cores, failovers = newFailoverCores(cores, plainEncoder, o.stderrOut, *cfg.Failover, o.clock)
+	}
+	if syslogCore != nil {
+		cores = append(cores, syslogCore)
+	}
+	var networkQueue *IsolatedMultiSyncer
+	if network != nil {
+		// 网络输出放进自己的队列，连接卡住时不影响写文件
+		networkQueue = NewIsolatedMultiSyncer(AsyncConfig{}, network)
+		cores = append(cores, zapcore.NewCore(encoder.Clone(), networkQueue, level))
+	}
+	var loki io.Closer
+	if cfg.Loki != nil {
+		var lokiCore zapcore.Core
+		lokiCore, loki = newLokiCore(cfg, encoder.Clone(), level)
+		cores = append(cores, lokiCore)
+	}
+	var elasticsearch io.Closer
+	if cfg.Elasticsearch != nil {
+		var esCore zapcore.Core
+		esCore, elasticsearch = newESCore(*cfg.Elasticsearch, jsonEncoder, level)
+		cores = append(cores, esCore)
+	}
+	if o.console || journaldFallback && len(files) == 0 {
+		cores = append(cores, zapcore.NewCore(consoleEncoder, zapcore.Lock(o.consoleOut), level))
+	}
+	if cfg.StderrMirror {
+		cores = append(cores, newStderrCore(plainEncoder, o.stderrOut, level, cfg.StderrKeepStack))
+	}
+	for i := range cores {
+		cores[i] = newSortFieldsCore(newTruncateCore(cores[i], cfg.MaxFieldBytes), cfg.SortFields)
+	}
+	core := zapcore.NewTee(cores...)
+	if cfg.Sampling != nil {
+		core = newSamplingCore(core, *cfg.Sampling, o.samplingHook)
+	}
+	zapOpts = append(zapOpts, zap.WithFatalHook(&fatalHook{
+		core:      core,
+		callbacks: o.fatalCallbacks,
+		panic:     o.fatalPanic,
+	}))
 
 	//logger := zap.New(core)
 	/*
@@ -113,11 +339,95 @@ func InitLogger3() {
 	*/
 
 	//logger := zap.New(core, zap.AddCaller())//外部main函数要使用全局logger，注意不能使用局部logger
-	logger = zap.New(core, zap.AddCaller())
-	sugarLogger = logger.Sugar()
+	lg := zap.New(core, zapOpts...)
+	if journaldFallback {
+		lg.Warn("journald is not available, fall back to file", zap.String("socket", journaldSocketPath))
+	}
+	if len(files) > 0 {
+		lg.Info("logging to file", zap.String("path", cfg.Filename)) // 记录一次展开后的实际路径
+	}
+	b := &builtLogger{
+		logger: lg,
+		level:  level,
+		stdLog: !cfg.DisableStdLog,
+		ecs:    cfg.ECS,
+		gelf:   cfg.Encoding == EncodingGELF,
+		files:  files,
+
+		errorOutput:   errorFile,
+		failovers:     failovers,
+		syslog:        syslogConn,
+		network:       network,
+		networkQueue:  networkQueue,
+		primarySink:   primarySink,
+		loki:          loki,
+		elasticsearch: elasticsearch,
+		journald:      journaldConn,
+	}
+	if len(files) > 0 {
+		b.file = files[0]
+	}
+	if cfg.Async != nil && len(files) > 0 {
+		var writers []*asyncWriteSyncer
+		for _, f := range files {
+			writers = append(writers, f.async)
+		}
+		b.asyncReporter = startAsyncDropReporter(lg, writers, cfg.Async.withDefaults().ReportInterval)
+	}
+	if cfg.Expvar {
+		publishStats()
+	}
+	if cfg.LowDisk != nil && len(files) > 0 {
+		b.lowDisk = startLowDiskMonitor(lg, level, filepath.Dir(cfg.Filename), *cfg.LowDisk, o.clock)
+	}
+	return b, nil
+}
+
+// getEncoderConfig 返回getEncoder使用的EncoderConfig，开发模式使用development的配置
+func getEncoderConfig(cfg LogConfig) (zapcore.EncoderConfig, error) {
+	loc, err := loadTimeZone(cfg.TimeZone)
+	if err != nil {
+		return zapcore.EncoderConfig{}, err
+	}
+	if err := validateTimeLayout(cfg.TimeLayout); err != nil {
+		return zapcore.EncoderConfig{}, err
+	}
+	var encoderConfig zapcore.EncoderConfig
+	if cfg.Mode == ModeDevelopment {
+		encoderConfig = zap.NewDevelopmentEncoderConfig()
+	} else {
+		encoderConfig = zap.NewProductionEncoderConfig()
+		encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	}
+	timeEncoder, err := newTimeEncoder(cfg.TimeEncoding, cfg.TimeLayout, encoderConfig.EncodeTime)
+	if err != nil {
+		return zapcore.EncoderConfig{}, err
+	}
+	encoderConfig.EncodeTime = timeEncoderIn(loc, timeEncoder)
+	if encoderConfig.EncodeDuration, err = newDurationEncoder(cfg.DurationEncoding, encoderConfig.EncodeDuration); err != nil {
+		return zapcore.EncoderConfig{}, err
+	}
+	if encoderConfig.EncodeCaller, err = newCallerEncoder(cfg.CallerEncoding, encoderConfig.EncodeCaller); err != nil {
+		return zapcore.EncoderConfig{}, err
+	}
+	if cfg.LogFunction {
+		encoderConfig.FunctionKey = functionKey
+	}
+	if cfg.ECS {
+		applyECSKeys(&encoderConfig)
+	}
+	if encoderConfig.EncodeLevel, err = newLevelEncoder(cfg.LevelEncoding, encoderConfig.EncodeLevel); err != nil {
+		return zapcore.EncoderConfig{}, err
+	}
+	if encoderConfig.LineEnding, err = newLineEnding(cfg.LineEnding); err != nil {
+		return zapcore.EncoderConfig{}, err
+	}
+	applyKeyNames(&encoderConfig, cfg)
+	return encoderConfig, nil
 }
 
-func getEncoder() zapcore.Encoder {
+func getEncoder(cfg LogConfig) (zapcore.Encoder, error) {
 	//return zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
 	/*
 		将编码器从JSON Encoder更改为普通Encoder。为此，我们需要将NewJSONEncoder()更改为NewConsoleEncoder()。
@@ -125,10 +435,30 @@ func getEncoder() zapcore.Encoder {
 		修改时间编码器
 		在日志文件中使用大写字母记录日志级别
 	*/
-	encoderConfig := zap.NewProductionEncoderConfig()
-	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
-	return zapcore.NewConsoleEncoder(encoderConfig)
+	encoderConfig, err := getEncoderConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	encoding := cfg.Encoding
+	if cfg.Mode == ModeDevelopment {
+		encoding = EncodingConsole
+	}
+	var encoder zapcore.Encoder
+	switch encoding {
+	case EncodingJSON:
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	case EncodingLogfmt:
+		encoder = newLogfmtEncoder(encoderConfig)
+	case EncodingGELF:
+		encoder = newGELFEncoder(encoderConfig)
+	case EncodingJSONPretty:
+		encoder = newPrettyJSONEncoder(encoderConfig)
+	case "", EncodingConsole:
+		encoder = withMultilineStack(zapcore.NewConsoleEncoder(encoderConfig), encoderConfig, cfg.MultilineStack)
+	default:
+		return nil, validateEncoding(cfg.Encoding)
+	}
+	return wrapEncoder(encoder, cfg), nil
 }
 
 /*
@@ -139,28 +469,89 @@ func getLogWriter() zapcore.WriteSyncer {
 实际输出日志文件要进行切割，防止日志文件过大，改造如下
 要在zap中加入Lumberjack支持，我们需要修改WriteSyncer代码。我们将按照下面的代码修改getLogWriter()函数：
 */
-func getLogWriter() zapcore.WriteSyncer {
+func getLogWriter(cfg LogConfig) *lumberjack.Logger {
+	useGzip := cfg.compression() == CompressionGzip && !cfg.processBackups() // 其他情况在切割后由我们自己压缩，见backup_hook.go
 	lumberJackLogger := &lumberjack.Logger{
-		Filename:   "./test.log", //日志文件的位置
-		MaxSize:    1,            //在进行切割之前，日志文件的最大大小（以MB为单位）
-		MaxBackups: 5,            //保留旧文件的最大个数
-		MaxAge:     30,           //保留旧文件的最大天数
-		Compress:   false,        //是否压缩/归档旧文件
+		Filename:   cfg.Filename,            //日志文件的位置
+		MaxSize:    cfg.lumberjackMaxSize(), //在进行切割之前，日志文件的最大大小（以MB为单位），MaxSizeBytes向上取整
+		MaxBackups: cfg.MaxBackups,          //保留旧文件的最大个数
+		MaxAge:     cfg.MaxAge,              //保留旧文件的最大天数
+		Compress:   useGzip,                 //是否压缩/归档旧文件
+		LocalTime:  cfg.BackupLocalTime,     //备份文件名中的时间戳使用本地时间
+	}
+	return lumberJackLogger
+}
+
+// prepareLogFile 提前创建日志目录并尝试创建/打开日志文件，
+// 否则lumberjack直到第一次写入才会报错，而且错误会被zap吞掉，日志悄悄丢失
+func prepareLogFile(cfg LogConfig) error {
+	dir := filepath.Dir(cfg.Filename)
+	if err := os.MkdirAll(dir, cfg.dirMode()); err != nil {
+		return fmt.Errorf("create log dir %s: %v", dir, err)
+	}
+	f, err := os.OpenFile(cfg.Filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, cfg.fileMode())
+	if err != nil {
+		return fmt.Errorf("log file %s is not writable: %v", cfg.Filename, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
 	}
-	return zapcore.AddSync(lumberJackLogger)
+	return enforceFileMode(cfg.Filename, cfg.FileMode)
+}
+
+// enforceFileMode 把日志文件的权限改为mode（mode为0时不处理）。
+// OpenFile创建文件时会受umask影响，已存在的文件也不会被改权限，所以这里显式chmod。
+// lumberjack切割时新文件沿用旧文件的权限，备份文件就是改名后的旧文件，因此权限会一直保持。
+// Windows上文件权限没有意义，什么都不做
+func enforceFileMode(filename string, mode os.FileMode) error {
+	if mode == 0 || runtime.GOOS == "windows" {
+		return nil
+	}
+	if err := os.Chmod(filename, mode); err != nil {
+		return fmt.Errorf("chmod log file %s: %v", filename, err)
+	}
+	return nil
+}
+
+// exitOnInitError 日志初始化失败时没有logger可用，只能输出到stderr并以非0状态退出
+func exitOnInitError(err error) {
+	fmt.Fprintf(os.Stderr, "init logger failed: %v\n", err)
+	os.Exit(1)
 }
 
 //==================================================
 //使用zap接收gin框架默认的日志并配置日志归档
-func mainDemo4() {
-	InitLogger3()
+// mainDemo4 初始化失败时返回错误，已经打开的日志由defer关闭，main再退出
+func mainDemo4(adminToken string) error {
+	if _, err := InitLogger3(); err != nil {
+		return err
+	}
+	// 本地开发不想生成test.log时，可以把Filename置空，只输出到console：
+	//cfg := defaultLogConfig()
+	//cfg.Filename = ""
+	//InitLoggerWithConfig(cfg)
+	defer Close()
+	// 访问日志比应用日志多得多，通过LoggerManager单独写到access.log，按自己的大小切割；
+	// GinRecovery和业务代码仍然写test.log
+	m, err := NewLoggerManager([]LogConfig{defaultAccessLogConfig()})
+	if err != nil {
+		return err
+	}
+	defer m.CloseAll()
+	UseGinWriter(logger) // gin自己的路由注册等输出也写到日志文件
 	//r := gin.Default()//不使用默认default中的logger
 	r := gin.New()
-	r.Use(GinLogger(logger), GinRecovery(logger, true))
+	r.Use(GinLogger(m.Get(accessLogName).Named(ginAccessLoggerName)), GinRecovery(logger, true))
 	r.GET("/hello", func(c *gin.Context) {
 		c.String(http.StatusOK, "hello!")
 	})
-	r.Run()
+	if adminToken != "" {
+		r.POST("/admin/log/rotate", RotateHandler(adminToken))
+	}
+	if err := r.Run(); err != nil {
+		logger.Error("gin server stopped", zap.Error(err))
+	}
+	return nil
 }
 
 /*
@@ -168,30 +559,183 @@ func mainDemo4() {
 我们可以模仿Logger()和Recovery()的实现，使用我们的日志库来接收gin框架默认输出的日志。
 这里以zap为例，我们实现两个中间件如下：
 */
-// GinLogger 接收gin框架默认的日志
+// ginAccessLoggerName GinLogger默认使用的子logger名，用来区分访问日志和应用日志
+const ginAccessLoggerName = "gin.access"
+
+// accessLogName 单独的访问日志在LoggerManager中的名字
+const accessLogName = "access"
+
+// defaultAccessLogConfig 单独写访问日志的配置：写到./access.log，
+// 访问日志量大，单个文件更大、保留的备份更多；调用位置都在GinLogger里，不记录caller
+func defaultAccessLogConfig() LogConfig {
+	cfg := defaultLogConfig()
+	cfg.Name = accessLogName
+	cfg.Filename = "./access.log"
+	cfg.MaxSize = 100
+	cfg.MaxBackups = 10
+	cfg.Level = "info"
+	cfg.DisableCaller = true
+	return cfg
+}
+
+// GinLogger 接收gin框架默认的日志，logger建议使用GetLogger(ginAccessLoggerName)。
+// 全局logger开启了ECS时按ECS的字段名输出，使用gelf时字段放到http下
 func GinLogger(logger *zap.Logger) gin.HandlerFunc {
+	return GinLoggerWithClock(logger, defaultClock)
+}
+
+// GinLoggerWithClock 同GinLogger，使用clock计算请求耗时
+func GinLoggerWithClock(logger *zap.Logger, clock Clock) gin.HandlerFunc {
+	conf := globalGinLoggerConfig()
+	conf.Clock = clock
+	// 全局配置中没有跳过规则，不会出错
+	return MustGinLoggerWithConfig(logger, conf)
+}
+
+// GinLoggerConfig GinLoggerWithConfig的配置，零值与GinLogger相同
+type GinLoggerConfig struct {
+	Clock Clock // 计算请求耗时使用的时钟，为nil时使用系统时间
+	// HTTPNamespace 把status、method、path等字段放到http对象下，避免与业务字段重名；
+	// 为false时保持原来平铺在顶层的输出
+	HTTPNamespace bool
+	// ECS 按ECS的字段名嵌套输出（http.request.method、url.path等），开启时忽略HTTPNamespace
+	ECS bool
+	// SkipPaths 路径完全相同的请求不记录访问日志，如/healthz、/metrics；请求本身照常处理
+	SkipPaths []string
+	// SkipPrefixes 路径以其中之一开头的请求不记录访问日志，如/static/
+	SkipPrefixes []string
+	// SkipRegexps 路径匹配其中之一的请求不记录访问日志，如^/static/.*\.(css|js|png)$；
+	// 在创建中间件时编译，不合法时GinLoggerWithConfig返回错误
+	SkipRegexps []string
+	// NeverSkipErrors 为true时，即使路径匹配SkipPaths、SkipPrefixes或SkipRegexps，返回5xx或者c.Errors不为空的请求也照常记录；
+	// 为false时只按路径决定，出错的/healthz也不记录
+	NeverSkipErrors bool
+}
+
+// httpNamespace HTTPNamespace开启时请求字段所在的对象名
+const httpNamespace = "http"
+
+// ginSkipper 按GinLoggerConfig中的路径规则判断是否跳过访问日志
+type ginSkipper struct {
+	paths    map[string]bool
+	prefixes []string
+	regexps  []*regexp.Regexp // 创建时编译好，请求时不再编译
+}
+
+// newGinSkipper 按conf创建并编译SkipRegexps，没有配置跳过规则时返回nil
+func newGinSkipper(conf GinLoggerConfig) (*ginSkipper, error) {
+	if len(conf.SkipPaths) == 0 && len(conf.SkipPrefixes) == 0 && len(conf.SkipRegexps) == 0 {
+		return nil, nil
+	}
+	s := &ginSkipper{paths: make(map[string]bool, len(conf.SkipPaths))}
+	for _, p := range conf.SkipPaths {
+		s.paths[p] = true
+	}
+	s.prefixes = append(s.prefixes, conf.SkipPrefixes...)
+	for _, expr := range conf.SkipRegexps {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("gin logger: invalid skip regexp %q: %v", expr, err)
+		}
+		s.regexps = append(s.regexps, re)
+	}
+	return s, nil
+}
+
+// skip 判断path是否匹配跳过规则，可以对nil调用
+func (s *ginSkipper) skip(path string) bool {
+	if s == nil {
+		return false
+	}
+	if s.paths[path] {
+		return true
+	}
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	for _, re := range s.regexps {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// MustGinLoggerWithConfig 同GinLoggerWithConfig，SkipRegexps不合法时panic。
+// 用于规则写死在代码里、出错只能是程序bug的场合，规则来自配置文件时应使用GinLoggerWithConfig处理错误
+func MustGinLoggerWithConfig(logger *zap.Logger, conf GinLoggerConfig) gin.HandlerFunc {
+	h, err := GinLoggerWithConfig(logger, conf)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// GinLoggerWithConfig 同GinLogger，按conf定制输出。SkipRegexps在这里编译，不合法时返回错误
+func GinLoggerWithConfig(logger *zap.Logger, conf GinLoggerConfig) (gin.HandlerFunc, error) {
+	clock := conf.Clock
+	if clock == nil {
+		clock = defaultClock
+	}
+	skipper, err := newGinSkipper(conf)
+	if err != nil {
+		return nil, err
+	}
 	return func(c *gin.Context) {
-		start := time.Now()
+		start := clock.Now()
 		path := c.Request.URL.Path
 		query := c.Request.URL.RawQuery
 		c.Next()
 
-		cost := time.Since(start)
-		logger.Info(path,
-			zap.Int("status", c.Writer.Status()),
-			zap.String("method", c.Request.Method),
-			zap.String("path", path),
-			zap.String("query", query),
-			zap.String("ip", c.ClientIP()),
-			zap.String("user-agent", c.Request.UserAgent()),
-			zap.String("errors", c.Errors.ByType(gin.ErrorTypePrivate).String()),
-			zap.Duration("cost", cost),
-		)
-	}
+		// 只按请求的路径决定，不看处理后的状态码，除非配置了NeverSkipErrors
+		if skipper.skip(path) && !(conf.NeverSkipErrors && (c.Writer.Status() >= 500 || len(c.Errors) > 0)) {
+			return
+		}
+		cost := clock.Now().Sub(start)
+		var fields []zap.Field
+		if conf.ECS {
+			fields = ecsAccessFields(c.Writer.Status(), c.Request.Method, path, query, c.ClientIP(), c.Request.UserAgent(), cost)
+		} else {
+			fields = make([]zap.Field, 0, 9)
+			if conf.HTTPNamespace {
+				fields = append(fields, zap.Namespace(httpNamespace))
+			}
+			fields = append(fields,
+				zap.Int("status", c.Writer.Status()),
+				zap.String("method", c.Request.Method),
+				zap.String("path", path),
+				zap.String("query", query),
+				zap.String("ip", c.ClientIP()),
+				zap.String("user-agent", c.Request.UserAgent()),
+				zap.Duration("cost", cost),
+			)
+		}
+		// ECS和普通输出都用GinErrorsField记录错误，保留类型和Meta
+		if len(c.Errors) > 0 {
+			fields = append(fields, GinErrorsField(c.Errors))
+		}
+		logger.Info(path, fields...)
+	}, nil
 }
 
 // GinRecovery recover掉项目可能出现的panic，并使用zap记录相关日志
 func GinRecovery(logger *zap.Logger, stack bool) gin.HandlerFunc {
+	return GinRecoveryWithConfig(logger, GinRecoveryConfig{Stack: stack})
+}
+
+// GinRecoveryConfig GinRecoveryWithConfig的配置
+type GinRecoveryConfig struct {
+	Stack bool // 记录panic时的堆栈
+	// StructuredRequest 用RequestField把请求记录为对象，而不是httputil.DumpRequest的字符串
+	StructuredRequest bool
+	// SkipHeaders StructuredRequest时不记录的header，为nil时使用默认的Authorization、Cookie等
+	SkipHeaders []string
+}
+
+// GinRecoveryWithConfig 同GinRecovery，按conf定制记录的内容
+func GinRecoveryWithConfig(logger *zap.Logger, conf GinRecoveryConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
@@ -206,11 +750,20 @@ func GinRecovery(logger *zap.Logger, stack bool) gin.HandlerFunc {
 					}
 				}
 
-				httpRequest, _ := httputil.DumpRequest(c.Request, false)
+				var request zap.Field
+				switch {
+				case !conf.StructuredRequest:
+					httpRequest, _ := httputil.DumpRequest(c.Request, false)
+					request = zap.String(requestFieldKey, string(httpRequest))
+				case conf.SkipHeaders != nil:
+					request = RequestFieldSkipping(c.Request, conf.SkipHeaders...)
+				default:
+					request = RequestField(c.Request)
+				}
 				if brokenPipe {
 					logger.Error(c.Request.URL.Path,
 						zap.Any("error", err),
-						zap.String("request", string(httpRequest)),
+						request,
 					)
 					// If the connection is dead, we can't write a status to it.
 					c.Error(err.(error)) // nolint: errcheck
@@ -218,18 +771,19 @@ func GinRecovery(logger *zap.Logger, stack bool) gin.HandlerFunc {
 					return
 				}
 
-				if stack {
+				if conf.Stack {
 					logger.Error("[Recovery from panic]",
 						zap.Any("error", err),
-						zap.String("request", string(httpRequest)),
+						request,
 						zap.String("stack", string(debug.Stack())),
 					)
 				} else {
 					logger.Error("[Recovery from panic]",
 						zap.Any("error", err),
-						zap.String("request", string(httpRequest)),
+						request,
 					)
 				}
+				_ = logger.Sync() // 开启缓冲写入时立即落盘，panic之后进程可能很快就退出了
 				c.AbortWithStatus(http.StatusInternalServerError)
 			}
 		}()
@@ -238,8 +792,21 @@ func GinRecovery(logger *zap.Logger, stack bool) gin.HandlerFunc {
 }
 
 func main() {
+	validateLogConfig := flag.String("validate-log-config", "", "只检查该日志配置文件并退出，不启动服务")
+	adminToken := flag.String("log-admin-token", "", "非空时注册POST /admin/log/rotate，请求需要带Authorization: Bearer <token>")
+	RegisterFlags(flag.CommandLine) // -log-level、-log-file、-log-max-size，InitLogger3等初始化时生效
+	flag.Parse()
+	if *validateLogConfig != "" {
+		if !validateConfigFile(*validateLogConfig, os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	//mainDemo1()
 	//mainDemo2()
 	//mainDemo3()
-	mainDemo4()
+	if err := mainDemo4(*adminToken); err != nil {
+		exitOnInitError(err)
+	}
 }
@@ -0,0 +1,553 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serveGin 用handlers处理一个请求，路由注册为target去掉query后的路径，返回200
+func serveGin(method, target string, handlers ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Use(handlers...)
+	r.Handle(method, strings.SplitN(target, "?", 2)[0], func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestGinLoggerWithoutCaller(t *testing.T) {
+	l, logs := newObservedLogger(t, WithCaller(false))
+	serveGin(http.MethodGet, "/users?id=1", MustGinLoggerWithConfig(l, GinLoggerConfig{}))
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.Caller.Defined {
+		t.Errorf("caller should be disabled, got %v", e.Caller)
+	}
+	fields := e.ContextMap()
+	if fields["status"] != int64(http.StatusOK) || fields["path"] != "/users" || fields["method"] != http.MethodGet || fields["query"] != "id=1" {
+		t.Errorf("request fields = %v", fields)
+	}
+}
+
+func TestGinLoggerExactCost(t *testing.T) {
+	clock := NewManualClock(fixedTime)
+	l, logs := newObservedLogger(t, WithClock(clock))
+	r := gin.New()
+	r.Use(MustGinLoggerWithConfig(l, GinLoggerConfig{Clock: clock}))
+	r.GET("/slow", func(c *gin.Context) {
+		clock.Add(1500 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if cost := entries[0].ContextMap()["cost"]; cost != 1500*time.Millisecond {
+		t.Errorf("cost = %v, want 1.5s", cost)
+	}
+	if !entries[0].Time.Equal(fixedTime.Add(1500 * time.Millisecond)) {
+		t.Errorf("entry time = %v, want the manual clock time", entries[0].Time)
+	}
+}
+
+func TestGinLoggerWithClockJSON(t *testing.T) {
+	clock := NewManualClock(fixedTime)
+	out := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingJSON
+	cfg.TimeZone = "utc"
+	cfg.DisableCaller = true
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(MustGinLoggerWithConfig(l, GinLoggerConfig{Clock: clock}))
+	r.GET("/users", func(c *gin.Context) {
+		clock.Add(25 * time.Millisecond)
+		c.Status(http.StatusNoContent)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/users?page=2", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("User-Agent", "test-agent")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	want := `{"level":"INFO","ts":"2024-05-17T10:00:00.025Z","msg":"/users","status":204,"method":"GET",` +
+		`"path":"/users","query":"page=2","ip":"10.0.0.1","user-agent":"test-agent","cost":0.025}`
+	if got := strings.TrimSpace(out.String()); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+// decodeJSONLines 把每行JSON日志解析为map
+func decodeJSONLines(t *testing.T, lines []string) []map[string]interface{} {
+	t.Helper()
+	entries := make([]map[string]interface{}, 0, len(lines))
+	for _, line := range lines {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+		entries = append(entries, m)
+	}
+	return entries
+}
+
+func TestLogFunction(t *testing.T) {
+	out := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingJSON
+	cfg.LogFunction = true
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("direct")
+	r := gin.New()
+	r.Use(MustGinLoggerWithConfig(l, GinLoggerConfig{}), GinRecovery(l, false))
+	r.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+	for _, target := range []string{"/ok", "/panic"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	entries := decodeJSONLines(t, out.Lines())
+	if len(entries) != 4 {
+		t.Fatalf("got %d entries, want 4:\n%s", len(entries), out.String())
+	}
+	// 依次为直接调用、/ok的访问日志、panic日志、/panic的访问日志
+	wantFuncs := []string{".TestLogFunction", ".GinLoggerWithConfig.func", ".GinRecoveryWithConfig.func", ".GinLoggerWithConfig.func"}
+	for i, e := range entries {
+		fn, _ := e[functionKey].(string)
+		if fn == "" {
+			t.Errorf("entry %d has no %s field: %v", i, functionKey, e)
+			continue
+		}
+		if !strings.Contains(fn, wantFuncs[i]) {
+			t.Errorf("entry %d: %s = %q, want containing %q", i, functionKey, fn, wantFuncs[i])
+		}
+		if e["caller"] == nil {
+			t.Errorf("entry %d: func should be logged alongside caller: %v", i, e)
+		}
+	}
+}
+
+func TestLogFunctionDisabledByDefault(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Encoding = EncodingJSON
+	if line := encodeLine(t, cfg); strings.Contains(line, `"`+functionKey+`"`) {
+		t.Errorf("func should be opt-in: %s", line)
+	}
+}
+
+func TestLogFunctionEncodings(t *testing.T) {
+	for _, encoding := range []string{EncodingConsole, EncodingLogfmt} {
+		t.Run(encoding, func(t *testing.T) {
+			cfg := defaultLogConfig()
+			cfg.Encoding = encoding
+			cfg.LogFunction = true
+			if line := encodeLine(t, cfg); !strings.Contains(line, ".encodeLine") {
+				t.Errorf("function name missing: %s", line)
+			}
+		})
+	}
+}
+
+// ginAccessLine 用cfg构建logger，GinLogger按conf处理GET /users?page=2后返回输出的那一行
+func ginAccessLine(t *testing.T, cfg LogConfig, conf GinLoggerConfig) string {
+	t.Helper()
+	clock := NewManualClock(fixedTime)
+	out := &zaptest.Buffer{}
+	cfg.Filename = ""
+	cfg.TimeZone = "utc"
+	cfg.DisableCaller = true
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Clock = clock
+	r := gin.New()
+	r.Use(MustGinLoggerWithConfig(l, conf))
+	r.GET("/users", func(c *gin.Context) {
+		clock.Add(25 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/users?page=2", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("User-Agent", "test-agent")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	lines := out.Lines()
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1:\n%s", len(lines), out.String())
+	}
+	return lines[0]
+}
+
+func TestGinLoggerHTTPNamespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		encoding  string
+		namespace bool
+		want      string
+	}{
+		{
+			name:     "flat json",
+			encoding: EncodingJSON,
+			want: `{"level":"INFO","ts":"2024-05-17T10:00:00.025Z","msg":"/users","status":200,"method":"GET",` +
+				`"path":"/users","query":"page=2","ip":"10.0.0.1","user-agent":"test-agent","cost":0.025}`,
+		},
+		{
+			name:      "nested json",
+			encoding:  EncodingJSON,
+			namespace: true,
+			want: `{"level":"INFO","ts":"2024-05-17T10:00:00.025Z","msg":"/users","http":{"status":200,"method":"GET",` +
+				`"path":"/users","query":"page=2","ip":"10.0.0.1","user-agent":"test-agent","cost":0.025}}`,
+		},
+		{
+			name:     "flat console",
+			encoding: EncodingConsole,
+			want: "2024-05-17T10:00:00.025Z\tINFO\t/users\t{\"status\": 200, \"method\": \"GET\", \"path\": \"/users\", " +
+				"\"query\": \"page=2\", \"ip\": \"10.0.0.1\", \"user-agent\": \"test-agent\", \"cost\": 0.025}",
+		},
+		{
+			name:      "nested console",
+			encoding:  EncodingConsole,
+			namespace: true,
+			want: "2024-05-17T10:00:00.025Z\tINFO\t/users\t{\"http\": {\"status\": 200, \"method\": \"GET\", \"path\": \"/users\", " +
+				"\"query\": \"page=2\", \"ip\": \"10.0.0.1\", \"user-agent\": \"test-agent\", \"cost\": 0.025}}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultLogConfig()
+			cfg.Encoding = tt.encoding
+			if got := ginAccessLine(t, cfg, GinLoggerConfig{HTTPNamespace: tt.namespace}); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGinLoggerHTTPNamespaceAvoidsCollision(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Encoding = EncodingJSON
+	line := ginAccessLine(t, cfg, GinLoggerConfig{HTTPNamespace: true})
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"status", "method", "path", "query", "ip", "user-agent", "cost"} {
+		if _, ok := m[key]; ok {
+			t.Errorf("%s should not be at the top level: %s", key, line)
+		}
+	}
+	if h, ok := m[httpNamespace].(map[string]interface{}); !ok || h["status"] != float64(http.StatusOK) {
+		t.Errorf("http object = %v", m[httpNamespace])
+	}
+}
+
+// 多个goroutine同时写日志时每条日志都是完整的一行：用-race运行，并把每一行解析回JSON
+func TestConcurrentLoggingStress(t *testing.T) {
+	goroutines, entries := 100, 1000
+	if testing.Short() {
+		goroutines, entries = 10, 100
+	}
+	tests := []struct {
+		name   string
+		modify func(cfg *LogConfig)
+	}{
+		{name: "file", modify: func(*LogConfig) {}},
+		{name: "retry and buffer", modify: func(cfg *LogConfig) {
+			cfg.Retry = &RetryConfig{}
+			cfg.BufferSize = 4096
+		}},
+		{name: "async", modify: func(cfg *LogConfig) {
+			cfg.Async = &AsyncConfig{QueueSize: goroutines * entries}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultLogConfig()
+			cfg.Filename = tempLogFile(t)
+			cfg.Encoding = EncodingJSON
+			cfg.MaxSize = 100 // 不切割，所有日志都在一个文件里
+			tt.modify(&cfg)
+			b, err := newLogger(WithConfig(cfg))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					l := b.logger.With(zap.Int("g", g))
+					for i := 0; i < entries; i++ {
+						l.Info("stress", zap.Int("i", i), zap.String("pad", strings.Repeat("x", i%64)))
+					}
+				}(g)
+			}
+			wg.Wait()
+			if err := b.close(); err != nil {
+				t.Fatal(err)
+			}
+
+			lines := readLines(t, cfg.Filename)[1:] // 第一行是"logging to file"
+			if len(lines) != goroutines*entries {
+				t.Fatalf("got %d lines, want %d", len(lines), goroutines*entries)
+			}
+			seen := make(map[string]bool, len(lines))
+			for _, line := range lines {
+				var entry struct {
+					Msg string `json:"msg"`
+					G   *int   `json:"g"`
+					I   *int   `json:"i"`
+				}
+				if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.Msg != "stress" || entry.G == nil || entry.I == nil {
+					t.Fatalf("garbled line %q: %v", line, err)
+				}
+				key := fmt.Sprint(*entry.G, "/", *entry.I)
+				if seen[key] {
+					t.Fatalf("duplicate entry %s", key)
+				}
+				seen[key] = true
+			}
+		})
+	}
+}
+
+// serveGinPaths 经过logger中间件依次请求paths，返回实际处理了的路径。
+// 路径中含有fail的请求返回500，含有warn的请求返回200但往c.Errors里加一个错误
+func serveGinPaths(logger gin.HandlerFunc, paths ...string) []string {
+	var handled []string
+	r := gin.New()
+	r.Use(logger)
+	r.NoRoute(func(c *gin.Context) {
+		handled = append(handled, c.Request.URL.Path)
+		switch {
+		case strings.Contains(c.Request.URL.Path, "fail"):
+			c.String(http.StatusInternalServerError, "fail")
+		case strings.Contains(c.Request.URL.Path, "warn"):
+			c.Error(fmt.Errorf("slow dependency"))
+			c.String(http.StatusOK, "ok")
+		default:
+			c.String(http.StatusOK, "ok")
+		}
+	})
+	for _, path := range paths {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	return handled
+}
+
+// loggedPaths 返回访问日志记录的路径
+func loggedPaths(logs *observer.ObservedLogs) []string {
+	var paths []string
+	for _, e := range logs.TakeAll() {
+		paths = append(paths, e.Message)
+	}
+	return paths
+}
+
+func TestGinLoggerSkip(t *testing.T) {
+	paths := []string{"/healthz", "/healthz/deep", "/healthzx", "/metrics", "/static/app.js", "/static", "/users"}
+	tests := []struct {
+		name string
+		conf GinLoggerConfig
+		want []string
+	}{
+		{"none", GinLoggerConfig{}, paths},
+		{
+			name: "exact",
+			conf: GinLoggerConfig{SkipPaths: []string{"/healthz", "/metrics"}},
+			want: []string{"/healthz/deep", "/healthzx", "/static/app.js", "/static", "/users"},
+		},
+		{
+			name: "prefix",
+			conf: GinLoggerConfig{SkipPrefixes: []string{"/static/", "/healthz"}},
+			want: []string{"/metrics", "/static", "/users"},
+		},
+		{
+			name: "exact and prefix",
+			conf: GinLoggerConfig{SkipPaths: []string{"/metrics", "/static"}, SkipPrefixes: []string{"/static/"}},
+			want: []string{"/healthz", "/healthz/deep", "/healthzx", "/users"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, logs := newObservedLogger(t)
+			handled := serveGinPaths(MustGinLoggerWithConfig(l, tt.conf), paths...)
+			if !reflect.DeepEqual(handled, paths) {
+				t.Errorf("handled %v, skipped requests must still be served", handled)
+			}
+			if got := loggedPaths(logs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("logged %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGinLoggerSkipErrors(t *testing.T) {
+	conf := GinLoggerConfig{SkipPaths: []string{"/healthz/fail", "/healthz/warn", "/healthz"}}
+	paths := []string{"/healthz", "/healthz/fail", "/healthz/warn", "/users/fail"}
+
+	// 只按路径决定：出错的/healthz也不记录
+	l, logs := newObservedLogger(t)
+	serveGinPaths(MustGinLoggerWithConfig(l, conf), paths...)
+	if got := loggedPaths(logs); !reflect.DeepEqual(got, []string{"/users/fail"}) {
+		t.Errorf("logged %v, skipping should not look at the status", got)
+	}
+
+	// NeverSkipErrors：5xx和c.Errors不为空的请求照常记录
+	conf.NeverSkipErrors = true
+	serveGinPaths(MustGinLoggerWithConfig(l, conf), paths...)
+	want := []string{"/healthz/fail", "/healthz/warn", "/users/fail"}
+	if got := loggedPaths(logs); !reflect.DeepEqual(got, want) {
+		t.Errorf("logged %v with NeverSkipErrors, want %v", got, want)
+	}
+}
+
+func TestGinLoggerSkipRegexps(t *testing.T) {
+	paths := []string{"/static/app.js", "/static/app.css", "/static/logo.png", "/static/index.html", "/static", "/assets/a.js", "/healthz", "/users"}
+	tests := []struct {
+		name string
+		conf GinLoggerConfig
+		want []string
+	}{
+		{
+			name: "regexp",
+			conf: GinLoggerConfig{SkipRegexps: []string{`^/static/.*\.(css|js|png)$`}},
+			want: []string{"/static/index.html", "/static", "/assets/a.js", "/healthz", "/users"},
+		},
+		{
+			// 前缀与正则重叠：匹配任意一条规则就跳过
+			name: "overlapping prefix",
+			conf: GinLoggerConfig{SkipPrefixes: []string{"/static/"}, SkipRegexps: []string{`\.js$`}},
+			want: []string{"/static", "/healthz", "/users"},
+		},
+		{
+			name: "overlapping path",
+			conf: GinLoggerConfig{SkipPaths: []string{"/healthz", "/static/app.js"}, SkipRegexps: []string{`^/(healthz|static/app\.js)$`, `^/assets/`}},
+			want: []string{"/static/app.css", "/static/logo.png", "/static/index.html", "/static", "/users"},
+		},
+		{
+			// 正则不加^、$时匹配路径的任意部分
+			name: "unanchored",
+			conf: GinLoggerConfig{SkipRegexps: []string{`static`}},
+			want: []string{"/assets/a.js", "/healthz", "/users"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, logs := newObservedLogger(t)
+			h, err := GinLoggerWithConfig(l, tt.conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if handled := serveGinPaths(h, paths...); !reflect.DeepEqual(handled, paths) {
+				t.Errorf("handled %v, skipped requests must still be served", handled)
+			}
+			if got := loggedPaths(logs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("logged %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGinLoggerInvalidSkipRegexp(t *testing.T) {
+	l, _ := newObservedLogger(t)
+	for _, expr := range []string{`^/static/(.*\.js$`, `*.png`, `[a-`} {
+		conf := GinLoggerConfig{SkipPrefixes: []string{"/static/"}, SkipRegexps: []string{`^/ok$`, expr}}
+		h, err := GinLoggerWithConfig(l, conf)
+		if err == nil || h != nil {
+			t.Errorf("GinLoggerWithConfig(%q) = %v, want an error when the middleware is created", expr, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), fmt.Sprintf("invalid skip regexp %q", expr)) {
+			t.Errorf("error = %v, want the pattern in the message", err)
+		}
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("MustGinLoggerWithConfig(%q) should panic", expr)
+				}
+			}()
+			MustGinLoggerWithConfig(l, conf)
+		}()
+	}
+}
+
+func TestNewGinSkipperNoRules(t *testing.T) {
+	s, err := newGinSkipper(GinLoggerConfig{})
+	if s != nil || err != nil {
+		t.Errorf("newGinSkipper() = %v, %v, want nil without rules", s, err)
+	}
+	if s.skip("/healthz") {
+		t.Error("nil skipper should not skip")
+	}
+}
+
+// BenchmarkGinLoggerSkip 被正则跳过的请求：正则在创建中间件时编译，请求时不应再分配内存编译
+func BenchmarkGinLoggerSkip(b *testing.B) {
+	h, err := GinLoggerWithConfig(zap.NewNop(), GinLoggerConfig{
+		SkipPaths:    []string{"/healthz", "/metrics"},
+		SkipPrefixes: []string{"/debug/"},
+		SkipRegexps:  []string{`^/static/.*\.(css|js|png)$`, `^/assets/`},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(h)
+	r.GET("/static/*file", func(c *gin.Context) { c.Status(http.StatusOK) })
+	req := httptest.NewRequest(http.MethodGet, "/static/js/app.js", nil)
+	w := httptest.NewRecorder()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(w, req)
+	}
+}
+
+// BenchmarkGinSkipperSkip 只测量匹配规则本身
+func BenchmarkGinSkipperSkip(b *testing.B) {
+	s, err := newGinSkipper(GinLoggerConfig{
+		SkipPaths:    []string{"/healthz", "/metrics"},
+		SkipPrefixes: []string{"/debug/"},
+		SkipRegexps:  []string{`^/static/.*\.(css|js|png)$`, `^/assets/`},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if !s.skip("/static/js/app.js") {
+			b.Fatal("path should be skipped")
+		}
+	}
+}
@@ -0,0 +1,103 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// withUmask 在fn执行期间使用umask mask
+func withUmask(mask int, fn func()) {
+	old := syscall.Umask(mask)
+	defer syscall.Umask(old)
+	fn()
+}
+
+func TestPrepareLogFileCreatesDirs(t *testing.T) {
+	tests := []struct {
+		name     string
+		dirMode  os.FileMode
+		fileMode os.FileMode
+		wantDir  os.FileMode
+		wantFile os.FileMode
+	}{
+		{name: "default", wantDir: 0755, wantFile: 0644},
+		{name: "explicit", dirMode: 0750, fileMode: 0640, wantDir: 0750, wantFile: 0640},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultLogConfig()
+			cfg.Filename = filepath.Join(tempDir(t), "logs", "nested", "app.log")
+			cfg.DirMode = tt.dirMode
+			cfg.FileMode = tt.fileMode
+			var err error
+			withUmask(0022, func() { err = prepareLogFile(cfg) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, dir := range []string{filepath.Dir(cfg.Filename), filepath.Dir(filepath.Dir(cfg.Filename))} {
+				info, err := os.Stat(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := info.Mode().Perm(); got != tt.wantDir {
+					t.Errorf("%s mode = %o, want %o", dir, got, tt.wantDir)
+				}
+			}
+			info, err := os.Stat(cfg.Filename)
+			if err != nil {
+				t.Fatalf("log file should be created: %v", err)
+			}
+			if got := info.Mode().Perm(); got != tt.wantFile {
+				t.Errorf("log file mode = %o, want %o", got, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestPrepareLogFileDirError(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Filename = filepath.Join(writeTempFile(t, "file", ""), "logs", "app.log")
+	err := prepareLogFile(cfg)
+	if err == nil || !strings.Contains(err.Error(), "create log dir") {
+		t.Fatalf("error = %v, want create log dir error", err)
+	}
+}
+
+func TestFileModeActiveAndBackup(t *testing.T) {
+	dir := tempDir(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = filepath.Join(dir, "test.log")
+	cfg.FileMode = 0600
+	// 已存在的文件也要改成FileMode
+	if err := ioutil.WriteFile(cfg.Filename, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := newLogger(WithConfig(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.close()
+	b.logger.Info("before rotate")
+	_, backup, err := b.file.rotateAndFindBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.logger.Info("after rotate")
+
+	for _, path := range []string{cfg.Filename, backup} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != 0600 {
+			t.Errorf("%s mode = %o, want 600", filepath.Base(path), got)
+		}
+	}
+}
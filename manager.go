@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+/*
+=============================================================
+LoggerManager
+一个服务里经常需要几个相互独立的logger，比如应用日志、访问日志、审计日志，各自写到自己的切割文件。
+LoggerManager根据一组LogConfig（用Name区分）创建这些logger，统一获取和关闭：
+
+	m, err := NewLoggerManager([]LogConfig{appCfg, accessCfg})
+	r.Use(GinLogger(m.Get("access")), GinRecovery(m.Get("app"), true))
+	defer m.CloseAll()
+*/
+
+// LoggerManager 管理多个相互独立的logger，可并发使用
+type LoggerManager struct {
+	mu      sync.RWMutex
+	loggers map[string]*builtLogger
+}
+
+// NewLoggerManager 为每个配置创建一个logger，配置的Name不能为空且不能重复。
+// 任意一个创建失败时，已创建的logger会被关闭
+func NewLoggerManager(cfgs []LogConfig) (*LoggerManager, error) {
+	m := &LoggerManager{loggers: make(map[string]*builtLogger, len(cfgs))}
+	for _, cfg := range cfgs {
+		if err := m.add(cfg); err != nil {
+			_ = m.CloseAll()
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *LoggerManager) add(cfg LogConfig) error {
+	if cfg.Name == "" {
+		return errors.New("logger manager: config name must not be empty")
+	}
+	if _, ok := m.loggers[cfg.Name]; ok {
+		return fmt.Errorf("logger manager: duplicate logger name %q", cfg.Name)
+	}
+	b, err := newLogger(WithConfig(cfg))
+	if err != nil {
+		return fmt.Errorf("logger manager: create logger %q: %v", cfg.Name, err)
+	}
+	m.loggers[cfg.Name] = b
+	return nil
+}
+
+// Get 返回名为name的logger，不存在时panic：名字写错属于编程错误，返回nil会推迟到第一次写日志时才崩溃
+func (m *LoggerManager) Get(name string) *zap.Logger {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.loggers[name]
+	if !ok {
+		panic(fmt.Sprintf("logger manager: unknown logger %q", name))
+	}
+	return b.logger
+}
+
+// Rotate 立即切割名为name的logger的日志文件，可以与写日志并发调用
+func (m *LoggerManager) Rotate(name string) error {
+	m.mu.RLock()
+	b, ok := m.loggers[name]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("logger manager: unknown logger %q", name)
+	}
+	return b.rotate()
+}
+
+// RotateAll 切割所有logger的日志文件，返回所有切割失败的错误
+func (m *LoggerManager) RotateAll() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var err error
+	for _, b := range m.loggers {
+		err = multierr.Append(err, b.rotate())
+	}
+	return err
+}
+
+// CloseAll Sync并关闭所有logger的日志文件，返回所有关闭失败的错误
+func (m *LoggerManager) CloseAll() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var err error
+	for _, b := range m.loggers {
+		_ = b.logger.Sync()
+		err = multierr.Append(err, b.close())
+	}
+	return err
+}
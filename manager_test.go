@@ -0,0 +1,202 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// managerConfigs 返回写到dir下name.log的一组配置
+func managerConfigs(dir string, names ...string) []LogConfig {
+	cfgs := make([]LogConfig, len(names))
+	for i, name := range names {
+		cfgs[i] = defaultLogConfig()
+		cfgs[i].Name = name
+		cfgs[i].Filename = filepath.Join(dir, name+".log")
+		cfgs[i].Encoding = EncodingJSON
+	}
+	return cfgs
+}
+
+func TestLoggerManager(t *testing.T) {
+	dir := tempDir(t)
+	m, err := NewLoggerManager(managerConfigs(dir, "app", "access", "audit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.Get("app").Info("app line")
+	m.Get("audit").Info("audit line")
+	func() {
+		defer func() {
+			if r := recover(); r != `logger manager: unknown logger "missing"` {
+				t.Errorf("recover() = %v, Get should panic for an unknown name", r)
+			}
+		}()
+		m.Get("missing")
+	}()
+
+	r := gin.New()
+	r.Use(MustGinLoggerWithConfig(m.Get("access"), GinLoggerConfig{}), GinRecovery(m.Get("app"), false))
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+	r.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	for _, path := range []string{"/ok", "/panic"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if err := m.CloseAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	app := readFile(t, filepath.Join(dir, "app.log"))
+	access := readFile(t, filepath.Join(dir, "access.log"))
+	audit := readFile(t, filepath.Join(dir, "audit.log"))
+	if !strings.Contains(app, "app line") || !strings.Contains(app, "[Recovery from panic]") || strings.Contains(app, `"path":"/ok"`) {
+		t.Errorf("app.log:\n%s", app)
+	}
+	if !strings.Contains(access, `"path":"/ok"`) || !strings.Contains(access, `"path":"/panic"`) ||
+		strings.Contains(access, "app line") || strings.Contains(access, "Recovery") {
+		t.Errorf("access.log:\n%s", access)
+	}
+	if !strings.Contains(audit, "audit line") || strings.Contains(audit, "app line") {
+		t.Errorf("audit.log:\n%s", audit)
+	}
+}
+
+func TestLoggerManagerConcurrentGet(t *testing.T) {
+	m, err := NewLoggerManager(managerConfigs(tempDir(t), "app", "access"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.CloseAll()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := []string{"app", "access"}[i%2]
+			for j := 0; j < 100; j++ {
+				m.Get(name).Info("concurrent")
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestNewLoggerManagerErrors(t *testing.T) {
+	dir := tempDir(t)
+	unnamed := managerConfigs(dir, "")
+	duplicate := managerConfigs(dir, "app", "app")
+	invalid := managerConfigs(dir, "app", "access")
+	invalid[1].MaxSize = 0
+
+	tests := []struct {
+		name    string
+		cfgs    []LogConfig
+		wantErr string
+	}{
+		{name: "empty name", cfgs: unnamed, wantErr: "config name must not be empty"},
+		{name: "duplicate name", cfgs: duplicate, wantErr: `duplicate logger name "app"`},
+		{name: "invalid config", cfgs: invalid, wantErr: `create logger "access"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewLoggerManager(tt.cfgs)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+			if m != nil {
+				t.Error("manager should be nil on error")
+			}
+		})
+	}
+}
+
+func TestLoggerManagerRotate(t *testing.T) {
+	dir := tempDir(t)
+	cfgs := managerConfigs(dir, "app", "access")
+	m, err := NewLoggerManager(cfgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.CloseAll()
+
+	m.Get("app").Info("app before")
+	m.Get("access").Info("access before")
+	if err := m.Rotate("access"); err != nil {
+		t.Fatal(err)
+	}
+	if got := logBackups(t, cfgs[1]); len(got) != 1 {
+		t.Errorf("access backups = %v, want 1", got)
+	}
+	if got := logBackups(t, cfgs[0]); len(got) != 0 {
+		t.Errorf("rotating access should not touch app, got %v", got)
+	}
+	if active := readFile(t, cfgs[1].Filename); active != "" {
+		t.Errorf("access.log should be empty after rotation:\n%s", active)
+	}
+	if err := m.Rotate("missing"); err == nil || !strings.Contains(err.Error(), `unknown logger "missing"`) {
+		t.Errorf("error = %v, want unknown logger", err)
+	}
+}
+
+// 与mainDemo4相同的两个文件：访问日志经LoggerManager写到access.log，GinRecovery和业务代码写全局logger的app.log
+func TestSeparateAccessLog(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	dir := tempDir(t)
+	appCfg := defaultLogConfig()
+	appCfg.Filename = filepath.Join(dir, "app.log")
+	appCfg.Encoding = EncodingJSON
+	app, _, err := InitLoggerWithConfig(appCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessCfg := defaultAccessLogConfig()
+	accessCfg.Filename = filepath.Join(dir, "access.log")
+	accessCfg.Encoding = EncodingJSON
+	m, err := NewLoggerManager([]LogConfig{accessCfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(GinLogger(m.Get(accessLogName).Named(ginAccessLoggerName)), GinRecovery(app, false))
+	r.GET("/hello", func(c *gin.Context) {
+		GetLogger("handler").Info("handling hello")
+		c.String(http.StatusOK, "hello!")
+	})
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+	for _, path := range []string{"/hello", "/panic", "/hello"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if err := m.CloseAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	access := readLines(t, accessCfg.Filename)[1:] // 第一行是"logging to file"
+	if len(access) != 3 {
+		t.Fatalf("access.log has %d lines, want one per request:\n%s", len(access), strings.Join(access, "\n"))
+	}
+	for i, want := range []string{`"path":"/hello"`, `"path":"/panic"`, `"path":"/hello"`} {
+		if !strings.Contains(access[i], want) || !strings.Contains(access[i], `"logger":"gin.access"`) || strings.Contains(access[i], `"caller"`) {
+			t.Errorf("access line %d = %s", i, access[i])
+		}
+	}
+	appLog := readFile(t, appCfg.Filename)
+	if !strings.Contains(appLog, "[Recovery from panic]") || !strings.Contains(appLog, "handling hello") ||
+		strings.Contains(appLog, `"path":"/hello"`) || strings.Contains(appLog, "gin.access") {
+		t.Errorf("app.log:\n%s", appLog)
+	}
+	if strings.Contains(readFile(t, accessCfg.Filename), "Recovery") {
+		t.Error("panics must not be written to access.log")
+	}
+}
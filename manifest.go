@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/*
+=============================================================
+备份的完整性清单
+合规要求能发现归档日志被篡改。配置Manifest后，每次切割出的备份（配置了压缩时是压缩后的文件）
+在后台计算SHA-256，并在日志目录下的manifest.jsonl追加一行：
+	{"file":"test-2024-05-17T10-00-00.000.log.gz","sha256":"...","bytes":1234,"rotated_at":"2024-05-17T10:00:00Z"}
+VerifyManifest重新计算清单中每个文件的SHA-256，返回内容或大小对不上、以及已经不存在的文件。
+注意MaxBackups、MaxAge等清理掉的备份以及上传后删除的备份也会报告为missing，需要调用方按需过滤。
+*/
+
+// manifestName 日志目录下的清单文件名
+const manifestName = "manifest.jsonl"
+
+// Mismatch.Reason的取值
+const (
+	MismatchMissing = "missing" // 文件不存在
+	MismatchBytes   = "bytes"   // 大小不一致
+	MismatchSHA256  = "sha256"  // 大小一致但内容不一致
+)
+
+// ManifestEntry manifest.jsonl中的一行
+type ManifestEntry struct {
+	File      string    `json:"file"` // 备份的文件名，相对于清单所在的目录
+	SHA256    string    `json:"sha256"`
+	Bytes     int64     `json:"bytes"`
+	RotatedAt time.Time `json:"rotated_at"`
+}
+
+// Mismatch 清单中一个与实际文件对不上的备份
+type Mismatch struct {
+	File   string // 备份的路径
+	Reason string // MismatchMissing、MismatchBytes或MismatchSHA256
+	Want   string // 清单中记录的大小或SHA-256
+	Got    string // 实际的大小或SHA-256，文件不存在时为空
+}
+
+// manifestMu 同一进程中的多个日志文件可能在同一个目录，追加清单时串行化
+var manifestMu sync.Mutex
+
+// hashFile 返回文件的SHA-256和字节数
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// appendManifest 计算备份的SHA-256并追加到同目录下的manifest.jsonl
+func appendManifest(path string, rotatedAt time.Time, mode os.FileMode) error {
+	sum, n, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(ManifestEntry{File: filepath.Base(path), SHA256: sum, Bytes: n, RotatedAt: rotatedAt})
+	if err != nil {
+		return err
+	}
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+	f, err := os.OpenFile(filepath.Join(filepath.Dir(path), manifestName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	// 一行一次写入，O_APPEND保证不会与其他进程的追加交错
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// VerifyManifest 检查dir/manifest.jsonl中列出的所有备份，返回对不上的文件；
+// 清单不存在或有无法解析的行时返回error
+func VerifyManifest(dir string) ([]Mismatch, error) {
+	f, err := os.Open(filepath.Join(dir, manifestName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var mismatches []Mismatch
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e ManifestEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return mismatches, fmt.Errorf("manifest %s line %d: %v", f.Name(), line, err)
+		}
+		path := filepath.Join(dir, e.File)
+		sum, n, err := hashFile(path)
+		switch {
+		case os.IsNotExist(err):
+			mismatches = append(mismatches, Mismatch{File: path, Reason: MismatchMissing, Want: e.SHA256})
+		case err != nil:
+			return mismatches, err
+		case n != e.Bytes:
+			mismatches = append(mismatches, Mismatch{File: path, Reason: MismatchBytes,
+				Want: fmt.Sprint(e.Bytes), Got: fmt.Sprint(n)})
+		case sum != e.SHA256:
+			mismatches = append(mismatches, Mismatch{File: path, Reason: MismatchSHA256, Want: e.SHA256, Got: sum})
+		}
+	}
+	return mismatches, sc.Err()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rotateWithManifest 写入并切割n次，返回manifest.jsonl中的记录
+func rotateWithManifest(t *testing.T, compression string, n int) ([]ManifestEntry, LogConfig) {
+	t.Helper()
+	clock := NewManualClock(fixedTime)
+	b, cfg := newClockedFileLogger(t, clock, func(cfg *LogConfig) {
+		cfg.Compression = compression
+		cfg.Manifest = true
+	})
+	for i := 0; i < n; i++ {
+		b.logger.Info("before rotate")
+		if err := b.rotate(); err != nil {
+			t.Fatal(err)
+		}
+		b.file.backups.wait()
+		clock.Add(time.Minute)
+		// lumberjack的备份文件名精确到毫秒，同一毫秒内切割两次会覆盖前一个备份
+		time.Sleep(2 * time.Millisecond)
+	}
+	var entries []ManifestEntry
+	for _, line := range readLines(t, filepath.Join(filepath.Dir(cfg.Filename), manifestName)) {
+		var e ManifestEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("manifest line %q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, cfg
+}
+
+func TestManifestHashesFinalArtifact(t *testing.T) {
+	for _, compression := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			entries, cfg := rotateWithManifest(t, compression, 2)
+			backups := logBackups(t, cfg)
+			if len(entries) != 2 || len(backups) != 2 {
+				t.Fatalf("manifest %+v, backups %v", entries, backups)
+			}
+			dir := filepath.Dir(cfg.Filename)
+			for i, e := range entries {
+				if filepath.Join(dir, e.File) != backups[i] {
+					t.Errorf("entry %d file = %s, want %s", i, e.File, filepath.Base(backups[i]))
+				}
+				data, err := ioutil.ReadFile(backups[i])
+				if err != nil {
+					t.Fatal(err)
+				}
+				sum := sha256.Sum256(data)
+				if e.SHA256 != hex.EncodeToString(sum[:]) || e.Bytes != int64(len(data)) {
+					t.Errorf("entry %d = %+v, want the hash of the file on disk", i, e)
+				}
+				if want := fixedTime.Add(time.Duration(i) * time.Minute); !e.RotatedAt.Equal(want) {
+					t.Errorf("entry %d rotated_at = %v, want %v", i, e.RotatedAt, want)
+				}
+			}
+			if mismatches, err := VerifyManifest(dir); err != nil || len(mismatches) != 0 {
+				t.Errorf("VerifyManifest() = %+v, %v on untouched backups", mismatches, err)
+			}
+		})
+	}
+}
+
+func TestVerifyManifestReportsTamperedFile(t *testing.T) {
+	entries, cfg := rotateWithManifest(t, CompressionGzip, 3)
+	dir := filepath.Dir(cfg.Filename)
+	corrupted := filepath.Join(dir, entries[1].File)
+	data, err := ioutil.ReadFile(corrupted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := ioutil.WriteFile(corrupted, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mismatches, err := VerifyManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 1 {
+		t.Fatalf("mismatches = %+v, want exactly the corrupted file", mismatches)
+	}
+	m := mismatches[0]
+	if m.File != corrupted || m.Reason != MismatchSHA256 || m.Want != entries[1].SHA256 || m.Got == m.Want {
+		t.Errorf("mismatch = %+v", m)
+	}
+}
+
+func TestVerifyManifestReasons(t *testing.T) {
+	entries, cfg := rotateWithManifest(t, CompressionNone, 3)
+	dir := filepath.Dir(cfg.Filename)
+	truncated := filepath.Join(dir, entries[0].File)
+	if err := os.Truncate(truncated, 1); err != nil {
+		t.Fatal(err)
+	}
+	removed := filepath.Join(dir, entries[2].File)
+	if err := os.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+
+	mismatches, err := VerifyManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 2 {
+		t.Fatalf("mismatches = %+v", mismatches)
+	}
+	if m := mismatches[0]; m.File != truncated || m.Reason != MismatchBytes || m.Got != "1" {
+		t.Errorf("truncated file: %+v", m)
+	}
+	if m := mismatches[1]; m.File != removed || m.Reason != MismatchMissing || m.Got != "" {
+		t.Errorf("removed file: %+v", m)
+	}
+}
+
+func TestVerifyManifestErrors(t *testing.T) {
+	dir := tempDir(t)
+	if _, err := VerifyManifest(dir); !os.IsNotExist(err) {
+		t.Errorf("VerifyManifest without a manifest = %v, want not exist", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, manifestName), []byte("\n{not json}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyManifest(dir); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("VerifyManifest with a bad line = %v", err)
+	}
+}
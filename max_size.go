@@ -0,0 +1,39 @@
+package main
+
+import "os"
+
+/*
+=============================================================
+小于1MB的切割阈值
+lumberjack的MaxSize以MB为单位，集成测试和嵌入式设备想按64KB切割做不到。
+配置MaxSizeBytes后以它为准（MaxSize被忽略），fileWriteSyncer自己记录文件大小，
+写入前发现会超过MaxSizeBytes就先调用Rotate；传给lumberjack的MaxSize取不小于MaxSizeBytes的整MB，
+保证总是我们先切割。
+*/
+
+const bytesPerMB = 1024 * 1024
+
+// maxSizeBytes 切割前日志文件的最大字节数，MaxSizeBytes大于0时优先于MaxSize
+func (cfg LogConfig) maxSizeBytes() int64 {
+	if cfg.MaxSizeBytes > 0 {
+		return cfg.MaxSizeBytes
+	}
+	return int64(cfg.MaxSize) * bytesPerMB
+}
+
+// lumberjackMaxSize 传给lumberjack的MaxSize（MB），MaxSizeBytes向上取整
+func (cfg LogConfig) lumberjackMaxSize() int {
+	if cfg.MaxSizeBytes > 0 {
+		return int((cfg.MaxSizeBytes + bytesPerMB - 1) / bytesPerMB)
+	}
+	return cfg.MaxSize
+}
+
+// fileSize 返回文件的大小，文件不存在时返回0
+func fileSize(name string) int64 {
+	info, err := os.Stat(name)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestMaxSizeBytesRotation(t *testing.T) {
+	const limit = 10 * 1024
+	clock := NewManualClock(fixedTime)
+	b, cfg := newClockedFileLogger(t, clock, func(cfg *LogConfig) {
+		cfg.MaxSize = 0
+		cfg.MaxSizeBytes = limit
+		cfg.MaxBackups = 0
+		cfg.MaxAge = 0
+	})
+
+	const entries = 500
+	last := fileSize(cfg.Filename)
+	for i := 0; i < entries; i++ {
+		b.logger.Info(fmt.Sprintf("entry %04d", i), zap.String("pad", strings.Repeat("x", 64)))
+		size := fileSize(cfg.Filename)
+		if size < last {
+			// lumberjack的备份文件名精确到毫秒，同一毫秒内切割两次会覆盖前一个备份
+			time.Sleep(2 * time.Millisecond)
+		}
+		last = size
+	}
+
+	backups := logBackups(t, cfg)
+	sort.Strings(backups)
+	files := append(backups, cfg.Filename)
+
+	// 按文件顺序拼起来应该正好是启动日志加上全部日志，并且每个文件都在写入下一行会超过limit时才切割
+	var lines []string
+	var sizes []int
+	for _, path := range files {
+		content := readFile(t, path)
+		if len(content) > limit {
+			t.Errorf("%s is %d bytes, over the %d byte limit", path, len(content), limit)
+		}
+		sizes = append(sizes, len(content))
+		lines = append(lines, readLines(t, path)...)
+	}
+	if len(lines) != entries+1 {
+		t.Fatalf("got %d lines across %d files, want %d", len(lines), len(files), entries+1)
+	}
+	for i, line := range lines[1:] {
+		if !strings.Contains(line, fmt.Sprintf(`"msg":"entry %04d"`, i)) {
+			t.Fatalf("line %d out of order: %s", i+1, line)
+		}
+	}
+	var want []int
+	size := 0
+	for _, line := range lines {
+		n := len(line) + 1
+		if size > 0 && size+n > limit {
+			want = append(want, size)
+			size = 0
+		}
+		size += n
+	}
+	want = append(want, size)
+	if fmt.Sprint(sizes) != fmt.Sprint(want) {
+		t.Errorf("file sizes = %v, want %v", sizes, want)
+	}
+	if len(backups) < 4 {
+		t.Errorf("expected several backups at %d bytes, got %d", limit, len(backups))
+	}
+}
+
+func TestMaxSizeBytesPrecedence(t *testing.T) {
+	tests := []struct {
+		maxSize      int
+		maxSizeBytes int64
+		wantBytes    int64
+		wantMB       int
+	}{
+		{maxSize: 3, wantBytes: 3 * bytesPerMB, wantMB: 3},
+		{maxSize: 3, maxSizeBytes: 10 * 1024, wantBytes: 10 * 1024, wantMB: 1},
+		{maxSize: 0, maxSizeBytes: bytesPerMB + 1, wantBytes: bytesPerMB + 1, wantMB: 2},
+		{maxSize: 1, maxSizeBytes: 2 * bytesPerMB, wantBytes: 2 * bytesPerMB, wantMB: 2},
+	}
+	for _, tt := range tests {
+		cfg := LogConfig{MaxSize: tt.maxSize, MaxSizeBytes: tt.maxSizeBytes}
+		if got := cfg.maxSizeBytes(); got != tt.wantBytes {
+			t.Errorf("MaxSize=%d MaxSizeBytes=%d: maxSizeBytes() = %d, want %d", tt.maxSize, tt.maxSizeBytes, got, tt.wantBytes)
+		}
+		if got := cfg.lumberjackMaxSize(); got != tt.wantMB {
+			t.Errorf("MaxSize=%d MaxSizeBytes=%d: lumberjackMaxSize() = %d, want %d", tt.maxSize, tt.maxSizeBytes, got, tt.wantMB)
+		}
+	}
+}
+
+func TestMaxSizeBytesValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxSize      int
+		maxSizeBytes int64
+		wantErr      string
+	}{
+		{name: "bytes without MaxSize", maxSize: 0, maxSizeBytes: 1024},
+		{name: "negative bytes", maxSize: 1, maxSizeBytes: -1, wantErr: "max size bytes must not be negative, got -1"},
+		{name: "neither set", maxSize: 0, maxSizeBytes: 0, wantErr: "max size must be greater than 0, got 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultLogConfig()
+			cfg.Filename = tempLogFile(t)
+			cfg.MaxSize = tt.maxSize
+			cfg.MaxSizeBytes = tt.maxSizeBytes
+			err := cfg.Validate()
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
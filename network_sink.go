@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+=============================================================
+通过TCP/UDP直接发送日志
+有的环境直接把日志发到Logstash的tcp input。配置Network后，日志用文件的Encoder编码，每条以换行结尾，
+通过TCP或UDP发送到Addr，可以单独使用，也可以与日志文件同时输出。
+启动时连不上或者连接断开后先缓存日志，等ReconnectBackoff（每次失败翻倍，最多30秒）之后在下一次写入时重连；
+缓存超过BufferLimit条时丢弃最早的。TCP只写出一部分时记下已经发出的字节，重连后只补发剩下的部分。重连次数和丢弃的条数见NetworkReconnects和NetworkDropped。
+*/
+
+// 网络输出的默认值
+const (
+	defaultNetworkDialTimeout      = 5 * time.Second
+	defaultNetworkReconnectBackoff = time.Second
+	defaultNetworkBufferLimit      = 1000
+	networkMaxReconnectBackoff     = 30 * time.Second
+)
+
+// NetworkSink 通过TCP/UDP发送日志的配置，为0的项使用默认值
+type NetworkSink struct {
+	Protocol         string        `yaml:"protocol" json:"protocol"`                   // tcp或udp
+	Addr             string        `yaml:"addr" json:"addr"`                           // 如logstash:5000
+	DialTimeout      time.Duration `yaml:"dial_timeout" json:"dial_timeout"`           // 连接和每次写入的超时，默认5秒
+	ReconnectBackoff time.Duration `yaml:"reconnect_backoff" json:"reconnect_backoff"` // 连接失败后等多久再重连，每次翻倍，默认1秒
+	BufferLimit      int           `yaml:"buffer_limit" json:"buffer_limit"`           // 连接断开期间最多缓存的条数，默认1000
+}
+
+func (n NetworkSink) validate() error {
+	switch n.Protocol {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+	default:
+		return fmt.Errorf("log config: unknown network protocol %q, want tcp or udp", n.Protocol)
+	}
+	if n.Addr == "" {
+		return fmt.Errorf("log config: network addr must not be empty")
+	}
+	if n.DialTimeout < 0 {
+		return fmt.Errorf("log config: network dial timeout must not be negative, got %s", n.DialTimeout)
+	}
+	if n.ReconnectBackoff < 0 {
+		return fmt.Errorf("log config: network reconnect backoff must not be negative, got %s", n.ReconnectBackoff)
+	}
+	if n.BufferLimit < 0 {
+		return fmt.Errorf("log config: network buffer limit must not be negative, got %d", n.BufferLimit)
+	}
+	return nil
+}
+
+func (n NetworkSink) withDefaults() NetworkSink {
+	if n.DialTimeout == 0 {
+		n.DialTimeout = defaultNetworkDialTimeout
+	}
+	if n.ReconnectBackoff == 0 {
+		n.ReconnectBackoff = defaultNetworkReconnectBackoff
+	}
+	if n.BufferLimit == 0 {
+		n.BufferLimit = defaultNetworkBufferLimit
+	}
+	return n
+}
+
+// networkReconnects 重新连接成功的次数，networkDropped 缓存满时丢弃的条数
+var networkReconnects, networkDropped uint64
+
+// NetworkReconnects 返回到目前为止网络输出重新连接成功的次数
+func NetworkReconnects() uint64 {
+	return atomic.LoadUint64(&networkReconnects)
+}
+
+// NetworkDropped 返回到目前为止网络输出因为连接断开、缓存已满而丢弃的日志条数
+func NetworkDropped() uint64 {
+	return atomic.LoadUint64(&networkDropped)
+}
+
+// networkWriteSyncer 把日志写到TCP/UDP连接，断开时缓存并在之后的写入中重连
+type networkWriteSyncer struct {
+	cfg   NetworkSink
+	clock Clock
+
+	mu       sync.Mutex
+	conn     net.Conn // 为nil表示连接已断开
+	pending  [][]byte // 还没发出去的日志
+	sent     int      // pending[0]中已经发出去的字节数
+	backoff  time.Duration
+	nextDial time.Time // 早于这个时间不重连
+	closed   bool
+}
+
+// newNetworkWriteSyncer 连接cfg.Addr，连接失败时以断开的状态开始，按退避时间重连
+func newNetworkWriteSyncer(cfg NetworkSink, clock Clock) *networkWriteSyncer {
+	w := &networkWriteSyncer{cfg: cfg.withDefaults(), clock: clock}
+	conn, err := w.dial()
+	if err != nil {
+		w.retryLater()
+		return w
+	}
+	w.conn = conn
+	return w
+}
+
+func (w *networkWriteSyncer) dial() (net.Conn, error) {
+	return net.DialTimeout(w.cfg.Protocol, w.cfg.Addr, w.cfg.DialTimeout)
+}
+
+// Write 复制p并补上换行后发送，连接断开时缓存起来；发送失败时返回错误（日志已缓存）
+func (w *networkWriteSyncer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return len(p), nil
+	}
+	entry := append(make([]byte, 0, len(p)+1), p...)
+	if len(entry) == 0 || entry[len(entry)-1] != '\n' {
+		entry = append(entry, '\n')
+	}
+	w.pending = append(w.pending, entry)
+	if over := len(w.pending) - w.cfg.BufferLimit; over > 0 {
+		w.pending = w.pending[over:] // 丢弃最早的，包括只发出了一部分的那条
+		w.sent = 0
+		atomic.AddUint64(&networkDropped, uint64(over))
+	}
+	return len(p), w.flushLocked()
+}
+
+// flushLocked 连接断开时尝试重连，然后按顺序发送缓存的日志
+func (w *networkWriteSyncer) flushLocked() error {
+	if w.conn == nil {
+		if w.clock.Now().Before(w.nextDial) {
+			return nil
+		}
+		conn, err := w.dial()
+		if err != nil {
+			w.retryLater()
+			return nil
+		}
+		w.conn, w.backoff = conn, 0
+		atomic.AddUint64(&networkReconnects, 1)
+	}
+	for len(w.pending) > 0 {
+		_ = w.conn.SetWriteDeadline(time.Now().Add(w.cfg.DialTimeout))
+		n, err := w.conn.Write(w.pending[0][w.sent:])
+		w.sent += n
+		if err != nil {
+			w.conn.Close()
+			w.conn = nil
+			w.retryLater()
+			return err
+		}
+		w.pending[0] = nil
+		w.pending = w.pending[1:]
+		w.sent = 0
+	}
+	return nil
+}
+
+// retryLater 按退避时间推迟下一次重连
+func (w *networkWriteSyncer) retryLater() {
+	if w.backoff == 0 {
+		w.backoff = w.cfg.ReconnectBackoff
+	} else if w.backoff *= 2; w.backoff > networkMaxReconnectBackoff {
+		w.backoff = networkMaxReconnectBackoff
+	}
+	w.nextDial = w.clock.Now().Add(w.backoff)
+}
+
+// Sync 尝试发送缓存的日志
+func (w *networkWriteSyncer) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	return w.flushLocked()
+}
+
+// Close 关闭连接，缓存中没发出去的日志丢弃。可重复调用
+func (w *networkWriteSyncer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
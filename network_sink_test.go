@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lineServer 本地的TCP服务，把收到的每一行发到lines
+type lineServer struct {
+	ln    net.Listener
+	lines chan string
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+// startLineServer 在addr上监听，addr为空时使用随机端口
+func startLineServer(t *testing.T, addr string) *lineServer {
+	t.Helper()
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &lineServer{ln: ln, lines: make(chan string, 100)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go func() {
+				sc := bufio.NewScanner(conn)
+				for sc.Scan() {
+					s.lines <- sc.Text()
+				}
+			}()
+		}
+	}()
+	t.Cleanup(s.kill)
+	return s
+}
+
+// kill 关闭监听和所有连接，模拟Logstash挂掉
+func (s *lineServer) kill() {
+	s.ln.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+// expect 按顺序读出want中的每一行
+func (s *lineServer) expect(t *testing.T, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case got := <-s.lines:
+			if got != w {
+				t.Fatalf("got line %q, want %q", got, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", w)
+		}
+	}
+}
+
+// unusedAddr 返回一个当前没有监听的本地地址
+func unusedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func newTestNetworkSink(t *testing.T, addr string, clock Clock, limit int) *networkWriteSyncer {
+	t.Helper()
+	w := newNetworkWriteSyncer(NetworkSink{Protocol: "tcp", Addr: addr, DialTimeout: time.Second, ReconnectBackoff: time.Second, BufferLimit: limit}, clock)
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func TestNetworkSinkStartsDisconnected(t *testing.T) {
+	addr := unusedAddr(t)
+	clock := NewManualClock(fixedTime)
+	w := newTestNetworkSink(t, addr, clock, 0)
+	if _, err := w.Write([]byte("first")); err != nil {
+		t.Fatalf("Write while disconnected = %v, want the entry buffered", err)
+	}
+
+	s := startLineServer(t, addr)
+	w.Write([]byte("second\n"))
+	w.mu.Lock()
+	pending := len(w.pending)
+	w.mu.Unlock()
+	if pending != 2 {
+		t.Fatalf("should not redial before the backoff, pending = %d", pending)
+	}
+
+	reconnects := NetworkReconnects()
+	clock.Add(time.Second)
+	w.Write([]byte("third"))
+	s.expect(t, "first", "second", "third")
+	if got := NetworkReconnects() - reconnects; got != 1 {
+		t.Errorf("NetworkReconnects() grew by %d, want 1", got)
+	}
+}
+
+func TestNetworkSinkRecoversAfterServerRestart(t *testing.T) {
+	s := startLineServer(t, "")
+	addr := s.ln.Addr().String()
+	clock := NewManualClock(fixedTime)
+	w := newTestNetworkSink(t, addr, clock, 0)
+	w.Write([]byte("before kill"))
+	s.expect(t, "before kill")
+
+	// 对端关闭后内核可能还会接受几次写入，直到Write返回错误，这条日志留在缓存里
+	s.kill()
+	var failed string
+	for i := 0; i < 100 && failed == ""; i++ {
+		entry := fmt.Sprintf("entry %d", i)
+		if _, err := w.Write([]byte(entry)); err != nil {
+			failed = entry
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if failed == "" {
+		t.Fatal("writes to a killed server never failed")
+	}
+	w.Write([]byte("while down"))
+
+	s = startLineServer(t, addr)
+	clock.Add(time.Second)
+	if err := w.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("after restart"))
+	s.expect(t, failed, "while down", "after restart")
+}
+
+// partialConn 第一次Write只写出n个字节并返回超时错误
+type partialConn struct {
+	net.Conn
+	n       int
+	written []byte
+}
+
+func (c *partialConn) Write(p []byte) (int, error) {
+	c.written = append(c.written, p[:c.n]...)
+	return c.n, errors.New("i/o timeout")
+}
+
+func (c *partialConn) Close() error                       { return nil }
+func (c *partialConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func TestNetworkSinkResendsOnlyUnsentTail(t *testing.T) {
+	s := startLineServer(t, "")
+	clock := NewManualClock(fixedTime)
+	w := newTestNetworkSink(t, s.ln.Addr().String(), clock, 0)
+	w.mu.Lock()
+	w.conn.Close()
+	fake := &partialConn{n: 5}
+	w.conn = fake
+	w.mu.Unlock()
+
+	if _, err := w.Write([]byte("hello world")); err == nil {
+		t.Fatal("partial write should report the error")
+	}
+	if string(fake.written) != "hello" {
+		t.Fatalf("first connection got %q", fake.written)
+	}
+	clock.Add(time.Second)
+	w.Write([]byte("next"))
+	// 新连接上只补发剩下的部分，不重复已经发出的字节
+	s.expect(t, " world", "next")
+}
+
+func TestNetworkSinkDropsBeyondBufferLimit(t *testing.T) {
+	clock := NewManualClock(fixedTime)
+	addr := unusedAddr(t)
+	w := newTestNetworkSink(t, addr, clock, 2)
+	dropped := NetworkDropped()
+	for i := 0; i < 5; i++ {
+		w.Write([]byte(fmt.Sprintf("entry %d", i)))
+	}
+	if got := NetworkDropped() - dropped; got != 3 {
+		t.Errorf("NetworkDropped() grew by %d, want 3", got)
+	}
+
+	s := startLineServer(t, addr)
+	clock.Add(time.Second)
+	if err := w.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(t, "entry 3", "entry 4")
+}
+
+func TestNetworkSinkValidate(t *testing.T) {
+	tests := []struct {
+		sink    NetworkSink
+		wantErr string
+	}{
+		{sink: NetworkSink{Protocol: "tcp", Addr: "logstash:5000"}},
+		{sink: NetworkSink{Protocol: "udp", Addr: "logstash:5000"}},
+		{sink: NetworkSink{Protocol: "http", Addr: "logstash:5000"}, wantErr: `unknown network protocol "http"`},
+		{sink: NetworkSink{Protocol: "tcp"}, wantErr: "network addr must not be empty"},
+		{sink: NetworkSink{Protocol: "tcp", Addr: "x", DialTimeout: -1}, wantErr: "dial timeout must not be negative"},
+		{sink: NetworkSink{Protocol: "tcp", Addr: "x", ReconnectBackoff: -1}, wantErr: "reconnect backoff must not be negative"},
+		{sink: NetworkSink{Protocol: "tcp", Addr: "x", BufferLimit: -1}, wantErr: "buffer limit must not be negative"},
+	}
+	for _, tt := range tests {
+		err := tt.sink.validate()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%+v: validate() = %v, want %q", tt.sink, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNetworkSinkWithLogger(t *testing.T) {
+	addr := unusedAddr(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingJSON
+	b, err := newLogger(WithConfig(cfg), WithNetwork(NetworkSink{Protocol: "tcp", Addr: addr}))
+	if err != nil {
+		t.Fatalf("an unreachable server must not fail the build: %v", err)
+	}
+	b.close()
+}
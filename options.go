@@ -0,0 +1,482 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+Functional Options
+InitLogger1/2/3各自写死了一套参数，不好扩展。NewLogger(opts...)通过选项组合出需要的logger，
+例如：
+	NewLogger(WithFile("./app.log"), WithLevel(zapcore.InfoLevel), WithConsole())
+WithConsole和WithFile同时使用时，日志会同时写到console和文件（tee），与选项顺序无关。
+*/
+
+// Option 构建logger的选项
+type Option func(*loggerOptions)
+
+type loggerOptions struct {
+	cfg     LogConfig
+	file    bool // 输出到lumberjack切割的文件
+	console bool // 输出到stdout
+
+	consoleOut zapcore.WriteSyncer // console输出的目标，默认os.Stdout
+	stderrOut  zapcore.WriteSyncer // StderrMirror和Failover输出的目标，默认os.Stderr
+	errorOut   zapcore.WriteSyncer // zap内部错误的输出目标，不为nil时忽略cfg.ErrorOutput
+
+	callerSkip   int                                           // 记录调用函数信息时额外跳过的栈帧数
+	samplingHook func(zapcore.Entry, zapcore.SamplingDecision) // 每次采样决策后调用
+	hooks        []func(zapcore.Entry) error                   // 每条日志写出后调用，见WithHooks
+
+	fatalCallbacks []func() // Fatal时在Sync之后、退出之前调用
+	fatalPanic     bool     // Fatal时panic而不是退出进程
+
+	clock Clock // 日志时间戳使用的时钟
+
+	primarySink func(fallback zapcore.WriteSyncer) (zapcore.Core, error) // 代替日志文件的输出，见WithPrimarySink
+}
+
+func newLoggerOptions(opts []Option) *loggerOptions {
+	o := &loggerOptions{cfg: defaultLogConfig(), clock: defaultClock, consoleOut: os.Stdout, stderrOut: os.Stderr}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.cfg.TeeToConsole {
+		o.console = true
+	}
+	// 没有指定任何输出时，与InitLogger3一样写到默认的日志文件；
+	// 文件名为空且没有配置Syslog、Network、Loki和journald时只输出到console
+	if !o.file && !o.console {
+		o.file = o.cfg.Filename != "" || o.cfg.FilenamePattern != ""
+		o.console = !o.file && o.cfg.Syslog == nil && o.cfg.Network == nil && o.cfg.Loki == nil &&
+			o.cfg.Sink != SinkJournald
+	}
+	return o
+}
+
+// applyMode 按预设模式覆盖输出、编码和级别
+func (o *loggerOptions) applyMode() error {
+	switch o.cfg.Mode {
+	case ModeDevelopment:
+		o.file, o.console = false, true
+		o.cfg.Encoding = EncodingConsole
+		o.cfg.Level = zapcore.DebugLevel.String()
+	case ModeProduction:
+		if o.cfg.Filename == "" && o.cfg.FilenamePattern == "" {
+			return errors.New("log config: production mode requires a filename")
+		}
+		o.file, o.console = true, false
+		o.cfg.Encoding = EncodingJSON
+		o.cfg.Level = zapcore.InfoLevel.String()
+	}
+	return validateMode(o.cfg.Mode)
+}
+
+// WithConfig 使用cfg中的全部配置，并输出到cfg.Filename；
+// cfg.Filename为空时不使用lumberjack，只输出到console
+func WithConfig(cfg LogConfig) Option {
+	return func(o *loggerOptions) {
+		o.cfg = cfg
+		o.file = cfg.Filename != "" || cfg.FilenamePattern != ""
+	}
+}
+
+// WithFile 输出到path，使用lumberjack切割
+func WithFile(path string) Option {
+	return func(o *loggerOptions) {
+		o.cfg.Filename = path
+		o.file = path != ""
+	}
+}
+
+// WithFilenamePattern 输出到按pattern渲染出的带日期的文件，如./logs/app-%Y-%m-%d.log，日期变化时换文件
+func WithFilenamePattern(pattern string) Option {
+	return func(o *loggerOptions) {
+		o.cfg.FilenamePattern = pattern
+		o.file = pattern != ""
+	}
+}
+
+// WithDailyDirs 日志文件放在按日期命名的子目录中，如./logs/2024-05-17/app.log，跨天时换目录
+func WithDailyDirs() Option {
+	return func(o *loggerOptions) {
+		o.cfg.DailyDirs = true
+	}
+}
+
+// WithConsole 输出到stdout
+func WithConsole() Option {
+	return func(o *loggerOptions) {
+		o.console = true
+	}
+}
+
+// WithConsoleOutput console输出写到ws而不是os.Stdout，主要给测试用
+func WithConsoleOutput(ws zapcore.WriteSyncer) Option {
+	return func(o *loggerOptions) {
+		o.consoleOut = ws
+	}
+}
+
+// WithColor console输出是终端时级别带颜色，force为true时不检测终端总是上色
+func WithColor(force bool) Option {
+	return func(o *loggerOptions) {
+		o.cfg.Color = true
+		o.cfg.ForceColor = force
+	}
+}
+
+// WithEpochMillis 每条日志在ts之外再带一个ts_ms字段，值为同一时刻的整数毫秒时间戳
+func WithEpochMillis() Option {
+	return func(o *loggerOptions) {
+		o.cfg.EpochMillisKey = defaultEpochMillisKey
+	}
+}
+
+// WithStderrMirror Warn及以上级别的日志额外输出一份到stderr，keepStack为false时去掉GinRecovery的stack字段
+func WithStderrMirror(keepStack bool) Option {
+	return func(o *loggerOptions) {
+		o.cfg.StderrMirror = true
+		o.cfg.StderrKeepStack = keepStack
+	}
+}
+
+// WithStderrOutput StderrMirror和Failover的输出写到ws而不是os.Stderr，主要给测试用
+func WithStderrOutput(ws zapcore.WriteSyncer) Option {
+	return func(o *loggerOptions) {
+		o.stderrOut = ws
+	}
+}
+
+// WithErrorOutput zap内部错误写到ws而不是cfg.ErrorOutput，写入次数计入InternalErrors
+func WithErrorOutput(ws zapcore.WriteSyncer) Option {
+	return func(o *loggerOptions) {
+		o.errorOut = ws
+	}
+}
+
+// WithLevel 设置日志级别
+func WithLevel(l zapcore.Level) Option {
+	return func(o *loggerOptions) {
+		o.cfg.Level = l.String()
+	}
+}
+
+// WithMaxSizeMB 设置切割前日志文件的最大大小（以MB为单位）
+func WithMaxSizeMB(n int) Option {
+	return func(o *loggerOptions) {
+		o.cfg.MaxSize = n
+	}
+}
+
+// WithCompress 是否用gzip压缩切割出的旧文件。
+// 访问日志由OpenAccessLog按自己的LogConfig打开，可以与应用日志分别设置
+func WithCompress(enabled bool) Option {
+	return func(o *loggerOptions) {
+		o.cfg.Compress = enabled
+	}
+}
+
+// WithJSON 使用JSON Encoder，等同于WithEncoding(EncodingJSON)
+func WithJSON() Option {
+	return WithEncoding(EncodingJSON)
+}
+
+// WithEncoding 设置Encoder：EncodingJSON或EncodingConsole
+func WithEncoding(encoding string) Option {
+	return func(o *loggerOptions) {
+		o.cfg.Encoding = encoding
+	}
+}
+
+// WithMode 使用预设模式，见ModeDevelopment和ModeProduction
+func WithMode(mode string) Option {
+	return func(o *loggerOptions) {
+		o.cfg.Mode = mode
+	}
+}
+
+// WithStdLog 是否把标准库log包的输出以Info级别重定向到logger，默认重定向。
+// 只对设置为全局logger的InitLogger系列函数生效
+func WithStdLog(enabled bool) Option {
+	return func(o *loggerOptions) {
+		o.cfg.DisableStdLog = !enabled
+	}
+}
+
+// WithService 在每条日志上附加服务名、版本和环境字段
+func WithService(name, version, env string) Option {
+	return func(o *loggerOptions) {
+		o.cfg.ServiceName = name
+		o.cfg.ServiceVersion = version
+		o.cfg.Env = env
+	}
+}
+
+// WithHostInfo 在每条日志上附加hostname和pid字段，多实例部署时用来区分是哪个副本写的日志
+func WithHostInfo() Option {
+	return func(o *loggerOptions) {
+		o.cfg.HostInfo = true
+	}
+}
+
+// WithCaller 是否记录调用函数信息，默认记录
+func WithCaller(enabled bool) Option {
+	return func(o *loggerOptions) {
+		o.cfg.DisableCaller = !enabled
+	}
+}
+
+// WithCallerSkip 记录调用函数信息时额外跳过n层栈帧。
+// 用自己的函数包装logger时，caller会指向包装函数，每包一层n加1就能指回真正的调用处
+func WithCallerSkip(n int) Option {
+	return func(o *loggerOptions) {
+		o.callerSkip = n
+	}
+}
+
+// WithSampling 对Info及以下级别的日志采样，hook可以为nil，
+// 被丢弃的条数可以通过SampledDropped查看
+func WithSampling(s SamplingConfig, hook func(zapcore.Entry, zapcore.SamplingDecision)) Option {
+	return func(o *loggerOptions) {
+		o.cfg.Sampling = &s
+		o.samplingHook = hook
+	}
+}
+
+// WithFailover 写日志文件连续失败时切换到stderr，恢复后切回文件，见failover.go
+func WithFailover(f FailoverConfig) Option {
+	return func(o *loggerOptions) {
+		o.cfg.Failover = &f
+	}
+}
+
+// WithLowDisk 日志盘剩余空间不足时把级别提高到Warn，见low_disk.go
+func WithLowDisk(l LowDiskConfig) Option {
+	return func(o *loggerOptions) {
+		o.cfg.LowDisk = &l
+	}
+}
+
+// WithExpvar 把Stats以logging为名发布到expvar，见stats.go
+func WithExpvar() Option {
+	return func(o *loggerOptions) {
+		o.cfg.Expvar = true
+	}
+}
+
+// WithRetry 写日志文件遇到可以重试的错误时按r重试，见retry.go
+func WithRetry(r RetryConfig) Option {
+	return func(o *loggerOptions) {
+		o.cfg.Retry = &r
+	}
+}
+
+// WithSyslog 同时输出到syslog，没有指定其他输出时只输出到syslog，见syslog.go
+func WithSyslog(s SyslogConfig) Option {
+	return func(o *loggerOptions) {
+		o.cfg.Syslog = &s
+	}
+}
+
+// WithNetwork 同时通过TCP/UDP发送到n.Addr，没有指定其他输出时只通过网络发送，见network_sink.go
+func WithNetwork(n NetworkSink) Option {
+	return func(o *loggerOptions) {
+		o.cfg.Network = &n
+	}
+}
+
+// WithLoki 同时推送到Loki，没有指定其他输出时只推送到Loki，见loki.go
+func WithLoki(l LokiConfig) Option {
+	return func(o *loggerOptions) {
+		o.cfg.Loki = &l
+	}
+}
+
+// WithElasticsearch 同时通过_bulk写入Elasticsearch，见elasticsearch.go
+func WithElasticsearch(e ElasticsearchConfig) Option {
+	return func(o *loggerOptions) {
+		o.cfg.Elasticsearch = &e
+	}
+}
+
+// WithPrimarySink 用build创建的core代替写日志文件的core（如kafkasink），
+// fallback是日志文件（没有日志文件时是stderr），build创建的core发送失败时可以改写到这里。
+// core实现了io.Closer时在关闭logger时先于日志文件关闭
+func WithPrimarySink(build func(fallback zapcore.WriteSyncer) (zapcore.Core, error)) Option {
+	return func(o *loggerOptions) {
+		o.primarySink = build
+	}
+}
+
+// WithHooks 注册zap.Hooks，每条日志写出后依次调用。
+// hook返回的error会输出到zap的ErrorOutput，不会中断日志输出，例如WithHooks(CountEntriesHook)
+func WithHooks(hooks ...func(zapcore.Entry) error) Option {
+	return func(o *loggerOptions) {
+		o.hooks = append(o.hooks, hooks...)
+	}
+}
+
+// WithOnFatal 注册Fatal时的清理回调，在日志Sync之后、进程退出之前按注册顺序调用
+func WithOnFatal(callbacks ...func()) Option {
+	return func(o *loggerOptions) {
+		o.fatalCallbacks = append(o.fatalCallbacks, callbacks...)
+	}
+}
+
+// WithFatalPanic Fatal时在Sync和回调之后panic而不是退出进程，供测试使用
+func WithFatalPanic() Option {
+	return func(o *loggerOptions) {
+		o.fatalPanic = true
+	}
+}
+
+// WithClock 日志时间戳使用clock提供的时间，默认使用系统时间
+func WithClock(clock Clock) Option {
+	return func(o *loggerOptions) {
+		o.clock = clock
+	}
+}
+
+// NewLogger 根据选项构建一个logger，不修改全局的logger和sugarLogger。
+// 底层的日志文件随进程退出关闭，需要自己关闭时使用Build
+func NewLogger(opts ...Option) (*zap.Logger, error) {
+	b, err := newLogger(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return b.logger, nil
+}
+
+// Build 根据选项构建logger和对应的SugaredLogger，不修改任何全局状态，
+// 多次调用得到的logger相互独立。closeFn会Sync并关闭底层的日志文件
+func Build(opts ...Option) (_ *zap.Logger, _ *zap.SugaredLogger, closeFn func() error, err error) {
+	b, err := newLogger(opts...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	closeFn = func() error {
+		_ = b.logger.Sync()
+		return b.close()
+	}
+	return b.logger, b.logger.Sugar(), closeFn, nil
+}
+
+// BuildFromConfig 同Build，使用cfg中的全部配置，不读取环境变量
+func BuildFromConfig(cfg LogConfig) (*zap.Logger, *zap.SugaredLogger, func() error, error) {
+	return Build(WithConfig(cfg))
+}
+
+// builtLogger newLogger构建出的logger及其附属资源
+type builtLogger struct {
+	logger *zap.Logger
+	level  zap.AtomicLevel    // 运行时可修改的日志级别
+	stdLog bool               // 设置为全局logger时是否重定向标准库log
+	ecs    bool               // 是否按ECS输出，见LogConfig.ECS
+	gelf   bool               // 是否使用GELF Encoder
+	file   *fileWriteSyncer   // 主日志文件，只输出到console时为nil
+	files  []*fileWriteSyncer // 所有日志文件，包括按级别拆分出的error文件
+
+	errorOutput *os.File // cfg.ErrorOutput打开的文件，输出到stderr时为nil
+
+	asyncReporter *asyncDropReporter   // 报告异步写入丢弃的条数，没有开启Async时为nil
+	failovers     []*failoverCore      // 写文件失败时切换到stderr的core，没有配置Failover时为nil
+	syslog        io.Closer            // syslog的连接，没有配置Syslog时为nil
+	network       *networkWriteSyncer  // TCP/UDP输出，没有配置Network时为nil
+	networkQueue  *IsolatedMultiSyncer // 网络输出前面的队列
+	primarySink   io.Closer            // WithPrimarySink创建的core，没有或者不需要关闭时为nil
+	loki          io.Closer            // 推送到Loki的队列，没有配置Loki时为nil
+	elasticsearch io.Closer            // 写入Elasticsearch的队列，没有配置Elasticsearch时为nil
+	journald      io.Closer            // journald的连接，Sink不是journald或者退回写文件时为nil
+	lowDisk       *lowDiskMonitor      // 检查日志盘剩余空间，没有配置LowDisk时为nil
+}
+
+// close 关闭所有日志文件
+func (b *builtLogger) close() error {
+	b.asyncReporter.close()
+	b.lowDisk.close()
+	var err error
+	if b.primarySink != nil {
+		err = b.primarySink.Close() // 先发送完，发送失败的日志还要写到文件
+	}
+	for _, f := range b.failovers {
+		f.close()
+	}
+	for _, f := range b.files {
+		err = multierr.Append(err, f.Close())
+	}
+	if b.syslog != nil {
+		err = multierr.Append(err, b.syslog.Close())
+	}
+	if b.journald != nil {
+		err = multierr.Append(err, b.journald.Close())
+	}
+	if b.network != nil {
+		err = multierr.Append(err, b.networkQueue.Close())
+		err = multierr.Append(err, b.network.Close())
+	}
+	if b.loki != nil {
+		err = multierr.Append(err, b.loki.Close())
+	}
+	if b.elasticsearch != nil {
+		err = multierr.Append(err, b.elasticsearch.Close())
+	}
+	if b.errorOutput != nil {
+		err = multierr.Append(err, b.errorOutput.Close())
+	}
+	return err
+}
+
+// rotate 切割所有日志文件
+func (b *builtLogger) rotate() error {
+	var err error
+	for _, f := range b.files {
+		err = multierr.Append(err, f.Rotate())
+	}
+	return err
+}
+
+// newLogger 同NewLogger，额外返回级别和关闭底层文件的函数
+func newLogger(opts ...Option) (*builtLogger, error) {
+	o := newLoggerOptions(opts)
+	if err := o.applyMode(); err != nil {
+		return nil, err
+	}
+	if o.file {
+		filename, err := resolveLogPath(o.cfg.Filename, o.cfg.BaseDir)
+		if err != nil {
+			return nil, err
+		}
+		o.cfg.Filename = filename
+		if o.cfg, err = o.cfg.resolveFilenamePattern(o.clock); err != nil {
+			return nil, err
+		}
+		if o.cfg.ErrorFile != nil {
+			errorFile := *o.cfg.ErrorFile
+			if errorFile.Filename, err = resolveLogPath(errorFile.Filename, o.cfg.BaseDir); err != nil {
+				return nil, err
+			}
+			o.cfg.ErrorFile = &errorFile
+		}
+		if err := o.cfg.Validate(); err != nil {
+			return nil, err
+		}
+	} else if err := o.cfg.validateCommon(); err != nil {
+		return nil, err
+	}
+	if o.cfg.ErrorOutput != "" && o.cfg.ErrorOutput != errorOutputStderr {
+		path, err := resolveLogPath(o.cfg.ErrorOutput, o.cfg.BaseDir)
+		if err != nil {
+			return nil, err
+		}
+		o.cfg.ErrorOutput = path
+	}
+	return buildLogger(o)
+}
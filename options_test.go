@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+)
+
+// logViaWrapper 模拟业务代码中包装logger的helper
+func logViaWrapper(l *zap.Logger, msg string) {
+	l.Info(msg)
+}
+
+func TestWithCallerSkip(t *testing.T) {
+	tests := []struct {
+		name     string
+		skip     int
+		wantFunc string
+	}{
+		{name: "no skip points at wrapper", skip: 0, wantFunc: ".logViaWrapper"},
+		{name: "skip one points at caller", skip: 1, wantFunc: ".TestWithCallerSkip.func1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, logs := newObservedLogger(t, WithCallerSkip(tt.skip))
+			logViaWrapper(l, "wrapped")
+
+			caller := logs.All()[0].Caller
+			if !caller.Defined || !strings.HasSuffix(caller.Function, tt.wantFunc) {
+				t.Errorf("caller function = %q, want %q", caller.Function, tt.wantFunc)
+			}
+			if tt.skip == 1 && !strings.HasSuffix(caller.File, "options_test.go") {
+				t.Errorf("caller file = %q, want options_test.go", caller.File)
+			}
+		})
+	}
+}
+
+// benchmarkInfo 对写到ioutil.Discard的JSON logger测量Info的吞吐
+func benchmarkInfo(b *testing.B, caller bool) {
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingJSON
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(zapcore.AddSync(ioutil.Discard)), WithCaller(caller))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			l.Info("request handled", zap.String("path", "/api/v1/users"), zap.Int("status", 200))
+		}
+	})
+}
+
+func BenchmarkInfoWithCaller(b *testing.B) {
+	benchmarkInfo(b, true)
+}
+
+func BenchmarkInfoNoCaller(b *testing.B) {
+	benchmarkInfo(b, false)
+}
+
+func TestBuildIndependentLoggers(t *testing.T) {
+	cleanupGlobalLogger(t)
+	globalMu.Lock()
+	prevGlobal, prevLogger := globalBuilt, logger
+	globalMu.Unlock()
+
+	pathA, pathB := tempLogFile(t), tempLogFile(t)
+	a, sugarA, closeA, err := Build(WithFile(pathA), WithJSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, sugarB, closeB, err := BuildFromConfig(LogConfig{Filename: pathB, MaxSize: 1, Level: "info", Encoding: EncodingJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				a.Info("from a")
+				sugarA.Debugw("sugar a")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				b.Info("from b")
+				sugarB.Debugw("sugar b dropped")
+			}
+		}()
+	}
+	wg.Wait()
+	if err := closeA(); err != nil {
+		t.Fatal(err)
+	}
+	if err := closeB(); err != nil {
+		t.Fatal(err)
+	}
+
+	outA, outB := readFile(t, pathA), readFile(t, pathB)
+	if strings.Count(outA, "from a") != 200 || strings.Count(outA, "sugar a") != 200 || strings.Contains(outA, "from b") {
+		t.Errorf("file a has %d/%d lines from a and foreign lines: %v",
+			strings.Count(outA, "from a"), strings.Count(outA, "sugar a"), strings.Contains(outA, "from b"))
+	}
+	if strings.Count(outB, "from b") != 200 || strings.Contains(outB, "dropped") || strings.Contains(outB, "from a") {
+		t.Errorf("file b has %d lines from b, debug or foreign lines present", strings.Count(outB, "from b"))
+	}
+
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	if globalBuilt != prevGlobal || logger != prevLogger {
+		t.Error("Build should not touch the global logger")
+	}
+}
+
+func TestConsoleOnlyWhenFilenameEmpty(t *testing.T) {
+	dir := tempDir(t)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	out := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.BaseDir = dir
+	cfg.Level = "info"
+	b, err := newLogger(WithConfig(cfg), WithConsoleOutput(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.logger.Debug("debug dropped")
+	b.logger.Info("console only")
+	if err := b.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.file != nil || len(b.files) != 0 {
+		t.Error("console-only logger should not open a log file")
+	}
+	lines := out.Lines()
+	if len(lines) != 1 || !strings.Contains(lines[0], "console only") || !strings.Contains(lines[0], "options_test.go:") {
+		t.Errorf("console output should have one info line with caller, got:\n%s", out.String())
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		t.Errorf("unexpected file %s created in console-only mode", e.Name())
+	}
+}
+
+// serveGinPanic 经过GinLogger和GinRecovery处理一个正常请求和一个panic的请求
+func serveGinPanic(l *zap.Logger) {
+	r := gin.New()
+	r.Use(MustGinLoggerWithConfig(l, GinLoggerConfig{}), GinRecovery(l, false))
+	r.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+	for _, path := range []string{"/ok", "/panic"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+}
+
+func TestTeeToConsoleObserver(t *testing.T) {
+	var console bytes.Buffer
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.TeeToConsole = true
+	l, fileSide := newObservedLogger(t, WithConfig(cfg), WithConsoleOutput(zapcore.AddSync(&console)))
+	serveGinPanic(l)
+
+	if fileSide.FilterMessage("/ok").Len() != 1 || fileSide.FilterMessage("[Recovery from panic]").Len() != 1 {
+		t.Errorf("file side missing gin entries: %v", fileSide.All())
+	}
+	out := console.String()
+	if !strings.Contains(out, "\t/ok\t") || !strings.Contains(out, "[Recovery from panic]") {
+		t.Errorf("console missing gin entries:\n%s", out)
+	}
+}
+
+func TestTeeToConsoleEncoders(t *testing.T) {
+	var console bytes.Buffer
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.Encoding = EncodingJSON
+	cfg.TeeToConsole = true
+	b, err := newLogger(WithConfig(cfg), WithConsoleOutput(zapcore.AddSync(&console)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveGinPanic(b.logger)
+	b.close()
+
+	file := readFile(t, cfg.Filename)
+	if !strings.Contains(file, `"msg":"/ok"`) || !strings.Contains(file, `"msg":"[Recovery from panic]"`) {
+		t.Errorf("file should contain JSON gin entries:\n%s", file)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(console.String()), "\n") {
+		if strings.HasPrefix(line, "{") {
+			t.Errorf("console should use the console encoder, got %s", line)
+		}
+	}
+	if !strings.Contains(console.String(), "\tINFO\t") || !strings.Contains(console.String(), "[Recovery from panic]") {
+		t.Errorf("console:\n%s", console.String())
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+=============================================================
+日志文件路径的展开和规范化
+~/logs/app.log这样的路径lumberjack不认识，相对路径又依赖启动时的工作目录，经常写到意想不到的地方。
+同一台机器上的多个实例写同一个目录时，文件名中可以用{hostname}和{pid}区分，如app-{hostname}-{pid}.log。
+交给lumberjack之前先：
+1. 把{hostname}、{pid}替换为主机名（只保留字母、数字、.、_、-）和进程号，切割出的备份也基于替换后的文件名；
+2. 把开头的~展开为当前用户的home目录；
+3. 相对路径基于BaseDir解析，BaseDir为空时使用可执行文件所在目录（而不是当前工作目录）；
+4. 统一分隔符并Clean。
+*/
+
+// hostname和getpid 返回主机名和进程号，测试时可以替换
+var (
+	hostname = os.Hostname
+	getpid   = os.Getpid
+)
+
+// expandPathTemplate 替换filename中的{hostname}和{pid}，只在创建logger（以及重新加载配置）时展开一次
+func expandPathTemplate(filename string) string {
+	if !strings.Contains(filename, "{") {
+		return filename
+	}
+	host, err := hostname()
+	if err != nil {
+		host = ""
+	}
+	return strings.NewReplacer(
+		"{hostname}", sanitizeHostname(host),
+		"{pid}", strconv.Itoa(getpid()),
+	).Replace(filename)
+}
+
+// sanitizeHostname 把主机名中文件名里不安全的字符替换为_，去掉开头的.，为空时返回unknown
+func sanitizeHostname(host string) string {
+	host = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, host)
+	host = strings.TrimLeft(host, ".")
+	if host == "" {
+		return "unknown"
+	}
+	return host
+}
+
+// resolveLogPath 把filename展开为规范化的绝对路径
+func resolveLogPath(filename, baseDir string) (string, error) {
+	if filename == "" {
+		return "", nil
+	}
+	filename = filepath.FromSlash(expandPathTemplate(filename))
+	if filename == "~" || strings.HasPrefix(filename, "~/") || strings.HasPrefix(filename, `~\`) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("expand ~ in log filename: %v", err)
+		}
+		filename = filepath.Join(home, filename[1:])
+	}
+	if !filepath.IsAbs(filename) {
+		if baseDir == "" {
+			exe, err := os.Executable()
+			if err != nil {
+				return "", fmt.Errorf("resolve executable dir for log filename: %v", err)
+			}
+			baseDir = filepath.Dir(exe)
+		}
+		filename = filepath.Join(filepath.FromSlash(baseDir), filename)
+	}
+	return filepath.Clean(filename), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestResolveLogPath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory:", err)
+	}
+	base := filepath.Join(tempDir(t), "base")
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs := filepath.Join(base, "abs", "app.log")
+
+	type testCase struct {
+		name     string
+		filename string
+		baseDir  string
+		want     string
+	}
+	tests := []testCase{
+		{name: "empty", filename: "", want: ""},
+		{name: "home", filename: "~/logs/app.log", want: filepath.Join(home, "logs", "app.log")},
+		{name: "home only", filename: "~", want: home},
+		{name: "dot relative to base", filename: "./app.log", baseDir: base, want: filepath.Join(base, "app.log")},
+		{name: "dot", filename: ".", baseDir: base, want: base},
+		{name: "relative to base", filename: "logs/../app.log", baseDir: base, want: filepath.Join(base, "app.log")},
+		{name: "relative to executable", filename: "app.log", want: filepath.Join(filepath.Dir(exe), "app.log")},
+		{name: "absolute", filename: abs, baseDir: "/ignored", want: abs},
+		{name: "absolute unclean", filename: filepath.Join(base, "a") + "/../b//app.log", want: filepath.Join(base, "b", "app.log")},
+		{name: "forward slashes", filename: "logs/sub/app.log", baseDir: base, want: filepath.Join(base, "logs", "sub", "app.log")},
+		{name: "base with forward slashes", filename: "app.log", baseDir: filepath.ToSlash(base), want: filepath.Join(base, "app.log")},
+	}
+	if runtime.GOOS == "windows" {
+		tests = append(tests,
+			testCase{name: "home backslash", filename: `~\logs\app.log`, want: filepath.Join(home, "logs", "app.log")},
+			testCase{name: "mixed slashes", filename: `logs\sub/app.log`, baseDir: base, want: filepath.Join(base, "logs", "sub", "app.log")},
+		)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveLogPath(tt.filename, tt.baseDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveLogPath(%q, %q) = %q, want %q", tt.filename, tt.baseDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvedPathLoggedAtStartup(t *testing.T) {
+	dir := tempDir(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = "./logs/../app.log"
+	cfg.BaseDir = dir
+	b, err := newLogger(WithConfig(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.close()
+
+	want := filepath.Join(dir, "app.log")
+	lines := readLines(t, want)
+	if len(lines) != 1 || !strings.Contains(lines[0], "logging to file") || !strings.Contains(lines[0], want) {
+		t.Errorf("startup line should log the resolved path %s once, got %q", want, lines)
+	}
+}
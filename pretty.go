@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+缩进的JSON
+本地调试时单行JSON不好看，Encoding配置为json-pretty时把JSON Encoder的输出用json.Indent缩进成多行。
+只用于console输出，不能和lumberjack文件一起使用。字段顺序与JSON Encoder相同，每条日志都一样。
+*/
+
+// prettyJSONEncoder 包装JSON Encoder，EncodeEntry的结果缩进后输出
+type prettyJSONEncoder struct {
+	zapcore.Encoder
+	lineEnding string
+}
+
+// newPrettyJSONEncoder 使用cfg创建缩进的JSON Encoder
+func newPrettyJSONEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	lineEnding := cfg.LineEnding
+	if lineEnding == "" {
+		lineEnding = zapcore.DefaultLineEnding
+	}
+	return prettyJSONEncoder{zapcore.NewJSONEncoder(cfg), lineEnding}
+}
+
+func (enc prettyJSONEncoder) Clone() zapcore.Encoder {
+	return prettyJSONEncoder{enc.Encoder.Clone(), enc.lineEnding}
+}
+
+func (enc prettyJSONEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	line, err := enc.Encoder.EncodeEntry(ent, fields)
+	if err != nil {
+		return nil, err
+	}
+	defer line.Free()
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, bytes.TrimRight(line.Bytes(), "\r\n"), "", "  "); err != nil {
+		return nil, err
+	}
+	out := bufferPool.Get()
+	_, _ = out.Write(indented.Bytes())
+	out.AppendString(enc.lineEnding)
+	return out, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestPrettyJSONGinLoggerGolden(t *testing.T) {
+	clock := NewManualClock(fixedTime)
+	out := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingJSONPretty
+	cfg.TimeZone = "utc"
+	cfg.DisableCaller = true
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(MustGinLoggerWithConfig(l, GinLoggerConfig{Clock: clock}))
+	r.GET("/users", func(c *gin.Context) {
+		clock.Add(25 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/users?page=2", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("User-Agent", "test-agent")
+	for i := 0; i < 2; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	entry := func(ts string) string {
+		return `{
+  "level": "INFO",
+  "ts": "` + ts + `",
+  "msg": "/users",
+  "status": 200,
+  "method": "GET",
+  "path": "/users",
+  "query": "page=2",
+  "ip": "10.0.0.1",
+  "user-agent": "test-agent",
+  "cost": 0.025
+}
+`
+	}
+	// 两条日志的字段顺序相同
+	want := entry("2024-05-17T10:00:00.025Z") + entry("2024-05-17T10:00:00.050Z")
+	if got := out.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPrettyJSONRejectedWithFile(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.Encoding = EncodingJSONPretty
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "encoding json-pretty cannot be used with a log file") {
+		t.Fatalf("error = %v, want json-pretty rejected", err)
+	}
+	if _, err := NewLogger(WithConfig(cfg)); err == nil {
+		t.Fatal("NewLogger should reject json-pretty with a log file")
+	}
+	if _, statErr := os.Stat(cfg.Filename); statErr == nil {
+		t.Error("rejected config should not create the log file")
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+按key脱敏
+password、token、authorization之类的字段总会被人不小心打进日志。配置RedactKeys后，
+key匹配的字符串字段的值替换为[REDACTED]，key不区分大小写，*开头或结尾表示后缀或前缀匹配，如*_secret。
+GinLogger的query字段按参数名脱敏（token=[REDACTED]），GinRecovery的request字段按header名和query参数脱敏
+（Authorization: [REDACTED]）。With的字段、Namespace和zap.Object内部的字段同样处理，JSON和console Encoder都生效。
+*/
+
+// redactedValue 脱敏后的值
+const redactedValue = "[REDACTED]"
+
+// gin中间件记录请求的字段
+const (
+	queryFieldKey   = "query"
+	requestFieldKey = "request"
+)
+
+// redactor 脱敏的key集合
+type redactor struct {
+	exact    map[string]bool
+	prefixes []string
+	suffixes []string
+}
+
+// newRedactor keys为空时返回nil
+func newRedactor(keys []string) *redactor {
+	if len(keys) == 0 {
+		return nil
+	}
+	r := &redactor{exact: make(map[string]bool)}
+	for _, k := range keys {
+		k = strings.ToLower(strings.TrimSpace(k))
+		switch {
+		case k == "" || k == "*":
+		case strings.HasPrefix(k, "*"):
+			r.suffixes = append(r.suffixes, k[1:])
+		case strings.HasSuffix(k, "*"):
+			r.prefixes = append(r.prefixes, k[:len(k)-1])
+		default:
+			r.exact[k] = true
+		}
+	}
+	return r
+}
+
+// match 判断key是否需要脱敏
+func (r *redactor) match(key string) bool {
+	key = strings.ToLower(key)
+	if r.exact[key] {
+		return true
+	}
+	for _, s := range r.suffixes {
+		if strings.HasSuffix(key, s) {
+			return true
+		}
+	}
+	for _, p := range r.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactString 返回key字段脱敏后的值
+func (r *redactor) redactString(key, value string) string {
+	switch {
+	case r.match(key):
+		return redactedValue
+	case key == queryFieldKey:
+		return r.redactQuery(value)
+	case key == requestFieldKey:
+		return r.redactRequestDump(value)
+	}
+	return value
+}
+
+// redactQuery 按参数名脱敏query字符串，参数顺序和未匹配的部分保持不变
+func (r *redactor) redactQuery(query string) string {
+	if query == "" {
+		return query
+	}
+	parts := strings.Split(query, "&")
+	for i, part := range parts {
+		name := part
+		if j := strings.IndexByte(part, '='); j >= 0 {
+			name = part[:j]
+		}
+		decoded := name
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			decoded = unescaped
+		}
+		if r.match(decoded) {
+			parts[i] = name + "=" + redactedValue
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// redactRequestDump 脱敏httputil.DumpRequest的输出：请求行里的query参数和匹配的header
+func (r *redactor) redactRequestDump(dump string) string {
+	lines := strings.Split(dump, "\n")
+	for i, line := range lines {
+		if i == 0 {
+			// GET /path?query HTTP/1.1
+			if q := strings.IndexByte(line, '?'); q >= 0 {
+				end := strings.LastIndexByte(line, ' ')
+				if end > q {
+					lines[i] = line[:q+1] + r.redactQuery(line[q+1:end]) + line[end:]
+				}
+			}
+			continue
+		}
+		colon := strings.IndexByte(line, ':')
+		if colon <= 0 || !r.match(strings.TrimSpace(line[:colon])) {
+			continue
+		}
+		cr := ""
+		if strings.HasSuffix(line, "\r") {
+			cr = "\r"
+		}
+		lines[i] = line[:colon] + ": " + redactedValue + cr
+	}
+	return strings.Join(lines, "\n")
+}
+
+// redactFields 返回脱敏后的fields，没有需要改的字段时返回原slice
+func (r *redactor) redactFields(fields []zapcore.Field) []zapcore.Field {
+	var out []zapcore.Field
+	for i, f := range fields {
+		var replaced zapcore.Field
+		switch f.Type {
+		case zapcore.StringType:
+			v := r.redactString(f.Key, f.String)
+			if v == f.String {
+				continue
+			}
+			replaced = f
+			replaced.String = v
+		case zapcore.ByteStringType:
+			s := string(f.Interface.([]byte))
+			v := r.redactString(f.Key, s)
+			if v == s {
+				continue
+			}
+			replaced = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: v}
+		case zapcore.ObjectMarshalerType:
+			replaced = f
+			replaced.Interface = redactMarshaler{f.Interface.(zapcore.ObjectMarshaler), r}
+		default:
+			continue
+		}
+		if out == nil {
+			out = make([]zapcore.Field, len(fields))
+			copy(out, fields)
+		}
+		out[i] = replaced
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
+
+// redactMarshaler 让zap.Object内部的字段也经过脱敏
+type redactMarshaler struct {
+	zapcore.ObjectMarshaler
+	r *redactor
+}
+
+func (m redactMarshaler) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	return m.ObjectMarshaler.MarshalLogObject(redactObjectEncoder{enc, m.r})
+}
+
+// redactObjectEncoder 脱敏写入的字符串
+type redactObjectEncoder struct {
+	zapcore.ObjectEncoder
+	r *redactor
+}
+
+func (enc redactObjectEncoder) AddString(key, value string) {
+	enc.ObjectEncoder.AddString(key, enc.r.redactString(key, value))
+}
+
+func (enc redactObjectEncoder) AddByteString(key string, value []byte) {
+	enc.ObjectEncoder.AddString(key, enc.r.redactString(key, string(value)))
+}
+
+func (enc redactObjectEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	return enc.ObjectEncoder.AddObject(key, redactMarshaler{obj, enc.r})
+}
+
+// redactEncoder 包装Encoder，With和每条日志的字段都先脱敏
+type redactEncoder struct {
+	zapcore.Encoder
+	r *redactor
+}
+
+// withRedaction keys非空时包装enc
+func withRedaction(enc zapcore.Encoder, keys []string) zapcore.Encoder {
+	r := newRedactor(keys)
+	if r == nil {
+		return enc
+	}
+	return redactEncoder{enc, r}
+}
+
+func (enc redactEncoder) Clone() zapcore.Encoder {
+	return redactEncoder{enc.Encoder.Clone(), enc.r}
+}
+
+func (enc redactEncoder) AddString(key, value string) {
+	enc.Encoder.AddString(key, enc.r.redactString(key, value))
+}
+
+func (enc redactEncoder) AddByteString(key string, value []byte) {
+	enc.Encoder.AddString(key, enc.r.redactString(key, string(value)))
+}
+
+func (enc redactEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	return enc.Encoder.AddObject(key, redactMarshaler{obj, enc.r})
+}
+
+func (enc redactEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	return enc.Encoder.EncodeEntry(ent, enc.r.redactFields(fields))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+)
+
+// redactKeys 测试使用的脱敏配置
+var redactKeys = []string{"password", "Token", "authorization", "*_secret", "x-api-*"}
+
+func TestRedactorMatch(t *testing.T) {
+	r := newRedactor(redactKeys)
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{key: "password", want: true},
+		{key: "PASSWORD", want: true},
+		{key: "token", want: true},
+		{key: "Authorization", want: true},
+		{key: "client_secret", want: true},
+		{key: "CLIENT_SECRET", want: true},
+		{key: "x-api-key", want: true},
+		{key: "secret", want: false},
+		{key: "password_hint", want: false},
+		{key: "user", want: false},
+	}
+	for _, tt := range tests {
+		if got := r.match(tt.key); got != tt.want {
+			t.Errorf("match(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+	if newRedactor(nil) != nil {
+		t.Error("no keys should disable redaction")
+	}
+}
+
+func TestRedactionEncoders(t *testing.T) {
+	tests := []struct {
+		encoding string
+		want     string
+	}{
+		{
+			encoding: EncodingJSON,
+			want: `{"level":"INFO","ts":"2024-05-17T10:00:00.000Z","msg":"hello","user":"alice","password":"[REDACTED]",` +
+				`"obj":{"password":"[REDACTED]","nested":{"db_secret":"[REDACTED]","host":"db1"}},` +
+				`"auth":{"Token":"[REDACTED]","client_secret":"[REDACTED]","scope":"read"}}`,
+		},
+		{
+			encoding: EncodingConsole,
+			want: "2024-05-17T10:00:00.000Z\tINFO\thello\t" + `{"user": "alice", "password": "[REDACTED]", ` +
+				`"obj": {"password": "[REDACTED]", "nested": {"db_secret": "[REDACTED]", "host": "db1"}}, ` +
+				`"auth": {"Token": "[REDACTED]", "client_secret": "[REDACTED]", "scope": "read"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			cfg := defaultLogConfig()
+			cfg.Encoding = tt.encoding
+			cfg.TimeZone = "utc"
+			cfg.DisableCaller = true
+			cfg.RedactKeys = redactKeys
+			got := encodeLine(t, cfg,
+				zap.String("user", "alice"),
+				zap.String("password", "hunter2"),
+				zap.Object("obj", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+					enc.AddString("password", "hunter2")
+					return enc.AddObject("nested", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+						enc.AddString("db_secret", "x")
+						enc.AddString("host", "db1")
+						return nil
+					}))
+				})),
+				zap.Namespace("auth"),
+				zap.String("Token", "abc"),
+				zap.ByteString("client_secret", []byte("s3cr3t")),
+				zap.String("scope", "read"),
+			)
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactionWithFields(t *testing.T) {
+	out := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingJSON
+	cfg.RedactKeys = redactKeys
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.With(zap.String("token", "abc")).Info("hello")
+	if got := out.String(); strings.Contains(got, "abc") || !strings.Contains(got, `"token":"[REDACTED]"`) {
+		t.Errorf("With fields should be redacted: %s", got)
+	}
+}
+
+func TestRedactionGinLoggerQuery(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Encoding = EncodingJSON
+	cfg.RedactKeys = redactKeys
+	cfg.Filename = ""
+	out := &zaptest.Buffer{}
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveGin(http.MethodGet, "/login?user=alice&token=abc&PassWord=x&api_secret=s&page=2", MustGinLoggerWithConfig(l, GinLoggerConfig{}))
+	want := `"query":"user=alice&token=[REDACTED]&PassWord=[REDACTED]&api_secret=[REDACTED]&page=2"`
+	if got := out.String(); !strings.Contains(got, want) {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestRedactionGinRecoveryAuthorization(t *testing.T) {
+	out := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingJSON
+	cfg.RedactKeys = redactKeys
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(GinRecovery(l, false))
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+	req := httptest.NewRequest(http.MethodGet, "/panic?token=abc&x=1", nil)
+	req.Header.Set("Authorization", "Bearer abc.def")
+	req.Header.Set("X-Api-Key", "k123")
+	req.Header.Set("Accept", "text/plain")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := out.String()
+	for _, secret := range []string{"Bearer", "abc.def", "k123", "token=abc"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("%q leaked into the dumped request: %s", secret, got)
+		}
+	}
+	for _, want := range []string{
+		`GET /panic?token=[REDACTED]&x=1 HTTP/1.1`,
+		`Authorization: [REDACTED]\r\n`,
+		`X-Api-Key: [REDACTED]\r\n`,
+		`Accept: text/plain\r\n`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("dumped request missing %q: %s", want, got)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+/*
+=============================================================
+热加载日志配置
+运维修改配置文件调高/调低日志级别时，服务不需要重启。
+WatchConfigFile监听InitLoggerFromFile使用的配置文件，文件变化后：
+1. 通过AtomicLevel立即应用新的日志级别；
+2. 文件名或切割配置变化时按新配置重建日志文件的writer（见fileWriteSyncer.swap）：大小阈值、备份数量和总大小、
+   压缩方式、manifest、文件权限、FilenamePattern和按时间切割都会生效，旧文件在reloadGracePeriod之后关闭。
+编码、模式、ErrorFile、缓冲/异步/重试以及syslog等其他输出需要重新初始化才能生效。
+新配置解析失败时记录一条Error日志，继续使用旧配置。
+*/
+
+// reloadGracePeriod 替换writer之后，延迟关闭旧writer的时间
+const reloadGracePeriod = 5 * time.Second
+
+// WatchConfigFile 监听配置文件path，变化时重新加载全局logger的配置，需要在InitLoggerFromFile之后调用。
+// 监听的是所在目录，编辑器先写临时文件再rename的保存方式也能触发。返回的stop用于停止监听
+func WatchConfigFile(path string) (stop func() error, err error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	path = filepath.Clean(path)
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	go func() {
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) == path && ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					_ = reloadConfigFile(path)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				currentLogger().Error("watch log config failed", zap.String("path", path), zap.Error(err))
+			}
+		}
+	}()
+	return watcher.Close, nil
+}
+
+// reloadConfigFile 重新读取配置文件并应用到全局logger，失败时保留旧配置并记录Error日志
+func reloadConfigFile(path string) error {
+	l := currentLogger()
+	cfg, err := loadLogConfigFile(path)
+	if err == nil {
+		cfg = applyFlagOverrides(applyEnvOverrides(cfg))
+		cfg.Filename, err = resolveLogPath(cfg.Filename, cfg.BaseDir)
+	}
+	if err == nil {
+		cfg, err = cfg.resolveFilenamePattern(defaultClock)
+	}
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		l.Error("reload log config failed, keep the old config", zap.String("path", path), zap.Error(err))
+		return err
+	}
+	if err := applyReloadedConfig(cfg); err != nil {
+		l.Error("apply reloaded log config failed", zap.String("path", path), zap.Error(err))
+		return err
+	}
+	l.Info("log config reloaded", zap.String("path", path), zap.String("level", cfg.Level))
+	return nil
+}
+
+// applyReloadedConfig 应用新的级别，文件或切割配置变化时按新配置重建日志文件的writer
+func applyReloadedConfig(cfg LogConfig) error {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+
+	globalMu.Lock()
+	var file *fileWriteSyncer
+	if globalBuilt != nil {
+		file = globalBuilt.file
+	}
+	atom := globalLevel
+	globalMu.Unlock()
+
+	if file != nil && cfg.Filename != "" {
+		if !file.sameSettings(cfg) {
+			if err := prepareLogFile(cfg); err != nil {
+				return fmt.Errorf("switch log file: %v", err)
+			}
+			closeOld, err := file.swap(cfg)
+			if err != nil {
+				return fmt.Errorf("switch log file: %v", err)
+			}
+			if closeOld != nil {
+				time.AfterFunc(reloadGracePeriod, func() { _ = closeOld() })
+			}
+		}
+	}
+	atom.SetLevel(level)
+	return nil
+}
+
+// currentLogger 返回当前的全局logger
+func currentLogger() *zap.Logger {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	return logger
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// writeConfig 写入配置文件，内容用YAML
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// replaceConfig 像编辑器一样先写临时文件再改名，监听时不会读到写了一半的配置
+func replaceConfig(t *testing.T, path, content string) {
+	t.Helper()
+	writeConfig(t, path+".tmp", content)
+	if err := os.Rename(path+".tmp", path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// initFromConfigFile 在临时目录下写入配置文件并用它初始化全局logger，返回目录和配置文件路径
+func initFromConfigFile(t *testing.T, content string) (dir, path string) {
+	t.Helper()
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	dir = tempDir(t)
+	path = filepath.Join(dir, "log.yaml")
+	writeConfig(t, path, strings.Replace(content, "$DIR", dir, -1))
+	if err := InitLoggerFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	return dir, path
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	dir, path := initFromConfigFile(t, "filename: $DIR/a.log\nlevel: info\nencoding: json\n")
+	stop, err := WatchConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	oldFile, newFile := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")
+
+	logger.Debug("debug before reload")
+	replaceConfig(t, path, "filename: "+newFile+"\nlevel: debug\nencoding: json\n")
+	waitFor(t, 5*time.Second, "the new level", func() bool { return Level().Level() == zapcore.DebugLevel })
+	logger.Debug("debug after reload")
+
+	if out := readFile(t, oldFile); strings.Contains(out, "debug before reload") || strings.Contains(out, "debug after reload") {
+		t.Errorf("old file:\n%s", out)
+	}
+	if out := readFile(t, newFile); !strings.Contains(out, "debug after reload") {
+		t.Errorf("new entries should land in the new file:\n%s", out)
+	}
+
+	// 解析失败时记录Error日志，保留旧的级别
+	replaceConfig(t, path, "filename: "+newFile+"\nlevel: [warn\n")
+	waitFor(t, 5*time.Second, "the reload error", func() bool {
+		return strings.Contains(readFile(t, newFile), "reload log config failed")
+	})
+	if Level().Level() != zapcore.DebugLevel {
+		t.Errorf("level = %v after a malformed config, want debug kept", Level().Level())
+	}
+	lines := readLines(t, newFile)
+	last := lines[len(lines)-1]
+	if !strings.Contains(last, `"level":"ERROR"`) || !strings.Contains(last, "keep the old config") {
+		t.Errorf("last entry = %s, want an error about the malformed config", last)
+	}
+}
+
+func TestReloadRejectsInvalidLevel(t *testing.T) {
+	dir, path := initFromConfigFile(t, "filename: $DIR/app.log\nlevel: warn\n")
+	writeConfig(t, path, "filename: "+filepath.Join(dir, "app.log")+"\nlevel: loud\n")
+	if err := reloadConfigFile(path); err == nil {
+		t.Fatal("an unknown level should be rejected")
+	}
+	if Level().Level() != zapcore.WarnLevel {
+		t.Errorf("level = %v, want warn kept", Level().Level())
+	}
+	if out := readFile(t, filepath.Join(dir, "app.log")); !strings.Contains(out, "reload log config failed") {
+		t.Errorf("log file:\n%s", out)
+	}
+}
+
+func TestReloadRebuildsRotationSettings(t *testing.T) {
+	dir, path := initFromConfigFile(t, "filename: $DIR/app.log\nlevel: debug\nencoding: json\n")
+	logFile := filepath.Join(dir, "app.log")
+	writeConfig(t, path, "filename: "+logFile+"\nlevel: debug\nencoding: json\n"+
+		"max_size_bytes: 1024\ncompression: zstd\nmax_total_size_mb: 10\nfile_mode: 0600\n")
+	if err := reloadConfigFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	before := Stats()
+	for i := 0; i < 30; i++ {
+		logger.Info("entry after reload", zap.String("pad", strings.Repeat("x", 100)))
+	}
+	globalMu.Lock()
+	file := globalBuilt.file
+	globalMu.Unlock()
+	file.backups.wait()
+
+	// 同一毫秒内切出的备份同名，按切割次数判断
+	if got := statsSince(before); got.Rotations < 2 {
+		t.Fatalf("Rotations = %d, the reloaded MaxSizeBytes should rotate at 1KB", got.Rotations)
+	}
+	backups := backupFiles(t, dir, "app-", "app.log")
+	if len(backups) == 0 {
+		t.Fatal("no backups after reloading MaxSizeBytes")
+	}
+	for _, b := range backups {
+		if !strings.HasSuffix(b, ".zst") {
+			t.Errorf("backup %s is not zstd-compressed after reloading compression", filepath.Base(b))
+		}
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(logFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("file mode = %v, want the reloaded 0600", info.Mode().Perm())
+		}
+	}
+}
+
+func TestReloadFilenamePattern(t *testing.T) {
+	dir, path := initFromConfigFile(t, "filename: $DIR/app.log\nlevel: debug\n")
+	writeConfig(t, path, "filename_pattern: "+filepath.Join(dir, "app-%Y-%m-%d.log")+"\nlevel: debug\n")
+	if err := reloadConfigFile(path); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("into the dated file")
+	dated := filepath.Join(dir, "app-"+time.Now().Format("2006-01-02")+".log")
+	if out := readFile(t, dated); !strings.Contains(out, "into the dated file") {
+		t.Errorf("dated file %s:\n%s", filepath.Base(dated), out)
+	}
+}
+
+func TestReloadSameSettingsKeepsFile(t *testing.T) {
+	dir, path := initFromConfigFile(t, "filename: $DIR/app.log\nlevel: debug\n")
+	globalMu.Lock()
+	file := globalBuilt.file
+	globalMu.Unlock()
+	file.mu.Lock()
+	lj := file.lj
+	file.mu.Unlock()
+
+	writeConfig(t, path, "filename: "+filepath.Join(dir, "app.log")+"\nlevel: info\n")
+	if err := reloadConfigFile(path); err != nil {
+		t.Fatal(err)
+	}
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	if file.lj != lj {
+		t.Error("only the level changed, the file should not be reopened")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+结构化的请求字段
+GinRecovery原来用httputil.DumpRequest把整个请求转成字符串，慢而且不好检索。
+RequestField把请求输出为嵌套对象：method、url、proto、host、remote_addr、content_length和header，
+header中Authorization、Cookie等默认不输出。
+*/
+
+// defaultSkipHeaders RequestField默认不输出的header
+var defaultSkipHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "Set-Cookie"}
+
+// RequestField 把r输出为名为request的对象字段，不输出defaultSkipHeaders中的header
+func RequestField(r *http.Request) zap.Field {
+	return RequestFieldSkipping(r, defaultSkipHeaders...)
+}
+
+// RequestFieldSkipping 同RequestField，不输出skipHeaders中的header（不区分大小写）
+func RequestFieldSkipping(r *http.Request, skipHeaders ...string) zap.Field {
+	return zap.Object(requestFieldKey, requestMarshaler{r, skipHeaders})
+}
+
+// requestMarshaler 实现zapcore.ObjectMarshaler
+type requestMarshaler struct {
+	r    *http.Request
+	skip []string
+}
+
+func (m requestMarshaler) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("method", m.r.Method)
+	enc.AddString("url", m.r.URL.String())
+	enc.AddString("proto", m.r.Proto)
+	enc.AddString("host", m.r.Host)
+	enc.AddString("remote_addr", m.r.RemoteAddr)
+	enc.AddInt64("content_length", m.r.ContentLength)
+	return enc.AddObject("header", headerMarshaler{m.r.Header, m.skip})
+}
+
+// headerMarshaler 按header名排序输出，同名的多个值用", "连接
+type headerMarshaler struct {
+	h    http.Header
+	skip []string
+}
+
+func (m headerMarshaler) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	names := make([]string, 0, len(m.h))
+	for name := range m.h {
+		if !m.skipped(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		enc.AddString(name, strings.Join(m.h[name], ", "))
+	}
+	return nil
+}
+
+func (m headerMarshaler) skipped(name string) bool {
+	for _, s := range m.skip {
+		if strings.EqualFold(s, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+)
+
+// newTestRequest 带有敏感header的POST请求
+func newTestRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "http://api.example.com/orders?id=7", strings.NewReader("body"))
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Cookie", "session=secret")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Add("Accept", "text/plain")
+	req.Header.Add("Accept", "application/json")
+	return req
+}
+
+func TestRequestFieldStructure(t *testing.T) {
+	enc := zapcore.NewMapObjectEncoder()
+	RequestField(newTestRequest()).AddTo(enc)
+
+	want := map[string]interface{}{
+		"method":         http.MethodPost,
+		"url":            "http://api.example.com/orders?id=7",
+		"proto":          "HTTP/1.1",
+		"host":           "api.example.com",
+		"remote_addr":    "10.0.0.1:1234",
+		"content_length": int64(4),
+		"header": map[string]interface{}{
+			"Accept":       "text/plain, application/json",
+			"Content-Type": "application/json",
+		},
+	}
+	if got := enc.Fields[requestFieldKey]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+}
+
+func TestRequestFieldSkipping(t *testing.T) {
+	enc := zapcore.NewMapObjectEncoder()
+	RequestFieldSkipping(newTestRequest(), "content-type", "ACCEPT").AddTo(enc)
+
+	header := enc.Fields[requestFieldKey].(map[string]interface{})["header"]
+	want := map[string]interface{}{
+		"Authorization": "Bearer secret",
+		"Cookie":        "session=secret",
+	}
+	if !reflect.DeepEqual(header, want) {
+		t.Errorf("header = %v, want %v (skip list replaces the defaults, case-insensitive)", header, want)
+	}
+}
+
+func TestGinRecoveryStructuredRequestJSON(t *testing.T) {
+	out := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingJSON
+	cfg.TimeZone = "utc"
+	cfg.DisableCaller = true
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out), WithClock(NewManualClock(fixedTime)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(GinRecoveryWithConfig(l, GinRecoveryConfig{StructuredRequest: true}))
+	r.POST("/orders", func(c *gin.Context) { panic("boom") })
+	r.ServeHTTP(httptest.NewRecorder(), newTestRequest())
+
+	want := `{"level":"ERROR","ts":"2024-05-17T10:00:00.000Z","msg":"[Recovery from panic]","error":"boom",` +
+		`"request":{"method":"POST","url":"http://api.example.com/orders?id=7","proto":"HTTP/1.1","host":"api.example.com",` +
+		`"remote_addr":"10.0.0.1:1234","content_length":4,"header":{"Accept":"text/plain, application/json",` +
+		`"Content-Type":"application/json"}}}`
+	if got := strings.TrimSpace(out.String()); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestGinRecoveryDumpRequestByDefault(t *testing.T) {
+	l, logs := newObservedLogger(t)
+	r := gin.New()
+	r.Use(GinRecovery(l, false))
+	r.POST("/orders", func(c *gin.Context) { panic("boom") })
+	r.ServeHTTP(httptest.NewRecorder(), newTestRequest())
+
+	request, ok := logs.All()[0].ContextMap()[requestFieldKey].(string)
+	if !ok || !strings.HasPrefix(request, "POST http://api.example.com/orders?id=7 HTTP/1.1\r\n") {
+		t.Errorf("without StructuredRequest the request is the DumpRequest string, got %v", logs.All()[0].ContextMap()[requestFieldKey])
+	}
+}
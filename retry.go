@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+写入失败时有限次重试
+一次EINTR或者只写了一部分就丢掉整条日志不划算。配置Retry后，写日志文件遇到EINTR、EAGAIN
+或者只写了一部分时，等Backoff（每次翻倍）之后重试，最多MaxRetries次；只写了一部分时只补写剩下的字节，
+不会重复写入，补写时也不检查切割，一条日志不会被分到两个文件中。ENOSPC、EBADF以及其他错误不重试。
+重试次数和最终丢失的条数见WriteRetries和WriteLost。
+*/
+
+// 重试的默认值
+const (
+	defaultRetryMaxRetries = 3
+	defaultRetryBackoff    = 10 * time.Millisecond
+)
+
+// RetryConfig 写入失败时重试的配置，为0的项使用默认值
+type RetryConfig struct {
+	MaxRetries int           `yaml:"max_retries" json:"max_retries"` // 每条日志最多重试的次数，默认3
+	Backoff    time.Duration `yaml:"backoff" json:"backoff"`         // 第一次重试前等待的时间，之后每次翻倍，默认10ms
+}
+
+func (r RetryConfig) validate() error {
+	if r.MaxRetries < 0 {
+		return fmt.Errorf("log config: retry max retries must not be negative, got %d", r.MaxRetries)
+	}
+	if r.Backoff < 0 {
+		return fmt.Errorf("log config: retry backoff must not be negative, got %s", r.Backoff)
+	}
+	return nil
+}
+
+func (r RetryConfig) withDefaults() RetryConfig {
+	if r.MaxRetries == 0 {
+		r.MaxRetries = defaultRetryMaxRetries
+	}
+	if r.Backoff == 0 {
+		r.Backoff = defaultRetryBackoff
+	}
+	return r
+}
+
+// writeRetries 所有重试的次数，writeLost 重试之后仍然没有写完的日志条数
+var writeRetries, writeLost uint64
+
+// WriteRetries 返回到目前为止写日志文件重试的次数
+func WriteRetries() uint64 {
+	return atomic.LoadUint64(&writeRetries)
+}
+
+// WriteLost 返回到目前为止写日志文件最终失败（包括不重试的错误）的日志条数
+func WriteLost() uint64 {
+	return atomic.LoadUint64(&writeLost)
+}
+
+// retryableWriteError 判断写入错误是否值得重试
+func retryableWriteError(err error) bool {
+	switch {
+	case errors.Is(err, syscall.ENOSPC), errors.Is(err, syscall.EBADF):
+		return false
+	case errors.Is(err, syscall.EINTR), errors.Is(err, syscall.EAGAIN), errors.Is(err, io.ErrShortWrite):
+		return true
+	}
+	return false
+}
+
+// restWriter 只写了一部分之后能补写同一条日志剩下字节的WriteSyncer，补写时不切割文件，见fileWriteSyncer.writeRest
+type restWriter interface {
+	writeRest(p []byte) (int, error)
+}
+
+// retryWriteSyncer 写入ws失败时按RetryConfig重试
+type retryWriteSyncer struct {
+	mu    sync.Mutex // 重试期间不能让别的日志写进来，否则半条日志和另一条日志交错
+	ws    zapcore.WriteSyncer
+	cfg   RetryConfig
+	sleep func(time.Duration)
+}
+
+func newRetryWriteSyncer(ws zapcore.WriteSyncer, cfg RetryConfig) *retryWriteSyncer {
+	return &retryWriteSyncer{ws: ws, cfg: cfg.withDefaults(), sleep: time.Sleep}
+}
+
+// Write 写入p，只写了一部分时从没写完的位置继续，返回实际写入的字节数
+func (r *retryWriteSyncer) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	written := 0
+	backoff := r.cfg.Backoff
+	for retries := 0; ; retries++ {
+		var n int
+		var err error
+		if rw, ok := r.ws.(restWriter); ok && written > 0 {
+			n, err = rw.writeRest(p[written:])
+		} else {
+			n, err = r.ws.Write(p[written:])
+		}
+		written += n
+		if err == nil && written < len(p) {
+			err = io.ErrShortWrite
+		}
+		if err == nil {
+			return written, nil
+		}
+		if retries >= r.cfg.MaxRetries || !retryableWriteError(err) {
+			atomic.AddUint64(&writeLost, 1)
+			return written, err
+		}
+		atomic.AddUint64(&writeRetries, 1)
+		r.sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (r *retryWriteSyncer) Sync() error {
+	return r.ws.Sync()
+}
+
+// enableRetry 按cfg在w外面包一层重试，需要在enableBuffer之前调用，缓冲写文件时也会重试
+func (w *fileWriteSyncer) enableRetry(cfg LogConfig) {
+	if cfg.Retry == nil {
+		return
+	}
+	w.retry = newRetryWriteSyncer(w, *cfg.Retry)
+}
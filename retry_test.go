@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// writeStep scriptedWriteSyncer一次Write的结果：写入前n个字节并返回err
+type writeStep struct {
+	n   int
+	err error
+}
+
+// scriptedWriteSyncer 按steps依次返回结果，steps用完之后总是全部写入
+type scriptedWriteSyncer struct {
+	steps []writeStep
+	calls int
+	out   []byte
+}
+
+func (s *scriptedWriteSyncer) Write(p []byte) (int, error) {
+	s.calls++
+	if len(s.steps) == 0 {
+		s.out = append(s.out, p...)
+		return len(p), nil
+	}
+	step := s.steps[0]
+	s.steps = s.steps[1:]
+	s.out = append(s.out, p[:step.n]...)
+	return step.n, step.err
+}
+
+func (s *scriptedWriteSyncer) Sync() error { return nil }
+
+func TestRetryWriteSyncer(t *testing.T) {
+	pathErr := func(errno syscall.Errno) error {
+		return &os.PathError{Op: "write", Path: "/var/log/app.log", Err: errno}
+	}
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name        string
+		steps       []writeStep
+		wantOut     string
+		wantErr     error
+		wantRetries uint64
+		wantLost    uint64
+	}{
+		{name: "no error", wantOut: "hello world"},
+		{name: "EINTR", steps: []writeStep{{0, syscall.EINTR}}, wantOut: "hello world", wantRetries: 1},
+		{name: "wrapped EAGAIN", steps: []writeStep{{0, pathErr(syscall.EAGAIN)}, {0, pathErr(syscall.EAGAIN)}}, wantOut: "hello world", wantRetries: 2},
+		{name: "short write", steps: []writeStep{{3, nil}, {4, nil}}, wantOut: "hello world", wantRetries: 2},
+		{name: "partial write with EINTR", steps: []writeStep{{5, syscall.EINTR}}, wantOut: "hello world", wantRetries: 1},
+		{name: "ENOSPC", steps: []writeStep{{2, pathErr(syscall.ENOSPC)}}, wantOut: "he", wantErr: syscall.ENOSPC, wantLost: 1},
+		{name: "EBADF", steps: []writeStep{{0, syscall.EBADF}}, wantErr: syscall.EBADF, wantLost: 1},
+		{name: "other error", steps: []writeStep{{0, errBoom}}, wantErr: errBoom, wantLost: 1},
+		{
+			name:        "retries exhausted",
+			steps:       []writeStep{{1, syscall.EINTR}, {1, syscall.EINTR}, {1, syscall.EINTR}, {1, syscall.EINTR}},
+			wantOut:     "hell",
+			wantErr:     syscall.EINTR,
+			wantRetries: 3,
+			wantLost:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := &scriptedWriteSyncer{steps: tt.steps}
+			r := newRetryWriteSyncer(ws, RetryConfig{MaxRetries: 3, Backoff: time.Millisecond})
+			var sleeps []time.Duration
+			r.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+			retriesBefore, lostBefore := WriteRetries(), WriteLost()
+
+			n, err := r.Write([]byte("hello world"))
+			if string(ws.out) != tt.wantOut || n != len(tt.wantOut) {
+				t.Errorf("wrote %q (n = %d), want %q", ws.out, n, tt.wantOut)
+			}
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := WriteRetries() - retriesBefore; got != tt.wantRetries {
+				t.Errorf("WriteRetries() grew by %d, want %d", got, tt.wantRetries)
+			}
+			if got := WriteLost() - lostBefore; got != tt.wantLost {
+				t.Errorf("WriteLost() grew by %d, want %d", got, tt.wantLost)
+			}
+			var wantSleeps []time.Duration
+			for i, d := uint64(0), time.Millisecond; i < tt.wantRetries; i, d = i+1, d*2 {
+				wantSleeps = append(wantSleeps, d)
+			}
+			if fmt.Sprint(sleeps) != fmt.Sprint(wantSleeps) {
+				t.Errorf("backoff = %v, want %v", sleeps, wantSleeps)
+			}
+		})
+	}
+}
+
+// 第一条只写了一部分、正在退避时，另一条日志不能写进来，否则文件里是半条日志接着另一条日志
+func TestRetryWriteSyncerHoldsLockWhileRetrying(t *testing.T) {
+	ws := &scriptedWriteSyncer{steps: []writeStep{{6, nil}}}
+	r := newRetryWriteSyncer(ws, RetryConfig{})
+	backingOff := make(chan struct{})
+	release := make(chan struct{})
+	r.sleep = func(time.Duration) {
+		close(backingOff)
+		<-release
+	}
+	first := make(chan struct{})
+	go func() {
+		r.Write([]byte("first line\n"))
+		close(first)
+	}()
+	<-backingOff
+
+	second := make(chan struct{})
+	go func() {
+		r.Write([]byte("second line\n"))
+		close(second)
+	}()
+	select {
+	case <-second:
+		t.Fatal("second Write finished while the first one was still retrying")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-first
+	<-second
+	if got := string(ws.out); got != "first line\nsecond line\n" {
+		t.Errorf("out = %q, want whole lines", got)
+	}
+}
+
+// shortFileWriteSyncer 第一次Write只把前short个字节交给文件，模拟只写了一部分
+type shortFileWriteSyncer struct {
+	*fileWriteSyncer
+	short int
+}
+
+func (s *shortFileWriteSyncer) Write(p []byte) (int, error) {
+	if s.short > 0 && s.short < len(p) {
+		p, s.short = p[:s.short], 0
+	}
+	return s.fileWriteSyncer.Write(p)
+}
+
+// 补写剩下的字节时不能按大小切割，否则一条日志的前半截在备份里、后半截在新文件里
+func TestRetryShortWriteDoesNotRotateMidEntry(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.MaxSizeBytes = 100
+	cfg.MaxBackups = 0
+	cfg.MaxAge = 0
+	w, err := openFileWriteSyncer(cfg, NewManualClock(fixedTime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	r := newRetryWriteSyncer(&shortFileWriteSyncer{fileWriteSyncer: w, short: 50}, RetryConfig{})
+	r.sleep = func(time.Duration) {}
+
+	// 空文件中写入超过阈值的一条日志，只写了50个字节之后补写
+	entry := strings.Repeat("x", 149) + "\n"
+	if n, err := r.Write([]byte(entry)); n != len(entry) || err != nil {
+		t.Fatalf("Write() = %d, %v", n, err)
+	}
+	if got := readFile(t, cfg.Filename); got != entry {
+		t.Errorf("log file = %q, want the whole entry", got)
+	}
+	if backups := backupFiles(t, filepath.Dir(cfg.Filename), "test-", "test.log"); len(backups) != 0 {
+		t.Errorf("backups = %v, the entry should not be split across files", backups)
+	}
+
+	// 下一条日志照常按大小切割
+	if _, err := r.Write([]byte("next\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, cfg.Filename); got != "next\n" {
+		t.Errorf("log file after the next entry = %q", got)
+	}
+}
+
+func TestRetryableWriteError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{syscall.EINTR, true},
+		{syscall.EAGAIN, true},
+		{fmt.Errorf("write: %w", syscall.EAGAIN), true},
+		{errors.New("short write"), false},
+		{syscall.ENOSPC, false},
+		{&os.PathError{Op: "write", Err: syscall.EBADF}, false},
+		{os.ErrClosed, false},
+	}
+	for _, tt := range tests {
+		if got := retryableWriteError(tt.err); got != tt.want {
+			t.Errorf("retryableWriteError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryConfigDefaults(t *testing.T) {
+	if got := (RetryConfig{}).withDefaults(); got.MaxRetries != defaultRetryMaxRetries || got.Backoff != defaultRetryBackoff {
+		t.Errorf("withDefaults() = %+v", got)
+	}
+	if err := (RetryConfig{MaxRetries: -1}).validate(); err == nil {
+		t.Error("negative MaxRetries should be rejected")
+	}
+	if err := (RetryConfig{Backoff: -time.Millisecond}).validate(); err == nil {
+		t.Error("negative Backoff should be rejected")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+=============================================================
+定点切割
+RotateDaily在过了零点之后的第一次写入时才切割，空闲的服务昨天的文件可能要到第二天上午才切出来，
+夜间的批处理拿不到完整的文件。配置RotateAt（如"00:00"，TimeZone时区）后，
+打开日志文件时启动一个goroutine，每天到点主动调用Rotate，Close时停止。
+- 每次触发后按当前时间重新计算下一次的时间，等待也按rotateAtMaxWait分段，系统时间跳变后不会错过或连续触发；
+- 到点前rotateAtSkipWindow之内刚按大小切割过、或者文件是空的时跳过这次，避免切出空的或几乎为空的文件。
+*/
+
+const (
+	rotateAtLayout      = "15:04"        // RotateAt的格式
+	rotateAtMaxWait     = time.Minute    // 每次最多等待这么久就重新检查时间
+	rotateAtSkipWindow  = time.Minute    // 这段时间内刚切割过时跳过定点切割
+	rotateAtMaxBackJump = 24 * time.Hour // 下一次切割比现在晚这么多说明时钟往回跳了，需要重新计算
+)
+
+// parseRotateAt 解析"15:04"格式的时间，返回时和分
+func parseRotateAt(s string) (hour, min int, err error) {
+	t, err := time.Parse(rotateAtLayout, strings.TrimSpace(s))
+	if err != nil {
+		return 0, 0, fmt.Errorf("log config: invalid rotate at %q, want HH:MM", s)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// scheduledRotation 每天在固定时刻切割
+type scheduledRotation struct {
+	clock     Clock
+	hour, min int
+	loc       *time.Location
+
+	// 以下字段由fileWriteSyncer.mu保护
+	max        int64     // lumberjack按大小切割的阈值
+	size       int64     // 当前文件的字节数，用来判断lumberjack是否刚按大小切割过
+	lastRotate time.Time // 上一次切割的时间
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newScheduledRotation 按cfg创建定点切割，没有配置RotateAt时返回nil
+func newScheduledRotation(cfg LogConfig, clock Clock) (*scheduledRotation, error) {
+	if cfg.RotateAt == "" {
+		return nil, nil
+	}
+	hour, min, err := parseRotateAt(cfg.RotateAt)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := loadTimeZone(cfg.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	s := &scheduledRotation{
+		clock: clock,
+		hour:  hour,
+		min:   min,
+		loc:   loc,
+		max:   cfg.maxSizeBytes(),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if info, err := os.Stat(cfg.Filename); err == nil {
+		s.size = info.Size()
+	}
+	return s, nil
+}
+
+// nextAfter 返回t之后的第一个切割时刻
+func (s *scheduledRotation) nextAfter(t time.Time) time.Time {
+	t = t.In(s.loc)
+	next := time.Date(t.Year(), t.Month(), t.Day(), s.hour, s.min, 0, 0, s.loc)
+	if !next.After(t) {
+		next = time.Date(t.Year(), t.Month(), t.Day()+1, s.hour, s.min, 0, 0, s.loc)
+	}
+	return next
+}
+
+// written 记录写入了n字节，与lumberjack的判断一致：超过max时lumberjack会先切割再写
+func (s *scheduledRotation) written(n int) {
+	if s.size+int64(n) > s.max {
+		s.rotated()
+	}
+	s.size += int64(n)
+}
+
+// rotated 记录发生了一次切割
+func (s *scheduledRotation) rotated() {
+	s.size = 0
+	s.lastRotate = s.clock.Now()
+}
+
+// recentlyRotated 判断是否刚切割过
+func (s *scheduledRotation) recentlyRotated() bool {
+	return !s.lastRotate.IsZero() && s.clock.Now().Sub(s.lastRotate) < rotateAtSkipWindow
+}
+
+// run 每天到点调用w.rotateScheduled，直到close
+func (s *scheduledRotation) run(w *fileWriteSyncer) {
+	defer close(s.done)
+	next := s.nextAfter(s.clock.Now())
+	for {
+		now := s.clock.Now()
+		if !now.Before(next) {
+			if err := w.rotateScheduled(s); err != nil {
+				w.reportError("scheduled log rotation failed", err)
+			}
+			next = s.nextAfter(s.clock.Now())
+			continue
+		}
+		if next.Sub(now) > rotateAtMaxBackJump {
+			next = s.nextAfter(now)
+		}
+		wait := next.Sub(now)
+		if wait > rotateAtMaxWait {
+			wait = rotateAtMaxWait
+		}
+		c, stopTimer := clockTimer(s.clock, wait)
+		select {
+		case <-c:
+		case <-s.stop:
+			stopTimer()
+			return
+		}
+	}
+}
+
+// close 停止goroutine并等待它退出，调用方不能持有fileWriteSyncer.mu
+func (s *scheduledRotation) close() {
+	close(s.stop)
+	<-s.done
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// pendingTimers 返回ManualClock上还没触发的定时器个数
+func pendingTimers(c *ManualClock) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// waitForScheduler 等待定点切割的goroutine处理完并重新开始等待
+func waitForScheduler(t *testing.T, c *ManualClock) {
+	t.Helper()
+	waitFor(t, 5*time.Second, "rotate-at goroutine to wait on the clock", func() bool { return pendingTimers(c) == 1 })
+}
+
+func TestRotateAtIdleService(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 5, 17, 23, 59, 30, 0, time.UTC))
+	b, cfg := newClockedFileLogger(t, clock, func(cfg *LogConfig) { cfg.RotateAt = "00:00" })
+	b.logger.Info("yesterday")
+	waitForScheduler(t, clock)
+
+	// 到点之前不切割
+	clock.Add(29 * time.Second)
+	waitForScheduler(t, clock)
+	if backups := logBackups(t, cfg); len(backups) != 0 {
+		t.Fatalf("rotated before 00:00: %v", backups)
+	}
+
+	// 没有任何写入，到点也要切割
+	clock.Add(time.Second)
+	waitFor(t, 5*time.Second, "scheduled rotation", func() bool { return len(logBackups(t, cfg)) == 1 })
+	if old := readFile(t, logBackups(t, cfg)[0]); !strings.Contains(old, "yesterday") {
+		t.Errorf("backup:\n%s", old)
+	}
+	if active := readFile(t, cfg.Filename); active != "" {
+		t.Errorf("active file should be empty after rotation:\n%s", active)
+	}
+}
+
+func TestRotateAtSurvivesClockJump(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 5, 17, 12, 0, 0, 0, time.UTC))
+	b, cfg := newClockedFileLogger(t, clock, func(cfg *LogConfig) { cfg.RotateAt = "03:30" })
+	b.logger.Info("before jump")
+	waitForScheduler(t, clock)
+
+	// 时钟往前跳了三天，只切割一次，不补切错过的几次
+	clock.Add(72 * time.Hour)
+	waitFor(t, 5*time.Second, "rotation after jump", func() bool { return len(logBackups(t, cfg)) == 1 })
+	waitForScheduler(t, clock)
+	b.logger.Info("after jump")
+	// lumberjack的备份文件名精确到毫秒，同一毫秒内切割两次会覆盖前一个备份
+	time.Sleep(2 * time.Millisecond)
+
+	// 触发后按跳变后的时间重新计算，下一次在第二天的03:30
+	clock.Add(15*time.Hour + 29*time.Minute)
+	waitForScheduler(t, clock)
+	if backups := logBackups(t, cfg); len(backups) != 1 {
+		t.Fatalf("rotated before the next 03:30: %v", backups)
+	}
+	clock.Add(time.Minute)
+	waitFor(t, 5*time.Second, "rotation at the recomputed time", func() bool { return len(logBackups(t, cfg)) == 2 })
+}
+
+func TestRotateAtSkipsAfterSizeRotation(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 5, 17, 23, 59, 30, 0, time.UTC))
+	b, cfg := newClockedFileLogger(t, clock, func(cfg *LogConfig) {
+		cfg.RotateAt = "00:00"
+		cfg.MaxSizeBytes = 300
+	})
+	waitForScheduler(t, clock)
+	for i := 0; i < 3; i++ {
+		b.logger.Info(strings.Repeat("x", 100))
+	}
+	sizeRotated := len(logBackups(t, cfg))
+	if sizeRotated == 0 {
+		t.Fatal("expected a size rotation")
+	}
+
+	// 30秒前刚按大小切割过，到点时跳过
+	clock.Add(30 * time.Second)
+	waitForScheduler(t, clock)
+	if got := len(logBackups(t, cfg)); got != sizeRotated {
+		t.Errorf("got %d backups, want %d: scheduled rotation should be skipped", got, sizeRotated)
+	}
+}
+
+func TestRotateAtStoppedByClose(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 5, 17, 23, 0, 0, 0, time.UTC))
+	b, cfg := newClockedFileLogger(t, clock, func(cfg *LogConfig) { cfg.RotateAt = "23:30" })
+	b.logger.Info("line")
+	waitForScheduler(t, clock)
+	b.close()
+	if n := pendingTimers(clock); n != 0 {
+		t.Errorf("Close should stop the goroutine and its timer, %d timers pending", n)
+	}
+	clock.Add(time.Hour)
+	if backups := logBackups(t, cfg); len(backups) != 0 {
+		t.Errorf("closed logger should not rotate, got %v", backups)
+	}
+}
+
+func TestParseRotateAt(t *testing.T) {
+	tests := []struct {
+		in        string
+		hour, min int
+		wantErr   bool
+	}{
+		{in: "00:00"},
+		{in: " 23:59 ", hour: 23, min: 59},
+		{in: "3:05", hour: 3, min: 5},
+		{in: "24:00", wantErr: true},
+		{in: "noon", wantErr: true},
+		{in: "12:00:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		hour, min, err := parseRotateAt(tt.in)
+		if (err != nil) != tt.wantErr || hour != tt.hour || min != tt.min {
+			t.Errorf("parseRotateAt(%q) = %d, %d, %v", tt.in, hour, min, err)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+// rotateBySelf 是否总是由fileWriteSyncer自己按大小切割，而不是交给lumberjack
+const rotateBySelf = false
+
+// rotateFileLocked 让lumberjack切割当前文件
+func (w *fileWriteSyncer) rotateFileLocked() error {
+	return w.lj.Rotate()
+}
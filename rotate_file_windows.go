@@ -0,0 +1,120 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/natefinch/lumberjack"
+)
+
+/*
+=============================================================
+Windows上的切割
+Windows上打开的文件不能改名，杀毒软件或者tail工具占着日志文件时lumberjack切割会失败：
+"The process cannot access the file because it is being used by another process"。
+这里总是自己按大小切割（rotateBySelf），并且自己用os.Rename改名：lumberjack返回的改名错误只保留了文字，
+errors.Is判断不出文件被占用。改名失败时每隔windowsRotateDelay重试，
+一直失败就把当前文件复制为备份再清空（copy+truncate），并把原因写到ErrorOutput。
+改名成功后由lumberjack打开新文件、压缩和清理备份；copy+truncate之后要等下一次正常切割才会处理这个备份。
+*/
+
+// rotateBySelf 是否总是由fileWriteSyncer自己按大小切割，而不是交给lumberjack
+const rotateBySelf = true
+
+// Windows上切割失败时的重试参数
+const (
+	windowsRotateAttempts = 5
+	windowsRotateDelay    = 100 * time.Millisecond
+)
+
+// 文件被其他进程占用时的错误码
+const (
+	errorAccessDenied     syscall.Errno = 5
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+// lumberjackBackupTimeFormat lumberjack备份文件名中的时间格式
+const lumberjackBackupTimeFormat = "2006-01-02T15-04-05.000"
+
+// fileInUse 判断err是否表示文件被其他进程占用
+func fileInUse(err error) bool {
+	return errors.Is(err, errorSharingViolation) || errors.Is(err, errorLockViolation) || errors.Is(err, errorAccessDenied)
+}
+
+// rotateFileLocked 把当前文件改名为lumberjack格式的备份，再让lumberjack打开新文件。
+// 文件被占用时重试，最后改为copy+truncate
+func (w *fileWriteSyncer) rotateFileLocked() error {
+	// 先关闭自己的句柄，之后的Write会重新打开
+	if err := w.lj.Close(); err != nil {
+		return err
+	}
+	name := w.lj.Filename
+	backup := lumberjackBackupName(w.lj, time.Now())
+	var err error
+	for attempt := 0; attempt < windowsRotateAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(windowsRotateDelay)
+		}
+		// 文件不存在时没有需要改名的，lumberjack直接新建
+		if err = os.Rename(name, backup); err == nil || os.IsNotExist(err) {
+			return w.lj.Rotate()
+		}
+		if !fileInUse(err) {
+			return err
+		}
+	}
+	w.reportError(fmt.Sprintf("rename %s for rotation failed, fall back to copy and truncate", name), err)
+	if err := copyTruncate(name, backup); err != nil {
+		return fmt.Errorf("rotate %s: %v", name, err)
+	}
+	return nil
+}
+
+// lumberjackBackupName 返回lj的文件在t时切割时lumberjack使用的备份文件名
+func lumberjackBackupName(lj *lumberjack.Logger, t time.Time) string {
+	if !lj.LocalTime {
+		t = t.UTC()
+	}
+	ext := filepath.Ext(lj.Filename)
+	return strings.TrimSuffix(lj.Filename, ext) + "-" + t.Format(lumberjackBackupTimeFormat) + ext
+}
+
+// copyTruncate 把name复制为backup后清空，下一次Write会重新打开这个已经清空的文件
+func copyTruncate(name, backup string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(backup, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Truncate(name, 0)
+}
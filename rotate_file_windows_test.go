@@ -0,0 +1,101 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+)
+
+// newWindowsFileLogger 构建写到临时文件的logger，后台错误写到返回的Buffer
+func newWindowsFileLogger(t *testing.T) (*builtLogger, LogConfig, *zaptest.Buffer) {
+	t.Helper()
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.Encoding = EncodingJSON
+	errOut := &zaptest.Buffer{}
+	b, err := newLogger(WithConfig(cfg), WithErrorOutput(errOut))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.close() })
+	return b, cfg, errOut
+}
+
+// holdFile 像tail工具一样打开path不关闭。Go在Windows上打开文件时不带FILE_SHARE_DELETE，其他进程不能改名
+func holdFile(t *testing.T, path string) *os.File {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestWindowsRenameErrorIsFileInUse(t *testing.T) {
+	path := writeTempFile(t, "held.log", "held\n")
+	holdFile(t, path)
+	err := os.Rename(path, path+".1")
+	if err == nil {
+		t.Fatal("rename of a held file should fail")
+	}
+	if !fileInUse(err) {
+		t.Errorf("fileInUse(%v) = false", err)
+	}
+}
+
+func TestWindowsRotateFallsBackToCopyTruncate(t *testing.T) {
+	b, cfg, errOut := newWindowsFileLogger(t)
+	b.logger.Info("before rotate")
+	holdFile(t, cfg.Filename)
+	before := InternalErrors()
+
+	if err := b.rotate(); err != nil {
+		t.Fatalf("rotate() = %v, want copy+truncate to succeed", err)
+	}
+	backups := logBackups(t, cfg)
+	if len(backups) != 1 || !strings.Contains(readFile(t, backups[0]), "before rotate") {
+		t.Fatalf("backups = %v, want one copy of the held file", backups)
+	}
+	if !strings.Contains(errOut.String(), "fall back to copy and truncate") || InternalErrors()-before != 1 {
+		t.Errorf("the fallback should be reported once, error output:\n%s", errOut.String())
+	}
+
+	b.logger.Info("after rotate")
+	active := readFile(t, cfg.Filename)
+	if strings.Contains(active, "before rotate") || !strings.Contains(active, "after rotate") {
+		t.Errorf("active file after copy+truncate:\n%s", active)
+	}
+}
+
+func TestWindowsRotateRetriesUntilReleased(t *testing.T) {
+	b, cfg, errOut := newWindowsFileLogger(t)
+	b.logger.Info("before rotate")
+	f := holdFile(t, cfg.Filename)
+	// 在第二次重试之前放开文件
+	go func() {
+		time.Sleep(windowsRotateDelay + windowsRotateDelay/2)
+		f.Close()
+	}()
+
+	if err := b.rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if errOut.String() != "" {
+		t.Errorf("rename succeeded after a retry, nothing should be reported:\n%s", errOut.String())
+	}
+	backups := logBackups(t, cfg)
+	if len(backups) != 1 || !strings.Contains(readFile(t, backups[0]), "before rotate") {
+		t.Fatalf("backups = %v", backups)
+	}
+	b.logger.Info("after rotate")
+	if active := readFile(t, cfg.Filename); strings.Contains(active, "before rotate") || !strings.Contains(active, "after rotate") {
+		t.Errorf("active file:\n%s", active)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/subtle"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+/*
+=============================================================
+切割日志的管理接口
+运维打包日志之前想先切出一个新文件，RotateHandler可以挂到如POST /admin/log/rotate上，
+切割全局logger的所有日志文件，返回每个文件新生成的备份和当前写入的文件：
+	{"files":[{"active":"/var/log/app.log","backup":"/var/log/app-2024-01-02T00-00-00.000.log"}]}
+请求必须带Authorization: Bearer <token>，否则返回401。
+*/
+
+// rotatedFile RotateHandler返回的一个日志文件的切割结果
+type rotatedFile struct {
+	Active string `json:"active"` // 切割后写入的文件
+	Backup string `json:"backup"` // 新生成的备份文件，没有找到时为空；开启压缩时随后会被压缩为Backup+".gz"或".zst"
+}
+
+// RotateHandler 切割全局logger的日志文件，token为空时拒绝所有请求
+func RotateHandler(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !bearerTokenValid(c.GetHeader("Authorization"), token) {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		globalMu.Lock()
+		b := globalBuilt
+		globalMu.Unlock()
+
+		files := []rotatedFile{}
+		if b != nil {
+			for _, f := range b.files {
+				active, backup, err := f.rotateAndFindBackup()
+				if err != nil {
+					currentLogger().Error("rotate log file by admin endpoint failed", zap.String("path", active), zap.Error(err))
+					c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				files = append(files, rotatedFile{Active: active, Backup: backup})
+			}
+		}
+		currentLogger().Info("log rotated by admin endpoint", zap.String("ip", c.ClientIP()))
+		c.JSON(http.StatusOK, gin.H{"files": files})
+	}
+}
+
+// bearerTokenValid 判断Authorization头是否为Bearer token，使用定长比较避免泄露token
+func bearerTokenValid(header, token string) bool {
+	const prefix = "Bearer "
+	if token == "" || len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(header[len(prefix):])), []byte(token)) == 1
+}
+
+// backupNames 返回filename所在目录中lumberjack生成的备份文件：name-<时间>.ext，压缩后再加.gz或.zst
+func backupNames(filename string) map[string]bool {
+	dir := filepath.Dir(filename)
+	ext := filepath.Ext(filename)
+	prefix := strings.TrimSuffix(filepath.Base(filename), ext) + "-"
+	names := make(map[string]bool)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return names
+	}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if strings.HasSuffix(trimCompressedSuffix(name), ext) {
+			names[filepath.Join(dir, name)] = true
+		}
+	}
+	return names
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveRotate 把RotateHandler(token)挂到POST /admin/log/rotate上，用authorization发一次请求
+func serveRotate(t *testing.T, token, authorization string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := gin.New()
+	r.POST("/admin/log/rotate", RotateHandler(token))
+	req := httptest.NewRequest(http.MethodPost, "/admin/log/rotate", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRotateHandlerUnauthorized(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	if _, _, err := InitLoggerWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+	}{
+		{name: "no header", token: "s3cret"},
+		{name: "wrong token", token: "s3cret", authorization: "Bearer wrong"},
+		{name: "token prefix", token: "s3cret", authorization: "Bearer s3c"},
+		{name: "not bearer", token: "s3cret", authorization: "Basic s3cret"},
+		{name: "empty token rejects all", token: "", authorization: "Bearer "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveRotate(t, tt.token, tt.authorization)
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want 401", w.Code)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q", got)
+			}
+		})
+	}
+	if backups := logBackups(t, cfg); len(backups) != 0 {
+		t.Errorf("unauthorized requests must not rotate, got %v", backups)
+	}
+}
+
+func TestRotateHandlerAuthorized(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	if _, _, err := InitLoggerWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("before rotate")
+
+	w := serveRotate(t, "s3cret", "bearer s3cret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Files []rotatedFile `json:"files"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	if len(resp.Files) != 1 {
+		t.Fatalf("files = %+v, want 1", resp.Files)
+	}
+	got := resp.Files[0]
+	if got.Active != cfg.Filename {
+		t.Errorf("active = %q, want %q", got.Active, cfg.Filename)
+	}
+	backups := logBackups(t, cfg)
+	if len(backups) != 1 || got.Backup != backups[0] {
+		t.Fatalf("backup = %q, files on disk %v", got.Backup, backups)
+	}
+	if _, err := os.Stat(got.Backup); err != nil {
+		t.Fatal(err)
+	}
+	if out := readFile(t, got.Backup); !strings.Contains(out, "before rotate") {
+		t.Errorf("backup:\n%s", out)
+	}
+	_ = logger.Sync()
+	if out := readFile(t, cfg.Filename); !strings.Contains(out, "log rotated by admin endpoint") || strings.Contains(out, "before rotate") {
+		t.Errorf("active file:\n%s", out)
+	}
+}
+
+func TestRotateHandlerWithoutLogger(t *testing.T) {
+	cleanupGlobalLogger(t)
+	_ = Close()
+	w := serveRotate(t, "s3cret", "Bearer s3cret")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"files":[]}` {
+		t.Errorf("status = %d, body %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+/*
+=============================================================
+按时间切割
+lumberjack只按大小切割，量小的服务一个文件能写好几天。配置RotateDaily后每天最多一个文件，
+RotateEvery则按固定间隔切割（如1h），两者与MaxSize同时生效，哪个先到就先切割。
+fileWriteSyncer每次Write只比较当前时间和缓存的下一次切割时间，到点才调用lumberjack的Rotate；
+时间取自注入的Clock，测试可以用ManualClock模拟跨过零点。
+*/
+
+// minRotateEvery RotateEvery的最小值，lumberjack备份文件名只精确到毫秒，切得太频繁没有意义
+const minRotateEvery = time.Second
+
+// timeRotation 按时间切割的策略
+type timeRotation struct {
+	clock Clock
+	daily bool           // 跨过loc时区的零点时切割
+	every time.Duration  // 跨过every的整数倍时切割，daily为true时不使用
+	loc   *time.Location // 计算零点使用的时区，与日志时间戳一致
+	next  time.Time      // 下一次切割的时间
+}
+
+// newTimeRotation 按cfg创建切割策略，没有配置按时间切割时返回nil。
+// 日志文件已存在时从文件的修改时间算起，进程重启后第一次写入也能切掉昨天的文件
+func newTimeRotation(cfg LogConfig, clock Clock) (*timeRotation, error) {
+	if !cfg.RotateDaily && cfg.RotateEvery == 0 {
+		return nil, nil
+	}
+	loc, err := loadTimeZone(cfg.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	r := &timeRotation{clock: clock, daily: cfg.RotateDaily, every: cfg.RotateEvery, loc: loc}
+	from := clock.Now()
+	if info, err := os.Stat(cfg.Filename); err == nil && info.Size() > 0 && info.ModTime().Before(from) {
+		from = info.ModTime()
+	}
+	r.next = r.boundaryAfter(from)
+	return r, nil
+}
+
+// boundaryAfter 返回t之后的第一个切割时间
+func (r *timeRotation) boundaryAfter(t time.Time) time.Time {
+	if r.daily {
+		t = t.In(r.loc)
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, r.loc)
+	}
+	return t.Truncate(r.every).Add(r.every)
+}
+
+// due 判断是否到了切割时间，到了时把下一次切割时间往后推，调用方需要加锁
+func (r *timeRotation) due() bool {
+	now := r.clock.Now()
+	if now.Before(r.next) {
+		return false
+	}
+	r.next = r.boundaryAfter(now)
+	return true
+}
+
+// validateRotation 检查按时间切割的配置
+func (cfg LogConfig) validateRotation() error {
+	if cfg.RotateEvery < 0 {
+		return fmt.Errorf("log config: rotate every must not be negative, got %s", cfg.RotateEvery)
+	}
+	if cfg.RotateEvery != 0 && cfg.RotateEvery < minRotateEvery {
+		return fmt.Errorf("log config: rotate every must be at least %s, got %s", minRotateEvery, cfg.RotateEvery)
+	}
+	if cfg.RotateDaily && cfg.RotateEvery != 0 {
+		return fmt.Errorf("log config: rotate daily and rotate every cannot be used together")
+	}
+	if cfg.RotateAt != "" {
+		if cfg.RotateDaily || cfg.RotateEvery != 0 {
+			return fmt.Errorf("log config: rotate at cannot be used with rotate daily or rotate every")
+		}
+		if _, _, err := parseRotateAt(cfg.RotateAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newClockedFileLogger 用clock构建写到临时文件的logger，modify修改配置
+func newClockedFileLogger(t *testing.T, clock Clock, modify func(cfg *LogConfig)) (*builtLogger, LogConfig) {
+	t.Helper()
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.Encoding = EncodingJSON
+	cfg.TimeZone = "utc"
+	modify(&cfg)
+	b, err := newLogger(WithConfig(cfg), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.close() })
+	return b, cfg
+}
+
+// logBackups 返回cfg.Filename的所有备份文件
+func logBackups(t *testing.T, cfg LogConfig) []string {
+	t.Helper()
+	dir, name := filepath.Split(cfg.Filename)
+	return backupFiles(t, dir, strings.TrimSuffix(name, filepath.Ext(name))+"-", name)
+}
+
+func TestRotateDailyCrossingMidnight(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 5, 17, 23, 59, 58, 0, time.UTC))
+	b, cfg := newClockedFileLogger(t, clock, func(cfg *LogConfig) { cfg.RotateDaily = true })
+
+	b.logger.Info("day one")
+	clock.Add(time.Second)
+	b.logger.Info("day one, last second")
+	if backups := logBackups(t, cfg); len(backups) != 0 {
+		t.Fatalf("no rotation expected before midnight, got %v", backups)
+	}
+
+	clock.Add(2 * time.Second)
+	b.logger.Info("day two")
+	backups := logBackups(t, cfg)
+	if len(backups) != 1 {
+		t.Fatalf("crossing midnight should rotate once, got %v", backups)
+	}
+	old := readFile(t, backups[0])
+	if !strings.Contains(old, "day one, last second") || strings.Contains(old, "day two") {
+		t.Errorf("backup:\n%s", old)
+	}
+	if active := readFile(t, cfg.Filename); !strings.Contains(active, "day two") || strings.Contains(active, "day one") {
+		t.Errorf("active file:\n%s", active)
+	}
+
+	// 同一天内不再切割
+	clock.Add(12 * time.Hour)
+	b.logger.Info("day two, noon")
+	if backups := logBackups(t, cfg); len(backups) != 1 {
+		t.Errorf("no second rotation expected on the same day, got %v", backups)
+	}
+}
+
+func TestRotateDailyUsesTimeZone(t *testing.T) {
+	if _, err := time.LoadLocation("Etc/GMT-8"); err != nil {
+		t.Skip("time zone database not available:", err)
+	}
+	// UTC 15:59是东八区的23:59，UTC的零点在东八区是8点
+	clock := NewManualClock(time.Date(2024, 5, 17, 15, 59, 0, 0, time.UTC))
+	b, cfg := newClockedFileLogger(t, clock, func(cfg *LogConfig) {
+		cfg.RotateDaily = true
+		cfg.TimeZone = "Etc/GMT-8"
+	})
+	b.logger.Info("before")
+	clock.Add(2 * time.Minute)
+	b.logger.Info("after local midnight")
+	if backups := logBackups(t, cfg); len(backups) != 1 {
+		t.Errorf("rotation should follow the configured zone, got %v", backups)
+	}
+}
+
+func TestRotateEvery(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 5, 17, 10, 0, 0, 0, time.UTC))
+	b, cfg := newClockedFileLogger(t, clock, func(cfg *LogConfig) { cfg.RotateEvery = time.Hour })
+	for i := 0; i < 3; i++ {
+		b.logger.Info("tick")
+		clock.Add(59 * time.Minute)
+		b.logger.Info("same hour")
+		clock.Add(time.Minute)
+		// lumberjack的备份文件名精确到毫秒，同一毫秒内切割两次会覆盖前一个备份
+		time.Sleep(2 * time.Millisecond)
+	}
+	b.logger.Info("last")
+	if backups := logBackups(t, cfg); len(backups) != 3 {
+		t.Errorf("got %d backups, want one per hour: %v", len(backups), backups)
+	}
+}
+
+func TestRotateDailyWithMaxSize(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 5, 17, 12, 0, 0, 0, time.UTC))
+	b, cfg := newClockedFileLogger(t, clock, func(cfg *LogConfig) {
+		cfg.RotateDaily = true
+		cfg.MaxSizeBytes = 300
+	})
+	// 同一天里按大小切割
+	for i := 0; i < 4; i++ {
+		b.logger.Info(strings.Repeat("x", 100))
+		time.Sleep(2 * time.Millisecond)
+	}
+	sizeRotated := len(logBackups(t, cfg))
+	if sizeRotated == 0 {
+		t.Fatal("MaxSizeBytes should still rotate within the day")
+	}
+	// 跨过零点时即使文件很小也切割
+	clock.Add(12 * time.Hour)
+	b.logger.Info("tomorrow")
+	if got := len(logBackups(t, cfg)); got != sizeRotated+1 {
+		t.Errorf("got %d backups after midnight, want %d", got, sizeRotated+1)
+	}
+}
+
+func TestValidateRotation(t *testing.T) {
+	tests := []struct {
+		modify  func(cfg *LogConfig)
+		wantErr string
+	}{
+		{modify: func(cfg *LogConfig) { cfg.RotateEvery = -time.Second }, wantErr: "must not be negative"},
+		{modify: func(cfg *LogConfig) { cfg.RotateEvery = time.Millisecond }, wantErr: "must be at least 1s"},
+		{modify: func(cfg *LogConfig) { cfg.RotateDaily = true; cfg.RotateEvery = time.Hour }, wantErr: "cannot be used together"},
+	}
+	for _, tt := range tests {
+		cfg := defaultLogConfig()
+		tt.modify(&cfg)
+		if err := cfg.validateRotation(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("error = %v, want %q", err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package s3upload 把切割出的日志备份上传到S3，配合LogConfig.OnRotate使用：
+//
+//	sess := session.Must(session.NewSession())
+//	cfg.OnRotate = s3upload.New(sess, "my-bucket", logger).OnRotate
+//
+// 上传失败时按Backoff翻倍重试，最终失败记录一条Error日志，备份留在本地。
+package s3upload
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+	"go.uber.org/zap"
+)
+
+// 默认的重试参数
+const (
+	defaultRetries = 3
+	defaultBackoff = time.Second
+)
+
+// Uploader 把备份上传到Bucket，key为Prefix加上备份的文件名
+type Uploader struct {
+	Bucket      string
+	Prefix      string        // key的前缀，如logs/app/
+	DeleteLocal bool          // 上传成功后删除本地的备份
+	Retries     int           // 失败后的重试次数
+	Backoff     time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	Logger      *zap.Logger   // 上传失败时记录Error日志
+
+	uploader s3manageriface.UploaderAPI
+	sleep    func(time.Duration)
+}
+
+// New 用sess创建上传到bucket的Uploader，logger为nil时不记录失败
+func New(sess client.ConfigProvider, bucket string, logger *zap.Logger) *Uploader {
+	return NewWithUploader(s3manager.NewUploader(sess), bucket, logger)
+}
+
+// NewWithUploader 同New，使用指定的s3manager上传，测试时可以传入假的实现
+func NewWithUploader(uploader s3manageriface.UploaderAPI, bucket string, logger *zap.Logger) *Uploader {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Uploader{
+		Bucket:   bucket,
+		Retries:  defaultRetries,
+		Backoff:  defaultBackoff,
+		Logger:   logger,
+		uploader: uploader,
+		sleep:    time.Sleep,
+	}
+}
+
+// OnRotate 上传backupPath，可以直接赋值给LogConfig.OnRotate，失败时记录Error日志
+func (u *Uploader) OnRotate(backupPath string) {
+	if err := u.Upload(backupPath); err != nil {
+		u.Logger.Error("upload log backup failed",
+			zap.String("path", backupPath), zap.String("bucket", u.Bucket), zap.Error(err))
+	}
+}
+
+// Upload 上传backupPath，失败时按Backoff重试Retries次
+func (u *Uploader) Upload(backupPath string) error {
+	key := path.Join(u.Prefix, filepath.Base(backupPath))
+	backoff := u.Backoff
+	var err error
+	for attempt := 0; attempt <= u.Retries; attempt++ {
+		if attempt > 0 {
+			u.sleep(backoff)
+			backoff *= 2
+		}
+		if err = u.uploadOnce(backupPath, key); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("upload %s to s3://%s/%s: %v", backupPath, u.Bucket, key, err)
+	}
+	if u.DeleteLocal {
+		return os.Remove(backupPath)
+	}
+	return nil
+}
+
+func (u *Uploader) uploadOnce(backupPath, key string) error {
+	f, err := os.Open(backupPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = u.uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(u.Bucket),
+		Key:    aws.String(key),
+		Body:   f,
+	})
+	return err
+}
@@ -0,0 +1,130 @@
+package s3upload
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// fakeS3 记录上传的bucket、key和内容，前failures次上传返回错误
+type fakeS3 struct {
+	failures int
+	calls    int
+	bucket   string
+	key      string
+	body     string
+}
+
+func (f *fakeS3) Upload(in *s3manager.UploadInput, _ ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	f.calls++
+	data, err := ioutil.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	if f.calls <= f.failures {
+		return nil, errors.New("503 slow down")
+	}
+	f.bucket, f.key, f.body = aws.StringValue(in.Bucket), aws.StringValue(in.Key), string(data)
+	return &s3manager.UploadOutput{}, nil
+}
+
+func (f *fakeS3) UploadWithContext(_ aws.Context, in *s3manager.UploadInput, opts ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	return f.Upload(in, opts...)
+}
+
+// newTestUploader 返回使用fake的Uploader，记录重试前的等待时间，不真正sleep
+func newTestUploader(fake *fakeS3, logger *zap.Logger) (*Uploader, *[]time.Duration) {
+	u := NewWithUploader(fake, "logs-bucket", logger)
+	var sleeps []time.Duration
+	u.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	return u, &sleeps
+}
+
+// writeBackup 在临时目录写一个备份文件
+func writeBackup(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "s3upload-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "app-2024-05-17T10-00-00.000.log.gz")
+	if err := ioutil.WriteFile(path, []byte("backup content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUpload(t *testing.T) {
+	fake := &fakeS3{}
+	u, sleeps := newTestUploader(fake, nil)
+	u.Prefix = "logs/app/"
+	path := writeBackup(t)
+
+	if err := u.Upload(path); err != nil {
+		t.Fatal(err)
+	}
+	if fake.bucket != "logs-bucket" || fake.key != "logs/app/app-2024-05-17T10-00-00.000.log.gz" || fake.body != "backup content" {
+		t.Errorf("uploaded %s/%s %q", fake.bucket, fake.key, fake.body)
+	}
+	if len(*sleeps) != 0 {
+		t.Errorf("no retry expected, slept %v", *sleeps)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("backup should be kept without DeleteLocal: %v", err)
+	}
+}
+
+func TestUploadRetries(t *testing.T) {
+	fake := &fakeS3{failures: 2}
+	u, sleeps := newTestUploader(fake, nil)
+	u.DeleteLocal = true
+	path := writeBackup(t)
+
+	if err := u.Upload(path); err != nil {
+		t.Fatal(err)
+	}
+	if fake.calls != 3 || fake.body != "backup content" {
+		t.Errorf("calls = %d, body %q", fake.calls, fake.body)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second}; len(*sleeps) != 2 || (*sleeps)[0] != want[0] || (*sleeps)[1] != want[1] {
+		t.Errorf("backoff = %v, want %v", *sleeps, want)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("DeleteLocal should remove the backup after upload, stat err = %v", err)
+	}
+}
+
+func TestOnRotateLogsFailure(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	fake := &fakeS3{failures: 100}
+	u, sleeps := newTestUploader(fake, zap.New(core))
+	u.DeleteLocal = true
+	path := writeBackup(t)
+
+	u.OnRotate(path)
+	if fake.calls != defaultRetries+1 || len(*sleeps) != defaultRetries {
+		t.Errorf("calls = %d, sleeps = %v", fake.calls, *sleeps)
+	}
+	entries := logs.FilterMessage("upload log backup failed").All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d error entries, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["path"] != path || fields["bucket"] != "logs-bucket" || !strings.Contains(fields["error"].(string), "503 slow down") {
+		t.Errorf("fields = %v", fields)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("backup should stay local after a failed upload: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+采样
+像mainDemo3里那样循环打印10000条相同的日志，在生产环境会把磁盘和下游打满。
+配置Sampling后，每个Tick内同一级别、同一消息的日志只保留前Initial条，之后每Thereafter条保留一条。
+只对Info及以下的级别采样，Warn及以上总是全部输出。
+*/
+
+// SamplingConfig 采样配置
+type SamplingConfig struct {
+	Initial    int           `yaml:"initial" json:"initial"`       // 每个Tick内同一消息先完整保留的条数
+	Thereafter int           `yaml:"thereafter" json:"thereafter"` // 之后每多少条保留一条
+	Tick       time.Duration `yaml:"tick" json:"tick"`             // 计数周期，默认1秒
+}
+
+func (s SamplingConfig) validate() error {
+	if s.Initial <= 0 {
+		return fmt.Errorf("log config: sampling initial must be greater than 0, got %d", s.Initial)
+	}
+	if s.Thereafter <= 0 {
+		return fmt.Errorf("log config: sampling thereafter must be greater than 0, got %d", s.Thereafter)
+	}
+	if s.Tick < 0 {
+		return fmt.Errorf("log config: sampling tick must not be negative, got %s", s.Tick)
+	}
+	return nil
+}
+
+// sampledDropped 被采样丢弃的日志条数
+var sampledDropped uint64
+
+// SampledDropped 返回到目前为止被采样丢弃的日志条数
+func SampledDropped() uint64 {
+	return atomic.LoadUint64(&sampledDropped)
+}
+
+// newSamplingCore 对core中Info及以下级别的日志采样，hook可以为nil
+func newSamplingCore(core zapcore.Core, s SamplingConfig, hook func(zapcore.Entry, zapcore.SamplingDecision)) zapcore.Core {
+	tick := s.Tick
+	if tick == 0 {
+		tick = time.Second
+	}
+	countHook := func(ent zapcore.Entry, dec zapcore.SamplingDecision) {
+		if dec&zapcore.LogDropped > 0 {
+			atomic.AddUint64(&sampledDropped, 1)
+		}
+		if hook != nil {
+			hook(ent, dec)
+		}
+	}
+	sampled := func(l zapcore.Level) bool { return l <= zapcore.InfoLevel }
+	warnAndAbove := func(l zapcore.Level) bool { return l > zapcore.InfoLevel }
+	return zapcore.NewTee(
+		zapcore.NewSamplerWithOptions(&levelFilterCore{core, sampled}, tick, s.Initial, s.Thereafter, zapcore.SamplerHook(countHook)),
+		&levelFilterCore{core, warnAndAbove},
+	)
+}
+
+// levelFilterCore 只让filter返回true的级别通过，其余行为与内部的core一致
+type levelFilterCore struct {
+	zapcore.Core
+	filter func(zapcore.Level) bool
+}
+
+func (c *levelFilterCore) Enabled(l zapcore.Level) bool {
+	return c.filter(l) && c.Core.Enabled(l)
+}
+
+func (c *levelFilterCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelFilterCore{c.Core.With(fields), c.filter}
+}
+
+func (c *levelFilterCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.filter(ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
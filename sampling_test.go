@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSampling(t *testing.T) {
+	const n = 12
+	tests := []struct {
+		level       zapcore.Level
+		wantKept    int
+		wantDropped int
+	}{
+		// Initial为2、Thereafter为5：保留第1、2、7、12条
+		{level: zapcore.DebugLevel, wantKept: 4, wantDropped: 8},
+		{level: zapcore.InfoLevel, wantKept: 4, wantDropped: 8},
+		{level: zapcore.WarnLevel, wantKept: n},
+		{level: zapcore.ErrorLevel, wantKept: n},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			var hookDropped int
+			hook := func(_ zapcore.Entry, dec zapcore.SamplingDecision) {
+				if dec&zapcore.LogDropped > 0 {
+					hookDropped++
+				}
+			}
+			l, logs := newObservedLogger(t, WithSampling(SamplingConfig{Initial: 2, Thereafter: 5, Tick: time.Hour}, hook))
+
+			before := SampledDropped()
+			for i := 0; i < n; i++ {
+				if ce := l.Check(tt.level, "same message"); ce != nil {
+					ce.Write()
+				}
+			}
+			if got := logs.Len(); got != tt.wantKept {
+				t.Errorf("kept %d entries, want %d", got, tt.wantKept)
+			}
+			if got := SampledDropped() - before; got != uint64(tt.wantDropped) {
+				t.Errorf("SampledDropped increased by %d, want %d", got, tt.wantDropped)
+			}
+			if hookDropped != tt.wantDropped {
+				t.Errorf("hook saw %d drops, want %d", hookDropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestSamplingPerMessage(t *testing.T) {
+	l, logs := newObservedLogger(t, WithSampling(SamplingConfig{Initial: 1, Thereafter: 100, Tick: time.Hour}, nil))
+	for i := 0; i < 3; i++ {
+		l.Info("a")
+		l.Info("b")
+	}
+	if got := logs.FilterMessage("a").Len(); got != 1 {
+		t.Errorf("message a kept %d times, want 1", got)
+	}
+	if got := logs.FilterMessage("b").Len(); got != 1 {
+		t.Errorf("message b kept %d times, want 1", got)
+	}
+}
+
+func TestSamplingConfigValidate(t *testing.T) {
+	tests := []struct {
+		cfg     SamplingConfig
+		wantErr string
+	}{
+		{cfg: SamplingConfig{Initial: 1, Thereafter: 1}},
+		{cfg: SamplingConfig{Initial: 0, Thereafter: 1}, wantErr: "sampling initial must be greater than 0"},
+		{cfg: SamplingConfig{Initial: 1, Thereafter: 0}, wantErr: "sampling thereafter must be greater than 0"},
+		{cfg: SamplingConfig{Initial: 1, Thereafter: 1, Tick: -time.Second}, wantErr: "sampling tick must not be negative"},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.validate()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%+v: error = %v, want %q", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleRotateSignalSIGUSR1(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	if _, _, err := InitLoggerWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	HandleRotateSignal()
+	HandleRotateSignal() // 重复调用只监听一次
+
+	logger.Info("before SIGUSR1")
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, "a rotated log file", func() bool {
+		return len(logBackups(t, cfg)) == 1
+	})
+	waitFor(t, 5*time.Second, "the rotation entry", func() bool {
+		return strings.Contains(readFile(t, cfg.Filename), "log rotated by signal")
+	})
+
+	backup := logBackups(t, cfg)[0]
+	if out := readFile(t, backup); !strings.Contains(out, "before SIGUSR1") || strings.Contains(out, "log rotated by signal") {
+		t.Errorf("backup:\n%s", out)
+	}
+	if out := readFile(t, cfg.Filename); strings.Contains(out, "before SIGUSR1") {
+		t.Errorf("new log file should only hold lines after the signal:\n%s", out)
+	}
+}
+
+func TestHandleRotateSignalStopsOnClose(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	if _, _, err := InitLoggerWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	HandleRotateSignal()
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	globalMu.Lock()
+	stop := globalRotateSignalStop
+	globalMu.Unlock()
+	if stop != nil {
+		t.Fatal("Close should stop the SIGUSR1 handler")
+	}
+
+	// 重新初始化但不再监听，SIGUSR1只应送到测试自己的channel，不应该切割新的日志文件
+	cfg.Filename = tempLogFile(t)
+	if _, _, err := InitLoggerWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	defer signal.Stop(ch)
+	logger.Info("after close")
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGUSR1 was not delivered")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if backups := logBackups(t, cfg); len(backups) != 0 {
+		t.Errorf("stopped handler still rotated: %v", backups)
+	}
+}
@@ -0,0 +1,82 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// HandleSignals 监听SIGHUP：通过InitLoggerFromFile初始化时重新读取配置文件，
+// 然后让lumberjack切割日志文件，配合外部的logrotate使用。ctx结束后停止监听
+func HandleSignals(ctx context.Context) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ch:
+				reopenOnSignal()
+			}
+		}
+	}()
+}
+
+// HandleRotateSignal 监听SIGUSR1，收到后调用Rotate切割全局logger的日志文件，
+// 并在新文件中记录一条"log rotated by signal"。Close时停止监听，重复调用只监听一次
+func HandleRotateSignal() {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	if globalRotateSignalStop != nil {
+		return
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ch:
+				rotateOnSignal()
+			}
+		}
+	}()
+	globalRotateSignalStop = func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+func rotateOnSignal() {
+	if err := Rotate(); err != nil {
+		currentLogger().Error("rotate log file on SIGUSR1 failed", zap.Error(err))
+		return
+	}
+	currentLogger().Info("log rotated by signal", zap.String("signal", "SIGUSR1"))
+}
+
+func reopenOnSignal() {
+	globalMu.Lock()
+	path := globalConfigPath
+	b := globalBuilt
+	globalMu.Unlock()
+
+	if path != "" {
+		_ = reloadConfigFile(path) // 失败时reloadConfigFile已经记录了日志
+	}
+	if b != nil {
+		if err := b.rotate(); err != nil {
+			currentLogger().Error("rotate log file on SIGHUP failed", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,57 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestHandleSignalsSIGHUP(t *testing.T) {
+	unsetLogEnv(t)
+	cleanupGlobalLogger(t)
+	dir := tempDir(t)
+	logFile := filepath.Join(dir, "app.log")
+	configFile := filepath.Join(dir, "log.yaml")
+	if err := ioutil.WriteFile(configFile, []byte("filename: "+logFile+"\nlevel: debug\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitLoggerFromFile(configFile); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	HandleSignals(ctx)
+
+	logger.Info("before SIGHUP")
+	if err := ioutil.WriteFile(configFile, []byte("filename: "+logFile+"\nlevel: warn\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, "a rotated log file", func() bool {
+		return len(backupFiles(t, dir, "app-", "app.log")) == 1
+	})
+
+	if Level().Level() != zapcore.WarnLevel {
+		t.Errorf("level = %v, want warn after reloading the config", Level().Level())
+	}
+	backup := backupFiles(t, dir, "app-", "app.log")[0]
+	if out := readFile(t, backup); !strings.Contains(out, "before SIGHUP") {
+		t.Errorf("backup should hold the lines before SIGHUP:\n%s", out)
+	}
+	logger.Warn("after SIGHUP")
+	_ = logger.Sync()
+	if out := readFile(t, logFile); !strings.Contains(out, "after SIGHUP") || strings.Contains(out, "before SIGHUP") {
+		t.Errorf("new log file:\n%s", out)
+	}
+}
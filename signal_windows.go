@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "context"
+
+// HandleSignals Windows上没有SIGHUP，什么都不做
+func HandleSignals(ctx context.Context) {}
+
+// HandleRotateSignal Windows上没有SIGUSR1，什么都不做
+func HandleRotateSignal() {}
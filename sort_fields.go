@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sort"
+
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+字段排序
+有些辅助函数从map生成字段，每次运行顺序都不一样，diff和告警规则的匹配就不稳定。
+配置SortFields后每次调用（Info、With等）传入的字段按key排序，ts、level、caller、msg仍在最前面。
+zap.Namespace之后的字段属于该namespace，只在namespace内部排序，namespace本身的位置不变。
+*/
+
+// sortFieldsCore 写出前对字段排序，与truncateCore一样包在每个输出的core外面
+type sortFieldsCore struct {
+	zapcore.Core
+}
+
+// newSortFieldsCore enabled为false时直接返回core
+func newSortFieldsCore(core zapcore.Core, enabled bool) zapcore.Core {
+	if !enabled {
+		return core
+	}
+	return &sortFieldsCore{core}
+}
+
+func (c *sortFieldsCore) With(fields []zapcore.Field) zapcore.Core {
+	return &sortFieldsCore{c.Core.With(sortFields(fields))}
+}
+
+func (c *sortFieldsCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *sortFieldsCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, sortFields(fields))
+}
+
+// sortFields 返回排好序的副本：以Namespace字段为界分段，每段内按key稳定排序
+func sortFields(fields []zapcore.Field) []zapcore.Field {
+	if len(fields) < 2 {
+		return fields
+	}
+	sorted := make([]zapcore.Field, len(fields))
+	copy(sorted, fields)
+	start := 0
+	for i := 0; i <= len(sorted); i++ {
+		if i < len(sorted) && sorted[i].Type != zapcore.NamespaceType {
+			continue
+		}
+		segment := sorted[start:i]
+		sort.SliceStable(segment, func(a, b int) bool { return segment[a].Key < segment[b].Key })
+		start = i + 1
+	}
+	return sorted
+}
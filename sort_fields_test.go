@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestSortFieldsSameOutputForAnyOrder(t *testing.T) {
+	for _, encoding := range []string{EncodingConsole, EncodingJSON} {
+		t.Run(encoding, func(t *testing.T) {
+			cfg := defaultLogConfig()
+			cfg.Encoding = encoding
+			cfg.TimeZone = "utc"
+			cfg.DisableCaller = true
+			cfg.SortFields = true
+			first := encodeLine(t, cfg, zap.String("zone", "b"), zap.Int("attempt", 2), zap.Bool("ok", true))
+			second := encodeLine(t, cfg, zap.Bool("ok", true), zap.String("zone", "b"), zap.Int("attempt", 2))
+			if first != second {
+				t.Errorf("output depends on field order:\n%s\n%s", first, second)
+			}
+		})
+	}
+}
+
+func TestSortFieldsGolden(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Encoding = EncodingConsole
+	cfg.TimeZone = "utc"
+	cfg.SortFields = true
+	got := encodeLine(t, cfg, zap.String("zone", "b"), zap.Int("attempt", 2),
+		zap.Namespace("req"), zap.String("path", "/x"), zap.String("id", "r1"))
+	// 时间、级别、caller、消息的位置不变，Namespace之后的字段只在req内部排序
+	want := "2024-05-17T10:00:00.000Z\tINFO\t" + callerOf(t, got) + "\thello\t" +
+		`{"attempt": 2, "zone": "b", "req": {"id": "r1", "path": "/x"}}`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestSortFieldsNamespacesKeepPosition(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Encoding = EncodingJSON
+	cfg.TimeZone = "utc"
+	cfg.DisableCaller = true
+	cfg.SortFields = true
+	first := encodeLine(t, cfg, zap.String("b", "1"), zap.String("a", "2"),
+		zap.Namespace("outer"), zap.String("y", "3"), zap.String("x", "4"),
+		zap.Namespace("inner"), zap.String("d", "5"), zap.String("c", "6"))
+	want := `{"level":"INFO","ts":"2024-05-17T10:00:00.000Z","msg":"hello","a":"2","b":"1",` +
+		`"outer":{"x":"4","y":"3","inner":{"c":"6","d":"5"}}}`
+	if first != want {
+		t.Errorf("got  %s\nwant %s", first, want)
+	}
+}
+
+func TestSortFieldsWith(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingJSON
+	cfg.SortFields = true
+	l, logs := newObservedLogger(t, WithConfig(cfg))
+	l.With(zap.String("z", "1"), zap.String("a", "2")).Info("hello", zap.String("m", "3"), zap.String("b", "4"))
+
+	var keys []string
+	for _, f := range logs.All()[0].Context {
+		keys = append(keys, f.Key)
+	}
+	want := []string{"a", "z", "b", "m"}
+	if len(keys) != len(want) {
+		t.Fatalf("keys = %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("keys = %v, want %v (With fields sorted before call fields)", keys, want)
+			break
+		}
+	}
+}
+
+// callerOf 取出console输出的caller列
+func callerOf(t *testing.T, line string) string {
+	t.Helper()
+	cols := strings.Split(line, "\t")
+	if len(cols) < 3 {
+		t.Fatalf("unexpected console line %q", line)
+	}
+	return cols[2]
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+按级别拆分日志文件
+值班只关心错误日志，配置ErrorFile后：
+Error以下级别写到Filename（如info.log），Error及以上写到ErrorFile.Filename（如error.log），
+两个文件各自使用lumberjack切割，Close时都会关闭。
+*/
+
+// ErrorFileConfig Error及以上级别日志单独写入的文件，切割参数为0时沿用LogConfig中的值。
+// LogConfig设置了Compression时忽略Compress，使用相同的压缩方式
+type ErrorFileConfig struct {
+	Filename   string `yaml:"filename" json:"filename"`
+	MaxSize    int    `yaml:"max_size" json:"max_size"`
+	MaxBackups int    `yaml:"max_backups" json:"max_backups"`
+	MaxAge     int    `yaml:"max_age" json:"max_age"`
+	Compress   bool   `yaml:"compress" json:"compress"`
+}
+
+// errorFileConfig 以cfg为基础，用ErrorFile中的文件名和切割参数生成error文件的配置
+func (cfg LogConfig) errorFileConfig() LogConfig {
+	ecfg := cfg
+	ecfg.Filename = cfg.ErrorFile.Filename
+	ecfg.FilenamePattern = ""
+	ecfg.DailyDirs = false
+	if cfg.ErrorFile.MaxSize != 0 {
+		ecfg.MaxSize = cfg.ErrorFile.MaxSize
+		ecfg.MaxSizeBytes = 0
+	}
+	if cfg.ErrorFile.MaxBackups != 0 {
+		ecfg.MaxBackups = cfg.ErrorFile.MaxBackups
+	}
+	if cfg.ErrorFile.MaxAge != 0 {
+		ecfg.MaxAge = cfg.ErrorFile.MaxAge
+	}
+	if cfg.Compression == "" {
+		ecfg.Compress = cfg.ErrorFile.Compress
+	}
+	ecfg.ErrorFile = nil
+	return ecfg
+}
+
+// validateErrorFile 检查error文件的配置
+func (cfg LogConfig) validateErrorFile() error {
+	if cfg.ErrorFile.Filename == "" {
+		return fmt.Errorf("log config: error file filename must not be empty")
+	}
+	if cfg.ErrorFile.Filename == cfg.Filename {
+		return fmt.Errorf("log config: error file must differ from %s", cfg.Filename)
+	}
+	return cfg.errorFileConfig().validateFile()
+}
+
+// newFileCores 创建写日志文件的core，返回的files中第一个是主日志文件。
+// 配置了ErrorFile时返回两个core：Error以下写主文件，Error及以上写error文件
+func newFileCores(cfg LogConfig, encoder zapcore.Encoder, level zapcore.LevelEnabler, clock Clock) ([]zapcore.Core, []*fileWriteSyncer, error) {
+	if err := prepareLogFile(cfg); err != nil {
+		return nil, nil, err
+	}
+	mainFile, err := openFileWriteSyncer(cfg, clock)
+	if err != nil {
+		return nil, nil, err
+	}
+	mainFile.enableRetry(cfg)
+	mainFile.enableBuffer(cfg, clock)
+	mainFile.enableAsync(cfg)
+	if cfg.ErrorFile == nil {
+		return []zapcore.Core{zapcore.NewCore(encoder, countingWriteSyncer{mainFile.writeSyncer()}, level)}, []*fileWriteSyncer{mainFile}, nil
+	}
+
+	ecfg := cfg.errorFileConfig()
+	if err := prepareLogFile(ecfg); err != nil {
+		_ = mainFile.Close()
+		return nil, nil, err
+	}
+	errFile, err := openFileWriteSyncer(ecfg, clock)
+	if err != nil {
+		_ = mainFile.Close()
+		return nil, nil, err
+	}
+	errFile.enableRetry(ecfg)
+	errFile.enableBuffer(ecfg, clock)
+	errFile.enableAsync(ecfg)
+	belowError := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return l < zapcore.ErrorLevel && level.Enabled(l)
+	})
+	errorAndAbove := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return l >= zapcore.ErrorLevel && level.Enabled(l)
+	})
+	cores := []zapcore.Core{
+		zapcore.NewCore(encoder, countingWriteSyncer{mainFile.writeSyncer()}, belowError),
+		zapcore.NewCore(encoder.Clone(), countingWriteSyncer{errFile.writeSyncer()}, errorAndAbove),
+	}
+	return cores, []*fileWriteSyncer{mainFile, errFile}, nil
+}
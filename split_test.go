@@ -0,0 +1,89 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitErrorFile(t *testing.T) {
+	dir := tempDir(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = filepath.Join(dir, "info.log")
+	cfg.Encoding = EncodingJSON
+	cfg.ErrorFile = &ErrorFileConfig{Filename: filepath.Join(dir, "error.log")}
+	b, err := newLogger(WithConfig(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.files) != 2 {
+		t.Fatalf("got %d files, want 2", len(b.files))
+	}
+	serveGinPanic(b.logger)
+	b.logger.Warn("warn line")
+	b.logger.Error("error line")
+	// 不先Sync，Close也要把两个文件都写完并关闭
+	if err := b.close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range b.files {
+		if !fileClosed(f) {
+			t.Errorf("%s not closed", f.lj.Filename)
+		}
+	}
+
+	info := readFile(t, cfg.Filename)
+	errs := readFile(t, cfg.ErrorFile.Filename)
+	if !strings.Contains(info, `"msg":"/ok"`) || !strings.Contains(info, `"msg":"/panic"`) || !strings.Contains(info, "warn line") {
+		t.Errorf("info.log should have access lines and warnings:\n%s", info)
+	}
+	if strings.Contains(info, "Recovery from panic") || strings.Contains(info, "error line") {
+		t.Errorf("info.log should not have errors:\n%s", info)
+	}
+	if !strings.Contains(errs, "[Recovery from panic]") || !strings.Contains(errs, "error line") {
+		t.Errorf("error.log should have the panic and errors:\n%s", errs)
+	}
+	if strings.Contains(errs, `"msg":"/ok"`) || strings.Contains(errs, "warn line") {
+		t.Errorf("error.log should only have errors:\n%s", errs)
+	}
+}
+
+func TestErrorFileConfig(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.MaxSizeBytes = 4096
+	cfg.FilenamePattern = "./app-%Y-%m-%d.log"
+	cfg.ErrorFile = &ErrorFileConfig{Filename: "error.log", MaxSize: 20, MaxAge: 3, Compress: true}
+
+	ecfg := cfg.errorFileConfig()
+	if ecfg.Filename != "error.log" || ecfg.FilenamePattern != "" || ecfg.ErrorFile != nil {
+		t.Errorf("error file config = %+v", ecfg)
+	}
+	if ecfg.MaxSize != 20 || ecfg.MaxSizeBytes != 0 || ecfg.MaxAge != 3 || !ecfg.Compress {
+		t.Errorf("own rotation settings not applied: %+v", ecfg)
+	}
+	if ecfg.MaxBackups != cfg.MaxBackups {
+		t.Errorf("max backups = %d, want inherited %d", ecfg.MaxBackups, cfg.MaxBackups)
+	}
+}
+
+func TestValidateErrorFile(t *testing.T) {
+	dir := tempDir(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = filepath.Join(dir, "info.log")
+	tests := []struct {
+		ef      ErrorFileConfig
+		wantErr string
+	}{
+		{ef: ErrorFileConfig{}, wantErr: "error file filename must not be empty"},
+		{ef: ErrorFileConfig{Filename: cfg.Filename}, wantErr: "error file must differ"},
+		{ef: ErrorFileConfig{Filename: filepath.Join(dir, "error.log"), MaxBackups: -1}, wantErr: "max backups must not be negative"},
+	}
+	for _, tt := range tests {
+		c := cfg
+		ef := tt.ef
+		c.ErrorFile = &ef
+		if err := c.Validate(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%+v: error = %v, want containing %q", tt.ef, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+console Encoder中多行的堆栈
+console Encoder把GinRecovery的stack字段当普通字符串放进JSON风格的字段里，\n\t全被转义成一整行。
+配置MultilineStack后，stack字段和zap自动附带的stacktrace从字段里拿出来，
+原样缩进输出在日志行下面。JSON等其他Encoder不受影响。
+整条日志（包括堆栈）仍在同一个buffer里，由core一次Write写出，切割不会把一条日志拆到两个文件里。
+*/
+
+// stackIndent 多行堆栈每行前面的缩进
+const stackIndent = "    "
+
+// multilineStackEncoder 包装console Encoder，把堆栈原样输出在日志行下面
+type multilineStackEncoder struct {
+	zapcore.Encoder
+	lineEnding string
+}
+
+// withMultilineStack enabled时包装console Encoder enc
+func withMultilineStack(enc zapcore.Encoder, cfg zapcore.EncoderConfig, enabled bool) zapcore.Encoder {
+	if !enabled {
+		return enc
+	}
+	lineEnding := cfg.LineEnding
+	if lineEnding == "" {
+		lineEnding = zapcore.DefaultLineEnding
+	}
+	return multilineStackEncoder{enc, lineEnding}
+}
+
+func (enc multilineStackEncoder) Clone() zapcore.Encoder {
+	return multilineStackEncoder{enc.Encoder.Clone(), enc.lineEnding}
+}
+
+func (enc multilineStackEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	var stacks []string
+	for _, f := range fields {
+		if isStackField(f) {
+			stacks = append(stacks, f.String)
+		}
+	}
+	if len(stacks) > 0 {
+		rest := make([]zapcore.Field, 0, len(fields)-len(stacks))
+		for _, f := range fields {
+			if !isStackField(f) {
+				rest = append(rest, f)
+			}
+		}
+		fields = rest
+	}
+	if ent.Stack != "" {
+		stacks = append(stacks, ent.Stack)
+		ent.Stack = ""
+	}
+	buf, err := enc.Encoder.EncodeEntry(ent, fields)
+	if err != nil || len(stacks) == 0 {
+		return buf, err
+	}
+	for _, stack := range stacks {
+		for _, line := range strings.Split(strings.TrimRight(stack, "\r\n"), "\n") {
+			buf.AppendString(stackIndent)
+			buf.AppendString(strings.TrimRight(line, "\r"))
+			buf.AppendString(enc.lineEnding)
+		}
+	}
+	return buf, nil
+}
+
+// isStackField 判断f是否是GinRecovery记录的stack字段
+func isStackField(f zapcore.Field) bool {
+	return f.Key == stackKey && f.Type == zapcore.StringType
+}
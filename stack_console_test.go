@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap/zapcore"
+)
+
+// writeRecorder 记录每次Write的内容
+type writeRecorder struct {
+	mu     sync.Mutex
+	writes []string
+}
+
+func (w *writeRecorder) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func (w *writeRecorder) Sync() error { return nil }
+
+// recoverPanicConsole 用console Encoder和GinRecovery处理一个panic的请求，返回每次Write的内容
+func recoverPanicConsole(t *testing.T, multiline bool) []string {
+	t.Helper()
+	out := &writeRecorder{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingConsole
+	cfg.TimeZone = "utc"
+	cfg.DisableCaller = true
+	cfg.MultilineStack = multiline
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out), WithClock(NewManualClock(fixedTime)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(GinRecoveryWithConfig(l, GinRecoveryConfig{Stack: true, StructuredRequest: true, SkipHeaders: []string{}}))
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+	return out.writes
+}
+
+func TestMultilineStackConsoleSnapshot(t *testing.T) {
+	writes := recoverPanicConsole(t, true)
+	if len(writes) != 1 {
+		t.Fatalf("entry and stack must be written in one Write call, got %d", len(writes))
+	}
+	lines := strings.Split(strings.TrimSuffix(writes[0], "\n"), "\n")
+
+	wantFirst := "2024-05-17T10:00:00.000Z\tERROR\t[Recovery from panic]\t" +
+		`{"error": "boom", "request": {"method": "GET", "url": "/panic", "proto": "HTTP/1.1", ` +
+		`"host": "example.com", "remote_addr": "192.0.2.1:1234", "content_length": 0, "header": {}}}`
+	if lines[0] != wantFirst {
+		t.Errorf("first line:\ngot  %s\nwant %s", lines[0], wantFirst)
+	}
+	if strings.Contains(lines[0], `\n`) || strings.Contains(lines[0], `"stack"`) {
+		t.Errorf("stack should not stay in the fields: %s", lines[0])
+	}
+	stack := lines[1:]
+	if len(stack) < 4 {
+		t.Fatalf("stack should follow on separate lines:\n%s", writes[0])
+	}
+	for _, line := range stack {
+		if !strings.HasPrefix(line, stackIndent) {
+			t.Errorf("stack line not indented: %q", line)
+		}
+	}
+	// 堆栈开头除了goroutine编号都是固定的
+	if !regexp.MustCompile(`^    goroutine \d+ \[running\]:$`).MatchString(stack[0]) {
+		t.Errorf("stack line 0 = %q, want the goroutine header", stack[0])
+	}
+	if want := stackIndent + "runtime/debug.Stack()"; stack[1] != want {
+		t.Errorf("stack line 1 = %q, want %q", stack[1], want)
+	}
+	if !strings.Contains(writes[0], ".TestMultilineStackConsoleSnapshot") {
+		t.Errorf("stack should include the test function:\n%s", writes[0])
+	}
+}
+
+func TestMultilineStackDisabled(t *testing.T) {
+	writes := recoverPanicConsole(t, false)
+	if len(writes) != 1 || strings.Count(writes[0], "\n") != 1 {
+		t.Fatalf("without MultilineStack the entry is one line, got %q", writes)
+	}
+	if !strings.Contains(writes[0], `"stack": "goroutine `) {
+		t.Errorf("stack should stay an escaped field: %s", writes[0])
+	}
+}
+
+func TestMultilineStackJSONUnchanged(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Encoding = EncodingJSON
+	cfg.MultilineStack = true
+	cfg.DisableCaller = true
+	cfg.TimeZone = "utc"
+	got := encodeLine(t, cfg, zapcore.Field{Key: stackKey, Type: zapcore.StringType, String: "a\n\tb"})
+	if want := `{"level":"INFO","ts":"2024-05-17T10:00:00.000Z","msg":"hello","stack":"a\n\tb"}`; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
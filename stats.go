@@ -0,0 +1,85 @@
+package main
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+日志管道的统计
+写日志文件的core外面包一层countingWriteSyncer，统计交给日志文件的条数、字节数和返回的错误，
+切割（包括FilenamePattern、DailyDirs换文件）时计一次Rotations。
+计数发生在缓冲和异步队列之前，GinLogger/GinRecovery写的日志立即就能在Stats中看到。
+Stats同时汇总各个文件中已有的计数器（异步丢弃、重试、内部错误等）和LowDisk的状态。
+配置Expvar后以"logging"为名发布到expvar，可以通过/debug/vars查看。
+*/
+
+// statsExpvarName 发布到expvar的变量名
+const statsExpvarName = "logging"
+
+// 写日志文件的计数
+var (
+	statEntries     uint64
+	statBytes       uint64
+	statWriteErrors uint64
+	statRotations   uint64
+)
+
+// LogStats 日志管道到目前为止的统计
+type LogStats struct {
+	Entries        uint64 `json:"entries"`         // 写入日志文件的条数
+	Bytes          uint64 `json:"bytes"`           // 写入日志文件的字节数（编码后、压缩前）
+	WriteErrors    uint64 `json:"write_errors"`    // 写日志文件返回错误的次数
+	Rotations      uint64 `json:"rotations"`       // 切割或换文件的次数
+	AsyncDropped   uint64 `json:"async_dropped"`   // 见AsyncDropped
+	SampledDropped uint64 `json:"sampled_dropped"` // 见SampledDropped
+	WriteRetries   uint64 `json:"write_retries"`   // 见WriteRetries
+	WriteLost      uint64 `json:"write_lost"`      // 见WriteLost
+	InternalErrors uint64 `json:"internal_errors"` // 见InternalErrors
+	VolumeLow      bool   `json:"volume_low"`      // 见LogVolumeLow
+}
+
+// Stats 返回日志管道到目前为止的统计，所有logger共用同一组计数
+func Stats() LogStats {
+	return LogStats{
+		Entries:        atomic.LoadUint64(&statEntries),
+		Bytes:          atomic.LoadUint64(&statBytes),
+		WriteErrors:    atomic.LoadUint64(&statWriteErrors),
+		Rotations:      atomic.LoadUint64(&statRotations),
+		AsyncDropped:   AsyncDropped(),
+		SampledDropped: SampledDropped(),
+		WriteRetries:   WriteRetries(),
+		WriteLost:      WriteLost(),
+		InternalErrors: InternalErrors(),
+		VolumeLow:      LogVolumeLow(),
+	}
+}
+
+// countingWriteSyncer 统计写入的条数、字节数和错误，core每条日志调用一次Write
+type countingWriteSyncer struct {
+	zapcore.WriteSyncer
+}
+
+func (w countingWriteSyncer) Write(p []byte) (int, error) {
+	n, err := w.WriteSyncer.Write(p)
+	atomic.AddUint64(&statEntries, 1)
+	atomic.AddUint64(&statBytes, uint64(n))
+	if err != nil {
+		atomic.AddUint64(&statWriteErrors, 1)
+	}
+	return n, err
+}
+
+// publishStatsOnce expvar.Publish重复发布同一个名字会panic，只发布一次
+var publishStatsOnce sync.Once
+
+// publishStats 以statsExpvarName把Stats发布到expvar，可重复调用
+func publishStats() {
+	publishStatsOnce.Do(func() {
+		expvar.Publish(statsExpvarName, expvar.Func(func() interface{} { return Stats() }))
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// statsSince 返回从before到现在各计数器的增量
+func statsSince(before LogStats) LogStats {
+	now := Stats()
+	return LogStats{
+		Entries:     now.Entries - before.Entries,
+		Bytes:       now.Bytes - before.Bytes,
+		WriteErrors: now.WriteErrors - before.WriteErrors,
+		Rotations:   now.Rotations - before.Rotations,
+	}
+}
+
+func TestStatsCountsEntriesAndBytes(t *testing.T) {
+	b, cfg := newClockedFileLogger(t, NewManualClock(fixedTime), func(*LogConfig) {})
+	before := Stats()
+	for i := 0; i < 10; i++ {
+		b.logger.Info("entry")
+	}
+	b.logger.Debug("below error")
+	b.logger.Error("error")
+	b.close()
+
+	lines := readLines(t, cfg.Filename)[1:]
+	var size uint64
+	for _, line := range lines {
+		size += uint64(len(line)) + 1
+	}
+	got := statsSince(before)
+	if got.Entries != 12 || len(lines) != 12 || got.Bytes != size || got.WriteErrors != 0 {
+		t.Errorf("stats = %+v, want 12 entries and %d bytes", got, size)
+	}
+}
+
+func TestStatsErrorFile(t *testing.T) {
+	b, _ := newClockedFileLogger(t, NewManualClock(fixedTime), func(cfg *LogConfig) {
+		cfg.ErrorFile = &ErrorFileConfig{Filename: filepath.Join(filepath.Dir(cfg.Filename), "error.log")}
+	})
+	before := Stats()
+	b.logger.Info("info")
+	b.logger.Error("error")
+	if got := statsSince(before); got.Entries != 2 {
+		t.Errorf("stats = %+v, each entry goes to one of the two files", got)
+	}
+}
+
+func TestStatsCountsRotations(t *testing.T) {
+	b, _ := newClockedFileLogger(t, NewManualClock(fixedTime), func(*LogConfig) {})
+	before := Stats()
+	for i := 0; i < 3; i++ {
+		b.logger.Info("before rotate")
+		if err := b.rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := statsSince(before); got.Rotations != 3 {
+		t.Errorf("Rotations = %d, want 3", got.Rotations)
+	}
+}
+
+func TestStatsCountsWriteErrors(t *testing.T) {
+	before := Stats()
+	w := countingWriteSyncer{failingWriteSyncer{}}
+	for i := 0; i < 3; i++ {
+		if _, err := w.Write([]byte("entry\n")); err == nil {
+			t.Fatal("write should fail")
+		}
+	}
+	if got := statsSince(before); got.Entries != 3 || got.Bytes != 0 || got.WriteErrors != 3 {
+		t.Errorf("stats = %+v, want 3 entries, 0 bytes and 3 errors", got)
+	}
+}
+
+func TestStatsGinTrafficVisibleImmediately(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *LogConfig)
+	}{
+		{"sync", func(*LogConfig) {}},
+		{"buffered", func(cfg *LogConfig) { cfg.BufferSize = 1 << 20; cfg.FlushInterval = time.Hour }},
+		{"async", func(cfg *LogConfig) { cfg.Async = &AsyncConfig{QueueSize: 100} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := newClockedFileLogger(t, NewManualClock(fixedTime), tt.modify)
+			before := Stats()
+			serveGinPanic(b.logger)
+			// 不Sync也不等异步队列，计数在缓冲和队列之前：两条访问日志和一条panic
+			if got := statsSince(before); got.Entries != 3 || got.Bytes == 0 {
+				t.Errorf("stats = %+v right after the requests", got)
+			}
+		})
+	}
+}
+
+func TestStatsExpvar(t *testing.T) {
+	b, _ := newClockedFileLogger(t, NewManualClock(fixedTime), func(cfg *LogConfig) { cfg.Expvar = true })
+	// 重复发布不会panic
+	publishStats()
+	b.logger.Info("entry")
+
+	v := expvar.Get(statsExpvarName)
+	if v == nil {
+		t.Fatalf("expvar %q is not published", statsExpvarName)
+	}
+	var got LogStats
+	if err := json.Unmarshal([]byte(v.String()), &got); err != nil {
+		t.Fatalf("expvar %s: %v", v.String(), err)
+	}
+	if want := Stats(); got != want {
+		t.Errorf("expvar = %+v, want %+v", got, want)
+	}
+}
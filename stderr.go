@@ -0,0 +1,68 @@
+package main
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+Warn及以上级别同时输出到stderr
+在Kubernetes里kubectl logs只看得到容器的stdout/stderr，日志都写到文件时警告和错误就看不到了。
+配置StderrMirror后，Warn及以上级别的日志除了写文件，还会用console Encoder再输出一份到stderr。
+GinRecovery记录的stack字段很长，stderr上默认去掉，StderrKeepStack为true时保留。
+*/
+
+// stackKey GinRecovery记录panic堆栈使用的字段名
+const stackKey = "stack"
+
+// newStderrCore 创建把Warn及以上级别输出到ws的core
+func newStderrCore(encoder zapcore.Encoder, ws zapcore.WriteSyncer, level zapcore.LevelEnabler, keepStack bool) zapcore.Core {
+	warnAndAbove := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return l >= zapcore.WarnLevel && level.Enabled(l)
+	})
+	core := zapcore.NewCore(encoder, zapcore.Lock(ws), warnAndAbove)
+	if keepStack {
+		return core
+	}
+	return &omitStackCore{core}
+}
+
+// omitStackCore 写出前去掉stack字段和自动附带的stacktrace
+type omitStackCore struct {
+	zapcore.Core
+}
+
+func (c *omitStackCore) With(fields []zapcore.Field) zapcore.Core {
+	return &omitStackCore{c.Core.With(withoutStack(fields))}
+}
+
+func (c *omitStackCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *omitStackCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Stack = ""
+	return c.Core.Write(ent, withoutStack(fields))
+}
+
+// withoutStack 返回去掉stack字段后的fields，没有stack字段时直接返回原slice
+func withoutStack(fields []zapcore.Field) []zapcore.Field {
+	for i, f := range fields {
+		if f.Key != stackKey {
+			continue
+		}
+		out := make([]zapcore.Field, 0, len(fields)-1)
+		out = append(out, fields[:i]...)
+		for _, f := range fields[i+1:] {
+			if f.Key != stackKey {
+				out = append(out, f)
+			}
+		}
+		return out
+	}
+	return fields
+}
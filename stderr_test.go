@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestStderrMirror(t *testing.T) {
+	tests := []struct {
+		name      string
+		keepStack bool
+	}{
+		{name: "omit stack", keepStack: false},
+		{name: "keep stack", keepStack: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr := &zaptest.Buffer{}
+			l, file := newObservedLogger(t, WithStderrMirror(tt.keepStack), WithStderrOutput(stderr))
+
+			l.Info("info line")
+			l.Warn("warn line")
+			l.Error("error line", zap.String(stackKey, "goroutine 1 [running]"), zap.Error(errors.New("boom")))
+
+			if file.Len() != 3 {
+				t.Errorf("file side got %d entries, want 3", file.Len())
+			}
+			if got := file.FilterMessage("error line").All()[0].ContextMap()[stackKey]; got != "goroutine 1 [running]" {
+				t.Errorf("file side should keep the stack field, got %v", got)
+			}
+			out := stderr.String()
+			if strings.Contains(out, "info line") {
+				t.Errorf("info should not be mirrored to stderr:\n%s", out)
+			}
+			if !strings.Contains(out, "warn line") || !strings.Contains(out, "error line") || !strings.Contains(out, "boom") {
+				t.Errorf("warn and error should be mirrored to stderr:\n%s", out)
+			}
+			if got := strings.Contains(out, "goroutine 1 [running]"); got != tt.keepStack {
+				t.Errorf("stack on stderr = %v, want %v:\n%s", got, tt.keepStack, out)
+			}
+		})
+	}
+}
+
+func TestStderrMirrorRespectsLevel(t *testing.T) {
+	stderr := &zaptest.Buffer{}
+	l, _ := newObservedLogger(t, WithLevel(zapcore.ErrorLevel), WithStderrMirror(false), WithStderrOutput(stderr))
+	l.Warn("warn below level")
+	if stderr.String() != "" {
+		t.Errorf("stderr mirror should honor the logger level:\n%s", stderr.String())
+	}
+}
+
+func TestWithoutStack(t *testing.T) {
+	fields := []zap.Field{zap.String("a", "1"), zap.String(stackKey, "s1"), zap.String("b", "2"), zap.String(stackKey, "s2")}
+	got := withoutStack(fields)
+	if len(got) != 2 || got[0].Key != "a" || got[1].Key != "b" {
+		t.Errorf("withoutStack = %v", got)
+	}
+	if len(fields) != 4 {
+		t.Error("withoutStack should not modify the input")
+	}
+	plain := fields[:1]
+	if got := withoutStack(plain); &got[0] != &plain[0] {
+		t.Error("fields without stack should be returned as is")
+	}
+}
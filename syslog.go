@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+=============================================================
+输出到syslog
+有的主机要求日志经过本机的syslog守护进程。配置Syslog后，日志用文件的Encoder编码后通过log/syslog
+发送（本机Unix socket，或者udp/tcp），级别按levelSeverity映射为syslog severity。
+可以单独使用（不配置Filename），也可以与日志文件同时输出。
+连接断开后按退避时间重连，期间最多缓存MaxPending条，超出时丢弃最早的。Windows上不支持。
+*/
+
+// 输出到syslog的默认值
+const (
+	defaultSyslogFacility   = "user"
+	defaultSyslogMaxPending = 1000
+)
+
+// SyslogConfig 输出到syslog的配置
+type SyslogConfig struct {
+	Network    string `yaml:"network" json:"network"`         // 为空时连接本机的syslog，也可以是udp、tcp、unix、unixgram
+	Addr       string `yaml:"addr" json:"addr"`               // syslog的地址，Network为空时忽略
+	Tag        string `yaml:"tag" json:"tag"`                 // 为空时使用进程名
+	Facility   string `yaml:"facility" json:"facility"`       // user、daemon、local0~local7等，默认user
+	MaxPending int    `yaml:"max_pending" json:"max_pending"` // 连接断开期间最多缓存的条数，默认1000
+}
+
+// syslogFacilities facility的名字及其值，与log/syslog中的LOG_KERN等相同
+var syslogFacilities = map[string]int{
+	"kern":     0 << 3,
+	"user":     1 << 3,
+	"mail":     2 << 3,
+	"daemon":   3 << 3,
+	"auth":     4 << 3,
+	"syslog":   5 << 3,
+	"lpr":      6 << 3,
+	"news":     7 << 3,
+	"uucp":     8 << 3,
+	"cron":     9 << 3,
+	"authpriv": 10 << 3,
+	"ftp":      11 << 3,
+	"local0":   16 << 3,
+	"local1":   17 << 3,
+	"local2":   18 << 3,
+	"local3":   19 << 3,
+	"local4":   20 << 3,
+	"local5":   21 << 3,
+	"local6":   22 << 3,
+	"local7":   23 << 3,
+}
+
+// facility 返回Facility对应的值
+func (s SyslogConfig) facility() (int, error) {
+	name := strings.ToLower(strings.TrimSpace(s.Facility))
+	if name == "" {
+		name = defaultSyslogFacility
+	}
+	f, ok := syslogFacilities[name]
+	if !ok {
+		return 0, fmt.Errorf("log config: unknown syslog facility %q", s.Facility)
+	}
+	return f, nil
+}
+
+func (s SyslogConfig) validate() error {
+	if _, err := s.facility(); err != nil {
+		return err
+	}
+	switch s.Network {
+	case "":
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6", "unix", "unixgram":
+		if s.Addr == "" {
+			return fmt.Errorf("log config: syslog addr must not be empty for network %s", s.Network)
+		}
+	default:
+		return fmt.Errorf("log config: unknown syslog network %q", s.Network)
+	}
+	if s.MaxPending < 0 {
+		return fmt.Errorf("log config: syslog max pending must not be negative, got %d", s.MaxPending)
+	}
+	return nil
+}
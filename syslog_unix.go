@@ -0,0 +1,202 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// syslog重连的退避时间，每次失败翻倍
+const (
+	syslogMinBackoff = 100 * time.Millisecond
+	syslogMaxBackoff = 30 * time.Second
+)
+
+// syslogEntry 连接断开期间缓存的一条日志
+type syslogEntry struct {
+	severity int64
+	msg      string
+}
+
+// syslogSink 通过log/syslog发送日志，连接断开后按退避时间重连
+type syslogSink struct {
+	cfg      SyslogConfig
+	priority syslog.Priority
+	clock    Clock
+
+	mu       sync.Mutex
+	w        *syslog.Writer // 为nil表示连接已断开
+	pending  []syslogEntry  // 连接断开期间缓存的日志
+	backoff  time.Duration
+	nextDial time.Time // 早于这个时间不重连
+	closed   bool
+}
+
+func newSyslogSink(cfg SyslogConfig, clock Clock) (*syslogSink, error) {
+	facility, err := cfg.facility()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxPending == 0 {
+		cfg.MaxPending = defaultSyslogMaxPending
+	}
+	s := &syslogSink{cfg: cfg, priority: syslog.Priority(facility) | syslog.LOG_INFO, clock: clock}
+	if s.w, err = s.dial(); err != nil {
+		return nil, fmt.Errorf("log config: dial syslog: %v", err)
+	}
+	return s, nil
+}
+
+func (s *syslogSink) dial() (*syslog.Writer, error) {
+	return syslog.Dial(s.cfg.Network, s.cfg.Addr, s.priority, s.cfg.Tag)
+}
+
+// send 发送一条日志，连接断开时缓存起来，发送失败时返回错误（日志已缓存）
+func (s *syslogSink) send(severity int64, msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.pending = append(s.pending, syslogEntry{severity, msg})
+	if over := len(s.pending) - s.cfg.MaxPending; over > 0 {
+		s.pending = s.pending[over:] // 丢弃最早的
+	}
+	return s.flushLocked()
+}
+
+// flushLocked 连接断开时尝试重连，然后按顺序发送缓存的日志
+func (s *syslogSink) flushLocked() error {
+	if s.w == nil {
+		if s.clock.Now().Before(s.nextDial) {
+			return nil
+		}
+		w, err := s.dial()
+		if err != nil {
+			s.retryLater()
+			return nil
+		}
+		s.w, s.backoff = w, 0
+	}
+	for len(s.pending) > 0 {
+		e := s.pending[0]
+		if err := writeSyslog(s.w, e.severity, e.msg); err != nil {
+			s.w.Close()
+			s.w = nil
+			s.retryLater()
+			return err
+		}
+		s.pending = s.pending[1:]
+	}
+	return nil
+}
+
+// retryLater 按退避时间推迟下一次重连
+func (s *syslogSink) retryLater() {
+	switch {
+	case s.backoff == 0:
+		s.backoff = syslogMinBackoff
+	case s.backoff < syslogMaxBackoff:
+		s.backoff *= 2
+		if s.backoff > syslogMaxBackoff {
+			s.backoff = syslogMaxBackoff
+		}
+	}
+	s.nextDial = s.clock.Now().Add(s.backoff)
+}
+
+// Sync 尝试发送缓存的日志
+func (s *syslogSink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	return s.flushLocked()
+}
+
+// Close 关闭连接，缓存中没发出去的日志丢弃。可重复调用
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.w == nil {
+		s.closed = true
+		return nil
+	}
+	s.closed = true
+	return s.w.Close()
+}
+
+// writeSyslog 按severity调用syslog.Writer对应的方法
+func writeSyslog(w *syslog.Writer, severity int64, msg string) error {
+	switch severity {
+	case 0:
+		return w.Emerg(msg)
+	case 1:
+		return w.Alert(msg)
+	case 2:
+		return w.Crit(msg)
+	case 3:
+		return w.Err(msg)
+	case 4:
+		return w.Warning(msg)
+	case 5:
+		return w.Notice(msg)
+	case 6:
+		return w.Info(msg)
+	}
+	return w.Debug(msg)
+}
+
+// syslogCore 用Encoder编码后发送到syslog的core
+type syslogCore struct {
+	zapcore.LevelEnabler
+	enc  zapcore.Encoder
+	sink *syslogSink
+}
+
+// newSyslogCore 按cfg连接syslog，返回的io.Closer用于关闭连接
+func newSyslogCore(cfg SyslogConfig, enc zapcore.Encoder, level zapcore.LevelEnabler, clock Clock) (zapcore.Core, io.Closer, error) {
+	sink, err := newSyslogSink(cfg, clock)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &syslogCore{LevelEnabler: level, enc: enc, sink: sink}, sink, nil
+}
+
+func (c *syslogCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &syslogCore{LevelEnabler: c.LevelEnabler, enc: enc, sink: c.sink}
+}
+
+func (c *syslogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *syslogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	msg := strings.TrimRight(buf.String(), "\r\n") // syslog每条一行，log/syslog会自己加换行
+	buf.Free()
+	return c.sink.send(levelSeverity(ent.Level), msg)
+}
+
+func (c *syslogCore) Sync() error {
+	return c.sink.Sync()
+}
@@ -0,0 +1,174 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// syslogPacket 匹配log/syslog发出的一条消息：<PRI>时间 [主机] tag[pid]: 内容，发到本机时没有主机名
+var syslogPacket = regexp.MustCompile(`^<(\d+)>.*? (\S+)\[\d+\]: (.*)\n$`)
+
+// syslogMessage 解析出的一条syslog消息
+type syslogMessage struct {
+	priority int
+	tag      string
+	msg      string
+}
+
+// readSyslog 从conn读一条syslog消息
+func readSyslog(t *testing.T, conn net.PacketConn) syslogMessage {
+	t.Helper()
+	buf := make([]byte, 64*1024)
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := syslogPacket.FindStringSubmatch(string(buf[:n]))
+	if m == nil {
+		t.Fatalf("not a syslog message: %q", buf[:n])
+	}
+	priority, _ := strconv.Atoi(m[1])
+	return syslogMessage{priority: priority, tag: m[2], msg: m[3]}
+}
+
+// newTestSyslogLogger 用JSON Encoder构建发送到cfg的syslog logger
+func newTestSyslogLogger(t *testing.T, cfg SyslogConfig, clock Clock) (*zap.Logger, *syslogSink) {
+	t.Helper()
+	encCfg := zap.NewProductionEncoderConfig()
+	encCfg.TimeKey = ""
+	core, closer, err := newSyslogCore(cfg, zapcore.NewJSONEncoder(encCfg), zapcore.DebugLevel, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closer.Close() })
+	return zap.New(core, zap.ErrorOutput(zapcore.AddSync(ioutil.Discard))), closer.(*syslogSink)
+}
+
+func TestSyslogSeverityOverUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	l, _ := newTestSyslogLogger(t, SyslogConfig{Network: "udp", Addr: conn.LocalAddr().String(), Tag: "myapp", Facility: "local0"}, defaultClock)
+
+	const local0 = 16 << 3
+	tests := []struct {
+		level    zapcore.Level
+		severity int
+	}{
+		{zapcore.DebugLevel, 7},
+		{zapcore.InfoLevel, 6},
+		{zapcore.WarnLevel, 4},
+		{zapcore.ErrorLevel, 3},
+		{zapcore.DPanicLevel, 2},
+	}
+	for _, tt := range tests {
+		if ce := l.Check(tt.level, "to syslog"); ce != nil {
+			ce.Write(zap.String("k", "v"))
+		}
+		got := readSyslog(t, conn)
+		if got.priority != local0|tt.severity {
+			t.Errorf("%v: priority = %d, want %d", tt.level, got.priority, local0|tt.severity)
+		}
+		if got.tag != "myapp" {
+			t.Errorf("%v: tag = %q", tt.level, got.tag)
+		}
+		want := `{"level":"` + tt.level.String() + `","msg":"to syslog","k":"v"}`
+		if got.msg != want {
+			t.Errorf("%v: msg = %s, want %s", tt.level, got.msg, want)
+		}
+	}
+}
+
+func TestSyslogReconnectsWithPending(t *testing.T) {
+	addr := filepath.Join(tempDir(t), "syslog.sock")
+	listen := func() net.PacketConn {
+		os.Remove(addr) // unixgram的socket文件在Close之后还在
+		conn, err := net.ListenPacket("unixgram", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	conn := listen()
+	clock := NewManualClock(fixedTime)
+	l, sink := newTestSyslogLogger(t, SyslogConfig{Network: "unixgram", Addr: addr, Tag: "myapp", MaxPending: 2}, clock)
+	l.Info("before restart")
+	if got := readSyslog(t, conn); !strings.Contains(got.msg, "before restart") {
+		t.Fatalf("msg = %s", got.msg)
+	}
+
+	// syslog守护进程重启期间发送失败，日志缓存起来，超过MaxPending时丢弃最早的
+	conn.Close()
+	l.Info("lost")
+	l.Info("pending 1")
+	l.Info("pending 2")
+	sink.mu.Lock()
+	pending, connected := len(sink.pending), sink.w != nil
+	sink.mu.Unlock()
+	if pending != 2 || connected {
+		t.Fatalf("pending = %d, connected = %v, want 2 cached entries while disconnected", pending, connected)
+	}
+
+	conn = listen()
+	defer conn.Close()
+	// 还在退避时间内时不重连
+	if err := l.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	sink.mu.Lock()
+	connected = sink.w != nil
+	sink.mu.Unlock()
+	if connected {
+		t.Fatal("should wait for the backoff before reconnecting")
+	}
+
+	// 退避时间过后Sync重连并按顺序发出缓存的日志
+	clock.Add(syslogMaxBackoff)
+	if err := l.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("after restart")
+	for _, want := range []string{"pending 1", "pending 2", "after restart"} {
+		if got := readSyslog(t, conn); !strings.Contains(got.msg, `"msg":"`+want+`"`) {
+			t.Errorf("msg = %s, want %s", got.msg, want)
+		}
+	}
+}
+
+func TestSyslogConfigValidate(t *testing.T) {
+	tests := []struct {
+		cfg     SyslogConfig
+		wantErr string
+	}{
+		{cfg: SyslogConfig{}},
+		{cfg: SyslogConfig{Network: "udp", Addr: "127.0.0.1:514", Facility: "LOCAL7"}},
+		{cfg: SyslogConfig{Facility: "local8"}, wantErr: `unknown syslog facility "local8"`},
+		{cfg: SyslogConfig{Network: "udp"}, wantErr: "syslog addr must not be empty for network udp"},
+		{cfg: SyslogConfig{Network: "http", Addr: "x"}, wantErr: `unknown syslog network "http"`},
+		{cfg: SyslogConfig{MaxPending: -1}, wantErr: "syslog max pending must not be negative"},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.validate()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%+v: validate() = %v, want %q", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
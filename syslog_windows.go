@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"io"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// newSyslogCore Windows上没有log/syslog，配置了Syslog时返回错误
+func newSyslogCore(cfg SyslogConfig, enc zapcore.Encoder, level zapcore.LevelEnabler, clock Clock) (zapcore.Core, io.Closer, error) {
+	return nil, nil, errors.New("log config: syslog is not supported on windows")
+}
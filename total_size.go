@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"time"
+)
+
+/*
+=============================================================
+备份总大小上限
+MaxBackups限制个数、MaxAge限制天数，都限制不了总大小：5个1GB的备份还是5GB。
+配置MaxTotalSizeMB后，每次切割（包括FilenamePattern换文件）之后统计所有备份的大小，
+从最旧的开始删除，直到总大小不超过上限。压缩和未压缩的备份都计入，正在写的文件不会被删除。
+与lumberjack清理备份一样，删除失败会被忽略，不影响日志写入。
+*/
+
+// backupFile 一个备份文件
+type backupFile struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// limitTotalSize 删除最旧的备份，直到names中除active之外的文件总大小不超过limit
+func limitTotalSize(active string, names map[string]bool, limit int64) error {
+	var files []backupFile
+	var total int64
+	for name := range names {
+		if name == active {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, backupFile{name: name, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}
+	// 旧的在前，修改时间相同时按文件名，备份文件名中的时间靠前的文件名也靠前
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].modTime.Equal(files[j].modTime) {
+			return files[i].modTime.Before(files[j].modTime)
+		}
+		return files[i].name < files[j].name
+	})
+	var firstErr error
+	for _, f := range files {
+		if total <= limit {
+			break
+		}
+		if err := os.Remove(f.name); err != nil && !os.IsNotExist(err) {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		total -= f.size
+	}
+	return firstErr
+}
+
+// limitTotalSizeLocked 按MaxTotalSizeMB清理当前文件和FilenamePattern匹配的所有旧文件的备份，调用方需要持有w.mu
+func (w *fileWriteSyncer) limitTotalSizeLocked() error {
+	if w.maxTotalBytes <= 0 {
+		return nil
+	}
+	names := backupNames(w.lj.Filename)
+	if w.dated != nil {
+		dated, err := datedFileNames(w.dated.cfg.FilenamePattern)
+		if err != nil {
+			return err
+		}
+		for name := range dated {
+			names[name] = true
+		}
+	}
+	return limitTotalSize(w.lj.Filename, names, w.maxTotalBytes)
+}
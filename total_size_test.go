@@ -0,0 +1,113 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimitTotalSizeDeletesOldestFirst(t *testing.T) {
+	dir := tempDir(t)
+	active := filepath.Join(dir, "app.log")
+	base := time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC)
+	seedFile(t, active, 500, base.Add(time.Hour))
+	names := map[string]bool{active: true}
+	// 修改时间依次变新，压缩和未压缩的备份混在一起
+	for i, f := range []struct {
+		name string
+		size int
+	}{
+		{"app-2024-05-13T00-00-00.000.log.gz", 100},
+		{"app-2024-05-14T00-00-00.000.log", 300},
+		{"app-2024-05-15T00-00-00.000.log.zst", 200},
+		{"app-2024-05-16T00-00-00.000.log", 250},
+		{"app-2024-05-16T12-00-00.000.log.gz", 150},
+	} {
+		path := filepath.Join(dir, f.name)
+		seedFile(t, path, f.size, base.Add(time.Duration(i-5)*time.Hour))
+		names[path] = true
+	}
+
+	// 总共1000字节，删掉最旧的三个（600字节）之后才不超过450
+	if err := limitTotalSize(active, names, 450); err != nil {
+		t.Fatal(err)
+	}
+	want := "app-2024-05-16T00-00-00.000.log,app-2024-05-16T12-00-00.000.log.gz,app.log"
+	if got := dirNames(t, dir); strings.Join(got, ",") != want {
+		t.Errorf("files = %v, want %s", got, want)
+	}
+
+	// 正在写的文件不计入总大小，也不会被删除
+	if err := limitTotalSize(active, names, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := dirNames(t, dir); strings.Join(got, ",") != "app.log" {
+		t.Errorf("files = %v, want only the active file", got)
+	}
+}
+
+func TestLimitTotalSizeSameModTime(t *testing.T) {
+	dir := tempDir(t)
+	modTime := time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC)
+	names := make(map[string]bool)
+	for _, name := range []string{
+		"app-2024-05-16T00-00-00.000.log",
+		"app-2024-05-14T00-00-00.000.log",
+		"app-2024-05-15T00-00-00.000.log",
+	} {
+		path := filepath.Join(dir, name)
+		seedFile(t, path, 100, modTime)
+		names[path] = true
+	}
+	// 修改时间相同时按文件名中的时间，旧的先删
+	if err := limitTotalSize(filepath.Join(dir, "app.log"), names, 150); err != nil {
+		t.Fatal(err)
+	}
+	if got := dirNames(t, dir); strings.Join(got, ",") != "app-2024-05-16T00-00-00.000.log" {
+		t.Errorf("files = %v", got)
+	}
+}
+
+func TestMaxTotalSizeAfterRotate(t *testing.T) {
+	clock := NewManualClock(fixedTime)
+	b, cfg := newClockedFileLogger(t, clock, func(cfg *LogConfig) {
+		cfg.MaxTotalSizeMB = 1
+		// 只按总大小清理，避免lumberjack按个数和天数删除预先放好的备份
+		cfg.MaxBackups = 0
+		cfg.MaxAge = 0
+	})
+	dir := filepath.Dir(cfg.Filename)
+	base := time.Now().Add(-time.Hour)
+	var seeded []string
+	for i, name := range []string{
+		"test-2024-05-14T00-00-00.000.log.gz",
+		"test-2024-05-15T00-00-00.000.log",
+		"test-2024-05-16T00-00-00.000.log",
+	} {
+		path := filepath.Join(dir, name)
+		seedFile(t, path, 400*1024, base.Add(time.Duration(i)*time.Minute))
+		seeded = append(seeded, path)
+	}
+	unrelated := filepath.Join(dir, "notes.txt")
+	seedFile(t, unrelated, 2*bytesPerMB, base)
+
+	b.logger.Info("before rotate")
+	if err := b.rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups := logBackups(t, cfg)
+	sort.Strings(backups)
+	// 1.2MB的旧备份加上刚切出的备份超过1MB，只需要删掉最旧的.gz
+	if len(backups) != 3 || backups[0] != seeded[1] || backups[1] != seeded[2] {
+		t.Fatalf("backups = %v", backups)
+	}
+	if !strings.Contains(readFile(t, backups[2]), "before rotate") {
+		t.Errorf("the new backup should be kept:\n%s", readFile(t, backups[2]))
+	}
+	if fileSize(unrelated) != 2*bytesPerMB {
+		t.Error("files that are not backups must not be touched")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strconv"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+=============================================================
+字段长度限制
+GinRecovery会记录整个请求和完整的堆栈，一个带超大header的请求就能产生几MB的一行日志，把下游解析打挂。
+配置MaxFieldBytes后，超过限制的字符串字段被截断，末尾加上"...(truncated, N bytes)"（N为原长度），
+并在日志上加一个truncated_fields字段记录被截断的字段数。
+*/
+
+// truncatedFieldsKey 记录被截断字段数的key
+const truncatedFieldsKey = "truncated_fields"
+
+// truncateCore 写出前截断过长的字符串字段。
+// 包在每个输出的core外面而不是整个Tee外面，这样各个core自己的级别过滤仍然生效
+type truncateCore struct {
+	zapcore.Core
+	max int
+}
+
+// newTruncateCore max<=0时直接返回core
+func newTruncateCore(core zapcore.Core, max int) zapcore.Core {
+	if max <= 0 {
+		return core
+	}
+	return &truncateCore{core, max}
+}
+
+func (c *truncateCore) With(fields []zapcore.Field) zapcore.Core {
+	fields, n := truncateFields(fields, c.max)
+	if n > 0 {
+		fields = append(fields, zap.Int(truncatedFieldsKey, n))
+	}
+	return &truncateCore{c.Core.With(fields), c.max}
+}
+
+func (c *truncateCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *truncateCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	fields, n := truncateFields(fields, c.max)
+	if len(ent.Stack) > c.max {
+		ent.Stack = truncateString(ent.Stack, c.max)
+		n++
+	}
+	if n > 0 {
+		fields = append(fields, zap.Int(truncatedFieldsKey, n))
+	}
+	return c.Core.Write(ent, fields)
+}
+
+// truncateFields 截断超过max字节的字符串字段，返回处理后的fields和被截断的字段数。
+// 没有需要截断的字段时返回原slice
+func truncateFields(fields []zapcore.Field, max int) ([]zapcore.Field, int) {
+	var out []zapcore.Field
+	n := 0
+	for i, f := range fields {
+		if f.Type != zapcore.StringType || len(f.String) <= max {
+			continue
+		}
+		if out == nil {
+			out = make([]zapcore.Field, len(fields), len(fields)+1)
+			copy(out, fields)
+		}
+		out[i].String = truncateString(f.String, max)
+		n++
+	}
+	if out == nil {
+		return fields, 0
+	}
+	return out, n
+}
+
+// truncateString 保留s的前max字节（不截断UTF-8字符），并注明原长度
+func truncateString(s string, max int) string {
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "...(truncated, " + strconv.Itoa(len(s)) + " bytes)"
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+/*
+=============================================================
+启动时清空日志文件
+短时间运行的批处理和本地实验希望每次运行都从空的test.log开始，而不是一直追加。
+配置TruncateOnStart后，打开日志文件时（第一次写入之前）按TruncateMode处理已有的日志文件：
+truncate（默认）直接清空；rotate像切割一样把它改名为备份（之后照常压缩、清理），再写新文件。
+文件不存在或为空时什么都不做，已有的备份不受影响。重新加载配置不会触发。
+*/
+
+// TruncateMode的取值
+const (
+	TruncateModeTruncate = "truncate" // 清空已有的日志文件，默认
+	TruncateModeRotate   = "rotate"   // 把已有的日志文件切割为备份
+)
+
+// validateTruncateMode 检查TruncateMode
+func validateTruncateMode(mode string) error {
+	switch mode {
+	case "", TruncateModeTruncate, TruncateModeRotate:
+		return nil
+	}
+	return fmt.Errorf("log config: unknown truncate mode %q, want %s or %s", mode, TruncateModeTruncate, TruncateModeRotate)
+}
+
+// truncateOnStart 配置了TruncateOnStart时清空或切割走已有的非空日志文件
+func (w *fileWriteSyncer) truncateOnStart(cfg LogConfig) error {
+	if !cfg.TruncateOnStart {
+		return nil
+	}
+	info, err := os.Stat(cfg.Filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+	if cfg.TruncateMode == TruncateModeRotate {
+		return w.Rotate()
+	}
+	if err := os.Truncate(cfg.Filename, 0); err != nil {
+		return fmt.Errorf("truncate log file %s: %v", cfg.Filename, err)
+	}
+	w.mu.Lock()
+	w.size = 0
+	w.mu.Unlock()
+	return nil
+}
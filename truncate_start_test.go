@@ -0,0 +1,157 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// oldBackupName 启动前已经存在的备份
+const oldBackupName = "test-2024-05-16T10-00-00.000.log"
+
+// seedLogDir 在临时目录下写入已有的日志文件和一个备份，content为空时不创建日志文件
+func seedLogDir(t *testing.T, content string) LogConfig {
+	t.Helper()
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.Encoding = EncodingJSON
+	cfg.MaxAge = 0 // 备份的日期早于MaxAge，lumberjack会在后台删掉它
+	dir := filepath.Dir(cfg.Filename)
+	if err := ioutil.WriteFile(filepath.Join(dir, oldBackupName), []byte("old backup\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if content != "" {
+		if err := ioutil.WriteFile(cfg.Filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cfg
+}
+
+// startLogger 按cfg创建logger，写一条日志后关闭
+func startLogger(t *testing.T, cfg LogConfig) {
+	t.Helper()
+	b, err := newLogger(WithConfig(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.logger.Info("new run")
+	b.close()
+}
+
+// checkOldBackup 检查启动前已有的备份没有被改动
+func checkOldBackup(t *testing.T, cfg LogConfig) {
+	t.Helper()
+	if got := readFile(t, filepath.Join(filepath.Dir(cfg.Filename), oldBackupName)); got != "old backup\n" {
+		t.Errorf("existing backup changed: %q", got)
+	}
+}
+
+func TestTruncateOnStartTruncate(t *testing.T) {
+	for _, mode := range []string{"", TruncateModeTruncate} {
+		t.Run("mode "+mode, func(t *testing.T) {
+			cfg := seedLogDir(t, "previous run\n")
+			cfg.TruncateOnStart = true
+			cfg.TruncateMode = mode
+			startLogger(t, cfg)
+
+			active := readFile(t, cfg.Filename)
+			if strings.Contains(active, "previous run") || !strings.Contains(active, "new run") {
+				t.Errorf("active file:\n%s", active)
+			}
+			if backups := logBackups(t, cfg); len(backups) != 1 {
+				t.Errorf("backups = %v, truncate should not create a backup", backups)
+			}
+			checkOldBackup(t, cfg)
+		})
+	}
+}
+
+func TestTruncateOnStartRotate(t *testing.T) {
+	cfg := seedLogDir(t, "previous run\n")
+	cfg.TruncateOnStart = true
+	cfg.TruncateMode = TruncateModeRotate
+	startLogger(t, cfg)
+
+	active := readFile(t, cfg.Filename)
+	if strings.Contains(active, "previous run") || !strings.Contains(active, "new run") {
+		t.Errorf("active file:\n%s", active)
+	}
+	backups := logBackups(t, cfg)
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want the old backup and the previous run", backups)
+	}
+	var rotated string
+	for _, name := range backups {
+		if filepath.Base(name) != oldBackupName {
+			rotated = readFile(t, name)
+		}
+	}
+	if rotated != "previous run\n" {
+		t.Errorf("rotated backup = %q, want the previous run", rotated)
+	}
+	checkOldBackup(t, cfg)
+}
+
+func TestTruncateOnStartMissingOrEmptyFile(t *testing.T) {
+	for _, mode := range []string{TruncateModeTruncate, TruncateModeRotate} {
+		t.Run(mode, func(t *testing.T) {
+			cfg := seedLogDir(t, "")
+			cfg.TruncateOnStart = true
+			cfg.TruncateMode = mode
+			startLogger(t, cfg)
+			if lines := readLines(t, cfg.Filename); len(lines) != 2 || !strings.Contains(lines[1], "new run") {
+				t.Errorf("active file lines = %q", lines)
+			}
+
+			// 文件存在但为空时也不切割
+			cfg = seedLogDir(t, "")
+			cfg.TruncateOnStart = true
+			cfg.TruncateMode = mode
+			if err := ioutil.WriteFile(cfg.Filename, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			startLogger(t, cfg)
+			if backups := logBackups(t, cfg); len(backups) != 1 {
+				t.Errorf("backups = %v, an empty file should not be rotated", backups)
+			}
+			checkOldBackup(t, cfg)
+		})
+	}
+}
+
+func TestTruncateOnStartDisabledAppends(t *testing.T) {
+	cfg := seedLogDir(t, "previous run\n")
+	cfg.TruncateMode = TruncateModeRotate
+	startLogger(t, cfg)
+	active := readFile(t, cfg.Filename)
+	if !strings.HasPrefix(active, "previous run\n") || !strings.Contains(active, "new run") {
+		t.Errorf("without TruncateOnStart the file should be appended to:\n%s", active)
+	}
+	if backups := logBackups(t, cfg); len(backups) != 1 {
+		t.Errorf("backups = %v", backups)
+	}
+}
+
+func TestTruncateOnStartResetsSize(t *testing.T) {
+	cfg := seedLogDir(t, strings.Repeat("x", 900)+"\n")
+	cfg.TruncateOnStart = true
+	cfg.MaxSizeBytes = 1000
+	startLogger(t, cfg)
+	// 清空后从0开始计算大小，新写的几百字节不应触发切割
+	if backups := logBackups(t, cfg); len(backups) != 1 {
+		t.Errorf("backups = %v, the truncated size should not count towards MaxSizeBytes", backups)
+	}
+}
+
+func TestValidateTruncateMode(t *testing.T) {
+	for _, mode := range []string{"", TruncateModeTruncate, TruncateModeRotate} {
+		if err := validateTruncateMode(mode); err != nil {
+			t.Errorf("validateTruncateMode(%q) = %v", mode, err)
+		}
+	}
+	if err := validateTruncateMode("delete"); err == nil || !strings.Contains(err.Error(), `unknown truncate mode "delete"`) {
+		t.Errorf("validateTruncateMode(delete) = %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestMaxFieldBytesGinRecovery(t *testing.T) {
+	const limit = 1024
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.Encoding = EncodingJSON
+	cfg.MaxFieldBytes = limit
+	b, err := newLogger(WithConfig(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(GinRecovery(b.logger, true))
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	req.Header.Set("X-Hostile", strings.Repeat("A", 1<<20))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	b.close()
+
+	lines := readLines(t, cfg.Filename)
+	line := lines[len(lines)-1]
+	// request、stack各不超过limit加上后缀，再算上JSON转义和其他字段
+	if len(line) > 4*limit {
+		t.Fatalf("line is %d bytes, want at most %d", len(line), 4*limit)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		t.Fatalf("truncated line should stay valid JSON: %v", err)
+	}
+	if m[truncatedFieldsKey] != float64(2) {
+		t.Errorf("%s = %v, want 2", truncatedFieldsKey, m[truncatedFieldsKey])
+	}
+	request, _ := m[requestFieldKey].(string)
+	if !strings.HasSuffix(request, " bytes)") || !strings.Contains(request, "...(truncated, ") {
+		t.Errorf("request should carry the truncation marker: %q", request[len(request)-40:])
+	}
+	if !strings.HasPrefix(request, "GET /panic HTTP/1.1") {
+		t.Errorf("request should keep its beginning: %q", request[:40])
+	}
+}
+
+func TestMaxFieldBytesShortFieldsUntouched(t *testing.T) {
+	out := &zaptest.Buffer{}
+	cfg := defaultLogConfig()
+	cfg.Filename = ""
+	cfg.Encoding = EncodingJSON
+	cfg.DisableCaller = true
+	cfg.MaxFieldBytes = 8
+	l, err := NewLogger(WithConfig(cfg), WithConsoleOutput(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.With(zap.String("ctx", "0123456789")).Info("hello", zap.String("short", "12345678"), zap.String("long", "123456789"))
+
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(out.Lines()[0]), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["short"] != "12345678" {
+		t.Errorf("short = %v, want untouched", m["short"])
+	}
+	if m["long"] != "12345678...(truncated, 9 bytes)" {
+		t.Errorf("long = %v", m["long"])
+	}
+	if m["ctx"] != "01234567...(truncated, 10 bytes)" {
+		t.Errorf("ctx = %v", m["ctx"])
+	}
+}
+
+func TestTruncateStringKeepsUTF8(t *testing.T) {
+	// "日"占3个字节，在第4个字节截断时退回到字符开头
+	if got, want := truncateString("a日本語", 3), "a...(truncated, 10 bytes)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"go.uber.org/multierr"
+)
+
+/*
+=============================================================
+只检查、不启动：上线前先验证日志配置
+  go run . --validate-log-config ./log.yaml
+会列出发现的所有问题，没有问题时以0退出，否则以1退出。
+检查目录是否可写时只在同一目录创建并删除一个临时文件，不会创建或清空真正的日志文件。
+*/
+
+// ValidateConfig 检查cfg的级别、编码、切割参数、目录可写性和时区，返回发现的全部问题，没有问题时返回nil
+func ValidateConfig(cfg LogConfig) []error {
+	filename, err := resolveLogPath(cfg.Filename, cfg.BaseDir)
+	if err != nil {
+		return []error{err}
+	}
+	cfg.Filename = filename
+	return multierr.Errors(cfg.Validate())
+}
+
+// validateConfigFile 读取YAML配置文件并检查，把结果写到w，返回是否通过
+func validateConfigFile(path string, w io.Writer) bool {
+	cfg, err := loadLogConfigFile(path)
+	if err != nil {
+		fmt.Fprintf(w, "%s: %v\n", path, err)
+		return false
+	}
+	errs := ValidateConfig(applyFlagOverrides(applyEnvOverrides(cfg)))
+	for _, err := range errs {
+		fmt.Fprintf(w, "%s: %v\n", path, err)
+	}
+	if len(errs) == 0 {
+		fmt.Fprintf(w, "%s: ok\n", path)
+	}
+	return len(errs) == 0
+}
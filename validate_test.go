@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateConfigReportsAllProblems(t *testing.T) {
+	dir := tempDir(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = filepath.Join(dir, "app.log")
+	cfg.Level = "verbose"
+	cfg.Encoding = "xml"
+	cfg.TimeZone = "Nowhere/City"
+
+	errs := ValidateConfig(cfg)
+	want := []string{"invalid log level", "invalid time zone", "unknown encoding"}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors %v, want %d", len(errs), errs, len(want))
+	}
+	all := ""
+	for _, err := range errs {
+		all += err.Error() + "\n"
+	}
+	for _, w := range want {
+		if !strings.Contains(all, w) {
+			t.Errorf("errors should report %q:\n%s", w, all)
+		}
+	}
+}
+
+func TestValidateConfigDoesNotTouchLogFile(t *testing.T) {
+	dir := tempDir(t)
+	cfg := defaultLogConfig()
+	cfg.Filename = filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(cfg.Filename, []byte("existing\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if errs := ValidateConfig(cfg); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if got := readFile(t, cfg.Filename); got != "existing\n" {
+		t.Errorf("log file changed to %q", got)
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("probe file left behind: %d entries in log dir", len(entries))
+	}
+
+	// 目录不存在时也不创建
+	cfg.Filename = filepath.Join(dir, "missing", "app.log")
+	if errs := ValidateConfig(cfg); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if _, err := os.Stat(filepath.Dir(cfg.Filename)); !os.IsNotExist(err) {
+		t.Errorf("validation should not create the log dir, stat err = %v", err)
+	}
+}
+
+func TestValidateConfigFile(t *testing.T) {
+	unsetLogEnv(t)
+	dir := tempDir(t)
+	good := filepath.Join(dir, "good.yaml")
+	bad := filepath.Join(dir, "bad.yaml")
+	logFile := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(good, []byte("filename: "+logFile+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(bad, []byte("filename: "+logFile+"\nlevel: loud\nmax_size: 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if !validateConfigFile(good, &out) || !strings.Contains(out.String(), good+": ok") {
+		t.Errorf("good config should pass, output:\n%s", out.String())
+	}
+	out.Reset()
+	if validateConfigFile(bad, &out) {
+		t.Error("bad config should fail")
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 {
+		t.Errorf("want one line per problem, got:\n%s", out.String())
+	}
+	if _, err := os.Stat(logFile); !os.IsNotExist(err) {
+		t.Errorf("validation should not create the log file, stat err = %v", err)
+	}
+}
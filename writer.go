@@ -0,0 +1,362 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/natefinch/lumberjack"
+	"go.uber.org/multierr"
+	"go.uber.org/zap/zapcore"
+)
+
+// fileWriteSyncer 包装lumberjack.Logger，Close之后的写入改为输出到stderr。
+// lumberjack在Close之后再次Write会重新打开文件，这里避免已关闭的logger继续占用文件句柄。
+type fileWriteSyncer struct {
+	mu     sync.Mutex
+	cfg    LogConfig // 打开文件使用的配置，重新加载配置时与新配置比较，见swap
+	clock  Clock
+	lj     *lumberjack.Logger
+	mode   os.FileMode // 日志文件的权限，0表示不处理
+	closed bool
+
+	rotation *timeRotation      // 按时间切割的策略，nil表示只按大小切割
+	schedule *scheduledRotation // 定点切割，nil表示没有配置RotateAt
+	dated    *datedFilename     // 带日期的文件名，nil表示没有配置FilenamePattern
+
+	maxBytes      int64 // 自己按大小切割的阈值，0表示交给lumberjack
+	size          int64 // 当前文件的字节数，只在maxBytes大于0时记录
+	maxTotalBytes int64 // MaxTotalSizeMB，大于0时每次切割后清理备份
+
+	backups *backupProcessor // 使用zstd或设置了OnRotate时在后台处理切割出的备份
+
+	retry  *retryWriteSyncer            // 写入失败时重试，nil表示不重试，见retry.go
+	buffer *zapcore.BufferedWriteSyncer // 缓冲写入，nil表示直接写文件，见buffer.go
+	async  *asyncWriteSyncer            // 异步写入，nil表示同步写，见async.go
+
+	errorOutput atomic.Value // 后台错误的输出，见reportError
+}
+
+func newFileWriteSyncer(lj *lumberjack.Logger, mode os.FileMode) *fileWriteSyncer {
+	return &fileWriteSyncer{lj: lj, mode: mode}
+}
+
+// fileParts 按LogConfig创建的文件和切割相关的部件，打开文件和重新加载配置时整体设置到fileWriteSyncer
+type fileParts struct {
+	lj       *lumberjack.Logger
+	rotation *timeRotation
+	schedule *scheduledRotation
+	dated    *datedFilename
+	backups  *backupProcessor
+}
+
+func newFileParts(cfg LogConfig, clock Clock) (fileParts, error) {
+	rotation, err := newTimeRotation(cfg, clock)
+	if err != nil {
+		return fileParts{}, err
+	}
+	schedule, err := newScheduledRotation(cfg, clock)
+	if err != nil {
+		return fileParts{}, err
+	}
+	dated, err := newDatedFilename(cfg, clock)
+	if err != nil {
+		return fileParts{}, err
+	}
+	return fileParts{
+		lj:       getLogWriter(cfg),
+		rotation: rotation,
+		schedule: schedule,
+		dated:    dated,
+		backups:  newBackupProcessor(cfg, clock),
+	}, nil
+}
+
+// setPartsLocked 换上按cfg创建的parts，并按cfg重新计算大小阈值、备份总大小和文件权限
+func (w *fileWriteSyncer) setPartsLocked(cfg LogConfig, parts fileParts) {
+	w.cfg = cfg
+	w.lj = parts.lj
+	w.mode = cfg.FileMode
+	w.rotation = parts.rotation
+	w.schedule = parts.schedule
+	w.dated = parts.dated
+	w.backups = parts.backups
+	if w.backups != nil {
+		w.backups.report = w.reportError
+	}
+	// 限制备份总大小或者需要处理备份时也自己按大小切割，这样每次切割之后都能处理备份；
+	// Windows上总是自己切割，改名失败时才能重试（见rotateFileLocked）
+	w.maxBytes, w.size = 0, 0
+	if cfg.MaxSizeBytes > 0 || cfg.MaxTotalSizeMB > 0 || w.backups != nil || rotateBySelf {
+		w.maxBytes = cfg.maxSizeBytes()
+		w.size = fileSize(cfg.Filename)
+	}
+	w.maxTotalBytes = int64(cfg.MaxTotalSizeMB) * bytesPerMB
+}
+
+// openFileWriteSyncer 按cfg创建lumberjack切割的文件，配置了按时间切割时使用clock判断时间
+func openFileWriteSyncer(cfg LogConfig, clock Clock) (*fileWriteSyncer, error) {
+	parts, err := newFileParts(cfg, clock)
+	if err != nil {
+		return nil, err
+	}
+	w := &fileWriteSyncer{clock: clock}
+	w.setPartsLocked(cfg, parts)
+	if cfg.CleanupOnStart {
+		if err := cleanupBackups(cfg, clock); err != nil {
+			return nil, err
+		}
+		if parts.dated != nil {
+			if err := parts.dated.cleanup(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := w.truncateOnStart(cfg); err != nil {
+		return nil, err
+	}
+	if parts.schedule != nil {
+		go parts.schedule.run(w)
+	}
+	return w, nil
+}
+
+func (w *fileWriteSyncer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.Stderr.Write(p)
+	}
+	if _, err := w.rotateIfDueLocked(); err != nil {
+		return 0, err
+	}
+	if w.maxBytes > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxBytes {
+		if err := w.rotateLocked(); err != nil {
+			return 0, err
+		}
+	}
+	if w.schedule != nil {
+		w.schedule.written(len(p))
+	}
+	n, err := w.lj.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// writeRest 补写一条日志只写了一部分时剩下的字节，不检查切割，否则按大小或时间切割会把这条日志分到两个文件中。
+// lumberjack自己按MaxSize切割时（maxBytes为0）仍可能在它内部切割
+func (w *fileWriteSyncer) writeRest(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.Stderr.Write(p)
+	}
+	n, err := w.lj.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// switchFileLocked FilenamePattern渲染出的文件名变化时换到新文件，关闭旧文件并清理过期的旧文件
+func (w *fileWriteSyncer) switchFileLocked(name string) error {
+	cfg, err := w.dated.switchTo(name)
+	if err != nil {
+		return err
+	}
+	old := w.lj
+	w.lj = getLogWriter(cfg)
+	w.size = fileSize(name)
+	atomic.AddUint64(&statRotations, 1)
+	if w.schedule != nil {
+		w.schedule.rotated()
+	}
+	if err := w.limitTotalSizeLocked(); err != nil {
+		w.reportError("limit total size of log backups failed", err)
+	}
+	return multierr.Append(old.Close(), w.dated.cleanup())
+}
+
+// rotateScheduled s到点时定点切割，文件为空或刚切割过时跳过；重新加载配置换掉了s时也跳过
+func (w *fileWriteSyncer) rotateScheduled(s *scheduledRotation) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || w.schedule != s || s.size == 0 || s.recentlyRotated() {
+		return nil
+	}
+	return w.rotateLocked()
+}
+
+// rotateIfDue 到了按时间切割的时间就切割，返回是否切割了
+func (w *fileWriteSyncer) rotateIfDue() (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return false, nil
+	}
+	return w.rotateIfDueLocked()
+}
+
+func (w *fileWriteSyncer) rotateIfDueLocked() (bool, error) {
+	if w.dated != nil {
+		if name, ok := w.dated.due(); ok {
+			return true, w.switchFileLocked(name)
+		}
+	}
+	if w.rotation == nil || !w.rotation.due() {
+		return false, nil
+	}
+	return true, w.rotateLocked()
+}
+
+// Sync lumberjack没有缓冲，每次Write都直接写文件，所以这里什么都不用做
+func (w *fileWriteSyncer) Sync() error {
+	return nil
+}
+
+// swap 按cfg换上新的文件和切割设置，之后的写入都进入新文件，返回关闭旧文件的函数。
+// 文件名、大小阈值、备份数量和总大小、压缩、manifest、文件权限、FilenamePattern和按时间切割都按cfg重建；
+// OnRotate不能写在配置文件里，cfg中没有时沿用原来的。已经Close时不替换，返回nil
+func (w *fileWriteSyncer) swap(cfg LogConfig) (closeOld func() error, err error) {
+	w.mu.Lock()
+	if cfg.OnRotate == nil {
+		cfg.OnRotate = w.cfg.OnRotate
+	}
+	w.mu.Unlock()
+	parts, err := newFileParts(cfg, w.clock)
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil, nil
+	}
+	old := fileParts{lj: w.lj, schedule: w.schedule, backups: w.backups}
+	w.setPartsLocked(cfg, parts)
+	w.mu.Unlock()
+
+	// 旧的定点切割goroutine可能正在等w.mu，解锁之后再停止它
+	if old.schedule != nil {
+		old.schedule.close()
+	}
+	if parts.schedule != nil {
+		go parts.schedule.run(w)
+	}
+	return func() error {
+		if old.backups != nil {
+			old.backups.wait()
+		}
+		return old.lj.Close()
+	}, nil
+}
+
+// sameSettings 判断cfg与当前使用的文件名和切割配置是否相同
+func (w *fileWriteSyncer) sameSettings(cfg LogConfig) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	cur := w.cfg
+	return cur.Filename == cfg.Filename &&
+		cur.FilenamePattern == cfg.FilenamePattern &&
+		cur.DailyDirs == cfg.DailyDirs &&
+		cur.MaxSize == cfg.MaxSize &&
+		cur.MaxSizeBytes == cfg.MaxSizeBytes &&
+		cur.MaxBackups == cfg.MaxBackups &&
+		cur.MaxAge == cfg.MaxAge &&
+		cur.MaxTotalSizeMB == cfg.MaxTotalSizeMB &&
+		cur.Compress == cfg.Compress &&
+		cur.Compression == cfg.Compression &&
+		cur.Manifest == cfg.Manifest &&
+		cur.BackupLocalTime == cfg.BackupLocalTime &&
+		cur.FileMode == cfg.FileMode &&
+		cur.RotateDaily == cfg.RotateDaily &&
+		cur.RotateEvery == cfg.RotateEvery &&
+		cur.RotateAt == cfg.RotateAt
+}
+
+// Rotate 让lumberjack立即切割：当前文件改名为备份，之后的写入进入新文件
+func (w *fileWriteSyncer) Rotate() error {
+	_ = w.flushBuffer() // 缓冲中的日志属于切割前的文件
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	return w.rotateLocked()
+}
+
+func (w *fileWriteSyncer) rotateLocked() error {
+	var before map[string]bool
+	if w.backups != nil {
+		before = backupNames(w.lj.Filename)
+	}
+	if err := w.rotateFileLocked(); err != nil {
+		return err
+	}
+	atomic.AddUint64(&statRotations, 1)
+	if w.backups != nil {
+		var backups []string
+		for name := range backupNames(w.lj.Filename) {
+			if !before[name] && trimCompressedSuffix(name) == name {
+				backups = append(backups, name)
+			}
+		}
+		w.backups.processAsync(backups)
+	}
+	w.size = 0
+	if w.schedule != nil {
+		w.schedule.rotated()
+	}
+	if err := w.limitTotalSizeLocked(); err != nil {
+		w.reportError("limit total size of log backups failed", err)
+	}
+	// 文件被外部删除后lumberjack会以0644新建，这里再保证一次权限
+	return enforceFileMode(w.lj.Filename, w.mode)
+}
+
+// rotateAndFindBackup 切割并返回当前写入的文件和新生成的备份文件，没有找到备份时backup为空
+func (w *fileWriteSyncer) rotateAndFindBackup() (active, backup string, err error) {
+	_ = w.flushBuffer()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	active = w.lj.Filename
+	if w.closed {
+		return active, "", nil
+	}
+	before := backupNames(active)
+	if err := w.rotateLocked(); err != nil {
+		return active, "", err
+	}
+	for name := range backupNames(active) {
+		if !before[name] {
+			return active, name, nil
+		}
+	}
+	return active, "", nil
+}
+
+// Close 关闭底层的文件句柄，可重复调用
+func (w *fileWriteSyncer) Close() error {
+	var err error
+	if w.async != nil {
+		err = w.async.Close() // 先把异步队列写完，可重复调用
+	}
+	if w.buffer != nil {
+		err = multierr.Append(err, w.buffer.Stop()) // 再把缓冲写进文件，可重复调用
+	}
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return err
+	}
+	w.closed = true
+	err = multierr.Append(err, w.lj.Close())
+	w.mu.Unlock()
+	// 定点切割的goroutine可能正在等w.mu，解锁之后再停止它，并等待后台处理完备份
+	if w.schedule != nil {
+		w.schedule.close()
+	}
+	if w.backups != nil {
+		w.backups.wait()
+	}
+	return err
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// rotateOnce 写一条日志后切割，返回新生成的备份文件
+func rotateOnce(t *testing.T, b *builtLogger) string {
+	t.Helper()
+	b.logger.Info("before rotate")
+	_, backup, err := b.file.rotateAndFindBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup == "" {
+		t.Fatal("rotation did not create a backup")
+	}
+	return backup
+}
+
+// backupTime 解析lumberjack备份文件名中的时间戳，如test-2024-05-17T10-00-00.000.log
+func backupTime(t *testing.T, active, backup string, loc *time.Location) time.Time {
+	t.Helper()
+	ext := filepath.Ext(active)
+	prefix := strings.TrimSuffix(filepath.Base(active), ext) + "-"
+	stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(backup), prefix), ext)
+	ts, err := time.ParseInLocation("2006-01-02T15-04-05.000", stamp, loc)
+	if err != nil {
+		t.Fatalf("backup name %s: %v", filepath.Base(backup), err)
+	}
+	return ts
+}
+
+// envBackupLocalTime 设置时TestBackupLocalTime在子进程中运行
+const envBackupLocalTime = "ZAP_LUMBERJACK_BACKUP_LOCAL_TIME"
+
+// backupLocalZone 和UTC相差5.5小时，两种时间戳不会混淆
+const backupLocalZone = "Asia/Kolkata"
+
+func TestBackupLocalTime(t *testing.T) {
+	if os.Getenv(envBackupLocalTime) == "" {
+		// 其他测试留下的lumberjack goroutine会读time.Local，不能在进程内修改，用TZ在子进程中设置本地时区
+		if _, err := time.LoadLocation(backupLocalZone); err != nil {
+			t.Skipf("time zone %s not available: %v", backupLocalZone, err)
+		}
+		cmd := exec.Command(os.Args[0], "-test.run=^TestBackupLocalTime$")
+		cmd.Env = append(os.Environ(), envBackupLocalTime+"=1", "TZ="+backupLocalZone)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("subprocess: %v\n%s", err, out)
+		}
+		return
+	}
+
+	local := time.Local
+	if _, offset := time.Now().Zone(); offset != 5*3600+1800 {
+		t.Fatalf("local offset = %ds, want TZ=%s", offset, backupLocalZone)
+	}
+	tests := []struct {
+		localTime bool
+		loc       *time.Location
+	}{
+		{localTime: false, loc: time.UTC},
+		{localTime: true, loc: local},
+	}
+	for _, tt := range tests {
+		t.Run(tt.loc.String(), func(t *testing.T) {
+			cfg := defaultLogConfig()
+			cfg.Filename = tempLogFile(t)
+			cfg.BackupLocalTime = tt.localTime
+			b, err := newLogger(WithConfig(cfg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.close()
+			backup := rotateOnce(t, b)
+
+			ts := backupTime(t, cfg.Filename, backup, tt.loc)
+			if d := time.Since(ts); d < -time.Minute || d > time.Minute {
+				t.Errorf("backup %s read as %s time is %v away from now", filepath.Base(backup), tt.loc, d)
+			}
+		})
+	}
+}
+
+// gunzipFile 返回gzip文件解压后的内容
+func gunzipFile(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// waitForBackup 等待active出现后缀为suffix的备份文件并返回。
+// 压缩的备份要等未压缩的原文件被删除，这时.gz才写完
+func waitForBackup(t *testing.T, active, suffix string) string {
+	t.Helper()
+	dir, name := filepath.Split(active)
+	prefix := strings.TrimSuffix(name, filepath.Ext(name))
+	var backup string
+	waitFor(t, 5*time.Second, "backup with suffix "+suffix, func() bool {
+		for _, path := range backupFiles(t, dir, prefix, name) {
+			if !strings.HasSuffix(path, suffix) {
+				continue
+			}
+			if _, err := os.Stat(trimCompressedSuffix(path)); strings.HasSuffix(path, ".gz") && !os.IsNotExist(err) {
+				continue
+			}
+			backup = path
+			return true
+		}
+		return false
+	})
+	return backup
+}
+
+func TestCompressBackupKeepsEntries(t *testing.T) {
+	cfg := defaultLogConfig()
+	cfg.Filename = tempLogFile(t)
+	cfg.Encoding = EncodingJSON
+	cfg.Compress = true
+	b, err := newLogger(WithConfig(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.logger.Info("用户登录成功", zap.String("用户", "张三"))
+	b.logger.Warn("磁盘空间不足 ⚠", zap.String("emoji", "🚀"))
+	before := readLines(t, cfg.Filename)
+	if _, _, err := b.file.rotateAndFindBackup(); err != nil {
+		t.Fatal(err)
+	}
+	b.close()
+
+	backup := waitForBackup(t, cfg.Filename, ".log.gz")
+	got := strings.Split(strings.TrimSuffix(gunzipFile(t, backup), "\n"), "\n")
+	if !reflect.DeepEqual(got, before) {
+		t.Errorf("decompressed backup differs from the original entries:\ngot  %q\nwant %q", got, before)
+	}
+	for _, line := range got {
+		if !utf8.ValidString(line) {
+			t.Errorf("invalid UTF-8 in %q", line)
+		}
+	}
+}
+
+func TestCompressPerLogger(t *testing.T) {
+	dir := tempDir(t)
+	cfgs := managerConfigs(dir, "app", "access")
+	cfgs[0].Compress = true
+	cfgs[1].Compress = false
+	m, err := NewLoggerManager(cfgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Get("app").Info("应用日志")
+	m.Get("access").Info("访问日志")
+	if err := m.RotateAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CloseAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	if backup := waitForBackup(t, cfgs[0].Filename, ".gz"); !strings.Contains(gunzipFile(t, backup), "应用日志") {
+		t.Errorf("app backup %s should hold the app entry", backup)
+	}
+	accessBackups := backupFiles(t, dir, "access-", "")
+	if len(accessBackups) != 1 || strings.HasSuffix(accessBackups[0], ".gz") {
+		t.Fatalf("access backups = %v, want one uncompressed file", accessBackups)
+	}
+	if !strings.Contains(readFile(t, accessBackups[0]), "访问日志") {
+		t.Errorf("access backup should hold the access entry")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+/*
+=============================================================
+zstd压缩备份
+gzip压缩的备份仍然很大、压缩也慢。Compression配置为zstd时不再让lumberjack压缩，
+每次切割之后在后台把新生成的备份压缩为.zst（见backupProcessor），压缩文件fsync成功之后才删除原文件。
+lumberjack清理备份时只认识.gz，所以压缩完成后再按MaxAge、MaxBackups、MaxTotalSizeMB
+清理一遍（见cleanupBackups），.zst文件也计入。
+*/
+
+// Compression的取值
+const (
+	CompressionNone = "none" // 不压缩
+	CompressionGzip = "gzip" // lumberjack压缩为.gz
+	CompressionZstd = "zstd" // 切割后压缩为.zst
+)
+
+// compressedSuffixes 压缩后的备份在原文件名后追加的后缀
+var compressedSuffixes = []string{".gz", ".zst"}
+
+// withCompressedSuffixes 返回name以及加上各种压缩后缀的名字
+func withCompressedSuffixes(name string) []string {
+	names := []string{name}
+	for _, suffix := range compressedSuffixes {
+		names = append(names, name+suffix)
+	}
+	return names
+}
+
+// trimCompressedSuffix 去掉name的压缩后缀
+func trimCompressedSuffix(name string) string {
+	for _, suffix := range compressedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// compression 实际使用的压缩方式：Compression为空时按Compress决定是否gzip
+func (cfg LogConfig) compression() string {
+	if cfg.Compression != "" {
+		return strings.ToLower(strings.TrimSpace(cfg.Compression))
+	}
+	if cfg.Compress {
+		return CompressionGzip
+	}
+	return CompressionNone
+}
+
+// validateCompression 检查Compression，与Compress冲突时报错
+func (cfg LogConfig) validateCompression() error {
+	switch c := cfg.compression(); c {
+	case CompressionNone, CompressionZstd:
+		if cfg.Compress {
+			return fmt.Errorf("log config: compress cannot be used with compression %s", c)
+		}
+		return nil
+	case CompressionGzip:
+		return nil
+	}
+	return fmt.Errorf("log config: unknown compression %q, want %s, %s or %s",
+		cfg.Compression, CompressionNone, CompressionGzip, CompressionZstd)
+}
+
+// compressFile 用newWriter把src压缩为dst，dst fsync成功之后才删除src
+func compressFile(src, dst string, newWriter func(io.Writer) (io.WriteCloser, error)) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(dst)
+		}
+	}()
+	enc, err := newWriter(out)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(enc, in); err != nil {
+		enc.Close()
+		return err
+	}
+	if err = enc.Close(); err != nil {
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
+
+// newZstdWriter compressFile使用的zstd压缩
+func newZstdWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w)
+}
+
+// newGzipWriter compressFile使用的gzip压缩，设置了OnRotate时代替lumberjack压缩
+func newGzipWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// unzstdFile 返回zstd文件解压后的内容
+func unzstdFile(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestZstdBackupRoundTrip(t *testing.T) {
+	b, cfg := newClockedFileLogger(t, NewManualClock(fixedTime), func(cfg *LogConfig) {
+		cfg.Compression = CompressionZstd
+		cfg.MaxAge = 0
+	})
+	for i := 0; i < 200; i++ {
+		b.logger.Info("before rotate, 压缩前的日志")
+	}
+	before := readLines(t, cfg.Filename)
+	if err := b.rotate(); err != nil {
+		t.Fatal(err)
+	}
+	b.file.backups.wait()
+
+	backups := logBackups(t, cfg)
+	if len(backups) != 1 || !strings.HasSuffix(backups[0], ".log.zst") {
+		t.Fatalf("backups = %v, want one .zst file", backups)
+	}
+	if _, err := os.Stat(trimCompressedSuffix(backups[0])); !os.IsNotExist(err) {
+		t.Errorf("uncompressed backup should be removed, stat err = %v", err)
+	}
+	got := strings.Split(strings.TrimSuffix(unzstdFile(t, backups[0]), "\n"), "\n")
+	if !reflect.DeepEqual(got, before) {
+		t.Errorf("decompressed backup differs from the original entries:\ngot  %q\nwant %q", got, before)
+	}
+}
+
+func TestZstdMaxBackupsCountsZst(t *testing.T) {
+	b, cfg := newClockedFileLogger(t, NewManualClock(fixedTime), func(cfg *LogConfig) {
+		cfg.Compression = CompressionZstd
+		cfg.MaxBackups = 2
+		cfg.MaxAge = 0
+	})
+	dir := filepath.Dir(cfg.Filename)
+	// 之前切割留下的.zst备份也要计入MaxBackups
+	old := filepath.Join(dir, "test-2024-05-01T00-00-00.000.log.zst")
+	seedFile(t, old, 10, fixedTime)
+
+	for i := 0; i < 3; i++ {
+		b.logger.Info("entry")
+		if err := b.rotate(); err != nil {
+			t.Fatal(err)
+		}
+		// lumberjack的备份文件名精确到毫秒，同一毫秒内切割两次会覆盖前一个备份
+		time.Sleep(2 * time.Millisecond)
+	}
+	b.file.backups.wait()
+
+	backups := logBackups(t, cfg)
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want 2", backups)
+	}
+	for _, path := range backups {
+		if !strings.HasSuffix(path, ".zst") || path == old {
+			t.Errorf("unexpected backup %s", path)
+		}
+	}
+}
+
+// failingWriter 写入时总是失败的压缩器
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+func (failingWriter) Close() error              { return nil }
+
+func TestCompressFileKeepsSourceOnError(t *testing.T) {
+	src := writeTempFile(t, "app-2024-05-17T00-00-00.000.log", "entry\n")
+	dst := src + ".zst"
+	err := compressFile(src, dst, func(io.Writer) (io.WriteCloser, error) { return failingWriter{}, nil })
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("err = %v, want disk full", err)
+	}
+	if got := readFile(t, src); got != "entry\n" {
+		t.Errorf("source should be kept after a failed compression, got %q", got)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("partial output should be removed, stat err = %v", err)
+	}
+}
+
+func TestValidateCompression(t *testing.T) {
+	tests := []struct {
+		compression string
+		compress    bool
+		want        string
+		wantErr     string
+	}{
+		{want: CompressionNone},
+		{compress: true, want: CompressionGzip},
+		{compression: " ZSTD ", want: CompressionZstd},
+		{compression: "gzip", compress: true, want: CompressionGzip},
+		{compression: "zstd", compress: true, want: CompressionZstd, wantErr: "compress cannot be used with compression zstd"},
+		{compression: "none", compress: true, want: CompressionNone, wantErr: "compress cannot be used with compression none"},
+		{compression: "bzip2", want: "bzip2", wantErr: `unknown compression "bzip2"`},
+	}
+	for _, tt := range tests {
+		cfg := LogConfig{Compression: tt.compression, Compress: tt.compress}
+		if got := cfg.compression(); got != tt.want {
+			t.Errorf("%+v: compression() = %q, want %q", tt, got, tt.want)
+		}
+		err := cfg.validateCompression()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%+v: validateCompression() = %v, want %q", tt, err, tt.wantErr)
+		}
+	}
+}